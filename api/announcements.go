@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//announcementsSetting is the db setting key announcements are stored under
+const announcementsSetting = "announcements"
+
+//Announcement is a message published to subscribers at PublishAt and removed at ExpiresAt.
+//Announcements with a zero ExpiresAt don't expire.
+//Announcement is the Payload of EventAnnouncement and EventAnnouncementExpired Events
+type Announcement struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	PublishAt time.Time `json:"publish_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Published bool      `json:"published"`
+}
+
+//active returns whether or not the announcement is published and not expired at t
+func (a *Announcement) active(t time.Time) bool {
+	return a.Published && (a.ExpiresAt.IsZero() || a.ExpiresAt.After(t))
+}
+
+//AnnouncementService stores announcements and publishes them when scheduled
+type AnnouncementService struct {
+	d      db.DB
+	sub    *SubscribeService
+	wake   chan struct{}
+	mu     *sync.Mutex
+	values []*Announcement
+}
+
+//NewAnnouncementService returns a new AnnouncementService and starts its scheduler
+func NewAnnouncementService(d db.DB, sub *SubscribeService) *AnnouncementService {
+	a := &AnnouncementService{d: d, sub: sub, wake: make(chan struct{}, 1), mu: new(sync.Mutex)}
+	if _, err := d.ReadSetting(announcementsSetting, &a.values); err != nil {
+		log.Println("Unable to read announcements:", err)
+	}
+
+	go a.schedule()
+	return a
+}
+
+//save stores the announcements. The caller must hold a.mu
+func (a *AnnouncementService) save() error {
+	return a.d.WriteSetting(announcementsSetting, a.values)
+}
+
+//run publishes due announcements, removes expired announcements, and returns when it should next be run
+func (a *AnnouncementService) run(now time.Time) time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var events []*Event
+	next := now.Add(time.Hour)
+	values := a.values[:0]
+
+	for _, ann := range a.values {
+		if !ann.ExpiresAt.IsZero() && !ann.ExpiresAt.After(now) {
+			if ann.Published {
+				events = append(events, &Event{Type: EventAnnouncementExpired, Payload: ann})
+			}
+			continue
+		}
+
+		if !ann.Published && !ann.PublishAt.After(now) {
+			ann.Published = true
+			events = append(events, &Event{Type: EventAnnouncement, Payload: ann})
+		}
+
+		if !ann.Published && ann.PublishAt.Before(next) {
+			next = ann.PublishAt
+		}
+		if !ann.ExpiresAt.IsZero() && ann.ExpiresAt.Before(next) {
+			next = ann.ExpiresAt
+		}
+
+		values = append(values, ann)
+	}
+	a.values = values
+
+	if len(events) > 0 {
+		if err := a.save(); err != nil {
+			log.Println("Unable to write announcements:", err)
+		}
+		go a.sub.Publish(events...)
+	}
+
+	return next
+}
+
+func (a *AnnouncementService) schedule() {
+	for {
+		next := a.run(time.Now())
+		select {
+		case <-time.After(time.Until(next)):
+		case <-a.wake:
+		}
+	}
+}
+
+func (a *AnnouncementService) reschedule() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+//Add stores the announcement and schedules it
+func (a *AnnouncementService) Add(ann *Announcement) error {
+	a.mu.Lock()
+	ann.ID = randString(12)
+	ann.Published = false
+	if ann.PublishAt.IsZero() {
+		ann.PublishAt = time.Now()
+	}
+	a.values = append(a.values, ann)
+	err := a.save()
+	a.mu.Unlock()
+
+	a.reschedule()
+	return err
+}
+
+//Remove deletes the announcement with the given id, publishing an EventAnnouncementExpired Event if it was active.
+//Remove returns false if the announcement doesn't exist
+func (a *AnnouncementService) Remove(id string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, ann := range a.values {
+		if ann.ID == id {
+			a.values = append(a.values[:i], a.values[i+1:]...)
+			if ann.Published {
+				go a.sub.Publish(&Event{Type: EventAnnouncementExpired, Payload: ann})
+			}
+			return true, a.save()
+		}
+	}
+
+	return false, nil
+}
+
+//List returns all announcements ordered by publish time, or only active announcements if activeOnly is true
+func (a *AnnouncementService) List(activeOnly bool) []*Announcement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	list := make([]*Announcement, 0, len(a.values))
+	for _, ann := range a.values {
+		if !activeOnly || ann.active(now) {
+			c := *ann
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PublishAt.Before(list[j].PublishAt) })
+
+	return list
+}
+
+type announcementsResponse struct {
+	Announcements []*Announcement `json:"announcements"`
+}
+
+//getAnnouncements returns the active announcements, or all announcements for authorized requests with all=true
+func getAnnouncements(a *AnnouncementService, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") == "true" {
+			if !checkAuth(w, r, sess) {
+				return
+			}
+			returnHTTP(w, http.StatusOK, &announcementsResponse{Announcements: a.List(false)})
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &announcementsResponse{Announcements: a.List(true)})
+	}
+}
+
+func postAnnouncement(a *AnnouncementService, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		ann := new(Announcement)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(ann); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if ann.Message == "" || (!ann.ExpiresAt.IsZero() && !ann.ExpiresAt.After(ann.PublishAt)) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := a.Add(ann); err != nil {
+			log.Println("Unable to write announcements:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, ann)
+	}
+}
+
+func deleteAnnouncement(a *AnnouncementService, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		ok, err := a.Remove(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println("Unable to write announcements:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
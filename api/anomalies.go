@@ -0,0 +1,228 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Anomaly types
+const (
+	//AnomalyOutlier is a score far outside the rest of its round
+	AnomalyOutlier = "outlier"
+	//AnomalyFast is a score entered suspiciously soon after the same user's previous score
+	AnomalyFast = "fast"
+	//AnomalyDuplicate is a team whose scores exactly match another team's in every round
+	AnomalyDuplicate = "duplicate"
+)
+
+const (
+	//outlierThreshold is the modified z-score above which a score is an outlier
+	outlierThreshold = 3.5
+	//outlierMinScores is the fewest scored teams a round needs before outliers are flagged
+	outlierMinScores = 5
+	//fastThreshold is the shortest expected time between a user's separate score entries.
+	//Scores submitted together aren't compared
+	fastThreshold = 2 * time.Second
+	//duplicateMinScores is the fewest scored rounds two teams need before they're flagged as duplicates
+	duplicateMinScores = 2
+)
+
+//Anomaly flags a score or team that may have been entered incorrectly.
+//Round is -1 and RoundID is empty for anomalies about a whole team
+type Anomaly struct {
+	Type        string `json:"type"`
+	Team        int    `json:"team"`
+	TeamID      string `json:"team_id"`
+	Round       int    `json:"round"`
+	RoundID     string `json:"round_id,omitempty"`
+	Description string `json:"description"`
+}
+
+type anomaliesResponse struct {
+	Anomalies []*Anomaly `json:"anomalies"`
+}
+
+//median returns the median of the sorted values
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+//outliers returns anomalies for scores whose modified z-score (using the median absolute deviation) is above outlierThreshold
+func outliers(c *db.Competition) []*Anomaly {
+	var anomalies []*Anomaly
+	for r := range c.Rounds {
+		if c.IsComputed(r) {
+			continue
+		}
+
+		var values []float64
+		for _, t := range c.Teams {
+			if t.Scores[r].Scored() {
+				values = append(values, float64(t.Scores[r].Value))
+			}
+		}
+		if len(values) < outlierMinScores {
+			continue
+		}
+
+		sort.Float64s(values)
+		med := median(values)
+		devs := make([]float64, len(values))
+		for i, v := range values {
+			devs[i] = math.Abs(v - med)
+		}
+		sort.Float64s(devs)
+		mad := median(devs)
+		if mad == 0 {
+			continue
+		}
+
+		for i, t := range c.Teams {
+			s := t.Scores[r]
+			if !s.Scored() {
+				continue
+			}
+			if z := 0.6745 * math.Abs(float64(s.Value)-med) / mad; z > outlierThreshold {
+				anomalies = append(anomalies, &Anomaly{
+					Type: AnomalyOutlier, Team: i, TeamID: t.ID, Round: r, RoundID: c.RoundIDs[r],
+					Description: fmt.Sprintf("%s score %s for %s is far from the round median of %g", c.Rounds[r], s, t.Name, med),
+				})
+			}
+		}
+	}
+	return anomalies
+}
+
+//fastEntries returns anomalies for scores attributed to a user less than fastThreshold after their previous entry
+func fastEntries(c *db.Competition, attributions map[string]*Attribution) []*Anomaly {
+	byUser := make(map[string][]*Attribution)
+	for _, a := range attributions {
+		if a.Team < 0 || a.Team >= len(c.Teams) || a.Round < 0 || a.Round >= len(c.Rounds) || c.IsComputed(a.Round) {
+			continue
+		}
+		byUser[a.User] = append(byUser[a.User], a)
+	}
+
+	var anomalies []*Anomaly
+	for user, list := range byUser {
+		sort.Slice(list, func(i, j int) bool {
+			if !list[i].Time.Equal(list[j].Time) {
+				return list[i].Time.Before(list[j].Time)
+			}
+			if list[i].Team != list[j].Team {
+				return list[i].Team < list[j].Team
+			}
+			return list[i].Round < list[j].Round
+		})
+
+		for i := 1; i < len(list); i++ {
+			prev, a := list[i-1], list[i]
+			gap := a.Time.Sub(prev.Time)
+			if gap <= 0 || gap >= fastThreshold {
+				continue
+			}
+			t := c.Teams[a.Team]
+			anomalies = append(anomalies, &Anomaly{
+				Type: AnomalyFast, Team: a.Team, TeamID: t.ID, Round: a.Round, RoundID: c.RoundIDs[a.Round],
+				Description: fmt.Sprintf("%s score for %s was entered by %s %s after their previous score", c.Rounds[a.Round], t.Name, user, gap.Round(time.Millisecond)),
+			})
+		}
+	}
+	return anomalies
+}
+
+//duplicates returns anomalies for teams whose scores and score fields exactly match an earlier team's in every round
+func duplicates(c *db.Competition) []*Anomaly {
+	var anomalies []*Anomaly
+	for i, t := range c.Teams {
+		for j := 0; j < i; j++ {
+			other := c.Teams[j]
+			scored, same := 0, true
+			for r := range c.Rounds {
+				if c.IsComputed(r) {
+					continue
+				}
+				a, b := t.Scores[r], other.Scores[r]
+				if !scoreEqual(a, b) || !reflect.DeepEqual(a.Fields, b.Fields) {
+					same = false
+					break
+				}
+				if a.Scored() {
+					scored++
+				}
+			}
+			if same && scored >= duplicateMinScores {
+				anomalies = append(anomalies, &Anomaly{
+					Type: AnomalyDuplicate, Team: i, TeamID: t.ID, Round: -1,
+					Description: fmt.Sprintf("%s has exactly the same scores as %s", t.Name, other.Name),
+				})
+				break
+			}
+		}
+	}
+	return anomalies
+}
+
+//findAnomalies returns the anomalies in the current competition, ordered by team and round
+func findAnomalies(d db.DB) ([]*Anomaly, error) {
+	c, err := d.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read database: %v", err)
+	}
+
+	anomalies := make([]*Anomaly, 0)
+	if c == nil {
+		return anomalies, nil
+	}
+
+	judgesMu.Lock()
+	attributions := make(map[string]*Attribution)
+	_, err = d.ReadSetting(attributionsSetting, &attributions)
+	judgesMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read score attributions: %v", err)
+	}
+
+	anomalies = append(anomalies, outliers(c)...)
+	anomalies = append(anomalies, fastEntries(c, attributions)...)
+	anomalies = append(anomalies, duplicates(c)...)
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		if anomalies[i].Team != anomalies[j].Team {
+			return anomalies[i].Team < anomalies[j].Team
+		}
+		return anomalies[i].Round < anomalies[j].Round
+	})
+
+	return anomalies, nil
+}
+
+//getAnomalies returns scores and teams that may have been entered incorrectly. Anomalies are computed when requested
+//and don't block score entry
+func getAnomalies(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		anomalies, err := findAnomalies(d)
+		if err != nil {
+			log.Println(err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &anomaliesResponse{Anomalies: anomalies})
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//apiKeysSetting is the db setting key API keys are stored under
+const apiKeysSetting = "api_keys"
+
+//apiKeysMu serializes changes to API keys
+var apiKeysMu = new(sync.Mutex)
+
+//APIKey is a key used by integrations. Only the hash of the key is stored
+type APIKey struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"-"`
+	Created time.Time `json:"created"`
+}
+
+//storedAPIKey is the stored form of an APIKey
+type storedAPIKey struct {
+	*APIKey
+	Hash string `json:"hash"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func readAPIKeys(d db.DB) ([]*APIKey, error) {
+	var stored []*storedAPIKey
+	if _, err := d.ReadSetting(apiKeysSetting, &stored); err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0, len(stored))
+	for _, s := range stored {
+		s.APIKey.Hash = s.Hash
+		keys = append(keys, s.APIKey)
+	}
+	return keys, nil
+}
+
+func writeAPIKeys(d db.DB, keys []*APIKey) error {
+	stored := make([]*storedAPIKey, 0, len(keys))
+	for _, k := range keys {
+		stored = append(stored, &storedAPIKey{APIKey: k, Hash: k.Hash})
+	}
+	return d.WriteSetting(apiKeysSetting, stored)
+}
+
+//findAPIKey returns the APIKey matching key, or nil if there isn't one
+func findAPIKey(d db.DB, key string) (*APIKey, error) {
+	keys, err := readAPIKeys(d)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashAPIKey(key)
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) == 1 {
+			return k, nil
+		}
+	}
+	return nil, nil
+}
+
+//checkAPIKey checks if the request has a valid API key in the X-API-Key header, the api_key query parameter, or the Basic password
+//If the request is not authorized checkAPIKey returns nil and writes the error to w
+//Otherwise checkAPIKey returns the APIKey
+func checkAPIKey(w http.ResponseWriter, r *http.Request, d db.DB) *APIKey {
+	if k := basicAPIKey(r); k != nil {
+		return k
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+
+	if key == "" {
+		returnHTTP(w, http.StatusUnauthorized, nil)
+		return nil
+	}
+
+	k, err := findAPIKey(d, key)
+	if err != nil {
+		log.Println("Unable to read API keys:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return nil
+	}
+
+	if k == nil {
+		returnHTTP(w, http.StatusUnauthorized, nil)
+		return nil
+	}
+
+	return k
+}
+
+type apiKeysResponse struct {
+	APIKeys []*APIKey `json:"api_keys"`
+}
+
+type apiKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+func getAPIKeys(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		keys, err := readAPIKeys(d)
+		if err != nil {
+			log.Println("Unable to read API keys:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+
+		returnHTTP(w, http.StatusOK, &apiKeysResponse{APIKeys: keys})
+	}
+}
+
+//postAPIKey creates a new API key. The key is only returned in this response
+func postAPIKey(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(apiKeyRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Name == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		apiKeysMu.Lock()
+		defer apiKeysMu.Unlock()
+
+		keys, err := readAPIKeys(d)
+		if err != nil {
+			log.Println("Unable to read API keys:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		key := randString(32)
+		k := &APIKey{ID: randString(12), Name: req.Name, Hash: hashAPIKey(key), Created: time.Now()}
+		if err = writeAPIKeys(d, append(keys, k)); err != nil {
+			log.Println("Unable to write API keys:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, &apiKeyResponse{APIKey: k, Key: key})
+	}
+}
+
+func deleteAPIKey(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		apiKeysMu.Lock()
+		defer apiKeysMu.Unlock()
+
+		keys, err := readAPIKeys(d)
+		if err != nil {
+			log.Println("Unable to read API keys:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		for i, k := range keys {
+			if k.ID == id {
+				if err = writeAPIKeys(d, append(keys[:i], keys[i+1:]...)); err != nil {
+					log.Println("Unable to write API keys:", err)
+					returnHTTP(w, http.StatusInternalServerError, nil)
+					return
+				}
+				returnHTTP(w, http.StatusOK, nil)
+				return
+			}
+		}
+
+		returnHTTP(w, http.StatusNotFound, nil)
+	}
+}
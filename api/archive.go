@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/archive"
+	"github.com/korylprince/competition-scorer/assets"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//maxArchiveSize is the largest archive that can be imported
+const maxArchiveSize = 256 << 20
+
+//getArchive returns a .scorerpkg archive of the competition
+func getArchive(d db.DB, store assets.Store, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		//the archive is streamed, so errors after this can only be logged
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="competition-%s%s"`, time.Now().Format("20060102-150405"), archive.Extension))
+		if err = archive.Export(w, d, store); err != nil {
+			log.Println("Unable to export archive:", err)
+		}
+	}
+}
+
+//postArchive replaces the competition, revisions, and state with those in the .scorerpkg archive in the request body
+func postArchive(d db.DB, store assets.Store, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		buf, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxArchiveSize))
+		if err != nil {
+			returnHTTP(w, http.StatusRequestEntityTooLarge, nil)
+			return
+		}
+
+		m, err := archive.Import(bytes.NewReader(buf), int64(len(buf)), actorDB(d, r, sess), store)
+		if err != nil {
+			log.Println("Unable to import archive:", err)
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+		committed := time.Now()
+
+		returnHTTP(w, http.StatusOK, m)
+		sub.NotifyCommitted(committed, 0)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+type archivedResponse struct {
+	Archived []*db.ArchivedCompetition `json:"archived"`
+}
+
+//deleteCompetition archives the competition instead of destroying it, leaving the database empty so a new competition can be created.
+//Archived competitions are listed at /competition/archived and can be restored with unarchive
+func deleteCompetition(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		a, err := db.Archive(actorDB(d, r, sess))
+		if err != nil {
+			log.Println("Unable to archive competition:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if a == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+		committed := time.Now()
+
+		returnHTTP(w, http.StatusOK, a)
+		sub.Publish(&Event{Type: EventState, Payload: &StatePayload{State: db.StateSetup}})
+		sub.NotifyCommitted(committed, 0)
+	}
+}
+
+func getArchived(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		archived, err := db.ListArchived(d)
+		if err != nil {
+			log.Println("Unable to read archived competitions:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &archivedResponse{Archived: archived})
+	}
+}
+
+//postUnarchive restores the archived competition with the given id. The current competition must be archived first
+func postUnarchive(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, err := db.Unarchive(actorDB(d, r, sess), mux.Vars(r)["id"])
+		if err != nil {
+			if errors.Is(err, db.ErrCompetitionExists) {
+				returnHTTP(w, http.StatusConflict, &jsonError{Code: http.StatusConflict, Description: "the current competition must be archived first"})
+				return
+			}
+			if errors.Is(err, db.ErrArchivedNotFound) {
+				returnHTTP(w, http.StatusNotFound, nil)
+				return
+			}
+			log.Println("Unable to unarchive competition:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, c)
+		sub.Publish(&Event{Type: EventState, Payload: &StatePayload{State: state}})
+		sub.NotifyCommitted(committed, 0)
+	}
+}
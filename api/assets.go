@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/assets"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//brandingSetting is the db setting key Branding is stored under
+const brandingSetting = "branding"
+
+//Branding references the assets displays use for branding
+type Branding struct {
+	Logo     string   `json:"logo"`
+	Sponsors []string `json:"sponsors"`
+}
+
+type assetsResponse struct {
+	Assets []*assets.Info `json:"assets"`
+}
+
+func getAssets(s assets.Store, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		infos, err := s.List()
+		if err != nil {
+			log.Println("Unable to list assets:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &assetsResponse{Assets: infos})
+	}
+}
+
+//putAsset stores the request body as the asset with the name given in the path
+func putAsset(s assets.Store, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		if !assets.ValidName(name) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, assets.MaxSize+1))
+		if err != nil {
+			returnHTTP(w, http.StatusRequestEntityTooLarge, nil)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+
+		if err = s.Put(name, contentType, data); err != nil {
+			if err == assets.ErrTooLarge {
+				returnHTTP(w, http.StatusRequestEntityTooLarge, nil)
+				return
+			}
+			log.Printf("Unable to write asset %s: %v", name, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+func deleteAsset(s assets.Store, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		if !assets.ValidName(name) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := s.Delete(name); err != nil {
+			log.Printf("Unable to delete asset %s: %v", name, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+func getBranding(d db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := &Branding{Sponsors: make([]string, 0)}
+		if _, err := d.ReadSetting(brandingSetting, b); err != nil {
+			log.Println("Unable to read branding:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, b)
+	}
+}
+
+func putBranding(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		b := new(Branding)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(b); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if b.Logo != "" && !assets.ValidName(b.Logo) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+		for _, name := range b.Sponsors {
+			if !assets.ValidName(name) {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		if err := d.WriteSetting(brandingSetting, b); err != nil {
+			log.Println("Unable to write branding:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, b)
+	}
+}
@@ -0,0 +1,472 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/pdf"
+)
+
+//roomsSetting is the db setting key the rooms teams are assigned to are stored under
+const roomsSetting = "rooms"
+
+//assignmentsSetting is the db setting key the generated room assignments are stored under
+const assignmentsSetting = "room_assignments"
+
+//Check-in roster layout in points
+const (
+	rosterMargin   = 36
+	rosterRow      = 24
+	rosterFontSize = 10
+	rosterIndex    = 28
+	rosterTeam     = 180
+	rosterCheckIn  = 60
+)
+
+//Room is a room or table teams are assigned to, holding at most Capacity teams
+type Room struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+}
+
+type roomsResponse struct {
+	Rooms []*Room `json:"rooms"`
+}
+
+//storedAssignments holds the room name of each team ID by round ID
+type storedAssignments struct {
+	Generated time.Time                    `json:"generated"`
+	Rounds    map[string]map[string]string `json:"rounds"`
+}
+
+//RoomAssignment is the room a team is in for a round
+type RoomAssignment struct {
+	TeamID string `json:"team_id"`
+	Team   string `json:"team"`
+	Room   string `json:"room"`
+}
+
+//RoundAssignments are the room assignments of a round, in team order
+type RoundAssignments struct {
+	RoundID     string            `json:"round_id"`
+	Round       string            `json:"round"`
+	Assignments []*RoomAssignment `json:"assignments"`
+}
+
+type assignmentsResponse struct {
+	Generated time.Time           `json:"generated"`
+	Rounds    []*RoundAssignments `json:"rounds"`
+}
+
+func readRooms(d db.DB) ([]*Room, error) {
+	rooms := make([]*Room, 0)
+	_, err := d.ReadSetting(roomsSetting, &rooms)
+	return rooms, err
+}
+
+//validRooms returns an error if rooms has an empty or duplicate name or a capacity less than 1
+func validRooms(rooms []*Room) error {
+	seen := make(map[string]bool)
+	for _, room := range rooms {
+		if room == nil || strings.TrimSpace(room.Name) == "" {
+			return fmt.Errorf("Room names can't be empty")
+		}
+		if seen[room.Name] {
+			return fmt.Errorf("Duplicate room %s", room.Name)
+		}
+		seen[room.Name] = true
+		if room.Capacity < 1 {
+			return fmt.Errorf("Room %s capacity must be at least 1", room.Name)
+		}
+	}
+	return nil
+}
+
+//assignRooms assigns every team in c to one of rooms for each round that isn't computed, filling the rooms in order.
+//The teams are rotated by about a room's worth each round, so with rooms of the same capacity teams move to the next room every round.
+//An error is returned if the rooms can't hold every team
+func assignRooms(c *db.Competition, rooms []*Room) (map[string]map[string]string, error) {
+	if len(rooms) == 0 {
+		return nil, fmt.Errorf("No rooms are configured")
+	}
+
+	capacity := 0
+	for _, room := range rooms {
+		capacity += room.Capacity
+	}
+	if capacity < len(c.Teams) {
+		return nil, fmt.Errorf("Rooms hold %d teams but there are %d teams", capacity, len(c.Teams))
+	}
+
+	n := len(c.Teams)
+	stride := (n + len(rooms) - 1) / len(rooms)
+	assignments := make(map[string]map[string]string)
+	rotation := 0
+	for i := range c.Rounds {
+		if c.IsComputed(i) {
+			continue
+		}
+
+		round := make(map[string]string, n)
+		room, used := 0, 0
+		for j := 0; j < n; j++ {
+			for used >= rooms[room].Capacity {
+				room, used = room+1, 0
+			}
+			round[c.Teams[(j+rotation*stride)%n].ID] = rooms[room].Name
+			used++
+		}
+
+		assignments[c.RoundIDs[i]] = round
+		rotation++
+	}
+
+	return assignments, nil
+}
+
+//roundAssignments returns the stored assignments of the round at index i of c, in team order, or nil if the round wasn't assigned.
+//If team isn't negative, only the assignment of the team at that index is returned
+func roundAssignments(c *db.Competition, stored *storedAssignments, i, team int) *RoundAssignments {
+	rooms, ok := stored.Rounds[c.RoundIDs[i]]
+	if !ok {
+		return nil
+	}
+
+	ra := &RoundAssignments{RoundID: c.RoundIDs[i], Round: c.Rounds[i], Assignments: make([]*RoomAssignment, 0)}
+	for j, t := range c.Teams {
+		if team >= 0 && j != team {
+			continue
+		}
+		//teams added after the rooms were assigned don't have a room
+		if room, ok := rooms[t.ID]; ok {
+			ra.Assignments = append(ra.Assignments, &RoomAssignment{TeamID: t.ID, Team: t.Name, Room: room})
+		}
+	}
+	return ra
+}
+
+func getRooms(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		rooms, err := readRooms(d)
+		if err != nil {
+			log.Println("Unable to read rooms:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &roomsResponse{Rooms: rooms})
+	}
+}
+
+//putRooms replaces the rooms teams are assigned to. Existing assignments aren't changed until they're generated again
+func putRooms(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(roomsResponse)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if req.Rooms == nil {
+			req.Rooms = make([]*Room, 0)
+		}
+
+		if err := validRooms(req.Rooms); err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+
+		if err := d.WriteSetting(roomsSetting, req.Rooms); err != nil {
+			log.Println("Unable to write rooms:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, req)
+	}
+}
+
+//postAssignments assigns every team to a room for each round that isn't computed, replacing the stored assignments
+func postAssignments(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		rooms, err := readRooms(d)
+		if err != nil {
+			log.Println("Unable to read rooms:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		stored := &storedAssignments{Generated: time.Now()}
+		if stored.Rounds, err = assignRooms(c, rooms); err != nil {
+			returnHTTP(w, http.StatusConflict, &jsonError{Code: http.StatusConflict, Description: err.Error()})
+			return
+		}
+
+		if err = d.WriteSetting(assignmentsSetting, stored); err != nil {
+			log.Println("Unable to write room assignments:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		resp := &assignmentsResponse{Generated: stored.Generated, Rounds: make([]*RoundAssignments, 0)}
+		for i := range c.Rounds {
+			if ra := roundAssignments(c, stored, i, -1); ra != nil {
+				resp.Rounds = append(resp.Rounds, ra)
+			}
+		}
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//readAssignments returns the competition and its stored room assignments, writing an error response and returning nil if they can't be read
+func readAssignments(w http.ResponseWriter, d db.DB) (*db.Competition, *storedAssignments) {
+	c := readCompetition(w, d)
+	if c == nil {
+		return nil, nil
+	}
+
+	stored := new(storedAssignments)
+	ok, err := d.ReadSetting(assignmentsSetting, stored)
+	if err != nil {
+		log.Println("Unable to read room assignments:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return nil, nil
+	}
+	if !ok {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return nil, nil
+	}
+
+	return c, stored
+}
+
+//queryRounds returns the indexes of the rounds given by ID or index in the round query parameters, or every round if there aren't any.
+//It writes an error response and returns nil if a round doesn't exist
+func queryRounds(w http.ResponseWriter, r *http.Request, c *db.Competition) []int {
+	var rounds []int
+	for _, ref := range r.URL.Query()["round"] {
+		round := c.FindRound(ref)
+		if round < 0 {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Unknown round %s", ref)})
+			return nil
+		}
+		rounds = append(rounds, round)
+	}
+	if rounds == nil {
+		rounds = make([]int, len(c.Rounds))
+		for i := range c.Rounds {
+			rounds[i] = i
+		}
+	}
+	return rounds
+}
+
+//getAssignments returns the room assignments for displays. The round query parameter, which can be given more than once,
+//limits the assignments to the given rounds by ID or index, and the team query parameter to a team by ID, slug, or index
+func getAssignments(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, stored := readAssignments(w, d)
+		if c == nil {
+			return
+		}
+
+		team := -1
+		if ref := r.URL.Query().Get("team"); ref != "" {
+			if team = c.FindTeam(ref); team < 0 {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Unknown team %s", ref)})
+				return
+			}
+		}
+
+		rounds := queryRounds(w, r, c)
+		if rounds == nil {
+			return
+		}
+
+		resp := &assignmentsResponse{Generated: stored.Generated, Rounds: make([]*RoundAssignments, 0)}
+		for _, i := range rounds {
+			if ra := roundAssignments(c, stored, i, team); ra != nil {
+				resp.Rounds = append(resp.Rounds, ra)
+			}
+		}
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//roomOrder returns the rooms of ra ordered like rooms, followed by rooms that are no longer configured by name
+func roomOrder(ra *RoundAssignments, rooms []*Room) []string {
+	index := make(map[string]int, len(rooms))
+	for i, room := range rooms {
+		index[room.Name] = i
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, a := range ra.Assignments {
+		if !seen[a.Room] {
+			seen[a.Room] = true
+			names = append(names, a.Room)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		ii, iok := index[names[i]]
+		ji, jok := index[names[j]]
+		if iok != jok {
+			return iok
+		}
+		if iok {
+			return ii < ji
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+//renderRosters returns a PDF with a check-in roster for each room of each of the given round assignments.
+//Each roster lists the teams in the room with their members and a box to mark them checked in
+func renderRosters(c *db.Competition, rounds []*RoundAssignments, rooms []*Room) []byte {
+	doc := pdf.New(c.Name + " Check-in Rosters")
+	width := doc.Width - 2*rosterMargin
+	membersWidth := width - rosterIndex - rosterTeam - rosterCheckIn
+	bottom := doc.Height - rosterMargin
+
+	for _, ra := range rounds {
+		for _, room := range roomOrder(ra, rooms) {
+			var page *pdf.Page
+			var y float64
+			sheet := 0
+
+			header := func() {
+				page = doc.AddPage()
+				sheet++
+				page.Text(rosterMargin, rosterMargin+18, 18, true, pdf.Truncate(room, width-80, 18, true))
+				page.TextRight(doc.Width-rosterMargin, rosterMargin+18, 10, false, fmt.Sprintf("Page %d", sheet))
+				page.Text(rosterMargin, rosterMargin+34, 10, false, pdf.Truncate(c.Name+" - "+ra.Round, width, 10, false))
+
+				y = rosterMargin + 48
+				page.Fill(rosterMargin, y, width, rosterRow, 0.85)
+				baseline := y + rosterRow - 8
+				x := float64(rosterMargin)
+				page.Text(x+4, baseline, rosterFontSize, true, "#")
+				x += rosterIndex
+				page.Text(x+4, baseline, rosterFontSize, true, "Team")
+				x += rosterTeam
+				page.Text(x+4, baseline, rosterFontSize, true, "Members")
+				x += membersWidth
+				page.Text(x+4, baseline, rosterFontSize, true, "Checked In")
+				y += rosterRow
+			}
+
+			header()
+			for _, a := range ra.Assignments {
+				if a.Room != room {
+					continue
+				}
+				if y+rosterRow > bottom {
+					header()
+				}
+
+				team := c.FindTeam(a.TeamID)
+				page.Rect(rosterMargin, y, width, rosterRow, 0.5)
+				baseline := y + rosterRow - 8
+				x := float64(rosterMargin)
+				page.Text(x+4, baseline, rosterFontSize, false, strconv.Itoa(team+1))
+				x += rosterIndex
+				page.Line(x, y, x, y+rosterRow, 0.5)
+				page.Text(x+4, baseline, rosterFontSize, false, pdf.Truncate(a.Team, rosterTeam-8, rosterFontSize, false))
+				x += rosterTeam
+				page.Line(x, y, x, y+rosterRow, 0.5)
+				page.Text(x+4, baseline, rosterFontSize, false, pdf.Truncate(strings.Join(c.Teams[team].Roster, ", "), membersWidth-8, rosterFontSize, false))
+				x += membersWidth
+				page.Line(x, y, x, y+rosterRow, 0.5)
+				page.Rect(x+rosterCheckIn/2-6, y+6, 12, 12, 0.5)
+				y += rosterRow
+			}
+		}
+	}
+
+	return doc.Bytes()
+}
+
+//getRosters returns a PDF of printable check-in rosters for each room. The round query parameter, which can be given more than once,
+//limits the rosters to the given rounds by ID or index; otherwise there are rosters for every assigned round
+func getRosters(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, stored := readAssignments(w, d)
+		if c == nil {
+			return
+		}
+
+		indexes := queryRounds(w, r, c)
+		if indexes == nil {
+			return
+		}
+
+		var rounds []*RoundAssignments
+		for _, i := range indexes {
+			if ra := roundAssignments(c, stored, i, -1); ra != nil {
+				rounds = append(rounds, ra)
+			}
+		}
+
+		if len(rounds) == 0 {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		rooms, err := readRooms(d)
+		if err != nil {
+			log.Println("Unable to read rooms:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		buf := renderRosters(c, rounds, rooms)
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-rosters-%s.pdf"`, db.Slug(c.Name), time.Now().Format("20060102-150405")))
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(buf); err != nil {
+			log.Println("Unable to write check-in rosters:", err)
+		}
+	}
+}
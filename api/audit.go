@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+type auditResponse struct {
+	Entries []*db.AuditEntry `json:"entries"`
+}
+
+//requestActor returns who made the request, to be recorded in audit entries, named like score attributions.
+//requestActor returns an empty string if the request isn't authenticated
+func requestActor(r *http.Request, sess *MemorySessionStore) string {
+	if k := basicAPIKey(r); k != nil {
+		return "apikey:" + k.Name
+	}
+
+	s := contextSession(r)
+	if s == nil {
+		match := authRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+		if len(match) != 2 {
+			return ""
+		}
+		if s = sess.Get(match[1]); s == nil {
+			return ""
+		}
+	}
+
+	return s.Username
+}
+
+//actorDB returns d recording the user making the request in audit entries
+func actorDB(d db.DB, r *http.Request, sess *MemorySessionStore) db.DB {
+	return db.WithActor(d, requestActor(r, sess))
+}
+
+//getAudit returns the audit entries recorded at or after the since query parameter (RFC 3339), or all entries if it isn't given
+func getAudit(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminScope(w, r, sess) {
+			return
+		}
+
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, s); err != nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		entries, err := d.AuditEntries(since)
+		if err != nil {
+			log.Println("Unable to read audit entries:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &auditResponse{Entries: entries})
+	}
+}
+
+type scoreEventsResponse struct {
+	Events []*db.ScoreEvent `json:"events"`
+}
+
+//getScoreEvents returns the score change events with sequence numbers at or after the from query parameter, or all events if it isn't given.
+//Clients replay the log by requesting from one past the last sequence number they've seen
+func getScoreEvents(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		var from uint64
+		if s := r.URL.Query().Get("from"); s != "" {
+			var err error
+			if from, err = strconv.ParseUint(s, 10, 64); err != nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		events, err := d.Events(from)
+		if err != nil {
+			log.Println("Unable to read score events:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &scoreEventsResponse{Events: events})
+	}
+}
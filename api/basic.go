@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//basicCacheDuration is how long successful Basic credentials are remembered so polling integrations don't hash a password every request.
+//Changed or removed credentials may keep working for this long
+const basicCacheDuration = time.Minute
+
+type basicContextKey int
+
+//Request context keys set by basicAuth
+const (
+	basicSessionKey basicContextKey = iota
+	basicAPIKeyKey
+)
+
+//basicLogin is a successful Basic login: either a Session for an admin or judge, or an APIKey
+type basicLogin struct {
+	session *Session
+	key     *APIKey
+	expires time.Time
+}
+
+//basicAuthenticator authenticates HTTP Basic credentials against the competition's admin, judges, and API keys
+type basicAuthenticator struct {
+	d     db.DB
+	cache map[[sha256.Size]byte]*basicLogin
+	mu    *sync.Mutex
+}
+
+//login returns the basicLogin for the given credentials, or nil if they aren't valid.
+//Admin and judge credentials are checked first. Otherwise the password is checked as an API key, and the username is ignored
+func (b *basicAuthenticator) login(username, password string) (*basicLogin, error) {
+	sum := sha256.Sum256([]byte(username + ":" + password))
+	now := time.Now()
+
+	b.mu.Lock()
+	for k, l := range b.cache {
+		if l.expires.Before(now) {
+			delete(b.cache, k)
+		}
+	}
+	l, ok := b.cache[sum]
+	b.mu.Unlock()
+	if ok {
+		return l, nil
+	}
+
+	l = &basicLogin{expires: now.Add(basicCacheDuration)}
+
+	status, err := b.d.Authenticate(username, password)
+	if err != nil && status {
+		log.Println("Unable to rehash password:", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if status {
+		l.session = &Session{Expires: l.expires, Username: username, Role: RoleAdmin}
+	} else if status, err = authenticateJudge(b.d, username, password); err != nil {
+		return nil, err
+	} else if status {
+		l.session = &Session{Expires: l.expires, Username: username, Role: RoleJudge}
+	} else if l.key, err = findAPIKey(b.d, password); err != nil {
+		return nil, err
+	}
+
+	if l.session == nil && l.key == nil {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	b.cache[sum] = l
+	b.mu.Unlock()
+
+	return l, nil
+}
+
+//basicAuth lets GET and HEAD requests authenticate with HTTP Basic credentials instead of a session, for integrations
+//that can't log in first. Admin and judge credentials act as a session of that role, and an API key given as the password
+//acts as that API key. Invalid credentials return 401 Unauthorized. Other requests are passed to h unchanged
+func basicAuth(d db.DB, h http.Handler) http.Handler {
+	b := &basicAuthenticator{d: d, cache: make(map[[sha256.Size]byte]*basicLogin), mu: new(sync.Mutex)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || (r.Method != "GET" && r.Method != "HEAD") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		l, err := b.login(username, password)
+		if err != nil {
+			log.Println("Unable to check Basic credentials:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if l == nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="competition-scorer", charset="UTF-8"`)
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return
+		}
+
+		ctx := r.Context()
+		if l.session != nil {
+			sess := *l.session
+			ctx = context.WithValue(ctx, basicSessionKey, &sess)
+		} else {
+			ctx = context.WithValue(ctx, basicAPIKeyKey, l.key)
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+//basicSession returns the Session of the request's Basic credentials, or nil if there isn't one
+func basicSession(r *http.Request) *Session {
+	s, _ := r.Context().Value(basicSessionKey).(*Session)
+	return s
+}
+
+//basicAPIKey returns the APIKey given as the request's Basic password, or nil if there isn't one
+func basicAPIKey(r *http.Request) *APIKey {
+	k, _ := r.Context().Value(basicAPIKeyKey).(*APIKey)
+	return k
+}
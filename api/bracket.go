@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Bracket SVG layout in pixels
+const (
+	bracketMargin   = 20
+	bracketHeader   = 30
+	bracketColumn   = 220
+	bracketBox      = 180
+	bracketLine     = 22
+	bracketUnit     = 60
+	bracketFontSize = 12
+)
+
+//bracketTeam is a team in a matchup. Score is its score in the matchup's round
+type bracketTeam struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Seed  int      `json:"seed"`
+	Score db.Score `json:"score"`
+}
+
+//bracketMatchup is a matchup between two teams. A team is null if it hasn't been decided yet, or if Bye is set, for a bye.
+//Winner is the index in Teams of the team that advances, or -1 if it hasn't been decided.
+//X and Y are the position of the matchup's center in bracket units: X is its round and each first round matchup is 1 unit tall
+type bracketMatchup struct {
+	X      float64         `json:"x"`
+	Y      float64         `json:"y"`
+	Teams  [2]*bracketTeam `json:"teams"`
+	Bye    bool            `json:"bye,omitempty"`
+	Winner int             `json:"winner"`
+}
+
+//bracketRound is a round of the bracket, decided by the scores of the competition round with ID.
+//ID is empty if the competition doesn't have enough rounds
+type bracketRound struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Matchups []*bracketMatchup `json:"matchups"`
+}
+
+//bracketResponse is a single elimination bracket laid out for rendering, Width rounds wide and Height units tall.
+//Champion is the team that won the final, or null if it hasn't been decided
+type bracketResponse struct {
+	Width     int             `json:"width"`
+	Height    int             `json:"height"`
+	Precision *db.Precision   `json:"precision"`
+	Rounds    []*bracketRound `json:"rounds"`
+	Champion  *bracketTeam    `json:"champion"`
+}
+
+//bracketSeeds returns the seeds of the first round slots of a bracket of size teams, a power of two,
+//so the first seed plays the last and the top seeds can't meet until the last rounds
+func bracketSeeds(size int) []int {
+	seeds := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, s := range seeds {
+			next = append(next, s, n+1-s)
+		}
+		seeds = next
+	}
+	return seeds
+}
+
+//bracketWinner returns the index of the team that wins m, or -1 if it hasn't been decided.
+//The higher score wins, a scored team beats a no-show, and ties go to the better seed
+func bracketWinner(m *bracketMatchup) int {
+	a, b := m.Teams[0], m.Teams[1]
+	switch {
+	case m.Bye && a != nil:
+		return 0
+	case m.Bye && b != nil:
+		return 1
+	case a == nil || b == nil:
+		return -1
+	case a.Score.Scored() && b.Score.Scored():
+		if a.Score.Value > b.Score.Value || (a.Score.Value == b.Score.Value && a.Seed < b.Seed) {
+			return 0
+		}
+		return 1
+	case a.Score.Scored() && b.Score.State == db.ScoreNoShow:
+		return 0
+	case b.Score.Scored() && a.Score.State == db.ScoreNoShow:
+		return 1
+	}
+	return -1
+}
+
+//bracket returns c's teams as a single elimination bracket, seeded in the competition's team order.
+//Bracket round r is decided by the r-th round of c that isn't computed. c must have at least two teams
+func bracket(c *db.Competition) *bracketResponse {
+	var rounds []int
+	for i := range c.Rounds {
+		if !c.IsComputed(i) {
+			rounds = append(rounds, i)
+		}
+	}
+
+	size, width := 2, 1
+	for size < len(c.Teams) {
+		size, width = size*2, width+1
+	}
+
+	resp := &bracketResponse{Width: width, Height: size / 2, Precision: c.Precision, Rounds: make([]*bracketRound, width)}
+
+	//entrants are the teams entering each slot of the current round
+	entrants := make([]*db.Team, size)
+	seeds := bracketSeeds(size)
+	for i, seed := range seeds {
+		if seed <= len(c.Teams) {
+			entrants[i] = c.Teams[seed-1]
+		}
+	}
+
+	for r := range resp.Rounds {
+		round := &bracketRound{Name: fmt.Sprintf("Bracket Round %d", r+1), Matchups: make([]*bracketMatchup, len(entrants)/2)}
+		k := -1
+		if r < len(rounds) {
+			k = rounds[r]
+			round.ID, round.Name = c.RoundIDs[k], c.Rounds[k]
+		}
+
+		span := float64(int(1) << uint(r))
+		next := make([]*db.Team, len(round.Matchups))
+		for m := range round.Matchups {
+			matchup := &bracketMatchup{X: float64(r), Y: (float64(m) + 0.5) * span, Bye: r == 0 && (entrants[2*m] == nil || entrants[2*m+1] == nil)}
+			for i, t := range entrants[2*m : 2*m+2] {
+				if t == nil {
+					continue
+				}
+				bt := &bracketTeam{ID: t.ID, Name: t.Name, Seed: c.TeamIndex(t.ID) + 1}
+				if k != -1 && !matchup.Bye {
+					bt.Score = t.Scores[k]
+				}
+				matchup.Teams[i] = bt
+			}
+
+			if matchup.Winner = bracketWinner(matchup); matchup.Winner != -1 {
+				next[m] = entrants[2*m+matchup.Winner]
+			}
+			round.Matchups[m] = matchup
+		}
+
+		resp.Rounds[r] = round
+		entrants = next
+	}
+
+	if final := resp.Rounds[width-1].Matchups[0]; final.Winner != -1 {
+		resp.Champion = final.Teams[final.Winner]
+	}
+
+	return resp
+}
+
+//readBracket reads the competition and returns its bracket.
+//If it doesn't exist, doesn't have at least two teams, or an error occurs readBracket returns nil and writes the error to w
+func readBracket(w http.ResponseWriter, r *http.Request, d db.DB, sess *MemorySessionStore) *bracketResponse {
+	if !checkMaintenance(w, r, d, sess) {
+		return nil
+	}
+
+	c := readCompetition(w, d)
+	if c == nil {
+		return nil
+	}
+
+	if len(c.Teams) < 2 {
+		returnHTTP(w, http.StatusNotFound, &jsonError{Code: http.StatusNotFound, Description: "A bracket needs at least two teams"})
+		return nil
+	}
+
+	return bracket(c)
+}
+
+func getBracket(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b := readBracket(w, r, d, sess); b != nil {
+			returnHTTP(w, http.StatusOK, b)
+		}
+	}
+}
+
+//svgText writes s XML escaped to buf
+func svgText(buf *bytes.Buffer, s string) {
+	xml.EscapeText(buf, []byte(s))
+}
+
+//renderBracket returns b as an SVG image for printing
+func renderBracket(b *bracketResponse) []byte {
+	width := 2*bracketMargin + (b.Width+1)*bracketColumn
+	height := 2*bracketMargin + bracketHeader + b.Height*bracketUnit
+	//center returns the pixel position of the center of a matchup at x, y
+	center := func(x, y float64) (int, int) {
+		return bracketMargin + int(x)*bracketColumn, bracketMargin + bracketHeader + int(y*bracketUnit)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="%d">`+"\n", width, height, width, height, bracketFontSize)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+
+	for r, round := range b.Rounds {
+		fmt.Fprintf(buf, `<text x="%d" y="%d" font-weight="bold">`, bracketMargin+r*bracketColumn, bracketMargin+bracketFontSize)
+		svgText(buf, round.Name)
+		buf.WriteString("</text>\n")
+
+		for i, m := range round.Matchups {
+			x, y := center(m.X, m.Y)
+			for j, t := range m.Teams {
+				top := y - bracketLine + j*bracketLine
+				fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", x, top, bracketBox, bracketLine)
+
+				name, score := "", ""
+				switch {
+				case t != nil:
+					name, score = fmt.Sprintf("%d. %s", t.Seed, t.Name), sheetCell(b.Precision, t.Score)
+				case m.Bye:
+					name = "Bye"
+				}
+
+				weight := "normal"
+				if m.Winner == j {
+					weight = "bold"
+				}
+				fmt.Fprintf(buf, `<text x="%d" y="%d" font-weight="%s">`, x+6, top+bracketLine-7, weight)
+				svgText(buf, name)
+				buf.WriteString("</text>\n")
+				fmt.Fprintf(buf, `<text x="%d" y="%d" font-weight="%s" text-anchor="end">`, x+bracketBox-6, top+bracketLine-7, weight)
+				svgText(buf, score)
+				buf.WriteString("</text>\n")
+			}
+
+			//connect the matchup to the matchup its winner plays next, or to the champion
+			nx, ny := center(m.X+1, (float64(i/2)+0.5)*float64(int(1)<<uint(r+1)))
+			if r == b.Width-1 {
+				ny = y
+			}
+			fmt.Fprintf(buf, `<path d="M%d %d H%d V%d H%d" fill="none" stroke="black"/>`+"\n", x+bracketBox, y, x+(bracketBox+bracketColumn)/2, ny, nx)
+		}
+	}
+
+	x, y := center(float64(b.Width), float64(b.Height)/2)
+	fmt.Fprintf(buf, `<text x="%d" y="%d" font-weight="bold">Champion</text>`+"\n", x, y-bracketLine-6)
+	fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", x, y-bracketLine/2, bracketBox, bracketLine)
+	fmt.Fprintf(buf, `<text x="%d" y="%d" font-weight="bold">`, x+6, y+bracketLine/2-7)
+	if b.Champion != nil {
+		svgText(buf, b.Champion.Name)
+	}
+	buf.WriteString("</text>\n</svg>\n")
+
+	return buf.Bytes()
+}
+
+func getBracketSVG(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := readBracket(w, r, d, sess)
+		if b == nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(renderBracket(b)); err != nil {
+			log.Println("Unable to write bracket:", err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//CatalogRouter serves the competitions of a db.Catalog, each with its own API router
+type CatalogRouter struct {
+	catalog   db.Catalog
+	newRouter func(db.DB) (http.Handler, error)
+
+	mu      *sync.Mutex
+	routers map[string]http.Handler
+}
+
+//NewCatalogRouter returns an HTTP router serving each competition in catalog under /competitions/{slug}/ of API v1 and v2
+//(e.g. /api/1.0/competitions/{slug}/competition), with the same routes as the main competition served by next.
+//Each competition's router is made with newRouter the first time it's requested.
+//Competitions can be listed by anyone and created by admins of the main competition, whose sessions are in sess.
+//Requests for other paths are served by next
+func NewCatalogRouter(catalog db.Catalog, sess *MemorySessionStore, newRouter func(db.DB) (http.Handler, error), next http.Handler) http.Handler {
+	c := &CatalogRouter{catalog: catalog, newRouter: newRouter, mu: new(sync.Mutex), routers: make(map[string]http.Handler)}
+
+	r := mux.NewRouter()
+	r.Path("/api/{version:1\\.0|2\\.0}/competitions").Methods("GET", "OPTIONS").Handler(logCORS(getCatalog(catalog)))
+	r.Path("/api/{version:1\\.0|2\\.0}/competitions").Methods("POST").Handler(logCORS(postCatalog(catalog, sess)))
+	r.PathPrefix("/api/{version:1\\.0|2\\.0}/competitions/{slug}/").Handler(c)
+	r.NotFoundHandler = next
+
+	return r
+}
+
+//router returns the router of the competition with the given slug, or nil if it doesn't exist
+func (c *CatalogRouter) router(slug string) (http.Handler, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h, ok := c.routers[slug]; ok {
+		return h, nil
+	}
+
+	d, err := c.catalog.Open(slug)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	h, err := c.newRouter(d)
+	if err != nil {
+		return nil, err
+	}
+	c.routers[slug] = h
+	return h, nil
+}
+
+//ServeHTTP serves the request with the competition's router, removing the competitions/{slug} part of the path
+func (c *CatalogRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h, err := c.router(vars["slug"])
+	if err != nil {
+		log.Println("Unable to open competition:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	if h == nil {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return
+	}
+
+	prefix := "/api/" + vars["version"] + "/competitions/" + vars["slug"]
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = "/api/" + vars["version"] + r.URL.Path[len(prefix):]
+	r2.URL.RawPath = ""
+
+	h.ServeHTTP(w, r2)
+}
+
+//CatalogEntry is a competition in the catalog. Name is empty if the competition hasn't been created yet
+type CatalogEntry struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type catalogResponse struct {
+	Competitions []*CatalogEntry `json:"competitions"`
+}
+
+func getCatalog(catalog db.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slugs, err := catalog.List()
+		if err != nil {
+			log.Println("Unable to list competitions:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		entries := make([]*CatalogEntry, 0, len(slugs))
+		for _, slug := range slugs {
+			d, err := catalog.Open(slug)
+			if err != nil {
+				log.Println("Unable to open competition:", err)
+				returnHTTP(w, http.StatusInternalServerError, nil)
+				return
+			}
+
+			e := &CatalogEntry{Slug: slug}
+			if d != nil {
+				c, err := d.Read()
+				if err != nil {
+					log.Println("Unable to read database:", err)
+					returnHTTP(w, http.StatusInternalServerError, nil)
+					return
+				}
+				if c != nil {
+					e.Name = c.Name
+				}
+			}
+			entries = append(entries, e)
+		}
+
+		returnHTTP(w, http.StatusOK, &catalogResponse{Competitions: entries})
+	}
+}
+
+//catalogRequest creates a competition in the catalog. Username and Password are the new competition's admin credentials
+type catalogRequest struct {
+	Slug     string `json:"slug"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+//postCatalog adds an empty competition with its own admin credentials to the catalog.
+//The competition is then created with POST /competitions/{slug}/competition by its admin
+func postCatalog(catalog db.Catalog, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(catalogRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || !db.ValidSlug(req.Slug) || req.Username == "" || req.Password == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		d, err := catalog.Create(req.Slug)
+		if err == db.ErrCompetitionExists {
+			returnHTTP(w, http.StatusConflict, nil)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to create competition:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if err = actorDB(d, r, sess).UpdateCredentials(req.Username, req.Password); err != nil {
+			log.Println("Unable to update credentials:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, &CatalogEntry{Slug: req.Slug})
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type chaosContextKey int
+
+//chaosKey is the request context key set by ChaosHandler
+const chaosKey chaosContextKey = iota
+
+//Chaos injects faults into the API so clients' reconnect and retry logic can be tested against it. It must not be used in production
+type Chaos struct {
+	//Latency is the most latency added to a request; each delayed request waits a random duration up to Latency
+	Latency time.Duration
+	//LatencyRate is the fraction of requests delayed
+	LatencyRate float64
+	//ErrorRate is the fraction of requests answered with a 5xx response instead of being served
+	ErrorRate float64
+	//DropRate is the fraction of live update messages that are silently dropped
+	DropRate float64
+}
+
+//chaosErrors are the responses returned for injected errors
+var chaosErrors = []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+
+//ParseChaos returns the Chaos described by s, a comma separated list of latency=<duration>, latency-rate=<fraction>,
+//error-rate=<fraction>, and drop-rate=<fraction>. latency-rate defaults to 1 if latency is set
+func ParseChaos(s string) (*Chaos, error) {
+	c := new(Chaos)
+	latencyRate := -1.0
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid option %q", item)
+		}
+
+		if kv[0] == "latency" {
+			d, err := time.ParseDuration(kv[1])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid latency %q", kv[1])
+			}
+			c.Latency = d
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid %s %q: must be between 0 and 1", kv[0], kv[1])
+		}
+
+		switch kv[0] {
+		case "latency-rate":
+			latencyRate = rate
+		case "error-rate":
+			c.ErrorRate = rate
+		case "drop-rate":
+			c.DropRate = rate
+		default:
+			return nil, fmt.Errorf("unknown option %q", kv[0])
+		}
+	}
+
+	c.LatencyRate = latencyRate
+	if latencyRate < 0 {
+		c.LatencyRate = 0
+		if c.Latency > 0 {
+			c.LatencyRate = 1
+		}
+	}
+
+	return c, nil
+}
+
+//String returns the Chaos in the form parsed by ParseChaos
+func (c *Chaos) String() string {
+	return fmt.Sprintf("latency=%s,latency-rate=%g,error-rate=%g,drop-rate=%g", c.Latency, c.LatencyRate, c.ErrorRate, c.DropRate)
+}
+
+//drop returns whether a live update message should be dropped. A nil Chaos never drops messages
+func (c *Chaos) drop() bool {
+	return c != nil && c.DropRate > 0 && mrand.Float64() < c.DropRate
+}
+
+//ChaosHandler returns h with the faults of c injected. Injected errors have the X-Chaos header set so they can be told apart from real ones
+func ChaosHandler(c *Chaos, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Latency > 0 && mrand.Float64() < c.LatencyRate {
+			time.Sleep(time.Duration(mrand.Int63n(int64(c.Latency) + 1)))
+		}
+
+		if c.ErrorRate > 0 && mrand.Float64() < c.ErrorRate {
+			w.Header().Set("X-Chaos", "error")
+			returnHTTP(w, chaosErrors[mrand.Intn(len(chaosErrors))], nil)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chaosKey, c)))
+	})
+}
+
+//requestChaos returns the Chaos injected into the request, or nil if there isn't one
+func requestChaos(r *http.Request) *Chaos {
+	c, _ := r.Context().Value(chaosKey).(*Chaos)
+	return c
+}
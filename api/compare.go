@@ -0,0 +1,209 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/archive"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//comparisonScore is a team's score in a round of a compared competition
+type comparisonScore struct {
+	Round string   `json:"round"`
+	Score db.Score `json:"score"`
+}
+
+//comparisonCompetition is a team's result in a compared competition.
+//Archive and Created are empty for the current competition
+type comparisonCompetition struct {
+	Name    string             `json:"name"`
+	Archive string             `json:"archive,omitempty"`
+	Created *time.Time         `json:"created,omitempty"`
+	State   db.State           `json:"state"`
+	Teams   int                `json:"teams"`
+	Rank    int                `json:"rank"`
+	Total   int32              `json:"total"`
+	Scores  []*comparisonScore `json:"scores"`
+}
+
+//roundTrend is a team's score in a round, matched by name, in each compared competition.
+//Scores is aligned with the compared competitions and is null where the competition didn't have the round
+type roundTrend struct {
+	Round  string      `json:"round"`
+	Scores []*db.Score `json:"scores"`
+}
+
+type comparisonResponse struct {
+	Team         string                   `json:"team"`
+	Competitions []*comparisonCompetition `json:"competitions"`
+	Placements   []int                    `json:"placements"`
+	Rounds       []*roundTrend            `json:"rounds"`
+}
+
+type archiveSummary struct {
+	File    string    `json:"file"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	State   db.State  `json:"state"`
+	Teams   int       `json:"teams"`
+}
+
+type archivesResponse struct {
+	Archives []*archiveSummary `json:"archives"`
+}
+
+//readArchives returns the archives in dir, logging archives that can't be read
+func readArchives(dir string) ([]*archive.Entry, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, skipped, err := archive.ReadDir(dir)
+	for name, err := range skipped {
+		log.Printf("Unable to read archive %s: %v", name, err)
+	}
+	return entries, err
+}
+
+//compareTeam returns the result of the team with the given slug in c, or nil if it isn't in c
+func compareTeam(c *db.Competition, slug string) *comparisonCompetition {
+	team := -1
+	for i, t := range c.Teams {
+		if db.Slug(t.Name) == slug {
+			team = i
+			break
+		}
+	}
+	if team < 0 {
+		return nil
+	}
+
+	result := &comparisonCompetition{Name: c.Name, Teams: len(c.Teams)}
+	for _, s := range c.Standings() {
+		if s.Team == team {
+			result.Rank, result.Total = s.Rank, s.Total
+		}
+	}
+	for i, r := range c.Rounds {
+		result.Scores = append(result.Scores, &comparisonScore{Round: r, Score: c.Teams[team].Scores[i]})
+	}
+	return result
+}
+
+func getArchives(dir string, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		entries, err := readArchives(dir)
+		if err != nil {
+			log.Println(err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		resp := &archivesResponse{Archives: make([]*archiveSummary, 0, len(entries))}
+		for _, e := range entries {
+			resp.Archives = append(resp.Archives, &archiveSummary{
+				File: e.File, Name: e.Competition.Name, Created: e.Manifest.Created, State: e.Manifest.State, Teams: len(e.Competition.Teams),
+			})
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//getComparison compares the team given by the team query parameter (a name, slug, or ID of a current team) across the archives
+//in dir, oldest first, and the current competition. Teams are matched by slug. The archives query parameter limits the
+//comparison to the given comma separated archive files, and current=false leaves out the current competition
+func getComparison(d db.DB, dir string, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		ref := r.URL.Query().Get("team")
+		if ref == "" {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "team is required"})
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		slug := db.Slug(ref)
+		if c != nil {
+			if i := c.FindTeam(ref); i >= 0 {
+				slug = db.Slug(c.Teams[i].Name)
+			}
+		}
+
+		entries, err := readArchives(dir)
+		if err != nil {
+			log.Println(err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		var only map[string]bool
+		if list := r.URL.Query().Get("archives"); list != "" {
+			only = make(map[string]bool)
+			for _, f := range strings.Split(list, ",") {
+				only[strings.TrimSpace(f)] = true
+			}
+		}
+
+		resp := &comparisonResponse{Team: slug, Competitions: make([]*comparisonCompetition, 0), Placements: make([]int, 0), Rounds: make([]*roundTrend, 0)}
+		for _, e := range entries {
+			if only != nil && !only[e.File] {
+				continue
+			}
+			if result := compareTeam(e.Competition, slug); result != nil {
+				created := e.Manifest.Created
+				result.Archive, result.Created, result.State = e.File, &created, e.Manifest.State
+				resp.Competitions = append(resp.Competitions, result)
+			}
+		}
+
+		if c != nil && r.URL.Query().Get("current") != "false" {
+			if result := compareTeam(c, slug); result != nil {
+				if result.State, err = d.State(); err != nil {
+					log.Println("Unable to read competition state:", err)
+					returnHTTP(w, http.StatusInternalServerError, nil)
+					return
+				}
+				resp.Competitions = append(resp.Competitions, result)
+			}
+		}
+
+		if len(resp.Competitions) == 0 {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		trends := make(map[string]*roundTrend)
+		for i, result := range resp.Competitions {
+			resp.Placements = append(resp.Placements, result.Rank)
+			for _, s := range result.Scores {
+				t, ok := trends[s.Round]
+				if !ok {
+					t = &roundTrend{Round: s.Round, Scores: make([]*db.Score, len(resp.Competitions))}
+					trends[s.Round] = t
+					resp.Rounds = append(resp.Rounds, t)
+				}
+				score := s.Score
+				t.Scores[i] = &score
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//computedError is returned if a score is submitted for a computed round or a computed round definition isn't valid
+type computedError struct {
+	Description string
+}
+
+func (e *computedError) Error() string {
+	return e.Description
+}
+
+//checkComputed returns a *computedError if a draft, which must be resolved against c, is for a computed round
+func checkComputed(c *db.Competition, scores []*Draft) error {
+	for _, s := range scores {
+		if c.IsComputed(s.Round) {
+			return &computedError{Description: fmt.Sprintf("%s is computed and can't be scored", c.Rounds[s.Round])}
+		}
+	}
+	return nil
+}
+
+//compute recomputes the computed rounds in c, returning a *computedError if a definition isn't valid
+func compute(c *db.Competition) error {
+	if err := c.Compute(); err != nil {
+		return &computedError{Description: err.Error()}
+	}
+	return nil
+}
+
+//computedEvents returns the events in competitionEvents for computed rounds only
+func computedEvents(id int, old, c *db.Competition) []*Event {
+	var events []*Event
+	for _, e := range competitionEvents(id, old, c) {
+		if p, ok := e.Payload.(*ScoreUpdatePayload); ok && c.IsComputed(p.Round) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+//computedRequest sets the computed rounds by round ID. Rounds not given are entered normally
+type computedRequest struct {
+	Computed map[string]*db.ComputedRound `json:"computed"`
+}
+
+func getComputed(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		computed := c.Computed
+		if computed == nil {
+			computed = make(map[string]*db.ComputedRound)
+		}
+
+		returnHTTP(w, http.StatusOK, &computedRequest{Computed: computed})
+	}
+}
+
+//putComputed replaces the computed round definitions and recomputes their scores.
+//Scores entered in rounds that become computed are replaced
+func putComputed(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(computedRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if old == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		c := old.Copy()
+		c.Computed = make(map[string]*db.ComputedRound)
+		for id, def := range req.Computed {
+			if def == nil {
+				continue
+			}
+			c.Computed[id] = def
+		}
+
+		if err = c.ValidateComputed(); err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+
+		if err = compute(c); err == nil {
+			err = checkRules(d, c, changedScores(old, c))
+		}
+		if err != nil {
+			returnInvalid(w, err)
+			return
+		}
+
+		if err = actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		id := subscriberID(r)
+		events := competitionEvents(id, old, c)
+		if err = attribute(d, session.Username, events); err != nil {
+			log.Println("Unable to write score attributions:", err)
+		}
+
+		sub.PublishCommitted(committed, events...)
+		sub.NotifyCommitted(committed, id)
+
+		computed := c.Computed
+		if computed == nil {
+			computed = make(map[string]*db.ComputedRound)
+		}
+		returnHTTP(w, http.StatusOK, &computedRequest{Computed: computed})
+	}
+}
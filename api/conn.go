@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+const (
+	//pongWait is how long a subscriber connection may be silent before it's closed
+	pongWait = 60 * time.Second
+	//pingPeriod is how often the server pings a subscriber connection
+	pingPeriod = pongWait * 9 / 10
+	//writeWait is how long a single write to a subscriber connection may take
+	writeWait = 10 * time.Second
+)
+
+//Client message types
+const (
+	ClientFilter   = "filter"
+	ClientSnapshot = "snapshot"
+	ClientAck      = "ack"
+	ClientPing     = "ping"
+)
+
+//ClientMessage represents a message sent by a subscriber.
+//Events is used by ClientFilter; an empty list subscribes to all events.
+//Team is used by ClientFilter to only receive score updates and team additions for the team with the given ID, slug, or index.
+//Seq is used by ClientAck and is the Seq of the last event the client received, on this or an earlier connection.
+//If a connection's first ack is for an event published before the connection subscribed, the client missed events while reconnecting
+//and is sent a snapshot reply, as if it had sent ClientSnapshot. Seqs restart when the server does
+type ClientMessage struct {
+	Type   string   `json:"type"`
+	Events []string `json:"events,omitempty"`
+	Team   string   `json:"team,omitempty"`
+	Seq    uint64   `json:"seq,omitempty"`
+}
+
+//SnapshotPayload is the Payload of a snapshot reply
+type SnapshotPayload struct {
+	Competition *db.Competition `json:"competition"`
+	State       db.State        `json:"state"`
+}
+
+//subscriberConn is a single WebSocket subscriber
+type subscriberConn struct {
+	conn   *websocket.Conn
+	d      db.DB
+	s      *SubscribeService
+	stats  *Stats
+	shaper *Shaper
+	pacer  *pacer
+	//chaos drops messages when fault injection is on
+	chaos *Chaos
+	//v1 is set for connections made to v1, whose messages are translated with v1JSON
+	v1 bool
+
+	id  int
+	sub <-chan *Event
+	//subscribed is the Seq of the last event published before the connection subscribed
+	subscribed uint64
+
+	//replies are messages sent only to this connection
+	replies chan *Event
+	done    chan struct{}
+
+	mu      *sync.Mutex
+	filter  map[string]bool
+	team    string
+	lastAck uint64
+}
+
+func newSubscriberConn(conn *websocket.Conn, remote string, d db.DB, s *SubscribeService, stats *Stats, shaper *Shaper) *subscriberConn {
+	conn.EnableWriteCompression(true)
+	c := &subscriberConn{
+		conn:    conn,
+		d:       d,
+		s:       s,
+		stats:   stats,
+		shaper:  shaper,
+		pacer:   shaper.conn(),
+		replies: make(chan *Event, 8),
+		done:    make(chan struct{}),
+		mu:      new(sync.Mutex),
+	}
+	c.id, c.sub, c.subscribed = s.subscribe(remote)
+	return c
+}
+
+//wants returns whether or not the connection's filter allows the given event
+func (c *subscriberConn) wants(e *Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.filter) != 0 && !c.filter[e.Type] {
+		return false
+	}
+	if c.team == "" {
+		return true
+	}
+	switch p := e.Payload.(type) {
+	case *ScoreUpdatePayload:
+		return p.TeamID == c.team
+	case *TeamAddedPayload:
+		return p.TeamID == c.team
+	}
+	return true
+}
+
+func (c *subscriberConn) write(e *Event) error {
+	if c.chaos.drop() {
+		return nil
+	}
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if c.v1 {
+		if buf, err = v1JSON(buf); err != nil {
+			return err
+		}
+	}
+
+	atomic.AddUint64(&c.stats.wsRawBytes, uint64(len(buf)))
+	c.stats.addTypeBytes(e.Type, len(buf))
+
+	if c.shaper.shapes(len(buf)) {
+		return c.writeShaped(buf)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, buf)
+}
+
+//errConnClosed is returned by writeShaped if the connection is closed while waiting to write
+var errConnClosed = errors.New("connection closed")
+
+//writeShaped writes buf as a single message a chunk at a time, waiting before each chunk as long as the Shaper requires
+func (c *subscriberConn) writeShaped(buf []byte) error {
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	for len(buf) > 0 {
+		n := c.shaper.chunk
+		if n > len(buf) {
+			n = len(buf)
+		}
+
+		if wait := c.shaper.wait(c.pacer, n); wait > 0 {
+			atomic.AddUint64(&c.stats.wsShapingDelay, uint64(wait))
+			select {
+			case <-time.After(wait):
+			case <-c.done:
+				return errConnClosed
+			}
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err = w.Write(buf[:n]); err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return w.Close()
+}
+
+//writeLoop writes events and replies to the connection until the connection fails or is closed
+func (c *subscriberConn) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case e, ok := <-c.sub:
+			if !ok {
+				return
+			}
+			if c.wants(e) {
+				err = c.write(e)
+			}
+			e.delivery.done()
+		case e := <-c.replies:
+			err = c.write(e)
+		case <-ticker.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			return
+		}
+
+		if err != nil {
+			log.Println("Unable to write WebSocket message:", err)
+			return
+		}
+	}
+}
+
+//reply queues a message for this connection only
+func (c *subscriberConn) reply(e *Event) {
+	select {
+	case c.replies <- e:
+	case <-c.done:
+	}
+}
+
+func (c *subscriberConn) handle(m *ClientMessage) {
+	switch m.Type {
+	case ClientFilter:
+		filter := make(map[string]bool)
+		for _, typ := range m.Events {
+			filter[typ] = true
+		}
+		team := m.Team
+		if team != "" {
+			comp, err := c.d.Read()
+			if err != nil {
+				log.Println("Unable to read database:", err)
+			} else if comp != nil {
+				if i := comp.FindTeam(team); i >= 0 {
+					team = comp.Teams[i].ID
+				}
+			}
+		}
+		c.mu.Lock()
+		c.filter, c.team = filter, team
+		c.mu.Unlock()
+	case ClientSnapshot:
+		m, err := ReadMaintenance(c.d)
+		if err != nil {
+			log.Println("Unable to read maintenance mode:", err)
+			return
+		}
+		if m.Enabled {
+			c.reply(&Event{Type: EventMaintenance, ID: c.id, Payload: m})
+			return
+		}
+		comp, err := c.d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			return
+		}
+		state, err := c.d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			return
+		}
+		c.reply(&Event{Type: ClientSnapshot, ID: c.id, Payload: &SnapshotPayload{Competition: comp, State: state}})
+	case ClientAck:
+		c.mu.Lock()
+		//a first ack older than the connection means events were published while the client was reconnecting
+		resume := c.lastAck == 0 && m.Seq < c.subscribed
+		if m.Seq > c.lastAck {
+			c.lastAck = m.Seq
+		}
+		c.mu.Unlock()
+		if resume {
+			c.handle(&ClientMessage{Type: ClientSnapshot})
+		}
+	case ClientPing:
+		c.reply(&Event{Type: "pong", ID: c.id})
+	}
+}
+
+//readLoop reads client messages until the connection fails or the client closes it
+func (c *subscriberConn) readLoop() {
+	defer close(c.done)
+
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		m := new(ClientMessage)
+		if err := c.conn.ReadJSON(m); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println("Unable to read WebSocket message:", err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.s.Touch(c.id)
+		c.handle(m)
+	}
+}
+
+//serve runs the connection until it's closed, then unsubscribes it
+func (c *subscriberConn) serve() {
+	defer c.conn.Close()
+
+	if err := c.write(&Event{Type: EventConnect, ID: c.id}); err != nil {
+		log.Println("Unable to write WebSocket message:", err)
+		c.unsubscribe()
+		c.drain()
+		return
+	}
+
+	go c.readLoop()
+	c.writeLoop()
+
+	c.unsubscribe()
+	c.drain()
+	c.conn.Close()
+	<-c.done
+}
+
+//drain marks the events still queued for the connection when it stopped writing as delivered, so their propagation is still observed.
+//The connection must be unsubscribed first so the queue is closed
+func (c *subscriberConn) drain() {
+	for e := range c.sub {
+		e.delivery.done()
+	}
+}
+
+func (c *subscriberConn) unsubscribe() {
+	c.s.Unsubscribe(c.id)
+}
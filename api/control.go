@@ -0,0 +1,156 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//RevealPayload is the Payload of an EventReveal Event.
+//Step is the number of reveal steps display clients should show
+type RevealPayload struct {
+	Step int `json:"step"`
+}
+
+//Reveal tracks the current reveal step for display clients
+type Reveal struct {
+	step int
+	mu   *sync.Mutex
+}
+
+//NewReveal returns a new Reveal at step 0
+func NewReveal() *Reveal {
+	return &Reveal{mu: new(sync.Mutex)}
+}
+
+//Next advances the reveal step and returns it
+func (r *Reveal) Next() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.step++
+	return r.step
+}
+
+//Reset sets the reveal step to 0
+func (r *Reveal) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.step = 0
+}
+
+//checkControl checks if the request has one of the given control tokens, either as a Bearer token or in the token query parameter.
+//If the request is not authorized checkControl returns false and writes the error to w
+func checkControl(w http.ResponseWriter, r *http.Request, tokens []string) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if token == "" {
+		returnHTTP(w, http.StatusUnauthorized, nil)
+		return false
+	}
+
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	returnHTTP(w, http.StatusUnauthorized, nil)
+	return false
+}
+
+type controlResponse struct {
+	Step  int      `json:"step,omitempty"`
+	State db.State `json:"state,omitempty"`
+}
+
+func controlRevealNext(tokens []string, rev *Reveal, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkControl(w, r, tokens) {
+			return
+		}
+
+		step := rev.Next()
+		returnHTTP(w, http.StatusOK, &controlResponse{Step: step})
+		sub.Publish(&Event{Type: EventReveal, Payload: &RevealPayload{Step: step}})
+	}
+}
+
+func controlRevealReset(tokens []string, rev *Reveal, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkControl(w, r, tokens) {
+			return
+		}
+
+		rev.Reset()
+		returnHTTP(w, http.StatusOK, &controlResponse{})
+		sub.Publish(&Event{Type: EventReveal, Payload: &RevealPayload{Step: 0}})
+	}
+}
+
+//controlFreeze toggles the competition between StateInProgress and StateFrozen
+func controlFreeze(d db.DB, tokens []string, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkControl(w, r, tokens) {
+			return
+		}
+
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		next := db.StateFrozen
+		if state == db.StateFrozen {
+			next = db.StateInProgress
+		}
+
+		if !state.CanTransition(next) {
+			returnHTTP(w, http.StatusConflict, nil)
+			return
+		}
+
+		if err = d.SetState(next); err != nil {
+			log.Println("Unable to write competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &controlResponse{State: next})
+		sub.Publish(&Event{Type: EventState, Payload: &StatePayload{State: next}})
+		sub.Publish(&Event{Type: EventFreeze, Payload: &FreezePayload{Frozen: next == db.StateFrozen}})
+	}
+}
+
+//controlTimer starts a countdown for the number of seconds in the seconds query parameter, or stops it if seconds is 0
+func controlTimer(tokens []string, t *Timer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkControl(w, r, tokens) {
+			return
+		}
+
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds < 0 {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if seconds == 0 {
+			t.Stop()
+		} else {
+			t.Start(0, time.Duration(seconds)*time.Second)
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Cue types
+const (
+	CueLead = "lead"
+	CueRank = "rank"
+)
+
+//DefaultCueTemplates are the text/template templates used for cues if none are configured.
+//Templates are executed with a *db.Standing and can use the ordinal function
+var DefaultCueTemplates = map[string]string{
+	CueLead: "{{.Name}} takes the lead with {{.Total}} points",
+	CueRank: "{{.Name}} moves up to {{ordinal .Rank}} place with {{.Total}} points",
+}
+
+//cueHistory is the number of cues kept for GET requests
+const cueHistory = 100
+
+//Cue is an announcer-ready text cue
+type Cue struct {
+	Seq  int       `json:"seq"`
+	Type string    `json:"type"`
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+//CueService generates Cues when the competition is updated
+type CueService struct {
+	d         db.DB
+	sub       *SubscribeService
+	templates map[string]*template.Template
+
+	previous []*db.Standing
+	cues     []*Cue
+	lastSeq  int
+	mu       *sync.Mutex
+}
+
+func ordinal(i int) string {
+	suffix := "th"
+	switch i % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if i%100 >= 11 && i%100 <= 13 {
+		suffix = "th"
+	}
+	return strconv.Itoa(i) + suffix
+}
+
+//NewCueService returns a new CueService using the given templates, keyed by cue type,
+//in place of DefaultCueTemplates, or an error if a template couldn't be parsed
+func NewCueService(d db.DB, sub *SubscribeService, templates map[string]string) (*CueService, error) {
+	c := &CueService{
+		d:         d,
+		sub:       sub,
+		templates: make(map[string]*template.Template),
+		mu:        new(sync.Mutex),
+	}
+
+	for typ, text := range DefaultCueTemplates {
+		if t, ok := templates[typ]; ok {
+			text = t
+		}
+
+		tmpl, err := template.New(typ).Funcs(template.FuncMap{"ordinal": ordinal}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %s cue template: %v", typ, err)
+		}
+		c.templates[typ] = tmpl
+	}
+
+	comp, err := d.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read database: %v", err)
+	}
+	if comp != nil {
+		c.previous = comp.Standings()
+	}
+
+	go c.watch()
+
+	return c, nil
+}
+
+func (c *CueService) watch() {
+	for {
+		_, events := c.sub.Subscribe()
+		for e := range events {
+			if e.Type == EventUpdate {
+				c.update(e.ID)
+			}
+		}
+	}
+}
+
+func (c *CueService) add(id int, typ string, s *db.Standing) {
+	buf := new(bytes.Buffer)
+	if err := c.templates[typ].Execute(buf, s); err != nil {
+		log.Printf("Unable to execute %s cue template: %v", typ, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.lastSeq++
+	cue := &Cue{Seq: c.lastSeq, Type: typ, Text: buf.String(), Time: time.Now()}
+	c.cues = append(c.cues, cue)
+	if len(c.cues) > cueHistory {
+		c.cues = c.cues[len(c.cues)-cueHistory:]
+	}
+	c.mu.Unlock()
+
+	c.sub.Publish(&Event{Type: EventCue, ID: id, Payload: cue})
+}
+
+//update compares the current standings with the previous standings and adds Cues for any changes
+func (c *CueService) update(id int) {
+	comp, err := c.d.Read()
+	if err != nil {
+		log.Println("Unable to read database:", err)
+		return
+	}
+	if comp == nil {
+		return
+	}
+
+	standings := comp.Standings()
+	previous := make(map[int]*db.Standing)
+	for _, s := range c.previous {
+		previous[s.Team] = s
+	}
+
+	oldLeader, newLeader := db.Leader(c.previous), db.Leader(standings)
+	if newLeader != nil && (oldLeader == nil || oldLeader.Team != newLeader.Team) {
+		c.add(id, CueLead, newLeader)
+	}
+
+	for _, s := range standings {
+		if newLeader != nil && s.Team == newLeader.Team {
+			continue
+		}
+		if p, ok := previous[s.Team]; ok && s.Total > 0 && s.Rank < p.Rank {
+			c.add(id, CueRank, s)
+		}
+	}
+
+	c.previous = standings
+}
+
+//Since returns the Cues with a Seq greater than seq
+func (c *CueService) Since(seq int) []*Cue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cues := make([]*Cue, 0)
+	for _, cue := range c.cues {
+		if cue.Seq > seq {
+			cues = append(cues, cue)
+		}
+	}
+	return cues
+}
+
+type cuesResponse struct {
+	Cues []*Cue `json:"cues"`
+}
+
+//getCues returns the cues after the since query parameter as JSON, or as plain text lines if format=text
+func getCues(c *CueService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since int
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = strconv.Atoi(s); err != nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		cues := c.Since(since)
+
+		if r.URL.Query().Get("format") == "text" {
+			lines := make([]string, 0, len(cues))
+			for _, cue := range cues {
+				lines = append(lines, cue.Text)
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, strings.Join(lines, "\n"))
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &cuesResponse{Cues: cues})
+	}
+}
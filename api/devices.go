@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//devicesSetting is the db setting key registered devices are stored under
+const devicesSetting = "devices"
+
+//deviceTimeout is how long after its last heartbeat a device is considered offline
+const deviceTimeout = 90 * time.Second
+
+//Device is a registered display device
+type Device struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	View     string                 `json:"view"`
+	Params   map[string]string      `json:"params,omitempty"`
+	LastSeen time.Time              `json:"last_seen"`
+	Online   bool                   `json:"online"`
+	Health   map[string]interface{} `json:"health,omitempty"`
+	Address  string                 `json:"address,omitempty"`
+}
+
+//DeviceViewPayload is the Payload of an EventDeviceView Event
+type DeviceViewPayload struct {
+	Device string            `json:"device"`
+	View   string            `json:"view"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+//DeviceRegistry tracks registered display devices.
+//Device names and views are stored in the database; heartbeats are kept in memory
+type DeviceRegistry struct {
+	d       db.DB
+	devices map[string]*Device
+	mu      *sync.Mutex
+}
+
+//NewDeviceRegistry returns a new DeviceRegistry with the devices stored in d
+func NewDeviceRegistry(d db.DB) *DeviceRegistry {
+	r := &DeviceRegistry{d: d, devices: make(map[string]*Device), mu: new(sync.Mutex)}
+
+	var devices []*Device
+	if _, err := d.ReadSetting(devicesSetting, &devices); err != nil {
+		log.Println("Unable to read devices:", err)
+	}
+	for _, dev := range devices {
+		dev.Online = false
+		dev.Health = nil
+		r.devices[dev.ID] = dev
+	}
+
+	return r
+}
+
+//save stores the registry. The caller must hold r.mu
+func (r *DeviceRegistry) save() error {
+	devices := make([]*Device, 0, len(r.devices))
+	for _, dev := range r.devices {
+		devices = append(devices, &Device{ID: dev.ID, Name: dev.Name, View: dev.View, Params: dev.Params})
+	}
+	return r.d.WriteSetting(devicesSetting, devices)
+}
+
+//Register adds a device with the given name, or returns the existing device with that name
+func (r *DeviceRegistry) Register(name string) (*Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, dev := range r.devices {
+		if dev.Name == name {
+			return dev, nil
+		}
+	}
+
+	dev := &Device{ID: randString(22), Name: name}
+	r.devices[dev.ID] = dev
+	return dev, r.save()
+}
+
+//Heartbeat records a heartbeat for the device with the given id and returns the device, or nil if it isn't registered
+func (r *DeviceRegistry) Heartbeat(id, address string, health map[string]interface{}) *Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dev, ok := r.devices[id]
+	if !ok {
+		return nil
+	}
+
+	dev.LastSeen = time.Now()
+	dev.Health = health
+	dev.Address = address
+	dev.Online = true
+
+	d := *dev
+	return &d
+}
+
+//SetView points the device with the given id at view and returns true, or returns false if it isn't registered
+func (r *DeviceRegistry) SetView(id, view string, params map[string]string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dev, ok := r.devices[id]
+	if !ok {
+		return false, nil
+	}
+
+	dev.View = view
+	dev.Params = params
+	return true, r.save()
+}
+
+//Remove unregisters the device with the given id
+func (r *DeviceRegistry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.devices, id)
+	return r.save()
+}
+
+//List returns all registered devices ordered by name
+func (r *DeviceRegistry) List() []*Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	devices := make([]*Device, 0, len(r.devices))
+	for _, dev := range r.devices {
+		dev.Online = now.Sub(dev.LastSeen) < deviceTimeout
+		d := *dev
+		devices = append(devices, &d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+
+	return devices
+}
+
+type deviceRequest struct {
+	Name   string                 `json:"name"`
+	Health map[string]interface{} `json:"health"`
+	View   string                 `json:"view"`
+	Params map[string]string      `json:"params"`
+}
+
+type devicesResponse struct {
+	Devices []*Device `json:"devices"`
+}
+
+func postDevice(reg *DeviceRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(deviceRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Name == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		dev, err := reg.Register(req.Name)
+		if err != nil {
+			log.Println("Unable to write devices:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, reg.Heartbeat(dev.ID, remoteIP(r), nil))
+	}
+}
+
+//putDeviceHeartbeat records a heartbeat and returns the device with the view it should show
+func putDeviceHeartbeat(reg *DeviceRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(deviceRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		dev := reg.Heartbeat(mux.Vars(r)["id"], remoteIP(r), req.Health)
+		if dev == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, dev)
+	}
+}
+
+func getDevices(reg *DeviceRegistry, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &devicesResponse{Devices: reg.List()})
+	}
+}
+
+func putDeviceView(reg *DeviceRegistry, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(deviceRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		ok, err := reg.SetView(id, req.View, req.Params)
+		if err != nil {
+			log.Println("Unable to write devices:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+		sub.Publish(&Event{Type: EventDeviceView, Payload: &DeviceViewPayload{Device: id, View: req.View, Params: req.Params}})
+	}
+}
+
+func deleteDevice(reg *DeviceRegistry, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if err := reg.Remove(mux.Vars(r)["id"]); err != nil {
+			log.Println("Unable to write devices:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//errDryRun is returned by dryRunDB methods that can't be previewed
+var errDryRun = &db.Error{Err: nil, Description: "Not supported in a dry run"}
+
+//dryRunDB is a DB that reads through to DB until the competition, state, or a setting is written,
+//then keeps the change in memory instead of storing it
+type dryRunDB struct {
+	db.DB
+
+	mu       *sync.Mutex
+	written  bool
+	c        *db.Competition
+	state    db.State
+	settings map[string][]byte
+}
+
+func newDryRunDB(d db.DB) *dryRunDB {
+	return &dryRunDB{DB: d, mu: new(sync.Mutex), settings: make(map[string][]byte)}
+}
+
+func (d *dryRunDB) Read() (*db.Competition, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.read()
+}
+
+//read returns the pending competition, or the stored competition if it hasn't been written. d.mu must be held
+func (d *dryRunDB) read() (*db.Competition, error) {
+	if d.written {
+		return d.c.Copy(), nil
+	}
+	return d.DB.Read()
+}
+
+//Write checks c like a DB would and keeps a copy of it
+func (d *dryRunDB) Write(c *db.Competition) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	var version int32
+	if current != nil {
+		version = current.Version
+	}
+
+	if c != nil {
+		if current != nil && c.Version != version {
+			return db.ErrStaleVersion
+		}
+		if err = c.Prepare(); err != nil {
+			return err
+		}
+		c.Version = version + 1
+	}
+
+	d.c, d.written = c.Copy(), true
+	return nil
+}
+
+func (d *dryRunDB) WriteScore(team, round int, score db.Score) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.read()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return &db.Error{Err: nil, Description: "Competition doesn't exist"}
+	}
+
+	if _, err = c.SetScore(team, round, score); err != nil {
+		return err
+	}
+	c.Version++
+
+	d.c, d.written = c, true
+	return nil
+}
+
+func (d *dryRunDB) State() (db.State, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != "" {
+		return d.state, nil
+	}
+	return d.DB.State()
+}
+
+func (d *dryRunDB) SetState(s db.State) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = s
+	return nil
+}
+
+func (d *dryRunDB) ReadSetting(key string, v interface{}) (bool, error) {
+	d.mu.Lock()
+	buf, ok := d.settings[key]
+	d.mu.Unlock()
+
+	if !ok {
+		return d.DB.ReadSetting(key, v)
+	}
+	if buf == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return false, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't decode Setting(%s)", key)}
+	}
+	return true, nil
+}
+
+func (d *dryRunDB) WriteSetting(key string, v interface{}) error {
+	var buf []byte
+	if v != nil {
+		var err error
+		if buf, err = json.Marshal(v); err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't encode Setting(%s)", key)}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settings[key] = buf
+	return nil
+}
+
+func (d *dryRunDB) Settings() (map[string]json.RawMessage, error) {
+	settings, err := d.DB.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, buf := range d.settings {
+		if buf == nil {
+			delete(settings, k)
+			continue
+		}
+		settings[k] = json.RawMessage(buf)
+	}
+	return settings, nil
+}
+
+func (d *dryRunDB) Init(name string, rounds int, teams []string, username, password string) error {
+	return errDryRun
+}
+
+func (d *dryRunDB) UpdateCredentials(username, password string) error {
+	return errDryRun
+}
+
+func (d *dryRunDB) RestoreRevision(id int32) (*db.Competition, error) {
+	return nil, errDryRun
+}
+
+func (d *dryRunDB) Restore(c *db.Competition, revisions []*db.Revision) error {
+	return errDryRun
+}
+
+func (d *dryRunDB) PruneRevisions() (int, error) {
+	return 0, errDryRun
+}
+
+//responseRecorder is an http.ResponseWriter that keeps the response. Like a real response, code is 200 OK unless set
+type responseRecorder struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        *bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code, r.wroteHeader = code, true
+	}
+}
+
+//dryRunResponse is the response of a dry run. Diff is the change the request would make, with From and To left 0,
+//and Standings are the standings after the change. Response is the response the request would have returned
+type dryRunResponse struct {
+	DryRun    bool             `json:"dry_run"`
+	Diff      *db.RevisionDiff `json:"diff"`
+	Standings []*db.Standing   `json:"standings"`
+	Response  json.RawMessage  `json:"response,omitempty"`
+}
+
+//dryRunnable serves the handler made by newHandler, or if the request has ?dry-run=true,
+//runs it against an in-memory copy of d's changes and responds with the change it would make without storing it or notifying subscribers.
+//Responses other than 2xx are returned as is
+func dryRunnable(d db.DB, sess *MemorySessionStore, sub *SubscribeService, newHandler func(db.DB, *MemorySessionStore, *SubscribeService) http.HandlerFunc) http.Handler {
+	h := newHandler(d, sess, sub)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dry, _ := strconv.ParseBool(r.URL.Query().Get("dry-run")); !dry {
+			h(w, r)
+			return
+		}
+
+		overlay := newDryRunDB(d)
+		rec := &responseRecorder{header: make(http.Header), code: http.StatusOK, body: new(bytes.Buffer)}
+		newHandler(overlay, sess, nil)(rec, r)
+
+		if rec.code < 200 || rec.code > 299 {
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.code)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		c, err := overlay.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		resp := &dryRunResponse{DryRun: true, Diff: db.Diff(old, c)}
+		if c != nil {
+			resp.Standings = c.Standings()
+		}
+		if json.Valid(rec.body.Bytes()) {
+			resp.Response = json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//getExport returns a JSON export of the competition, state, settings, and revisions
+func getExport(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminScope(w, r, sess) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="competition-%s.json"`, time.Now().Format("20060102-150405")))
+		w.Header().Set("Cache-Control", "no-store")
+
+		//the export is streamed, so errors after this can only be logged
+		if err := db.Export(d, w); err != nil {
+			log.Println("Unable to write export:", err)
+		}
+	}
+}
+
+//postImport replaces the competition, state, settings, and revisions with the JSON export in the request body
+//and notifies subscribers of the imported competition
+func postImport(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if err := db.Import(actorDB(d, r, sess), http.MaxBytesReader(w, r.Body, maxArchiveSize)); errors.Is(err, db.ErrInvalidExport) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		} else if err != nil {
+			log.Println("Unable to import export:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		id := subscriberID(r)
+		sub.Publish(&Event{Type: EventState, ID: id, Payload: &StatePayload{State: state}})
+		sub.NotifyCommitted(committed, id)
+
+		resp := new(versionResponse)
+		if c != nil {
+			resp.Version = c.Version
+		}
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//Optional features that can be enabled or disabled per deployment
+const (
+	FeatureAPIv2      = "api_v2"
+	FeatureBasicAuth  = "basic_auth"
+	FeatureDevices    = "devices"
+	FeatureHooks      = "hooks"
+	FeatureIngest     = "ingest"
+	FeatureJudges     = "judges"
+	FeaturePlaylist   = "playlist"
+	FeatureSMSGateway = "sms_gateway"
+)
+
+//defaultFeatures are whether or not each feature is enabled if not configured
+var defaultFeatures = map[string]bool{
+	FeatureAPIv2:      true,
+	FeatureBasicAuth:  false,
+	FeatureDevices:    true,
+	FeatureHooks:      true,
+	FeatureIngest:     true,
+	FeatureJudges:     true,
+	FeaturePlaylist:   true,
+	FeatureSMSGateway: true,
+}
+
+//Features are whether or not each optional feature is enabled.
+//The routes of disabled features return 404 Not Found
+type Features map[string]bool
+
+//DefaultFeatures returns the Features used if none are configured
+func DefaultFeatures() Features {
+	f := make(Features, len(defaultFeatures))
+	for name, enabled := range defaultFeatures {
+		f[name] = enabled
+	}
+	return f
+}
+
+//ParseFeatures returns the DefaultFeatures changed by the given comma separated list of name=on or name=off,
+//or an error if one occurred
+func ParseFeatures(list string) (Features, error) {
+	f := DefaultFeatures()
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		parts := strings.SplitN(s, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if _, ok := defaultFeatures[name]; !ok {
+			known := make([]string, 0, len(defaultFeatures))
+			for k := range defaultFeatures {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("Unknown feature %s; features are %s", name, strings.Join(known, ", "))
+		}
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Feature %s must be set to on or off", name)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(parts[1])) {
+		case "on", "true", "1":
+			f[name] = true
+		case "off", "false", "0":
+			f[name] = false
+		default:
+			return nil, fmt.Errorf("Feature %s must be set to on or off", name)
+		}
+	}
+	return f, nil
+}
+
+//Enabled returns whether or not the given feature is enabled
+func (f Features) Enabled(name string) bool {
+	return f[name]
+}
+
+//require returns h if the given feature is enabled, or a handler that returns 404 Not Found otherwise
+func (f Features) require(name string, h http.Handler) http.Handler {
+	if f.Enabled(name) {
+		return h
+	}
+	return http.HandlerFunc(notFound)
+}
+
+type featuresResponse struct {
+	Features Features `json:"features"`
+}
+
+//getFeatures returns whether or not each optional feature is enabled so clients can hide disabled features
+func getFeatures(f Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		returnHTTP(w, http.StatusOK, &featuresResponse{Features: f})
+	}
+}
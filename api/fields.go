@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//fieldsSetting is the db setting key custom field definitions are stored under
+const fieldsSetting = "custom_fields"
+
+//Custom field types
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldBool   = "bool"
+)
+
+//FieldDefinition defines a custom field
+type FieldDefinition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+//FieldDefinitions are the custom fields that can be set on teams and submitted with scores
+type FieldDefinitions struct {
+	Team  []*FieldDefinition `json:"team"`
+	Score []*FieldDefinition `json:"score"`
+}
+
+//fieldError is returned if custom fields don't match their definitions
+type fieldError struct {
+	Description string
+}
+
+func (e *fieldError) Error() string {
+	return e.Description
+}
+
+//isInvalid returns whether or not err describes invalid input that should be returned to the client
+func isInvalid(err error) bool {
+	switch err.(type) {
+	case *ruleError, *fieldError, *computedError, *lockError:
+		return true
+	}
+	return false
+}
+
+//returnInvalid writes err to w as a 400 Bad Request if it describes invalid input,
+//or logs it and writes a 500 Internal Server Error otherwise
+func returnInvalid(w http.ResponseWriter, err error) {
+	if isInvalid(err) {
+		returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+	log.Println(err)
+	returnHTTP(w, http.StatusInternalServerError, nil)
+}
+
+func readFieldDefinitions(d db.DB) (*FieldDefinitions, error) {
+	defs := new(FieldDefinitions)
+	_, err := d.ReadSetting(fieldsSetting, defs)
+	return defs, err
+}
+
+//checkFields returns a *fieldError if f has a field that isn't in defs or has the wrong type
+func checkFields(kind string, defs []*FieldDefinition, f db.Fields) error {
+	for name, v := range f {
+		var def *FieldDefinition
+		for _, fd := range defs {
+			if fd.Name == name {
+				def = fd
+			}
+		}
+
+		if def == nil {
+			return &fieldError{Description: fmt.Sprintf("Unknown %s field %s", kind, name)}
+		}
+
+		var ok bool
+		switch def.Type {
+		case FieldString:
+			_, ok = v.(string)
+		case FieldNumber:
+			_, ok = v.(float64)
+		case FieldBool:
+			_, ok = v.(bool)
+		}
+
+		if !ok && v != nil {
+			return &fieldError{Description: fmt.Sprintf("%s field %s must be a %s", kind, name, def.Type)}
+		}
+	}
+	return nil
+}
+
+//checkScoreFields returns a *fieldError if a draft's score fields aren't valid, or another error if one occurred
+func checkScoreFields(d db.DB, scores []*Draft) error {
+	defs, err := readFieldDefinitions(d)
+	if err != nil {
+		return fmt.Errorf("Unable to read custom fields: %v", err)
+	}
+
+	for _, s := range scores {
+		if err = checkFields("score", defs.Score, s.Score.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//checkCompetitionFields returns a *fieldError if team or score fields in c that changed from old aren't valid,
+//or another error if one occurred. old can be nil
+func checkCompetitionFields(d db.DB, old, c *db.Competition) error {
+	defs, err := readFieldDefinitions(d)
+	if err != nil {
+		return fmt.Errorf("Unable to read custom fields: %v", err)
+	}
+
+	for _, t := range c.Teams {
+		var oldTeam *db.Team
+		if old != nil {
+			if i := old.TeamIndex(t.ID); i >= 0 {
+				oldTeam = old.Teams[i]
+			}
+		}
+
+		if oldTeam == nil || !reflect.DeepEqual(oldTeam.Fields, t.Fields) {
+			if err = checkFields("team", defs.Team, t.Fields); err != nil {
+				return err
+			}
+		}
+
+		for j, s := range t.Scores {
+			if oldTeam != nil && j < len(c.RoundIDs) {
+				if r := old.RoundIndex(c.RoundIDs[j]); r >= 0 && r < len(oldTeam.Scores) && reflect.DeepEqual(oldTeam.Scores[r].Fields, s.Fields) {
+					continue
+				}
+			}
+			if err = checkFields("score", defs.Score, s.Fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func getFieldDefinitions(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		defs, err := readFieldDefinitions(d)
+		if err != nil {
+			log.Println("Unable to read custom fields:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, defs)
+	}
+}
+
+//validDefinitions returns an error if defs has an empty or duplicate name or an unknown type
+func validDefinitions(kind string, defs []*FieldDefinition) error {
+	seen := make(map[string]bool)
+	for _, def := range defs {
+		if def == nil || def.Name == "" {
+			return fmt.Errorf("%s field names can't be empty", kind)
+		}
+		if seen[def.Name] {
+			return fmt.Errorf("Duplicate %s field %s", kind, def.Name)
+		}
+		seen[def.Name] = true
+		if def.Type != FieldString && def.Type != FieldNumber && def.Type != FieldBool {
+			return fmt.Errorf("%s field %s type must be %s, %s, or %s", kind, def.Name, FieldString, FieldNumber, FieldBool)
+		}
+	}
+	return nil
+}
+
+//putFieldDefinitions replaces the custom field definitions. Existing values aren't changed,
+//but values of removed or retyped fields are rejected the next time they're changed
+func putFieldDefinitions(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		defs := new(FieldDefinitions)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(defs); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		for kind, list := range map[string][]*FieldDefinition{"team": defs.Team, "score": defs.Score} {
+			if err := validDefinitions(kind, list); err != nil {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+				return
+			}
+		}
+
+		if err := d.WriteSetting(fieldsSetting, defs); err != nil {
+			log.Println("Unable to write custom fields:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, defs)
+	}
+}
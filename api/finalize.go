@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//finalizeSetting is the db setting key the scheduled finalization time is stored under
+const finalizeSetting = "finalize_at"
+
+//FinalizeSchedule is the time the competition will be finalized, and is the Payload of EventFinalizeScheduled Events.
+//A zero At means finalization isn't scheduled. Remaining is the number of seconds until At when it was sent
+type FinalizeSchedule struct {
+	At        time.Time `json:"at"`
+	Remaining int       `json:"remaining"`
+}
+
+//Finalizer finalizes the competition at a scheduled time
+type Finalizer struct {
+	d    db.DB
+	sub  *SubscribeService
+	wake chan struct{}
+	mu   *sync.Mutex
+	at   time.Time
+}
+
+//NewFinalizer returns a new Finalizer and starts its scheduler
+func NewFinalizer(d db.DB, sub *SubscribeService) *Finalizer {
+	f := &Finalizer{d: d, sub: sub, wake: make(chan struct{}, 1), mu: new(sync.Mutex)}
+	if _, err := d.ReadSetting(finalizeSetting, &f.at); err != nil {
+		log.Println("Unable to read finalization schedule:", err)
+	}
+
+	go f.schedule()
+	return f
+}
+
+//finalize moves the competition to StateFinalized and notifies subscribers, as if an admin had changed the state
+func (f *Finalizer) finalize() {
+	state, err := f.d.State()
+	if err != nil {
+		log.Println("Unable to read competition state:", err)
+		return
+	}
+
+	if !state.CanTransition(db.StateFinalized) {
+		log.Printf("Scheduled finalization skipped: competition is %s", state)
+		return
+	}
+
+	if err = f.d.SetState(db.StateFinalized); err != nil {
+		log.Println("Unable to write competition state:", err)
+		return
+	}
+
+	f.sub.Publish(&Event{Type: EventState, Payload: &StatePayload{State: db.StateFinalized}})
+	if state == db.StateFrozen {
+		f.sub.Publish(&Event{Type: EventFreeze, Payload: &FreezePayload{Frozen: false}})
+	}
+}
+
+//run finalizes the competition if it's due and returns when it should next be run
+func (f *Finalizer) run(now time.Time) time.Time {
+	f.mu.Lock()
+	at := f.at
+	due := !at.IsZero() && !at.After(now)
+	if due {
+		f.at = time.Time{}
+		if err := f.d.WriteSetting(finalizeSetting, nil); err != nil {
+			log.Println("Unable to write finalization schedule:", err)
+		}
+	}
+	f.mu.Unlock()
+
+	if !at.IsZero() && !due {
+		return at
+	}
+
+	if due {
+		f.finalize()
+		f.sub.Publish(&Event{Type: EventFinalizeScheduled, Payload: &FinalizeSchedule{}})
+	}
+
+	return now.Add(time.Hour)
+}
+
+func (f *Finalizer) schedule() {
+	for {
+		next := f.run(time.Now())
+		select {
+		case <-time.After(time.Until(next)):
+		case <-f.wake:
+		}
+	}
+}
+
+//Schedule sets the time the competition will be finalized, replacing any earlier schedule.
+//A zero at cancels the scheduled finalization
+func (f *Finalizer) Schedule(at time.Time) error {
+	f.mu.Lock()
+	f.at = at
+	var err error
+	if at.IsZero() {
+		err = f.d.WriteSetting(finalizeSetting, nil)
+	} else {
+		err = f.d.WriteSetting(finalizeSetting, at)
+	}
+	f.mu.Unlock()
+
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+
+	f.sub.Publish(&Event{Type: EventFinalizeScheduled, Payload: f.Scheduled()})
+	return err
+}
+
+//Scheduled returns the scheduled finalization
+func (f *Finalizer) Scheduled() *FinalizeSchedule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := &FinalizeSchedule{At: f.at}
+	if !f.at.IsZero() {
+		s.Remaining = int(time.Until(f.at).Seconds())
+	}
+	return s
+}
+
+func getFinalizeSchedule(f *Finalizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		returnHTTP(w, http.StatusOK, f.Scheduled())
+	}
+}
+
+type finalizeRequest struct {
+	At time.Time `json:"at"`
+}
+
+//putFinalizeSchedule schedules the competition to be finalized at the given time, which must be in the future.
+//If the competition can't be finalized at that time, for example because it's still in setup, it's left unchanged
+func putFinalizeSchedule(sess *MemorySessionStore, f *Finalizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(finalizeRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !req.At.After(time.Now()) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := f.Schedule(req.At); err != nil {
+			log.Println("Unable to write finalization schedule:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, f.Scheduled())
+	}
+}
+
+//deleteFinalizeSchedule cancels the scheduled finalization
+func deleteFinalizeSchedule(sess *MemorySessionStore, f *Finalizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if err := f.Schedule(time.Time{}); err != nil {
+			log.Println("Unable to write finalization schedule:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, f.Scheduled())
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//gatewayNumbersSetting is the db setting key registered gateway phone numbers are stored under
+const gatewayNumbersSetting = "gateway_numbers"
+
+//smsRegexp matches score messages like "T12 R3 85" or "T12 R3 NS" for a no-show. Team and round numbers start at 1
+var smsRegexp = regexp.MustCompile(`(?i)^\s*T\s*(\d+)\s+R\s*(\d+)\s+(-?\d+|NS)\s*$`)
+
+//SMSGateway configures the Twilio SMS webhook.
+//URL is the public webhook URL configured in Twilio; if empty it's derived from the request
+type SMSGateway struct {
+	AuthToken string
+	URL       string
+}
+
+//validSignature returns whether or not the request was signed by Twilio with the gateway's auth token
+func (g *SMSGateway) validSignature(r *http.Request) bool {
+	u := g.URL
+	if u == "" {
+		u = requestURL(r)
+	}
+
+	keys := make([]string, 0, len(r.PostForm))
+	for k := range r.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := []byte(u)
+	for _, k := range keys {
+		for _, v := range r.PostForm[k] {
+			buf = append(buf, k...)
+			buf = append(buf, v...)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(g.AuthToken))
+	mac.Write(buf)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature")))
+}
+
+type twiml struct {
+	XMLName xml.Name `xml:"Response"`
+	Message string   `xml:"Message"`
+}
+
+func replySMS(w http.ResponseWriter, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	if err := xml.NewEncoder(w).Encode(&twiml{Message: fmt.Sprintf(format, a...)}); err != nil {
+		log.Println("Unable to encode TwiML:", err)
+	}
+}
+
+//postSMS receives score messages from the Twilio webhook and submits them as the judge registered to the sending number
+func postSMS(d db.DB, sub *SubscribeService, g *SMSGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g.AuthToken == "" {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !g.validSignature(r) {
+			returnHTTP(w, http.StatusForbidden, nil)
+			return
+		}
+
+		numbers := make(map[string]string)
+		if _, err := d.ReadSetting(gatewayNumbersSetting, &numbers); err != nil {
+			log.Println("Unable to read gateway numbers:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		judge, ok := numbers[r.PostForm.Get("From")]
+		if !ok {
+			replySMS(w, "This number is not registered")
+			return
+		}
+
+		match := smsRegexp.FindStringSubmatch(r.PostForm.Get("Body"))
+		if match == nil {
+			replySMS(w, "Send scores as: T<team> R<round> <score or NS for no-show>, e.g. T12 R3 85")
+			return
+		}
+
+		team, _ := strconv.Atoi(match[1])
+		round, _ := strconv.Atoi(match[2])
+		score := db.Score{State: db.ScoreNoShow}
+		if !strings.EqualFold(match[3], "NS") {
+			value, err := strconv.ParseInt(match[3], 10, 32)
+			if err != nil {
+				replySMS(w, "Invalid score")
+				return
+			}
+			score = db.NewScore(int32(value))
+		}
+
+		if team < 1 || round < 1 {
+			replySMS(w, "Invalid score")
+			return
+		}
+
+		code, err := applyScores(d, sub, "sms:"+judge, 0, []*Draft{{Team: team - 1, Round: round - 1, Score: score}})
+		if err != nil && !isInvalid(err) {
+			log.Println("Unable to submit SMS score:", err)
+		}
+
+		switch code {
+		case http.StatusOK:
+			replySMS(w, "OK: Team %d Round %d = %s", team, round, score)
+		case http.StatusBadRequest:
+			replySMS(w, "Invalid score: %v", err)
+		case http.StatusConflict:
+			replySMS(w, "Scores can't be changed right now or team/round doesn't exist")
+		default:
+			replySMS(w, "Unable to save score; please try again")
+		}
+	}
+}
+
+type gatewayNumbersRequest struct {
+	Numbers map[string]string `json:"numbers"`
+}
+
+func getGatewayNumbers(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		numbers := make(map[string]string)
+		if _, err := d.ReadSetting(gatewayNumbersSetting, &numbers); err != nil {
+			log.Println("Unable to read gateway numbers:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &gatewayNumbersRequest{Numbers: numbers})
+	}
+}
+
+//putGatewayNumbers replaces the registered phone numbers, a map of E.164 phone number to judge name
+func putGatewayNumbers(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(gatewayNumbersRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		for number, judge := range req.Numbers {
+			if !strings.HasPrefix(number, "+") || judge == "" {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		if err := d.WriteSetting(gatewayNumbersSetting, req.Numbers); err != nil {
+			log.Println("Unable to write gateway numbers:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, req)
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//gridCell is a score in the grid: a number if scored, null if unscored, or "no_show"
+type gridCell db.Score
+
+//MarshalJSON fulfills the json.Marshaler interface
+func (g gridCell) MarshalJSON() ([]byte, error) {
+	switch db.Score(g).State {
+	case db.ScoreScored:
+		return json.Marshal(g.Value)
+	case db.ScoreNoShow:
+		return json.Marshal(db.ScoreNoShow)
+	}
+	return []byte("null"), nil
+}
+
+//UnmarshalJSON fulfills the json.Unmarshaler interface
+func (g *gridCell) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var state db.ScoreState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		if state != db.ScoreNoShow {
+			return fmt.Errorf("Unknown score %q: must be a number, null, or %q", state, db.ScoreNoShow)
+		}
+		*g = gridCell{State: db.ScoreNoShow}
+		return nil
+	}
+
+	var s db.Score
+	if err := s.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*g = gridCell(s)
+	return nil
+}
+
+type gridHeader struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Computed bool   `json:"computed,omitempty"`
+	Raw      bool   `json:"raw,omitempty"`
+}
+
+//gridResponse is the score grid: Scores[i][j] is the score of Teams[i] in Rounds[j].
+//Scores are values in units of the competition's Precision, which is null for whole numbers
+type gridResponse struct {
+	Version   string        `json:"version"`
+	Precision *db.Precision `json:"precision"`
+	Teams     []*gridHeader `json:"teams"`
+	Rounds    []*gridHeader `json:"rounds"`
+	Scores    [][]gridCell  `json:"scores"`
+}
+
+//gridRequest sets scores in the grid: Scores[i][j] is the score of the team with ID Teams[i] in the round with ID Rounds[j].
+//Teams and Rounds can be any subset of the competition's teams and rounds. Version must be the version of the grid the scores were entered in
+type gridRequest struct {
+	Version string       `json:"version"`
+	Teams   []string     `json:"teams"`
+	Rounds  []string     `json:"rounds"`
+	Scores  [][]gridCell `json:"scores"`
+}
+
+//gridChangedError is returned with 409 Conflict when the grid is written with a stale version
+var gridChangedError = &jsonError{Code: http.StatusConflict, Description: "The grid has changed since it was read"}
+
+//gridVersion returns the version token of c's grid, its Version, which changes whenever c is written
+func gridVersion(c *db.Competition) string {
+	return strconv.FormatInt(int64(c.Version), 10)
+}
+
+func grid(c *db.Competition) *gridResponse {
+	resp := &gridResponse{
+		Version:   gridVersion(c),
+		Precision: c.Precision,
+		Teams:     make([]*gridHeader, len(c.Teams)),
+		Rounds:    make([]*gridHeader, len(c.Rounds)),
+		Scores:    make([][]gridCell, len(c.Teams)),
+	}
+	for j, r := range c.Rounds {
+		resp.Rounds[j] = &gridHeader{ID: c.RoundIDs[j], Name: r, Computed: c.IsComputed(j), Raw: c.IsRaw(j)}
+	}
+	for i, t := range c.Teams {
+		resp.Teams[i] = &gridHeader{ID: t.ID, Name: t.Name}
+		resp.Scores[i] = make([]gridCell, len(t.Scores))
+		for j, s := range t.Scores {
+			resp.Scores[i][j] = gridCell(s)
+		}
+	}
+	return resp
+}
+
+func getGrid(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if checkSession(w, r, sess, RoleAdmin) == nil {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, grid(c))
+	}
+}
+
+//putGrid sets the scores in the request if the competition hasn't changed since the given version.
+//Only cells that differ from the current grid are applied, and either all of them are applied or none are.
+//The scores are written with the version, so a write after it was checked is a conflict too.
+//Scores keep their custom fields. The new grid is returned
+func putGrid(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		req := new(gridRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Invalid grid: %v", err)})
+			return
+		}
+
+		if req.Version == "" {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "version is required"})
+			return
+		}
+
+		if len(req.Scores) != len(req.Teams) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "scores must have a row for each team"})
+			return
+		}
+		for i, row := range req.Scores {
+			if len(row) != len(req.Rounds) {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("scores row %d must have a score for each round", i)})
+				return
+			}
+		}
+
+		version, err := strconv.ParseInt(req.Version, 10, 32)
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Invalid version %q", req.Version)})
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		if int32(version) != c.Version {
+			returnHTTP(w, http.StatusConflict, gridChangedError)
+			return
+		}
+
+		var drafts []*Draft
+		for i, teamID := range req.Teams {
+			team := c.TeamIndex(teamID)
+			if team < 0 {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Unknown team %s", teamID)})
+				return
+			}
+			for j, roundID := range req.Rounds {
+				round := c.RoundIndex(roundID)
+				if round < 0 {
+					returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Unknown round %s", roundID)})
+					return
+				}
+
+				old := c.Teams[team].Scores[round]
+				score := db.Score(req.Scores[i][j])
+				if scoreEqual(score, old) {
+					continue
+				}
+				score.Fields = old.Fields
+				drafts = append(drafts, &Draft{Team: team, TeamID: teamID, Round: round, RoundID: roundID, Score: score})
+			}
+		}
+
+		if len(drafts) > 0 {
+			code, err := applyScoresAt(d, sub, session.Username, subscriberID(r), drafts, c.Version)
+			if code == http.StatusConflict && err == nil {
+				returnHTTP(w, code, gridChangedError)
+				return
+			}
+			if code != http.StatusOK {
+				returnHTTP(w, code, applyErrorBody(code, err, "Unable to set grid:"))
+				return
+			}
+
+			if c, err = d.Read(); err != nil {
+				log.Println("Unable to read database:", err)
+				returnHTTP(w, http.StatusInternalServerError, nil)
+				return
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, grid(c))
+	}
+}
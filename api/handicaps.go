@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//handicapResponse is a team's handicap and its total before and after the handicap is applied
+type handicapResponse struct {
+	TeamID   string       `json:"team_id"`
+	Name     string       `json:"name"`
+	Handicap *db.Handicap `json:"handicap"`
+	Scored   int32        `json:"scored"`
+	Total    int32        `json:"total"`
+	Rank     int          `json:"rank"`
+}
+
+type handicapsResponse struct {
+	Handicaps []*handicapResponse `json:"handicaps"`
+}
+
+//newHandicapResponse returns the handicap of the team with the given Standing
+func newHandicapResponse(c *db.Competition, s *db.Standing) *handicapResponse {
+	t := c.Teams[s.Team]
+	return &handicapResponse{TeamID: t.ID, Name: t.Name, Handicap: t.Handicap, Scored: s.Total - t.Handicap.Points(), Total: s.Total, Rank: s.Rank}
+}
+
+//getHandicaps returns every team with a handicap in standings order
+func getHandicaps(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		resp := &handicapsResponse{Handicaps: make([]*handicapResponse, 0)}
+		for _, s := range c.Standings() {
+			if c.Teams[s.Team].Handicap != nil {
+				resp.Handicaps = append(resp.Handicaps, newHandicapResponse(c, s))
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//handicapRequest sets a team's handicap. Reason is required
+type handicapRequest struct {
+	Value  int32  `json:"value"`
+	Reason string `json:"reason"`
+}
+
+//setHandicap sets or, if remove is true, removes the handicap of the team given in the path by ID, slug, or index
+func setHandicap(d db.DB, sess *MemorySessionStore, sub *SubscribeService, remove bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !remove && !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		var h *db.Handicap
+		if !remove {
+			req := new(handicapRequest)
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				log.Println("Unable to decode request body:", err)
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+
+			if req.Reason = strings.TrimSpace(req.Reason); req.Reason == "" {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "A reason for the handicap is required"})
+				return
+			}
+			h = &db.Handicap{Value: req.Value, Reason: req.Reason, User: session.Username}
+		}
+
+		old, team := readTeam(w, r, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		c.Teams[team].Handicap = h
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+		if h == nil {
+			log.Printf("Handicap for %s removed by %s", c.Teams[team].Name, session.Username)
+		} else {
+			log.Printf("Handicap for %s set to %d by %s: %s", c.Teams[team].Name, h.Value, session.Username, h.Reason)
+		}
+
+		for _, s := range c.Standings() {
+			if s.Team == team {
+				returnHTTP(w, http.StatusOK, newHandicapResponse(c, s))
+				return
+			}
+		}
+	}
+}
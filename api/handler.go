@@ -1,12 +1,17 @@
 package api
 
 import (
+	"bufio"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"log"
 	"mime"
 	"net/http"
 	"regexp"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -60,25 +65,68 @@ func checkJSON(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
-//checkAuth checks if the given request is authorized in the session store
+//checkSession checks if the given request has a session in the session store with one of the given roles
+//If the request is not authorized checkSession returns nil and writes the error to w
+//Otherwise checkSession returns the Session
+func checkSession(w http.ResponseWriter, r *http.Request, s *MemorySessionStore, roles ...string) *Session {
+	sess := contextSession(r)
+	if sess == nil {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return nil
+		}
+
+		match := authRegexp.FindStringSubmatch(auth)
+		if len(match) != 2 {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return nil
+		}
+
+		if sess = s.Get(match[1]); sess == nil {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return nil
+		}
+	}
+
+	for _, role := range roles {
+		if sess.Role == role && sess.allows(r) {
+			return sess
+		}
+	}
+
+	returnHTTP(w, http.StatusForbidden, nil)
+	return nil
+}
+
+//contextSession returns the Session of the request's Basic credentials or service account token, or nil if there isn't one
+func contextSession(r *http.Request) *Session {
+	if s := basicSession(r); s != nil {
+		return s
+	}
+	return serviceSession(r)
+}
+
+//checkAuth checks if the given request is authorized as an admin in the session store
 //If the request is not authorized checkAuth returns false and writes the error to w
 //Otherwise checkAuth returns true
 func checkAuth(w http.ResponseWriter, r *http.Request, s *MemorySessionStore) bool {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		returnHTTP(w, http.StatusUnauthorized, nil)
-		return false
-	}
+	return checkSession(w, r, s, RoleAdmin) != nil
+}
 
-	match := authRegexp.FindStringSubmatch(auth)
-	if len(match) != 2 {
-		returnHTTP(w, http.StatusBadRequest, nil)
+//checkEditable checks if the competition's state allows changes
+//If it doesn't checkEditable returns false and writes the error to w
+//Otherwise checkEditable returns true
+func checkEditable(w http.ResponseWriter, d db.DB) bool {
+	state, err := d.State()
+	if err != nil {
+		log.Println("Unable to read competition state:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
 		return false
 	}
 
-	id := match[1]
-	if !s.Check(id) {
-		returnHTTP(w, http.StatusUnauthorized, nil)
+	if !state.Editable() {
+		returnHTTP(w, http.StatusConflict, nil)
 		return false
 	}
 
@@ -86,12 +134,22 @@ func checkAuth(w http.ResponseWriter, r *http.Request, s *MemorySessionStore) bo
 }
 
 type authRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	LogoutOthers bool   `json:"logout_others"`
 }
 
 type authResponse struct {
-	SessionID string `json:"session_id"`
+	SessionID    string `json:"session_id"`
+	RefreshToken string `json:"refresh_token"`
+	*Session
+}
+
+//newAuthResponse creates a session for the given user and role and returns the response for it.
+//If logoutOthers is true, the user's other sessions are revoked
+func newAuthResponse(s *MemorySessionStore, username, role string, logoutOthers bool) *authResponse {
+	id, sess, token := s.Create(username, role, logoutOthers)
+	return &authResponse{SessionID: id, RefreshToken: token, Session: sess}
 }
 
 func postAuth(d db.DB, s *MemorySessionStore) http.HandlerFunc {
@@ -109,18 +167,32 @@ func postAuth(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 		}
 
 		status, err := d.Authenticate(a.Username, a.Password)
-		if err != nil {
+		if err != nil && status {
+			log.Println("Unable to rehash password:", err)
+		} else if err != nil {
 			log.Println("Unable to check username/password:", err)
 			returnHTTP(w, http.StatusInternalServerError, nil)
 			return
 		}
 
+		if status {
+			returnHTTP(w, http.StatusOK, newAuthResponse(s, a.Username, RoleAdmin, a.LogoutOthers))
+			return
+		}
+
+		status, err = authenticateJudge(d, a.Username, a.Password)
+		if err != nil {
+			log.Println("Unable to check judge username/password:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
 		if !status {
 			returnHTTP(w, http.StatusUnauthorized, nil)
 			return
 		}
 
-		returnHTTP(w, http.StatusOK, &authResponse{SessionID: s.Create()})
+		returnHTTP(w, http.StatusOK, newAuthResponse(s, a.Username, RoleJudge, a.LogoutOthers))
 	}
 }
 
@@ -130,7 +202,7 @@ func putAuth(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 			return
 		}
 
-		if !checkAuth(w, r, s) {
+		if !checkLoginAdmin(w, r, s) {
 			return
 		}
 
@@ -142,7 +214,7 @@ func putAuth(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 			return
 		}
 
-		err := d.UpdateCredentials(c.Username, c.Password)
+		err := actorDB(d, r, s).UpdateCredentials(c.Username, c.Password)
 		if err != nil {
 			log.Println("Unable to update credentials:", err)
 			returnHTTP(w, http.StatusInternalServerError, nil)
@@ -153,8 +225,73 @@ func putAuth(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 	}
 }
 
-func getCompetition(d db.DB) http.HandlerFunc {
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+//postAuthRefresh exchanges a refresh token for a new session and refresh token
+func postAuthRefresh(s *MemorySessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(refreshRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		id, sess, token := s.Refresh(req.RefreshToken)
+		if id == "" {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &authResponse{SessionID: id, RefreshToken: token, Session: sess})
+	}
+}
+
+//deleteAuth revokes the request's session and every session and refresh token from the same login
+func deleteAuth(s *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if checkSession(w, r, s, RoleAdmin, RoleJudge) == nil {
+			return
+		}
+
+		//service account tokens aren't sessions and are revoked by deleting the account
+		match := authRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+		if len(match) != 2 {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		s.Revoke(match[1])
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+//getAuth returns the session for the request's session ID
+func getAuth(s *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess := checkSession(w, r, s, RoleAdmin, RoleJudge)
+		if sess == nil {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, sess)
+	}
+}
+
+func getCompetition(d db.DB, sess *MemorySessionStore, limiter *ConnectionLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
 		c, err := d.Read()
 		if err != nil {
 			log.Println("Unable to read database:", err)
@@ -167,7 +304,14 @@ func getCompetition(d db.DB) http.HandlerFunc {
 			return
 		}
 
-		returnHTTP(w, http.StatusOK, c)
+		if tags := requestTags(r); len(tags) > 0 {
+			c = c.WithTags(tags...)
+		}
+
+		hints := clientHints(limiter, remoteIP(r))
+		w.Header().Set("X-Poll-Interval", strconv.Itoa(hints.PollInterval))
+		w.Header().Set("Cache-Control", "no-cache")
+		streamCompetition(w, http.StatusOK, c, jsonField{Name: "hints", Value: hints})
 	}
 }
 
@@ -181,40 +325,175 @@ type createRequest struct {
 
 type createResponse struct {
 	Competition *db.Competition `json:"competition"`
-	SessionID   string          `json:"session_id"`
+	*authResponse
 }
 
-func createCompetition(w http.ResponseWriter, r *http.Request, d db.DB, s *MemorySessionStore) {
-	c := new(createRequest)
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(c); err != nil {
-		log.Println("Unable to decode request body:", err)
-		returnHTTP(w, http.StatusBadRequest, nil)
-		return
-	}
+//checkSetupToken returns whether or not the request has the given setup token in the X-Setup-Token header.
+//checkSetupToken returns false if token is empty
+func checkSetupToken(r *http.Request, token string) bool {
+	given := r.Header.Get("X-Setup-Token")
+	return token != "" && given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
 
-	err := d.Init(c.Name, c.Rounds, c.Teams, c.Username, c.Password)
-	if err != nil {
-		log.Println("Unable to init database:", err)
-		returnHTTP(w, http.StatusInternalServerError, nil)
-		return
-	}
+//postCompetition creates the competition if it doesn't exist.
+//The request must be from an admin or have the setup token, which is only accepted before the competition is created.
+//The username and password set the admin credentials and are required if the request isn't from an admin
+func postCompetition(d db.DB, s *MemorySessionStore, setupToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
 
-	comp, err := d.Read()
-	if err != nil {
-		log.Println("Unable to read database:", err)
-		returnHTTP(w, http.StatusInternalServerError, nil)
-		return
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if old != nil {
+			returnHTTP(w, http.StatusConflict, nil)
+			return
+		}
+
+		var session *Session
+		if !checkSetupToken(r, setupToken) {
+			if session = checkSession(w, r, s, RoleAdmin); session == nil {
+				return
+			}
+		}
+
+		c := new(createRequest)
+		dec := json.NewDecoder(r.Body)
+		if err = dec.Decode(c); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		teams := &db.Competition{Teams: make([]*db.Team, 0, len(c.Teams))}
+		for _, name := range c.Teams {
+			teams.Teams = append(teams.Teams, &db.Team{Name: name})
+		}
+		if !checkDuplicates(w, r, nil, teams) {
+			return
+		}
+
+		//username and password must be given together, and are required without an admin session
+		if (c.Username == "") != (c.Password == "") || (c.Username == "" && session == nil) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		err = d.Init(c.Name, c.Rounds, c.Teams, c.Username, c.Password)
+		if err != nil {
+			log.Println("Unable to init database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		comp, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		username := c.Username
+		if username == "" {
+			username = session.Username
+		}
+
+		returnHTTP(w, http.StatusCreated, &createResponse{Competition: comp, authResponse: newAuthResponse(s, username, RoleAdmin, false)})
 	}
+}
+
+//staleError is returned with 409 Conflict when a competition is written with a stale Version
+var staleError = &jsonError{Code: http.StatusConflict, Description: "The competition has changed since it was read"}
 
-	returnHTTP(w, http.StatusCreated, &createResponse{Competition: comp, SessionID: s.Create()})
+//versionResponse is the new Version of a written competition
+type versionResponse struct {
+	Version int32 `json:"version"`
 }
 
+//putRequest replaces the competition. Competition.Version must be the Version of the competition it was changed from
 type putRequest struct {
 	Competition *db.Competition `json:"competition"`
 	ID          int             `json:"id"`
 }
 
+//inheritRoundIDs returns the IDs of c's rounds from old for a client that doesn't send them.
+//A round keeps the ID of the old round with the same name, or if no rounds were added or removed, the ID of the old round in its place
+func inheritRoundIDs(old, c *db.Competition) []string {
+	ids := make([]string, len(c.Rounds))
+	used := make(map[string]bool)
+	for i, name := range c.Rounds {
+		for j, oldName := range old.Rounds {
+			if oldName == name && j < len(old.RoundIDs) && !used[old.RoundIDs[j]] {
+				ids[i] = old.RoundIDs[j]
+				used[ids[i]] = true
+				break
+			}
+		}
+	}
+
+	if len(c.Rounds) != len(old.Rounds) {
+		return ids
+	}
+
+	for i := range ids {
+		if ids[i] == "" && i < len(old.RoundIDs) && !used[old.RoundIDs[i]] {
+			ids[i] = old.RoundIDs[i]
+			used[ids[i]] = true
+		}
+	}
+
+	return ids
+}
+
+//inheritTeamIDs gives each of c's teams without an ID the ID of the old team with the same name
+func inheritTeamIDs(old, c *db.Competition) {
+	used := make(map[string]bool)
+	for _, t := range c.Teams {
+		if t.ID != "" {
+			used[t.ID] = true
+		}
+	}
+
+	for _, t := range c.Teams {
+		if t.ID != "" {
+			continue
+		}
+		for _, o := range old.Teams {
+			if o.Name == t.Name && !used[o.ID] {
+				t.ID = o.ID
+				used[o.ID] = true
+				break
+			}
+		}
+	}
+}
+
+//checkTeams writes 400 Bad Request and returns false if c has a null team or a team without exactly one score for each round
+func checkTeams(w http.ResponseWriter, c *db.Competition) bool {
+	if c == nil {
+		return true
+	}
+
+	for i, t := range c.Teams {
+		if t == nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("team %d is null", i)})
+			return false
+		}
+		if len(t.Scores) != len(c.Rounds) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("team %s must have a score for each round", t.Name)})
+			return false
+		}
+	}
+
+	return true
+}
+
 func putCompetition(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !checkJSON(w, r) {
@@ -229,11 +508,16 @@ func putCompetition(d db.DB, sess *MemorySessionStore, sub *SubscribeService) ht
 		}
 
 		if oldComp == nil {
-			createCompetition(w, r, d, sess)
+			returnHTTP(w, http.StatusNotFound, nil)
 			return
 		}
 
-		if !checkAuth(w, r, sess) {
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
 			return
 		}
 
@@ -245,56 +529,140 @@ func putCompetition(d db.DB, sess *MemorySessionStore, sub *SubscribeService) ht
 			return
 		}
 
-		err = d.Write(req.Competition)
+		if !checkTeams(w, req.Competition) {
+			return
+		}
+
+		if req.Competition != nil && req.Competition.RoundIDs != nil && len(req.Competition.RoundIDs) != len(req.Competition.Rounds) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "round_ids must have an ID for each round"})
+			return
+		}
+
+		//preserve round IDs, team logos, IDs, custom fields, rosters, handicaps, tags, and computed rounds for clients that don't send them
+		if req.Competition != nil {
+			if req.Competition.RoundIDs == nil {
+				req.Competition.RoundIDs = inheritRoundIDs(oldComp, req.Competition)
+			}
+			inheritTeamIDs(oldComp, req.Competition)
+			for _, t := range req.Competition.Teams {
+				i := oldComp.TeamIndex(t.ID)
+				if t.ID == "" || i == -1 {
+					continue
+				}
+				old := oldComp.Teams[i]
+				if t.Logo == "" && old.Name == t.Name {
+					t.Logo = old.Logo
+				}
+				if t.Fields == nil {
+					t.Fields = old.Fields
+				}
+				if t.Roster == nil {
+					t.Roster = old.Roster
+				}
+				if t.Handicap == nil {
+					t.Handicap = old.Handicap
+				}
+				if t.Tags == nil {
+					t.Tags = old.Tags
+				}
+				for j, s := range t.Scores {
+					k := oldComp.RoundIndex(req.Competition.RoundIDs[j])
+					//v1 sends no-shows back as 0
+					if isV1(r) && s.Scored() && s.Value == 0 && k != -1 && k < len(old.Scores) && old.Scores[k].State == db.ScoreNoShow {
+						t.Scores[j] = old.Scores[k]
+						continue
+					}
+					if s.Fields == nil && k != -1 && k < len(old.Scores) && scoreEqual(s, old.Scores[k]) {
+						t.Scores[j].Fields = old.Scores[k].Fields
+					}
+				}
+			}
+			if req.Competition.Precision == nil {
+				req.Competition.Precision = oldComp.Precision
+			}
+			if req.Competition.Computed == nil {
+				req.Competition.Computed = oldComp.Computed
+			}
+		}
+
+		if !checkDuplicates(w, r, oldComp, req.Competition) {
+			return
+		}
+
+		if req.Competition != nil {
+			req.Competition.AssignIDs()
+			if err = compute(req.Competition); err == nil {
+				err = checkLocked(d, req.Competition, changedScores(oldComp, req.Competition))
+			}
+			if err == nil {
+				err = checkRules(d, req.Competition, changedScores(oldComp, req.Competition))
+			}
+			if err == nil {
+				err = checkCompetitionFields(d, oldComp, req.Competition)
+			}
+			if err != nil {
+				returnInvalid(w, err)
+				return
+			}
+		}
+
+		err = actorDB(d, r, sess).Write(req.Competition)
+		if err == db.ErrStaleVersion {
+			returnHTTP(w, http.StatusConflict, staleError)
+			return
+		}
 		if err != nil {
 			log.Println("Unable to write database:", err)
 			returnHTTP(w, http.StatusInternalServerError, nil)
 			return
 		}
+		committed := time.Now()
 
-		returnHTTP(w, http.StatusOK, nil)
-		sub.Notify(req.ID)
+		events := competitionEvents(req.ID, oldComp, req.Competition)
+		if err = attribute(d, session.Username, events); err != nil {
+			log.Println("Unable to write score attributions:", err)
+		}
+
+		if req.Competition != nil {
+			returnHTTP(w, http.StatusOK, &versionResponse{Version: req.Competition.Version})
+		} else {
+			returnHTTP(w, http.StatusOK, nil)
+		}
+		sub.PublishCommitted(committed, events...)
+		sub.NotifyCommitted(committed, req.ID)
 	}
 }
 
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+	EnableCompression: true,
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-type subscribeResponse struct {
-	Type string `json:"type"`
-	ID   int    `json:"id"`
-}
-
-func subscribeCompetition(s *SubscribeService) http.HandlerFunc {
+func subscribeCompetition(d db.DB, s *SubscribeService, l *ConnectionLimiter, shaper *Shaper, stats *Stats) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println("Unable to start WebSocket connection:", err)
+		ip := remoteIP(r)
+		if !l.Acquire(ip) {
+			atomic.AddUint64(&stats.wsRejected, 1)
+			w.Header().Set("Retry-After", "30")
+			returnHTTP(w, http.StatusServiceUnavailable, nil)
 			return
 		}
+		defer l.Release(ip)
 
-		myID, sub := s.Subscribe()
-		err = conn.WriteJSON(subscribeResponse{Type: "connect", ID: myID})
+		conn, err := upgrader.Upgrade(&countingHijacker{ResponseWriter: w, count: &stats.wsWireBytes}, r, nil)
 		if err != nil {
-			log.Println("Unable to write WebSocket message:", err)
-			s.Unsubscribe(myID)
+			log.Println("Unable to start WebSocket connection:", err)
 			return
 		}
 
-		for {
-			id := <-sub
-			err = conn.WriteJSON(subscribeResponse{Type: "update", ID: id})
-			if err != nil {
-				log.Println("Unable to write WebSocket message:", err)
-				s.Unsubscribe(myID)
-				return
-			}
-		}
+		c := newSubscriberConn(conn, r.RemoteAddr, d, s, stats, shaper)
+		c.chaos = requestChaos(r)
+		c.v1 = isV1(r)
+		c.serve()
 	}
 }
 
@@ -308,14 +676,38 @@ func getRevisions(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 			return
 		}
 
-		rev, err := d.Revisions()
+		//revisions are streamed, so errors after the first revision is written can only be logged
+		bw := bufio.NewWriter(w)
+		count := 0
+		err := d.WalkRevisions(func(rev *db.Revision) error {
+			if count == 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				bw.WriteString(`{"revisions":[`)
+			} else {
+				bw.WriteByte(',')
+			}
+			count++
+			return marshalTo(bw, rev)
+		})
+
 		if err != nil {
 			log.Println("Unable to read database revisions:", err)
-			returnHTTP(w, http.StatusInternalServerError, nil)
+			if count == 0 {
+				returnHTTP(w, http.StatusInternalServerError, nil)
+			}
 			return
 		}
 
-		returnHTTP(w, http.StatusOK, &revisionsRequest{Revisions: rev})
+		if count == 0 {
+			returnHTTP(w, http.StatusOK, &revisionsRequest{Revisions: []*db.Revision{}})
+			return
+		}
+
+		bw.WriteString("]}\n")
+		if err = bw.Flush(); err != nil {
+			log.Println("Unable to write revisions:", err)
+		}
 	}
 }
 
@@ -339,6 +731,252 @@ func getRevision(d db.DB, s *MemorySessionStore) http.HandlerFunc {
 			return
 		}
 
-		returnHTTP(w, http.StatusOK, rev)
+		if rev == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		//revisions never change
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		streamRevision(w, http.StatusOK, rev)
+	}
+}
+
+//getRevisionDiff returns the difference between the revisions given in the path
+func getRevisionDiff(d db.DB, s *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, s) {
+			return
+		}
+
+		a, err := strconv.Atoi(mux.Vars(r)["a"])
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		b, err := strconv.Atoi(mux.Vars(r)["b"])
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		diff, err := d.DiffRevisions(int32(a), int32(b))
+		if err != nil {
+			log.Printf("Unable to compare database revisions %d and %d: %v", a, b, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if diff == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		//revisions never change
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		returnHTTP(w, http.StatusOK, diff)
+	}
+}
+
+//maxCompareRevisions is the most revisions that can be compared at once by getRevisionCompare
+const maxCompareRevisions = 1000
+
+//getRevisionCompare returns the aggregate difference across the revisions between the from and to query parameters
+func getRevisionCompare(d db.DB, s *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, s) {
+			return
+		}
+
+		from, err := strconv.Atoi(r.URL.Query().Get("from"))
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		to, err := strconv.Atoi(r.URL.Query().Get("to"))
+		if err != nil || to < from {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if to-from > maxCompareRevisions {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("At most %d revisions can be compared at once", maxCompareRevisions)})
+			return
+		}
+
+		diff, err := db.CompareRevisionRange(d, int32(from), int32(to))
+		if err != nil {
+			log.Printf("Unable to compare database revisions %d through %d: %v", from, to, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if diff == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		//revisions never change
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		returnHTTP(w, http.StatusOK, diff)
+	}
+}
+
+//postRestoreRevision replaces the competition with the revision given in the path, storing the current competition as a new revision
+func postRestoreRevision(d db.DB, s *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, s) {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		c, err := actorDB(d, r, s).RestoreRevision(int32(id))
+		if err != nil {
+			log.Printf("Unable to restore database revision %d: %v", id, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+		committed := time.Now()
+
+		streamCompetition(w, http.StatusOK, c)
+
+		subID := subscriberID(r)
+		if old != nil {
+			sub.PublishCommitted(committed, competitionEvents(subID, old, c)...)
+		}
+		sub.NotifyCommitted(committed, subID)
+	}
+}
+
+type stateRequest struct {
+	State db.State `json:"state"`
+	ID    int      `json:"id"`
+}
+
+type stateResponse struct {
+	State db.State `json:"state"`
+}
+
+func getState(d db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &stateResponse{State: state})
+	}
+}
+
+func putState(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(stateRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !req.State.Valid() {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if !state.CanTransition(req.State) {
+			returnHTTP(w, http.StatusConflict, nil)
+			return
+		}
+
+		if err = d.SetState(req.State); err != nil {
+			log.Println("Unable to write competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &stateResponse{State: req.State})
+		sub.Publish(&Event{Type: EventState, ID: req.ID, Payload: &StatePayload{State: req.State}})
+		if state == db.StateFrozen || req.State == db.StateFrozen {
+			sub.Publish(&Event{Type: EventFreeze, ID: req.ID, Payload: &FreezePayload{Frozen: req.State == db.StateFrozen}})
+		}
+	}
+}
+
+type timerRequest struct {
+	Seconds int `json:"seconds"`
+	ID      int `json:"id"`
+}
+
+//putTimer starts a countdown of the given number of seconds, or stops the countdown if seconds is 0
+func putTimer(sess *MemorySessionStore, t *Timer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(timerRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if req.Seconds < 0 {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if req.Seconds == 0 {
+			t.Stop()
+		} else {
+			t.Start(req.ID, time.Duration(req.Seconds)*time.Second)
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
 	}
 }
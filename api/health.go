@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Health statuses
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+//HealthDetails explains a Health status. Database is the error reading the competition, if there was one.
+//Recovery is set if the competition couldn't be read at startup and was restored from a revision, until it's cleared with DELETE /admin/recovery.
+//StorageAlert is set while writes are failing because the disk is full or the filesystem is read-only
+type HealthDetails struct {
+	Database     string           `json:"database,omitempty"`
+	Recovery     *db.Recovery     `json:"recovery,omitempty"`
+	StorageAlert *db.StorageAlert `json:"storage_alert,omitempty"`
+}
+
+//Health is the response of the health check
+type Health struct {
+	Status  string         `json:"status"`
+	Details *HealthDetails `json:"details"`
+}
+
+//HealthHandler returns a health check for d. It responds 503 Service Unavailable if the competition can't be read
+//and reports a degraded status if the competition was recovered or writes are failing
+func HealthHandler(d db.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := &Health{Status: HealthOK, Details: new(HealthDetails)}
+
+		if _, err := d.Read(); err != nil {
+			h.Status, h.Details.Database = HealthDown, err.Error()
+			returnHTTP(w, http.StatusServiceUnavailable, h)
+			return
+		}
+
+		recovery := new(db.Recovery)
+		ok, err := d.ReadSetting(db.RecoverySetting, recovery)
+		if err != nil {
+			log.Println("Unable to read recovery:", err)
+		} else if ok {
+			h.Status, h.Details.Recovery = HealthDegraded, recovery
+		}
+
+		if s, ok := d.(db.Storage); ok {
+			if alert := s.StorageAlert(); alert != nil {
+				h.Status, h.Details.StorageAlert = HealthDegraded, alert
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, h)
+	})
+}
+
+//deleteRecovery clears the Recovery reported by the health check once it's been reviewed
+func deleteRecovery(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if err := d.WriteSetting(db.RecoverySetting, nil); err != nil {
+			log.Println("Unable to clear recovery:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
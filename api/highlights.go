@@ -0,0 +1,235 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Highlight types
+const (
+	HighlightLeadChange = "lead_change"
+	HighlightMover      = "mover"
+)
+
+//moverThreshold is the fewest places a team must move in a single update to be a mover
+const moverThreshold = 2
+
+//highlightHistory is the number of highlights kept for GET requests
+const highlightHistory = 100
+
+//Highlight is a notable change in the standings, and is the Payload of EventLeadChange and EventMover Events.
+//Delta is the number of places the team moved, positive if it moved up.
+//For a lead change, Team is the new leader and PreviousLeader is the team that lost the lead, if there was one
+type Highlight struct {
+	Seq                int       `json:"seq"`
+	Type               string    `json:"type"`
+	Team               int       `json:"team"`
+	TeamID             string    `json:"team_id"`
+	Name               string    `json:"name"`
+	Rank               int       `json:"rank"`
+	PreviousRank       int       `json:"previous_rank,omitempty"`
+	Delta              int       `json:"delta"`
+	Total              int32     `json:"total"`
+	PreviousLeaderID   string    `json:"previous_leader_id,omitempty"`
+	PreviousLeaderName string    `json:"previous_leader_name,omitempty"`
+	Time               time.Time `json:"time"`
+}
+
+//HighlightService publishes Highlights when the competition is updated
+type HighlightService struct {
+	d   db.DB
+	sub *SubscribeService
+
+	//previous holds the standings of the last update by team ID
+	previous   map[string]*db.Standing
+	leader     string
+	highlights []*Highlight
+	lastSeq    int
+	mu         *sync.Mutex
+}
+
+//NewHighlightService returns a new HighlightService and starts watching for updates
+func NewHighlightService(d db.DB, sub *SubscribeService) *HighlightService {
+	h := &HighlightService{d: d, sub: sub, previous: make(map[string]*db.Standing), mu: new(sync.Mutex)}
+
+	c, err := d.Read()
+	if err != nil {
+		log.Println("Unable to read database:", err)
+	}
+	if c != nil {
+		h.previous, h.leader = standingsByID(c)
+	}
+
+	go h.watch()
+
+	return h
+}
+
+//standingsByID returns c's standings keyed by team ID and the ID of the leader, if there is one
+func standingsByID(c *db.Competition) (map[string]*db.Standing, string) {
+	standings := c.Standings()
+	byID := make(map[string]*db.Standing, len(standings))
+	for _, s := range standings {
+		byID[c.Teams[s.Team].ID] = s
+	}
+
+	var leader string
+	if l := db.Leader(standings); l != nil {
+		leader = c.Teams[l.Team].ID
+	}
+
+	return byID, leader
+}
+
+func (h *HighlightService) watch() {
+	for {
+		_, events := h.sub.Subscribe()
+		for e := range events {
+			if e.Type == EventUpdate {
+				h.update(e.ID)
+			}
+		}
+	}
+}
+
+//update compares the current standings with the previous standings and publishes Highlights for a lead change and movers,
+//biggest moves first
+func (h *HighlightService) update(id int) {
+	c, err := h.d.Read()
+	if err != nil {
+		log.Println("Unable to read database:", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	standings, leader := standingsByID(c)
+
+	h.mu.Lock()
+	previous, previousLeader := h.previous, h.leader
+	h.previous, h.leader = standings, leader
+	h.mu.Unlock()
+
+	var highlights []*Highlight
+	now := time.Now()
+
+	if leader != "" && leader != previousLeader {
+		s := standings[leader]
+		hl := &Highlight{Type: HighlightLeadChange, Team: s.Team, TeamID: leader, Name: s.Name, Rank: s.Rank, Total: s.Total, Time: now}
+		if p, ok := previous[leader]; ok {
+			hl.PreviousRank, hl.Delta = p.Rank, p.Rank-s.Rank
+		}
+		if p, ok := previous[previousLeader]; ok {
+			hl.PreviousLeaderID, hl.PreviousLeaderName = previousLeader, p.Name
+		}
+		highlights = append(highlights, hl)
+	}
+
+	var movers []*Highlight
+	for teamID, s := range standings {
+		p, ok := previous[teamID]
+		if !ok || (s.Total == 0 && p.Total == 0) {
+			continue
+		}
+		if delta := p.Rank - s.Rank; delta >= moverThreshold || delta <= -moverThreshold {
+			movers = append(movers, &Highlight{
+				Type: HighlightMover, Team: s.Team, TeamID: teamID, Name: s.Name,
+				Rank: s.Rank, PreviousRank: p.Rank, Delta: delta, Total: s.Total, Time: now,
+			})
+		}
+	}
+	sort.Slice(movers, func(i, j int) bool {
+		di, dj := movers[i].Delta, movers[j].Delta
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		if di != dj {
+			return di > dj
+		}
+		return movers[i].Rank < movers[j].Rank
+	})
+	highlights = append(highlights, movers...)
+
+	for _, hl := range highlights {
+		h.add(id, hl)
+	}
+}
+
+func (h *HighlightService) add(id int, hl *Highlight) {
+	h.mu.Lock()
+	h.lastSeq++
+	hl.Seq = h.lastSeq
+	h.highlights = append(h.highlights, hl)
+	if len(h.highlights) > highlightHistory {
+		h.highlights = h.highlights[len(h.highlights)-highlightHistory:]
+	}
+	h.mu.Unlock()
+
+	typ := EventMover
+	if hl.Type == HighlightLeadChange {
+		typ = EventLeadChange
+	}
+	h.sub.Publish(&Event{Type: typ, ID: id, Payload: hl})
+}
+
+//Since returns the Highlights with a Seq greater than seq
+func (h *HighlightService) Since(seq int) []*Highlight {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	highlights := make([]*Highlight, 0)
+	for _, hl := range h.highlights {
+		if hl.Seq > seq {
+			highlights = append(highlights, hl)
+		}
+	}
+	return highlights
+}
+
+type highlightsResponse struct {
+	Highlights []*Highlight `json:"highlights"`
+}
+
+//getHighlights returns the highlights after the since query parameter, optionally only of the given type
+func getHighlights(h *HighlightService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since int
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = strconv.Atoi(s); err != nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		typ := r.URL.Query().Get("type")
+		if typ != "" && typ != HighlightLeadChange && typ != HighlightMover {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("type must be %s or %s", HighlightLeadChange, HighlightMover)})
+			return
+		}
+
+		highlights := h.Since(since)
+		if typ != "" {
+			filtered := make([]*Highlight, 0, len(highlights))
+			for _, hl := range highlights {
+				if hl.Type == typ {
+					filtered = append(filtered, hl)
+				}
+			}
+			highlights = filtered
+		}
+
+		returnHTTP(w, http.StatusOK, &highlightsResponse{Highlights: highlights})
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import "math"
+
+//poll intervals suggested to clients, in seconds
+const (
+	minPollInterval = 5
+	maxPollInterval = 60
+)
+
+//ClientHints tell display clients how to stay up to date without overloading the server.
+//Clients should subscribe if WebSocket is true, and otherwise poll every PollInterval seconds
+type ClientHints struct {
+	PollInterval int     `json:"poll_interval"`
+	WebSocket    bool    `json:"websocket"`
+	Load         float64 `json:"load"`
+}
+
+//clientHints returns the ClientHints for a client at the given IP address.
+//The suggested poll interval grows with the fraction of subscriber connections in use
+func clientHints(l *ConnectionLimiter, ip string) *ClientHints {
+	load := l.Load()
+	return &ClientHints{
+		PollInterval: minPollInterval + int(math.Round(load*load*(maxPollInterval-minPollInterval))),
+		WebSocket:    l.Available(ip),
+		Load:         math.Round(load*100) / 100,
+	}
+}
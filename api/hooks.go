@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//hookRevisionsLimit is the most revisions returned by a single poll
+const hookRevisionsLimit = 50
+
+type hookRevision struct {
+	ID        int32  `json:"id"`
+	Timestamp string `json:"timestamp"`
+}
+
+type hookRevisionsResponse struct {
+	Revisions []*hookRevision `json:"revisions"`
+	Cursor    int32           `json:"cursor"`
+}
+
+//getHookRevisions returns the revisions newer than the cursor query parameter, newest first, for polling triggers
+func getHookRevisions(d db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if checkAPIKey(w, r, d) == nil {
+			return
+		}
+
+		cursor := int32(-1)
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			i, err := strconv.ParseInt(c, 10, 32)
+			if err != nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+			cursor = int32(i)
+		}
+
+		resp := &hookRevisionsResponse{Revisions: make([]*hookRevision, 0), Cursor: cursor}
+		err := d.WalkRevisions(func(rev *db.Revision) error {
+			if rev.ID > cursor {
+				resp.Revisions = append(resp.Revisions, &hookRevision{ID: rev.ID, Timestamp: rev.Timestamp.UTC().Format("2006-01-02T15:04:05Z")})
+			}
+			if rev.ID > resp.Cursor {
+				resp.Cursor = rev.ID
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println("Unable to read database revisions:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		sort.Slice(resp.Revisions, func(i, j int) bool { return resp.Revisions[i].ID > resp.Revisions[j].ID })
+		if len(resp.Revisions) > hookRevisionsLimit {
+			resp.Revisions = resp.Revisions[:hookRevisionsLimit]
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//hookScoreRequest sets a score. Team and Round are IDs, names, or numbers starting at 1. A null Score clears the score
+type hookScoreRequest struct {
+	Team  interface{} `json:"team"`
+	Round interface{} `json:"round"`
+	Score db.Score    `json:"score"`
+}
+
+//postHookScore sets a single score for no-code integrations
+func postHookScore(d db.DB, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		key := checkAPIKey(w, r, d)
+		if key == nil {
+			return
+		}
+
+		req := new(hookScoreRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		teams, teamIDs := make([]string, len(c.Teams)), make([]string, len(c.Teams))
+		for i, t := range c.Teams {
+			teams[i], teamIDs[i] = t.Name, t.ID
+		}
+
+		team, err := lookup(numberOrString(req.Team), teams, teamIDs)
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "team " + err.Error()})
+			return
+		}
+
+		round, err := lookup(numberOrString(req.Round), c.Rounds, c.RoundIDs)
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "round " + err.Error()})
+			return
+		}
+
+		code, err := applyScores(d, sub, "apikey:"+key.Name, 0, []*Draft{{Team: team, Round: round, Score: req.Score}})
+		returnHTTP(w, code, applyErrorBody(code, err, "Unable to set score:"))
+	}
+}
+
+//numberOrString converts numeric strings to numbers, since no-code platforms often send every value as a string
+func numberOrString(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if i, err := strconv.Atoi(s); err == nil {
+			return float64(i)
+		}
+	}
+	return v
+}
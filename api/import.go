@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/importer"
+)
+
+//importCompetition replaces the competition with one built from the request body.
+//The format query parameter selects the importer and the optional name query parameter sets the competition name
+func importCompetition(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if old == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = old.Name
+		}
+
+		var c *db.Competition
+		switch r.URL.Query().Get("format") {
+		case "vex", "ftc", "matches":
+			c, err = importer.MatchResults(name, r.Body)
+		default:
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err != nil {
+			log.Println("Unable to import competition:", err)
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+
+		if !checkDuplicates(w, r, nil, c) {
+			return
+		}
+
+		//the import replaces the competition, whatever it was changed to
+		c.Version = old.Version
+		if err = actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		returnHTTP(w, http.StatusOK, c)
+		sub.NotifyCommitted(committed, 0)
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/importer"
+)
+
+//ingestSetting is the db setting key ingestion systems are stored under
+const ingestSetting = "ingest"
+
+//IngestSystem maps results pushed by an external scoring system to score updates.
+//Items is the JSONPath of the array of results in the request body ($ if the body is the array).
+//Team, Round, and Score are the JSONPaths of the values within each result.
+//Teams and rounds are matched by name if the value is a string, or by number (starting at 1) if it's a number
+type IngestSystem struct {
+	Token string `json:"token"`
+	Items string `json:"items"`
+	Team  string `json:"team"`
+	Round string `json:"round"`
+	Score string `json:"score"`
+}
+
+func readIngestSystems(d db.DB) (map[string]*IngestSystem, error) {
+	systems := make(map[string]*IngestSystem)
+	_, err := d.ReadSetting(ingestSetting, &systems)
+	return systems, err
+}
+
+//lookup returns the index of the value in names: by ID or name if v is a string, or by number if it's a number
+func lookup(v interface{}, names, ids []string) (int, error) {
+	switch val := v.(type) {
+	case string:
+		for i, id := range ids {
+			if id == strings.TrimSpace(val) {
+				return i, nil
+			}
+		}
+		for i, name := range names {
+			if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(val)) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%s not found", val)
+	case float64:
+		i := int(val)
+		if float64(i) != val || i < 1 || i > len(names) {
+			return 0, fmt.Errorf("%v out of range", val)
+		}
+		return i - 1, nil
+	}
+	return 0, fmt.Errorf("unexpected value %v", v)
+}
+
+//scores maps the decoded body to scores for c
+func (s *IngestSystem) scores(body interface{}, c *db.Competition) ([]*Draft, error) {
+	items, err := importer.JSONPath(body, s.Items)
+	if err != nil {
+		return nil, fmt.Errorf("items: %v", err)
+	}
+
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("items is not an array")
+	}
+
+	teams, teamIDs := make([]string, len(c.Teams)), make([]string, len(c.Teams))
+	for i, t := range c.Teams {
+		teams[i], teamIDs[i] = t.Name, t.ID
+	}
+
+	scores := make([]*Draft, 0, len(list))
+	for i, item := range list {
+		teamVal, err := importer.JSONPath(item, s.Team)
+		if err != nil {
+			return nil, fmt.Errorf("item %d team: %v", i, err)
+		}
+		team, err := lookup(teamVal, teams, teamIDs)
+		if err != nil {
+			return nil, fmt.Errorf("item %d team: %v", i, err)
+		}
+
+		roundVal, err := importer.JSONPath(item, s.Round)
+		if err != nil {
+			return nil, fmt.Errorf("item %d round: %v", i, err)
+		}
+		round, err := lookup(roundVal, c.Rounds, c.RoundIDs)
+		if err != nil {
+			return nil, fmt.Errorf("item %d round: %v", i, err)
+		}
+
+		scoreVal, err := importer.JSONPath(item, s.Score)
+		if err != nil {
+			return nil, fmt.Errorf("item %d score: %v", i, err)
+		}
+
+		var score db.Score
+		switch val := scoreVal.(type) {
+		case nil:
+		case float64:
+			if val > math.MaxInt32 || val < math.MinInt32 {
+				return nil, fmt.Errorf("item %d score: %v out of range", i, val)
+			}
+			score = db.NewScore(int32(math.Round(val)))
+		case string:
+			v, err := strconv.ParseInt(strings.TrimSpace(val), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("item %d score: %v", i, err)
+			}
+			score = db.NewScore(int32(v))
+		default:
+			return nil, fmt.Errorf("item %d score: unexpected value %v", i, val)
+		}
+
+		scores = append(scores, &Draft{Team: team, Round: round, Score: score})
+	}
+
+	return scores, nil
+}
+
+//postIngest applies results pushed by the external system named in the path, authenticated with the system's Bearer token
+func postIngest(d db.DB, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		systems, err := readIngestSystems(d)
+		if err != nil {
+			log.Println("Unable to read ingest systems:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		name := mux.Vars(r)["system"]
+		system, ok := systems[name]
+		if !ok {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return
+		}
+
+		if !checkControl(w, r, []string{system.Token}) {
+			return
+		}
+
+		var body interface{}
+		dec := json.NewDecoder(r.Body)
+		if err = dec.Decode(&body); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		scores, err := system.scores(body, c)
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+
+		code, err := applyScores(d, sub, "external:"+name, 0, scores)
+		returnHTTP(w, code, applyErrorBody(code, err, "Unable to ingest scores:"))
+	}
+}
+
+func getIngestSystems(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminScope(w, r, sess) {
+			return
+		}
+
+		systems, err := readIngestSystems(d)
+		if err != nil {
+			log.Println("Unable to read ingest systems:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, systems)
+	}
+}
+
+//putIngestSystems replaces the configured ingestion systems, a map of system name to IngestSystem
+func putIngestSystems(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		systems := make(map[string]*IngestSystem)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(&systems); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		for name, s := range systems {
+			if name == "" || s == nil || len(s.Token) < 16 || s.Team == "" || s.Round == "" || s.Score == "" {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+			if s.Items == "" {
+				s.Items = "$"
+			}
+		}
+
+		if err := d.WriteSetting(ingestSetting, systems); err != nil {
+			log.Println("Unable to write ingest systems:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, systems)
+	}
+}
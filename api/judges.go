@@ -0,0 +1,706 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//judgesSetting is the db setting key judge accounts are stored under
+const judgesSetting = "judges"
+
+//attributionsSetting is the db setting key score attributions are stored under
+const attributionsSetting = "attributions"
+
+//draftsSetting returns the db setting key the given judge's drafts are stored under
+func draftsSetting(judge string) string {
+	return "drafts/" + judge
+}
+
+//judgesMu serializes changes to judge accounts, drafts, and attributions
+var judgesMu = new(sync.Mutex)
+
+//maxJudgeWeight is the largest weight a judge can be given
+const maxJudgeWeight = 1000
+
+//judgeAccount is a judge's login. Weight is how much the judge counts in panel scoring; zero is treated as 1
+type judgeAccount struct {
+	Hash   []byte  `json:"hash"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+//judgeWeight returns the panel scoring weight of the judge with the given username.
+//Users without a judge account, like admins, have a weight of 1
+func judgeWeight(judges map[string]*judgeAccount, username string) float64 {
+	if j, ok := judges[username]; ok && j.Weight > 0 {
+		return j.Weight
+	}
+	return 1
+}
+
+//Attribution records who last set a score and when
+type Attribution struct {
+	Team  int       `json:"team"`
+	Round int       `json:"round"`
+	User  string    `json:"user"`
+	Time  time.Time `json:"time"`
+}
+
+//Draft is a judge's tentative score. Drafts are only visible to the judge that created them.
+//The team and round can be given by index or by ID; IDs take precedence
+type Draft struct {
+	Team    int      `json:"team"`
+	TeamID  string   `json:"team_id,omitempty"`
+	Round   int      `json:"round"`
+	RoundID string   `json:"round_id,omitempty"`
+	Score   db.Score `json:"score"`
+}
+
+//resolve sets the draft's indexes and IDs from whichever were given.
+//resolve returns false if the team or round doesn't exist in c
+func (d *Draft) resolve(c *db.Competition) bool {
+	if d.TeamID != "" {
+		d.Team = c.TeamIndex(d.TeamID)
+	}
+	if d.RoundID != "" {
+		d.Round = c.RoundIndex(d.RoundID)
+	}
+
+	if d.Team < 0 || d.Team >= len(c.Teams) || d.Round < 0 || d.Round >= len(c.Rounds) {
+		return false
+	}
+
+	d.TeamID, d.RoundID = c.Teams[d.Team].ID, c.RoundIDs[d.Round]
+	return true
+}
+
+func cellKey(team, round int) string {
+	return fmt.Sprintf("%d:%d", team, round)
+}
+
+func readJudges(d db.DB) (map[string]*judgeAccount, error) {
+	judges := make(map[string]*judgeAccount)
+	_, err := d.ReadSetting(judgesSetting, &judges)
+	return judges, err
+}
+
+//authenticateJudge returns if the given username and password belong to a judge account or an error if one occurred
+func authenticateJudge(d db.DB, username, password string) (bool, error) {
+	judges, err := readJudges(d)
+	if err != nil {
+		return false, err
+	}
+
+	j, ok := judges[username]
+	if !ok || !db.CheckPassword(j.Hash, password) {
+		return false, nil
+	}
+
+	if db.NeedsRehash(j.Hash) {
+		if err = rehashJudge(d, username, password); err != nil {
+			log.Println("Unable to rehash judge password:", err)
+		}
+	}
+
+	return true, nil
+}
+
+//rehashJudge stores a new hash of the judge's password made with the current password options
+func rehashJudge(d db.DB, username, password string) error {
+	judgesMu.Lock()
+	defer judgesMu.Unlock()
+
+	judges, err := readJudges(d)
+	if err != nil {
+		return err
+	}
+
+	j, ok := judges[username]
+	if !ok {
+		return nil
+	}
+
+	if j.Hash, err = db.HashPassword(password); err != nil {
+		return err
+	}
+
+	return d.WriteSetting(judgesSetting, judges)
+}
+
+//attribute records user as the author of the score changes in events
+func attribute(d db.DB, user string, events []*Event) error {
+	judgesMu.Lock()
+	defer judgesMu.Unlock()
+
+	attributions := make(map[string]*Attribution)
+	if _, err := d.ReadSetting(attributionsSetting, &attributions); err != nil {
+		return err
+	}
+
+	changed := false
+	now := time.Now()
+	for _, e := range events {
+		if p, ok := e.Payload.(*ScoreUpdatePayload); ok {
+			attributions[cellKey(p.Team, p.Round)] = &Attribution{Team: p.Team, Round: p.Round, User: user, Time: now}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return d.WriteSetting(attributionsSetting, attributions)
+}
+
+//remapCells moves attributions and drafts to follow reordered teams and rounds.
+//teamOrder and roundOrder give the old index for each new index
+func remapCells(d db.DB, teamOrder, roundOrder []int) error {
+	judgesMu.Lock()
+	defer judgesMu.Unlock()
+
+	newTeam := make(map[int]int, len(teamOrder))
+	for i, old := range teamOrder {
+		newTeam[old] = i
+	}
+
+	newRound := make(map[int]int, len(roundOrder))
+	for i, old := range roundOrder {
+		newRound[old] = i
+	}
+
+	//remap returns the new cell for the old one, or false if it was removed
+	remap := func(team, round int) (int, int, bool) {
+		t, ok := newTeam[team]
+		if !ok {
+			return 0, 0, false
+		}
+		r, ok := newRound[round]
+		return t, r, ok
+	}
+
+	attributions := make(map[string]*Attribution)
+	if _, err := d.ReadSetting(attributionsSetting, &attributions); err != nil {
+		return err
+	}
+
+	remapped := make(map[string]*Attribution, len(attributions))
+	for _, a := range attributions {
+		if t, r, ok := remap(a.Team, a.Round); ok {
+			a.Team, a.Round = t, r
+			remapped[cellKey(t, r)] = a
+		}
+	}
+
+	if err := d.WriteSetting(attributionsSetting, remapped); err != nil {
+		return err
+	}
+
+	judges, err := readJudges(d)
+	if err != nil {
+		return err
+	}
+
+	for name := range judges {
+		drafts, err := readDrafts(d, name)
+		if err != nil {
+			return err
+		}
+
+		if len(drafts) == 0 {
+			continue
+		}
+
+		remapped := make(map[string]*Draft, len(drafts))
+		for _, draft := range drafts {
+			if t, r, ok := remap(draft.Team, draft.Round); ok {
+				draft.Team, draft.Round = t, r
+				remapped[cellKey(t, r)] = draft
+			}
+		}
+
+		if err = d.WriteSetting(draftsSetting(name), remapped); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//judgeRequest creates or updates a judge account. Password can be omitted to keep an existing judge's password,
+//and Weight to keep an existing judge's weight (or 1 for a new judge)
+type judgeRequest struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Weight   *float64 `json:"weight"`
+}
+
+type judgesResponse struct {
+	Judges  []string           `json:"judges"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+func getJudges(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		judges, err := readJudges(d)
+		if err != nil {
+			log.Println("Unable to read judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		names := make([]string, 0, len(judges))
+		weights := make(map[string]float64, len(judges))
+		for name := range judges {
+			names = append(names, name)
+			weights[name] = judgeWeight(judges, name)
+		}
+		sort.Strings(names)
+
+		returnHTTP(w, http.StatusOK, &judgesResponse{Judges: names, Weights: weights})
+	}
+}
+
+//putJudge creates or updates a judge account. A new judge must be given a password
+func putJudge(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(judgeRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Name == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if req.Weight != nil && (*req.Weight*weightScale < 1 || *req.Weight > maxJudgeWeight) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("weight must be between %g and %d", 1.0/weightScale, maxJudgeWeight)})
+			return
+		}
+
+		var hash []byte
+		if req.Password != "" {
+			var err error
+			if hash, err = db.HashPassword(req.Password); err != nil {
+				log.Println("Unable to hash password:", err)
+				returnHTTP(w, http.StatusInternalServerError, nil)
+				return
+			}
+		}
+
+		judgesMu.Lock()
+		defer judgesMu.Unlock()
+
+		judges, err := readJudges(d)
+		if err != nil {
+			log.Println("Unable to read judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		j, ok := judges[req.Name]
+		if !ok {
+			if hash == nil {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+			j = new(judgeAccount)
+			judges[req.Name] = j
+		}
+		if hash != nil {
+			j.Hash = hash
+		}
+		if req.Weight != nil {
+			j.Weight = *req.Weight
+		}
+		if err = d.WriteSetting(judgesSetting, judges); err != nil {
+			log.Println("Unable to write judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+func deleteJudge(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		judgesMu.Lock()
+		defer judgesMu.Unlock()
+
+		judges, err := readJudges(d)
+		if err != nil {
+			log.Println("Unable to read judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		delete(judges, name)
+		if err = d.WriteSetting(judgesSetting, judges); err != nil {
+			log.Println("Unable to write judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if err = d.WriteSetting(draftsSetting(name), nil); err != nil {
+			log.Println("Unable to delete drafts:", err)
+		}
+
+		sess.RevokeUser(name, RoleJudge)
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+type attributionsResponse struct {
+	Attributions []*Attribution `json:"attributions"`
+}
+
+func getAttributions(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		attributions := make(map[string]*Attribution)
+		if _, err := d.ReadSetting(attributionsSetting, &attributions); err != nil {
+			log.Println("Unable to read score attributions:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		list := make([]*Attribution, 0, len(attributions))
+		for _, a := range attributions {
+			list = append(list, a)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Team != list[j].Team {
+				return list[i].Team < list[j].Team
+			}
+			return list[i].Round < list[j].Round
+		})
+
+		returnHTTP(w, http.StatusOK, &attributionsResponse{Attributions: list})
+	}
+}
+
+func readDrafts(d db.DB, judge string) (map[string]*Draft, error) {
+	drafts := make(map[string]*Draft)
+	_, err := d.ReadSetting(draftsSetting(judge), &drafts)
+	return drafts, err
+}
+
+type draftsResponse struct {
+	Drafts []*Draft `json:"drafts"`
+}
+
+func draftList(drafts map[string]*Draft) *draftsResponse {
+	list := make([]*Draft, 0, len(drafts))
+	for _, dr := range drafts {
+		list = append(list, dr)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Team != list[j].Team {
+			return list[i].Team < list[j].Team
+		}
+		return list[i].Round < list[j].Round
+	})
+	return &draftsResponse{Drafts: list}
+}
+
+//getDrafts returns the drafts of the judge making the request
+func getDrafts(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleJudge)
+		if session == nil {
+			return
+		}
+
+		drafts, err := readDrafts(d, session.Username)
+		if err != nil {
+			log.Println("Unable to read drafts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, draftList(drafts))
+	}
+}
+
+//putDraft stores a draft score for the judge making the request. A nil score deletes the draft
+func putDraft(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleJudge)
+		if session == nil {
+			return
+		}
+
+		draft := new(Draft)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(draft); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil || !draft.resolve(c) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		judgesMu.Lock()
+		defer judgesMu.Unlock()
+
+		drafts, err := readDrafts(d, session.Username)
+		if err != nil {
+			log.Println("Unable to read drafts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if draft.Score.State == db.ScoreUnscored {
+			delete(drafts, cellKey(draft.Team, draft.Round))
+		} else {
+			drafts[cellKey(draft.Team, draft.Round)] = draft
+		}
+
+		if err = d.WriteSetting(draftsSetting(session.Username), drafts); err != nil {
+			log.Println("Unable to write drafts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, draftList(drafts))
+	}
+}
+
+//checkDrafts resolves scores against c and checks they can be applied, returning the HTTP status code and error if they can't
+func checkDrafts(d db.DB, c *db.Competition, scores []*Draft) (int, error) {
+	for _, s := range scores {
+		if !s.resolve(c) {
+			return http.StatusConflict, nil
+		}
+	}
+
+	err := checkComputed(c, scores)
+	if err == nil {
+		err = checkLocked(d, c, scores)
+	}
+	if err == nil {
+		err = checkRules(d, c, scores)
+	}
+	if err == nil {
+		err = checkScoreFields(d, scores)
+	}
+
+	if err != nil {
+		if isInvalid(err) {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+//applyScores sets the given scores in the competition, attributing them to user, and notifies subscribers.
+//applyScores returns http.StatusOK if the scores were applied, or the HTTP status to return and an error if one occurred.
+//If a score doesn't satisfy its round's validation rule, has invalid custom fields, or is for a computed or locked round, no scores are applied and the error is a *ruleError, *fieldError, *computedError, or *lockError
+func applyScores(d db.DB, sub *SubscribeService, user string, id int, scores []*Draft) (int, error) {
+	return applyScoresAt(d, sub, user, id, scores, -1)
+}
+
+//applyScoresAt is applyScores for scores entered in the given Version of the competition, or in the current competition if version is negative.
+//Scores for a version are written in full with the version, so http.StatusConflict is returned if the competition changed since then
+func applyScoresAt(d db.DB, sub *SubscribeService, user string, id int, scores []*Draft, version int32) (int, error) {
+	state, err := d.State()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read competition state: %v", err)
+	}
+
+	if !state.Editable() {
+		return http.StatusConflict, nil
+	}
+
+	c, err := d.Read()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read database: %v", err)
+	}
+
+	if c == nil {
+		return http.StatusNotFound, nil
+	}
+
+	if version >= 0 && c.Version != version {
+		return http.StatusConflict, nil
+	}
+
+	if code, err := checkDrafts(d, c, scores); code != http.StatusOK {
+		return code, err
+	}
+
+	old := c.Copy()
+	events := make([]*Event, 0, len(scores))
+	for _, s := range scores {
+		c.Teams[s.Team].Scores[s.Round] = s.Score
+		events = append(events, &Event{Type: EventScoreUpdate, ID: id, Payload: &ScoreUpdatePayload{Team: s.Team, TeamID: s.TeamID, Round: s.Round, RoundID: s.RoundID, Score: s.Score}})
+	}
+
+	//a single score is written without rewriting the competition or storing a revision
+	ad := db.WithActor(d, user)
+	if len(scores) == 1 && version < 0 {
+		if _, err = c.SetScore(scores[0].Team, scores[0].Round, scores[0].Score); err == nil {
+			err = ad.WriteScore(scores[0].Team, scores[0].Round, scores[0].Score)
+		}
+	} else {
+		err = ad.Write(c)
+	}
+	if err == db.ErrStaleVersion {
+		return http.StatusConflict, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to write database: %v", err)
+	}
+	committed := time.Now()
+
+	//rounds computed from the submitted scores changed too
+	events = append(events, computedEvents(id, old, c)...)
+
+	if err = attribute(d, user, events); err != nil {
+		log.Println("Unable to write score attributions:", err)
+	}
+
+	sub.PublishCommitted(committed, events...)
+	sub.NotifyCommitted(committed, id)
+
+	return http.StatusOK, nil
+}
+
+type submitRequest struct {
+	Drafts []*Draft `json:"drafts"`
+	ID     int      `json:"id"`
+}
+
+//submitDrafts moves the given drafts (or all drafts if none are given) of the judge making the request into the competition.
+//If panel scoring is enabled, the drafts are recorded as panel entries and the panel's weighted scores are applied.
+//Otherwise, if double entry is enabled, the drafts are recorded as entries instead and only scores another judge entered the same are applied
+func submitDrafts(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleJudge)
+		if session == nil {
+			return
+		}
+
+		req := new(submitRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		judgesMu.Lock()
+		drafts, err := readDrafts(d, session.Username)
+		if err != nil {
+			judgesMu.Unlock()
+			log.Println("Unable to read drafts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		submit := drafts
+		if len(req.Drafts) > 0 {
+			submit = make(map[string]*Draft)
+			for _, dr := range req.Drafts {
+				key := cellKey(dr.Team, dr.Round)
+				if _, ok := drafts[key]; !ok {
+					judgesMu.Unlock()
+					returnHTTP(w, http.StatusNotFound, nil)
+					return
+				}
+				submit[key] = drafts[key]
+			}
+		}
+		judgesMu.Unlock()
+
+		list := make([]*Draft, 0, len(submit))
+		for _, dr := range submit {
+			list = append(list, dr)
+		}
+
+		de, err := readDoubleEntry(d)
+		if err != nil {
+			log.Println("Unable to read double entry:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		panel, err := readPanel(d)
+		if err != nil {
+			log.Println("Unable to read panel:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		apply := applyScores
+		if panel.Enabled {
+			apply = panelScores
+		} else if de.Enabled {
+			apply = verifyScores
+		}
+
+		if code, err := apply(d, sub, session.Username, req.ID, list); code != http.StatusOK {
+			returnHTTP(w, code, applyErrorBody(code, err, "Unable to submit drafts:"))
+			return
+		}
+
+		judgesMu.Lock()
+		if drafts, err = readDrafts(d, session.Username); err == nil {
+			for key := range submit {
+				delete(drafts, key)
+			}
+			err = d.WriteSetting(draftsSetting(session.Username), drafts)
+		}
+		judgesMu.Unlock()
+		if err != nil {
+			log.Println("Unable to write drafts:", err)
+		}
+
+		returnHTTP(w, http.StatusOK, draftList(drafts))
+	}
+}
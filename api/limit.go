@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+//ConnectionLimiter limits the number of concurrent subscriber connections in total and per IP address.
+//A limit of 0 means unlimited
+type ConnectionLimiter struct {
+	total    int
+	perIP    int
+	count    int
+	ipCounts map[string]int
+	mu       *sync.Mutex
+}
+
+//NewConnectionLimiter returns a new ConnectionLimiter with the given limits
+func NewConnectionLimiter(total, perIP int) *ConnectionLimiter {
+	return &ConnectionLimiter{
+		total:    total,
+		perIP:    perIP,
+		ipCounts: make(map[string]int),
+		mu:       new(sync.Mutex),
+	}
+}
+
+//Acquire reserves a connection for the given IP address and returns true,
+//or returns false if a limit has been reached
+func (l *ConnectionLimiter) Acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.total > 0 && l.count >= l.total {
+		return false
+	}
+
+	if l.perIP > 0 && l.ipCounts[ip] >= l.perIP {
+		return false
+	}
+
+	l.count++
+	l.ipCounts[ip]++
+	return true
+}
+
+//Release releases a connection reserved with Acquire
+func (l *ConnectionLimiter) Release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.count--
+	l.ipCounts[ip]--
+	if l.ipCounts[ip] <= 0 {
+		delete(l.ipCounts, ip)
+	}
+}
+
+//Count returns the current number of connections
+func (l *ConnectionLimiter) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+//Available returns whether or not a connection could currently be acquired for the given IP address
+func (l *ConnectionLimiter) Available(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return (l.total <= 0 || l.count < l.total) && (l.perIP <= 0 || l.ipCounts[ip] < l.perIP)
+}
+
+//Load returns the fraction of the total connection limit in use, from 0 to 1.
+//Load returns 0 if there is no total limit
+func (l *ConnectionLimiter) Load() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.total <= 0 {
+		return 0
+	}
+	if l.count >= l.total {
+		return 1
+	}
+	return float64(l.count) / float64(l.total)
+}
+
+//remoteIP returns the IP address of the client that made r
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
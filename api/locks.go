@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//roundLocksSetting is the db setting key locked rounds are stored under, by round ID
+const roundLocksSetting = "round_locks"
+
+//lockHistorySetting is the db setting key the history of round locks and unlocks is stored under
+const lockHistorySetting = "round_lock_history"
+
+//maxLockHistory is the number of lock history entries kept
+const maxLockHistory = 1000
+
+//Lock history actions
+const (
+	LockActionLock   = "lock"
+	LockActionUnlock = "unlock"
+)
+
+//locksMu serializes changes to round locks
+var locksMu = new(sync.Mutex)
+
+//RoundLock records who locked a round and when
+type RoundLock struct {
+	User   string    `json:"user"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+//LockEntry is a round being locked or unlocked
+type LockEntry struct {
+	Action  string    `json:"action"`
+	RoundID string    `json:"round_id"`
+	Round   string    `json:"round"`
+	User    string    `json:"user"`
+	Time    time.Time `json:"time"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+//lockError is returned if a score in a locked round is changed
+type lockError struct {
+	Description string
+}
+
+func (e *lockError) Error() string {
+	return e.Description
+}
+
+func readRoundLocks(d db.DB) (map[string]*RoundLock, error) {
+	locks := make(map[string]*RoundLock)
+	_, err := d.ReadSetting(roundLocksSetting, &locks)
+	return locks, err
+}
+
+//checkLocked returns a *lockError if a draft, which must be resolved against c, changes an entered score in a locked round.
+//Computed rounds are recomputed from their sources and aren't checked
+func checkLocked(d db.DB, c *db.Competition, scores []*Draft) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	locks, err := readRoundLocks(d)
+	if err != nil {
+		return fmt.Errorf("Unable to read round locks: %v", err)
+	}
+
+	for _, s := range scores {
+		if _, ok := locks[s.RoundID]; ok && !c.IsComputed(s.Round) {
+			return &lockError{Description: fmt.Sprintf("%s is locked and must be unlocked by an admin before it can be changed", c.Rounds[s.Round])}
+		}
+	}
+	return nil
+}
+
+type locksResponse struct {
+	Locks   map[string]*RoundLock `json:"locks"`
+	History []*LockEntry          `json:"history"`
+}
+
+//getLocks returns the locked rounds by round ID and the history of locks and unlocks, oldest first
+func getLocks(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		locks, err := readRoundLocks(d)
+		if err != nil {
+			log.Println("Unable to read round locks:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		history := make([]*LockEntry, 0)
+		if _, err = d.ReadSetting(lockHistorySetting, &history); err != nil {
+			log.Println("Unable to read round lock history:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &locksResponse{Locks: locks, History: history})
+	}
+}
+
+//lockRequest optionally gives the reason a round is locked or unlocked
+type lockRequest struct {
+	Reason string `json:"reason"`
+}
+
+type lockResponse struct {
+	RoundID string     `json:"round_id"`
+	Locked  bool       `json:"locked"`
+	Lock    *RoundLock `json:"lock,omitempty"`
+}
+
+//setLock locks or unlocks the round given in the path by ID or index and records it in the lock history
+func setLock(d db.DB, sess *MemorySessionStore, lock bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		req := new(lockRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, round := readRound(w, r, d)
+		if c == nil {
+			return
+		}
+		id := c.RoundIDs[round]
+
+		locksMu.Lock()
+		defer locksMu.Unlock()
+
+		locks, err := readRoundLocks(d)
+		if err != nil {
+			log.Println("Unable to read round locks:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		//remove locks for rounds that no longer exist
+		for rid := range locks {
+			if c.RoundIndex(rid) < 0 {
+				delete(locks, rid)
+			}
+		}
+
+		if _, ok := locks[id]; ok == lock {
+			returnHTTP(w, http.StatusOK, &lockResponse{RoundID: id, Locked: lock, Lock: locks[id]})
+			return
+		}
+
+		now := time.Now()
+		entry := &LockEntry{Action: LockActionUnlock, RoundID: id, Round: c.Rounds[round], User: session.Username, Time: now, Reason: req.Reason}
+		if lock {
+			entry.Action = LockActionLock
+			locks[id] = &RoundLock{User: session.Username, Time: now, Reason: req.Reason}
+		} else {
+			delete(locks, id)
+		}
+
+		if err = d.WriteSetting(roundLocksSetting, locks); err != nil {
+			log.Println("Unable to write round locks:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		var history []*LockEntry
+		if _, err = d.ReadSetting(lockHistorySetting, &history); err != nil {
+			log.Println("Unable to read round lock history:", err)
+		} else {
+			history = append(history, entry)
+			if len(history) > maxLockHistory {
+				history = history[len(history)-maxLockHistory:]
+			}
+			if err = d.WriteSetting(lockHistorySetting, history); err != nil {
+				log.Println("Unable to write round lock history:", err)
+			}
+		}
+		log.Printf("Round %s (%s) %sed by %s", c.Rounds[round], id, entry.Action, session.Username)
+
+		returnHTTP(w, http.StatusOK, &lockResponse{RoundID: id, Locked: lock, Lock: locks[id]})
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/assets"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//maxLogoUpload is the largest logo that can be uploaded before it's re-encoded
+const maxLogoUpload = 5 << 20
+
+//readTeam reads the competition and returns it with the index of the team given in the path by index, ID, or slug.
+//If the team can't be read readTeam writes the error to w and returns nil
+func readTeam(w http.ResponseWriter, r *http.Request, d db.DB) (*db.Competition, int) {
+	c, err := d.Read()
+	if err != nil {
+		log.Println("Unable to read database:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return nil, 0
+	}
+
+	team := -1
+	if c != nil {
+		team = c.FindTeam(mux.Vars(r)["team"])
+	}
+
+	if c == nil || team < 0 || team >= len(c.Teams) {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return nil, 0
+	}
+
+	return c, team
+}
+
+func getTeamLogo(d db.DB, s assets.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		if c.Teams[team].Logo == "" {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		a, err := s.Get(c.Teams[team].Logo)
+		if err != nil {
+			log.Printf("Unable to read asset %s: %v", c.Teams[team].Logo, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if a == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Write(a.Data)
+	}
+}
+
+//putTeamLogo re-encodes the uploaded image and sets it as the team's logo
+func putTeamLogo(d db.DB, s assets.Store, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		data, err := assets.EncodeLogo(http.MaxBytesReader(w, r.Body, maxLogoUpload))
+		if err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		name := fmt.Sprintf("team-logo-%s.png", randString(12))
+		if err = s.Put(name, "image/png", data); err != nil {
+			log.Printf("Unable to write asset %s: %v", name, err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		old := c.Teams[team].Logo
+		c.Teams[team].Logo = name
+		if err = actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		if old != "" {
+			if err = s.Delete(old); err != nil {
+				log.Printf("Unable to delete asset %s: %v", old, err)
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, c.Teams[team])
+		sub.NotifyCommitted(committed, 0)
+	}
+}
+
+func deleteTeamLogo(d db.DB, s assets.Store, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		old := c.Teams[team].Logo
+		if old == "" {
+			returnHTTP(w, http.StatusOK, nil)
+			return
+		}
+
+		c.Teams[team].Logo = ""
+		if err := actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		if err := s.Delete(old); err != nil {
+			log.Printf("Unable to delete asset %s: %v", old, err)
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+		sub.NotifyCommitted(committed, 0)
+	}
+}
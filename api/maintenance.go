@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//maintenanceSetting is the db setting key Maintenance is stored under
+const maintenanceSetting = "maintenance"
+
+//Maintenance is the maintenance mode configuration.
+//While Enabled, public endpoints return Message instead of competition data
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+type maintenanceError struct {
+	*jsonError
+	Message string `json:"message"`
+}
+
+//ReadMaintenance returns the stored Maintenance configuration or an error if one occurred
+func ReadMaintenance(d db.DB) (*Maintenance, error) {
+	m := new(Maintenance)
+	_, err := d.ReadSetting(maintenanceSetting, m)
+	return m, err
+}
+
+//authorized returns whether or not the given request has a valid session without writing an error
+func authorized(r *http.Request, s *MemorySessionStore) bool {
+	if contextSession(r) != nil {
+		return true
+	}
+	match := authRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	return len(match) == 2 && s.Check(match[1])
+}
+
+//checkMaintenance checks if the competition is in maintenance mode.
+//If it is and the request is not authorized checkMaintenance returns false and writes the maintenance message to w.
+//Otherwise checkMaintenance returns true
+func checkMaintenance(w http.ResponseWriter, r *http.Request, d db.DB, s *MemorySessionStore) bool {
+	m, err := ReadMaintenance(d)
+	if err != nil {
+		log.Println("Unable to read maintenance mode:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return false
+	}
+
+	if !m.Enabled || authorized(r, s) {
+		return true
+	}
+
+	returnHTTP(w, http.StatusServiceUnavailable, &maintenanceError{jsonError: codeToJSON(http.StatusServiceUnavailable), Message: m.Message})
+	return false
+}
+
+func getMaintenance(d db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, err := ReadMaintenance(d)
+		if err != nil {
+			log.Println("Unable to read maintenance mode:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, m)
+	}
+}
+
+func putMaintenance(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		m := new(Maintenance)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(m); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := d.WriteSetting(maintenanceSetting, m); err != nil {
+			log.Println("Unable to write maintenance mode:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, m)
+		sub.Publish(&Event{Type: EventMaintenance, Payload: m})
+	}
+}
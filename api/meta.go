@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//metaRequest changes competition metadata without resubmitting scores. Omitted fields are unchanged.
+//RoundOrder and TeamOrder list the current index of each round or team in its new position. IDs don't change
+type metaRequest struct {
+	Name       string   `json:"name"`
+	Rounds     []string `json:"rounds"`
+	RoundOrder []int    `json:"round_order"`
+	TeamOrder  []int    `json:"team_order"`
+	ID         int      `json:"id"`
+}
+
+//permutation returns order if it is a permutation of 0 to n-1, or the identity permutation if order is nil
+func permutation(order []int, n int) ([]int, bool) {
+	if order == nil {
+		order = make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		return order, true
+	}
+
+	if len(order) != n {
+		return nil, false
+	}
+
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return nil, false
+		}
+		seen[i] = true
+	}
+
+	return order, true
+}
+
+//patchCompetitionMeta renames the competition and its rounds and reorders rounds and teams, keeping scores with their team and round
+func patchCompetitionMeta(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(metaRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if old == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		roundOrder, ok := permutation(req.RoundOrder, len(old.Rounds))
+		if !ok {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "round_order must list each round once"})
+			return
+		}
+
+		teamOrder, ok := permutation(req.TeamOrder, len(old.Teams))
+		if !ok {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "team_order must list each team once"})
+			return
+		}
+
+		if req.Rounds != nil && len(req.Rounds) != len(old.Rounds) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "rounds must name each round"})
+			return
+		}
+
+		c := &db.Competition{Version: old.Version, Name: old.Name, Rounds: make([]string, len(old.Rounds)), RoundIDs: make([]string, len(old.Rounds)), Teams: make([]*db.Team, len(old.Teams))}
+		if req.Name != "" {
+			c.Name = req.Name
+		}
+
+		for i, o := range roundOrder {
+			c.Rounds[i] = old.Rounds[o]
+			c.RoundIDs[i] = old.RoundIDs[o]
+			if req.Rounds != nil {
+				if req.Rounds[i] == "" {
+					returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "round names can't be empty"})
+					return
+				}
+				c.Rounds[i] = req.Rounds[i]
+			}
+		}
+
+		for i, o := range teamOrder {
+			t := old.Teams[o]
+			scores := make([]db.Score, len(roundOrder))
+			for j, ro := range roundOrder {
+				scores[j] = t.Scores[ro]
+			}
+			c.Teams[i] = &db.Team{ID: t.ID, Name: t.Name, Scores: scores, Logo: t.Logo}
+		}
+
+		if err = actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		if err = remapCells(d, teamOrder, roundOrder); err != nil {
+			log.Println("Unable to remap attributions and drafts:", err)
+		}
+
+		returnHTTP(w, http.StatusOK, c)
+		sub.PublishCommitted(committed, competitionEvents(req.ID, old, c)...)
+		sub.NotifyCommitted(committed, req.ID)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sync"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//NotificationsSetting is the db setting key notification preferences are stored under, keyed by role and username
+const NotificationsSetting = "notifications"
+
+//Notification kinds a user can choose to be notified of
+const (
+	NotifyDispute    = "dispute"
+	NotifyLeadChange = "lead_change"
+	NotifyFinalized  = "finalized"
+)
+
+var notificationKinds = map[string]bool{NotifyDispute: true, NotifyLeadChange: true, NotifyFinalized: true}
+
+//notificationsMu serializes changes to notification preferences
+var notificationsMu = new(sync.Mutex)
+
+//NotificationPreferences are the events a user is notified of and where notifications are sent.
+//Email is an email address and Slack is a Slack incoming webhook URL; notifications aren't sent to a destination that's empty
+type NotificationPreferences struct {
+	Email  string   `json:"email,omitempty"`
+	Slack  string   `json:"slack,omitempty"`
+	Events []string `json:"events"`
+}
+
+//Wants returns whether or not p is notified of the given kind
+func (p *NotificationPreferences) Wants(kind string) bool {
+	for _, e := range p.Events {
+		if e == kind {
+			return true
+		}
+	}
+	return false
+}
+
+//valid returns whether or not p's destinations and events are valid
+func (p *NotificationPreferences) valid() bool {
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return false
+		}
+	}
+
+	if p.Slack != "" {
+		u, err := url.Parse(p.Slack)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return false
+		}
+	}
+
+	for _, e := range p.Events {
+		if !notificationKinds[e] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func notificationKey(s *Session) string {
+	return s.Role + "/" + s.Username
+}
+
+//ReadNotificationPreferences returns the notification preferences of all users, keyed by role and username
+func ReadNotificationPreferences(d db.DB) (map[string]*NotificationPreferences, error) {
+	prefs := make(map[string]*NotificationPreferences)
+	_, err := d.ReadSetting(NotificationsSetting, &prefs)
+	return prefs, err
+}
+
+//getNotifications returns the notification preferences of the user making the request
+func getNotifications(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleAdmin, RoleJudge)
+		if session == nil {
+			return
+		}
+
+		prefs, err := ReadNotificationPreferences(d)
+		if err != nil {
+			log.Println("Unable to read notification preferences:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		p, ok := prefs[notificationKey(session)]
+		if !ok {
+			p = &NotificationPreferences{Events: []string{}}
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
+
+//putNotifications replaces the notification preferences of the user making the request. Empty preferences are removed
+func putNotifications(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin, RoleJudge)
+		if session == nil {
+			return
+		}
+
+		p := new(NotificationPreferences)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(p); err != nil || !p.valid() {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+		if p.Events == nil {
+			p.Events = []string{}
+		}
+
+		notificationsMu.Lock()
+		defer notificationsMu.Unlock()
+
+		prefs, err := ReadNotificationPreferences(d)
+		if err != nil {
+			log.Println("Unable to read notification preferences:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if len(p.Events) == 0 || (p.Email == "" && p.Slack == "") {
+			delete(prefs, notificationKey(session))
+		} else {
+			prefs[notificationKey(session)] = p
+		}
+
+		if err = d.WriteSetting(NotificationsSetting, prefs); err != nil {
+			log.Println("Unable to write notification preferences:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//panelSetting is the db setting key Panel is stored under
+const panelSetting = "panel"
+
+//panelEntriesSetting is the db setting key judges' panel entries are stored under, keyed by team and round ID
+const panelEntriesSetting = "panel_entries"
+
+//weightScale is the fixed point scale judge weights are rounded to when averaging, so averages round with the competition's Precision
+const weightScale = 10000
+
+//panelMu serializes changes to panel entries
+var panelMu = new(sync.Mutex)
+
+//Panel is the panel scoring configuration.
+//While Enabled, every judge's submitted score is kept as an entry and the official score is the mean of the judges' entries
+//weighted by their account weights. A no-show is official only if no judge scored the team.
+//Panel scoring takes precedence over double entry. Scores set by admins are official until the next judge entry
+type Panel struct {
+	Enabled bool `json:"enabled"`
+}
+
+//PanelScore is the judges' entries for a score.
+//Team and Round are resolved from the IDs when read
+type PanelScore struct {
+	Team    int      `json:"team"`
+	TeamID  string   `json:"team_id"`
+	Round   int      `json:"round"`
+	RoundID string   `json:"round_id"`
+	Entries []*Entry `json:"entries"`
+}
+
+//JudgeCalibration compares a judge's panel entries to the panel's weighted mean for the same scores.
+//Only scores with scored entries from at least two judges are compared. Values are in units of the competition's Precision.
+//Bias is the judge's mean difference from the panel: negative for a harsh judge and positive for a lenient one
+type JudgeCalibration struct {
+	Judge       string  `json:"judge"`
+	Weight      float64 `json:"weight"`
+	Count       int     `json:"count"`
+	Mean        float64 `json:"mean"`
+	StdDev      float64 `json:"stddev"`
+	PanelMean   float64 `json:"panel_mean"`
+	PanelStdDev float64 `json:"panel_stddev"`
+	Bias        float64 `json:"bias"`
+}
+
+type calibrationResponse struct {
+	Judges    []*JudgeCalibration `json:"judges"`
+	Precision *db.Precision       `json:"precision"`
+}
+
+func readPanel(d db.DB) (*Panel, error) {
+	p := new(Panel)
+	_, err := d.ReadSetting(panelSetting, p)
+	return p, err
+}
+
+//readPanelScores returns the panel entries resolved against c. Entries for teams or rounds that no longer exist are dropped
+func readPanelScores(d db.DB, c *db.Competition) (map[string]*PanelScore, error) {
+	ps := make(map[string]*PanelScore)
+	if _, err := d.ReadSetting(panelEntriesSetting, &ps); err != nil {
+		return nil, err
+	}
+
+	for key, p := range ps {
+		p.Team, p.Round = c.TeamIndex(p.TeamID), c.RoundIndex(p.RoundID)
+		if p.Team < 0 || p.Round < 0 {
+			delete(ps, key)
+		}
+	}
+	return ps, nil
+}
+
+//add records e, replacing the user's previous entry
+func (p *PanelScore) add(e *Entry) {
+	entries := make([]*Entry, 0, len(p.Entries)+1)
+	for _, old := range p.Entries {
+		if old.User != e.User {
+			entries = append(entries, old)
+		}
+	}
+	p.Entries = append(entries, e)
+}
+
+//score returns the weighted mean of the scored entries, rounded with prec, with the custom fields of the latest entry.
+//If no entry is scored, score returns a no-show
+func (p *PanelScore) score(judges map[string]*judgeAccount, prec *db.Precision) db.Score {
+	var num, den int64
+	var latest *Entry
+	for _, e := range p.Entries {
+		if latest == nil || e.Time.After(latest.Time) {
+			latest = e
+		}
+		if e.Score.Scored() {
+			w := int64(math.Round(judgeWeight(judges, e.User) * weightScale))
+			num += w * int64(e.Score.Value)
+			den += w
+		}
+	}
+
+	if den == 0 {
+		return db.Score{State: db.ScoreNoShow, Fields: latest.Score.Fields}
+	}
+
+	s := db.NewScore(int32(prec.Divide(num, den)))
+	s.Fields = latest.Score.Fields
+	return s
+}
+
+//panelScores records the given scores as entries by user and applies the panel's score for each to the competition.
+//panelScores returns http.StatusOK if the scores were applied, or the HTTP status to return and an error if one occurred
+func panelScores(d db.DB, sub *SubscribeService, user string, id int, scores []*Draft) (int, error) {
+	state, err := d.State()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read competition state: %v", err)
+	}
+
+	if !state.Editable() {
+		return http.StatusConflict, nil
+	}
+
+	panelMu.Lock()
+	defer panelMu.Unlock()
+
+	c, err := d.Read()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read database: %v", err)
+	}
+
+	if c == nil {
+		return http.StatusNotFound, nil
+	}
+
+	if code, err := checkDrafts(d, c, scores); code != http.StatusOK {
+		return code, err
+	}
+
+	ps, err := readPanelScores(d, c)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read panel entries: %v", err)
+	}
+
+	judges, err := readJudges(d)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read judges: %v", err)
+	}
+
+	official := make([]*Draft, 0, len(scores))
+	now := time.Now()
+	for _, s := range scores {
+		key := verificationKey(s.TeamID, s.RoundID)
+		p, ok := ps[key]
+		if !ok {
+			p = &PanelScore{Team: s.Team, TeamID: s.TeamID, Round: s.Round, RoundID: s.RoundID}
+			ps[key] = p
+		}
+		p.add(&Entry{User: user, Score: s.Score, Time: now})
+		official = append(official, &Draft{Team: s.Team, TeamID: s.TeamID, Round: s.Round, RoundID: s.RoundID, Score: p.score(judges, c.Precision)})
+	}
+
+	if code, err := applyScores(d, sub, user, id, official); code != http.StatusOK {
+		return code, err
+	}
+
+	if err = d.WriteSetting(panelEntriesSetting, ps); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to write panel entries: %v", err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func getPanel(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		p, err := readPanel(d)
+		if err != nil {
+			log.Println("Unable to read panel:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
+
+//putPanel enables or disables panel scoring. Panel entries are kept when it's disabled
+func putPanel(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		p := new(Panel)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(p); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := d.WriteSetting(panelSetting, p); err != nil {
+			log.Println("Unable to write panel:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
+
+//meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+//getCalibration returns a calibration report for every judge with comparable panel entries, ordered by judge.
+//If the round query parameter is set to a round ID or index, only entries for that round are compared
+func getCalibration(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		round := -1
+		if ref := r.URL.Query().Get("round"); ref != "" {
+			if round = c.FindRound(ref); round < 0 {
+				returnHTTP(w, http.StatusNotFound, nil)
+				return
+			}
+		}
+
+		panelMu.Lock()
+		ps, err := readPanelScores(d, c)
+		panelMu.Unlock()
+		if err != nil {
+			log.Println("Unable to read panel entries:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		judges, err := readJudges(d)
+		if err != nil {
+			log.Println("Unable to read judges:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		entries := make(map[string][]float64)
+		panel := make(map[string][]float64)
+		for _, p := range ps {
+			if round >= 0 && p.Round != round {
+				continue
+			}
+
+			var num, den float64
+			var scored []*Entry
+			for _, e := range p.Entries {
+				if e.Score.Scored() {
+					w := judgeWeight(judges, e.User)
+					num += w * float64(e.Score.Value)
+					den += w
+					scored = append(scored, e)
+				}
+			}
+			if len(scored) < 2 || den == 0 {
+				continue
+			}
+
+			for _, e := range scored {
+				entries[e.User] = append(entries[e.User], float64(e.Score.Value))
+				panel[e.User] = append(panel[e.User], num/den)
+			}
+		}
+
+		list := make([]*JudgeCalibration, 0, len(entries))
+		for user, values := range entries {
+			jc := &JudgeCalibration{Judge: user, Weight: judgeWeight(judges, user), Count: len(values)}
+			jc.Mean, jc.StdDev = meanStdDev(values)
+			jc.PanelMean, jc.PanelStdDev = meanStdDev(panel[user])
+			jc.Bias = jc.Mean - jc.PanelMean
+			list = append(list, jc)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Judge < list[j].Judge
+		})
+
+		returnHTTP(w, http.StatusOK, &calibrationResponse{Judges: list, Precision: c.Precision})
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Paste match modes
+const (
+	PasteAuto  = "auto"
+	PasteOrder = "order"
+	PasteName  = "name"
+)
+
+//pasteRequest sets a round's scores from tab separated text as copied from a spreadsheet.
+//With Match PasteOrder, each line is the score of the team in the same position; the last column is used.
+//With Match PasteName, each line is a team name (or slug) and its score in the first two columns.
+//PasteAuto, the default, matches by name if any line has more than one column and by order otherwise.
+//Scores can be numbers, rounded to the competition's precision, blank for unscored, or NS for no-shows. Changes are only written if Apply is true
+type pasteRequest struct {
+	Text  string `json:"text"`
+	Match string `json:"match"`
+	Apply bool   `json:"apply"`
+	ID    int    `json:"id"`
+}
+
+//pasteRow is a pasted line matched to a team
+type pasteRow struct {
+	Line    int      `json:"line"`
+	Text    string   `json:"text"`
+	Team    int      `json:"team"`
+	TeamID  string   `json:"team_id"`
+	Name    string   `json:"name"`
+	Old     db.Score `json:"old"`
+	Score   db.Score `json:"score"`
+	Changed bool     `json:"changed"`
+}
+
+//pasteError is a pasted line that couldn't be used
+type pasteError struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+type pasteResponse struct {
+	Round     int           `json:"round"`
+	RoundID   string        `json:"round_id"`
+	Match     string        `json:"match"`
+	Rows      []*pasteRow   `json:"rows"`
+	Errors    []*pasteError `json:"errors"`
+	Unmatched []string      `json:"unmatched"`
+	Applied   bool          `json:"applied"`
+}
+
+//parsePasteScore parses a pasted spreadsheet cell as a score with p's decimal places
+func parsePasteScore(p *db.Precision, cell string) (db.Score, error) {
+	cell = strings.TrimSpace(cell)
+	switch strings.ToLower(strings.Replace(strings.Replace(cell, "_", "", -1), " ", "", -1)) {
+	case "", "-":
+		return db.Score{State: db.ScoreUnscored}, nil
+	case "ns", "noshow":
+		return db.Score{State: db.ScoreNoShow}, nil
+	}
+
+	v, err := p.Parse(strings.Replace(cell, ",", "", -1))
+	if err != nil {
+		return db.Score{}, fmt.Errorf("%q isn't a number, blank, or NS", cell)
+	}
+	return db.NewScore(v), nil
+}
+
+//findPasteTeam returns the index of the team in c with the given name, ignoring case, or slug, or -1 if there isn't one
+func findPasteTeam(c *db.Competition, name string) int {
+	name = strings.TrimSpace(name)
+	for i, t := range c.Teams {
+		if strings.EqualFold(t.Name, name) {
+			return i
+		}
+	}
+	slug := db.Slug(name)
+	for i, t := range c.Teams {
+		if t.Slug == slug {
+			return i
+		}
+	}
+	return -1
+}
+
+//matchPaste matches the lines of text to the teams of c and their scores in round
+func matchPaste(c *db.Competition, round int, text, match string) *pasteResponse {
+	text = strings.TrimRight(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	lines := strings.Split(text, "\n")
+
+	if match == PasteAuto {
+		match = PasteOrder
+		for _, l := range lines {
+			if strings.Contains(strings.Trim(l, "\t"), "\t") {
+				match = PasteName
+				break
+			}
+		}
+	}
+
+	resp := &pasteResponse{Round: round, RoundID: c.RoundIDs[round], Match: match, Rows: make([]*pasteRow, 0), Errors: make([]*pasteError, 0), Unmatched: make([]string, 0)}
+	matched := make(map[int]int)
+	for i, l := range lines {
+		fail := func(format string, a ...interface{}) {
+			resp.Errors = append(resp.Errors, &pasteError{Line: i + 1, Text: l, Error: fmt.Sprintf(format, a...)})
+		}
+
+		cells := strings.Split(l, "\t")
+		team, cell := i, cells[len(cells)-1]
+		if match == PasteName {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			if len(cells) < 2 {
+				fail("Expected a team name and a score")
+				continue
+			}
+			if team, cell = findPasteTeam(c, cells[0]), cells[1]; team < 0 {
+				fail("No team named %s", strings.TrimSpace(cells[0]))
+				continue
+			}
+		} else if team >= len(c.Teams) {
+			fail("There are only %d teams", len(c.Teams))
+			continue
+		}
+
+		if line, ok := matched[team]; ok {
+			fail("%s was already matched on line %d", c.Teams[team].Name, line)
+			continue
+		}
+
+		score, err := parsePasteScore(c.Precision, cell)
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+		matched[team] = i + 1
+
+		old := c.Teams[team].Scores[round]
+		score.Fields = old.Fields
+		resp.Rows = append(resp.Rows, &pasteRow{
+			Line: i + 1, Text: l, Team: team, TeamID: c.Teams[team].ID, Name: c.Teams[team].Name, Old: old, Score: score, Changed: !scoreEqual(old, score),
+		})
+	}
+
+	for i, t := range c.Teams {
+		if _, ok := matched[i]; !ok {
+			resp.Unmatched = append(resp.Unmatched, t.Name)
+		}
+	}
+
+	return resp
+}
+
+//postPaste previews or applies pasted scores for the round given in the path by ID or index.
+//Pasted scores are only applied if every line could be used; unmatched teams are left unchanged
+func postPaste(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		req := new(pasteRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || strings.TrimSpace(req.Text) == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		switch req.Match {
+		case "":
+			req.Match = PasteAuto
+		case PasteAuto, PasteOrder, PasteName:
+		default:
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("match must be %s, %s, or %s", PasteAuto, PasteOrder, PasteName)})
+			return
+		}
+
+		c, round := readRound(w, r, d)
+		if c == nil {
+			return
+		}
+
+		resp := matchPaste(c, round, req.Text, req.Match)
+
+		var drafts []*Draft
+		for _, row := range resp.Rows {
+			if row.Changed {
+				drafts = append(drafts, &Draft{Team: row.Team, TeamID: row.TeamID, Round: round, RoundID: resp.RoundID, Score: row.Score})
+			}
+		}
+
+		if !req.Apply || len(resp.Errors) > 0 || len(drafts) == 0 {
+			returnHTTP(w, http.StatusOK, resp)
+			return
+		}
+
+		code, err := applyScores(d, sub, session.Username, req.ID, drafts)
+		if code != http.StatusOK {
+			returnHTTP(w, code, applyErrorBody(code, err, "Unable to apply pasted scores:"))
+			return
+		}
+		resp.Applied = true
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
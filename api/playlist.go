@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//playlistSetting is the db setting key the Playlist is stored under
+const playlistSetting = "playlist"
+
+//PlaylistItem is a view shown by display clients for Duration seconds.
+//Params are passed to the display client unchanged
+type PlaylistItem struct {
+	View     string            `json:"view"`
+	Duration int               `json:"duration"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+//Playlist is a rotation of views shown by display clients
+type Playlist struct {
+	Items   []*PlaylistItem `json:"items"`
+	Enabled bool            `json:"enabled"`
+}
+
+//PlaylistCuePayload is the Payload of an EventPlaylistCue Event
+type PlaylistCuePayload struct {
+	Index int           `json:"index"`
+	Item  *PlaylistItem `json:"item"`
+	Until time.Time     `json:"until"`
+}
+
+//PlaylistService cycles through the stored Playlist and publishes the current view
+type PlaylistService struct {
+	d       db.DB
+	sub     *SubscribeService
+	current *PlaylistCuePayload
+	stop    chan struct{}
+	mu      *sync.Mutex
+}
+
+//NewPlaylistService returns a new PlaylistService and starts the stored Playlist if it's enabled
+func NewPlaylistService(d db.DB, sub *SubscribeService) *PlaylistService {
+	p := &PlaylistService{d: d, sub: sub, mu: new(sync.Mutex)}
+
+	pl := new(Playlist)
+	if _, err := d.ReadSetting(playlistSetting, pl); err != nil {
+		log.Println("Unable to read playlist:", err)
+	}
+	p.Start(pl)
+
+	return p
+}
+
+func (p *PlaylistService) run(pl *Playlist, stop chan struct{}) {
+	for i := 0; ; i = (i + 1) % len(pl.Items) {
+		item := pl.Items[i]
+		cue := &PlaylistCuePayload{Index: i, Item: item, Until: time.Now().Add(time.Duration(item.Duration) * time.Second)}
+
+		p.mu.Lock()
+		p.current = cue
+		p.mu.Unlock()
+		p.sub.Publish(&Event{Type: EventPlaylistCue, Payload: cue})
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(item.Duration) * time.Second):
+		}
+	}
+}
+
+//Start stops the running Playlist and starts the given Playlist if it's enabled and has items
+func (p *PlaylistService) Start(pl *Playlist) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.current = nil
+
+	if !pl.Enabled || len(pl.Items) == 0 {
+		return
+	}
+
+	p.stop = make(chan struct{})
+	go p.run(pl, p.stop)
+}
+
+//Current returns the view currently being shown, or nil if no Playlist is running
+func (p *PlaylistService) Current() *PlaylistCuePayload {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+func getPlaylist(d db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pl := &Playlist{Items: make([]*PlaylistItem, 0)}
+		if _, err := d.ReadSetting(playlistSetting, pl); err != nil {
+			log.Println("Unable to read playlist:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, pl)
+	}
+}
+
+func putPlaylist(d db.DB, sess *MemorySessionStore, p *PlaylistService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		pl := new(Playlist)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(pl); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		for _, item := range pl.Items {
+			if item == nil || item.View == "" || item.Duration <= 0 {
+				returnHTTP(w, http.StatusBadRequest, nil)
+				return
+			}
+		}
+
+		if err := d.WriteSetting(playlistSetting, pl); err != nil {
+			log.Println("Unable to write playlist:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		p.Start(pl)
+		returnHTTP(w, http.StatusOK, pl)
+	}
+}
+
+func getPlaylistCurrent(p *PlaylistService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := p.Current()
+		if current == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, current)
+	}
+}
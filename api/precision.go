@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+func getPrecision(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		p := c.Precision
+		if p == nil {
+			p = &db.Precision{Rounding: db.RoundHalfUp}
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
+
+//putPrecision sets the competition's decimal places and rounding mode.
+//If the number of places changes, every entered score is rescaled so its value is unchanged, rounding if places are removed
+func putPrecision(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		p := new(db.Precision)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(p); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if p.Rounding == "" {
+			p.Rounding = db.RoundHalfUp
+		}
+
+		if err := p.Validate(); err != nil {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		}
+
+		old := readCompetition(w, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		c.Precision = p
+
+		places := 0
+		if old.Precision != nil {
+			places = old.Precision.Places
+		}
+		if places != p.Places {
+			for _, t := range c.Teams {
+				for j, s := range t.Scores {
+					if !s.Scored() || c.IsComputed(j) {
+						continue
+					}
+					v, err := p.Rescale(s.Value, places)
+					if err != nil {
+						returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("%s's %s score can't be rescaled: %v", t.Name, c.Rounds[j], err)})
+						return
+					}
+					t.Scores[j].Value = v
+				}
+			}
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, p)
+	}
+}
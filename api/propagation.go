@@ -0,0 +1,126 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//PropagationSLA is the target time for a change to reach every connected screen after it's written to the database
+const PropagationSLA = time.Second
+
+//propagationBuckets are the upper bounds of the propagation latency histogram buckets. Latencies above the last bound are counted in +Inf
+var propagationBuckets = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+//propagationEvents are the Event types published after a database write whose propagation is measured
+var propagationEvents = map[string]bool{
+	EventUpdate:       true,
+	EventScoreUpdate:  true,
+	EventTeamAdded:    true,
+	EventRoundRenamed: true,
+}
+
+//delivery tracks the delivery of a published Event to client subscribers.
+//When the last client subscriber has been sent the Event, skipped it, or dropped it, the time since its write was committed is observed
+type delivery struct {
+	committed time.Time
+	pending   int32
+	hist      *propagationHistogram
+}
+
+//done marks the Event delivered to one client subscriber. A nil delivery is ignored
+func (d *delivery) done() {
+	if d != nil && atomic.AddInt32(&d.pending, -1) == 0 {
+		d.hist.observe(time.Since(d.committed))
+	}
+}
+
+//propagationHistogram is a histogram of the latencies from committing an Event's write to its delivery to the last client subscriber
+type propagationHistogram struct {
+	//counts holds the count of each bucket in propagationBuckets, then +Inf
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+	mu     *sync.Mutex
+}
+
+func newPropagationHistogram() *propagationHistogram {
+	return &propagationHistogram{counts: make([]uint64, len(propagationBuckets)+1), mu: new(sync.Mutex)}
+}
+
+func (h *propagationHistogram) observe(latency time.Duration) {
+	i := 0
+	for i < len(propagationBuckets) && latency > propagationBuckets[i] {
+		i++
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += latency
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+//PropagationBucket is a cumulative histogram bucket: Count is the number of Events delivered within LE seconds, or "+Inf"
+type PropagationBucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+//PropagationStats describes the latency from a database write being committed to its Event's delivery to the last connected client.
+//Mean and Max are in seconds. WithinSLA is the fraction of Events delivered within PropagationSLA.
+//Events published while no clients are connected aren't counted
+type PropagationStats struct {
+	Count     uint64               `json:"count"`
+	Mean      float64              `json:"mean"`
+	Max       float64              `json:"max"`
+	SLA       float64              `json:"sla"`
+	WithinSLA float64              `json:"within_sla"`
+	Buckets   []*PropagationBucket `json:"buckets"`
+}
+
+func (h *propagationHistogram) snapshot() *PropagationStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := &PropagationStats{
+		Count:   h.count,
+		Max:     h.max.Seconds(),
+		SLA:     PropagationSLA.Seconds(),
+		Buckets: make([]*PropagationBucket, 0, len(h.counts)),
+	}
+
+	var cumulative, within uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(propagationBuckets) {
+			le = strconv.FormatFloat(propagationBuckets[i].Seconds(), 'g', -1, 64)
+			if propagationBuckets[i] <= PropagationSLA {
+				within = cumulative
+			}
+		}
+		p.Buckets = append(p.Buckets, &PropagationBucket{LE: le, Count: cumulative})
+	}
+
+	if h.count > 0 {
+		p.Mean = (h.sum / time.Duration(h.count)).Seconds()
+		p.WithinSLA = float64(within) / float64(h.count)
+	}
+	return p
+}
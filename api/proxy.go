@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//TrustedProxies is a list of networks whose X-Forwarded-* headers are trusted
+type TrustedProxies []*net.IPNet
+
+//ParseTrustedProxies parses a comma separated list of IP addresses and CIDR networks or returns an error if one occurred
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address: %s", s)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid network: %s", s)
+		}
+		proxies = append(proxies, n)
+	}
+	return proxies, nil
+}
+
+//Contains returns whether or not ip is in one of the trusted networks
+func (p TrustedProxies) Contains(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range p {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+//clientIP returns the client IP address for a request from a trusted proxy.
+//X-Forwarded-For is read from right to left, skipping trusted proxies, and X-Real-IP is used if it's not set
+func (p TrustedProxies) clientIP(r *http.Request) string {
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		var ip string
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(hops[i])
+			if net.ParseIP(ip) == nil {
+				//the header is malformed past this point, so use the last valid address
+				if i == len(hops)-1 {
+					return ""
+				}
+				return strings.TrimSpace(hops[i+1])
+			}
+			if !p.Contains(ip) {
+				return ip
+			}
+		}
+		return ip
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+
+	return ""
+}
+
+//Handler returns an http.Handler that, for requests from a trusted proxy, replaces the request's remote address,
+//scheme, and host with the client's from the X-Forwarded-For, X-Real-IP, X-Forwarded-Proto, and X-Forwarded-Host headers
+//before calling h. Forwarded headers from untrusted addresses are ignored
+func (p TrustedProxies) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(p) == 0 || !p.Contains(remoteIP(r)) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if ip := p.clientIP(r); ip != "" {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+
+		if proto := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0])); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+
+		if host := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); host != "" {
+			r.Host = host
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+//requestURL returns the absolute URL the client used to make r, including any prefix stripped by the router
+func requestURL(r *http.Request) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, uri)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//publicScore is a team's score in a round on its public page
+type publicScore struct {
+	Round   string   `json:"round"`
+	RoundID string   `json:"round_id"`
+	Score   db.Score `json:"score"`
+}
+
+//publicTrend is a team's standing after a round. Movement is the number of places gained since the previous round
+type publicTrend struct {
+	Round    string `json:"round"`
+	RoundID  string `json:"round_id"`
+	Rank     int    `json:"rank"`
+	Total    int32  `json:"total"`
+	Movement int    `json:"movement"`
+}
+
+//publicTeamResponse is a spectator-friendly summary of a team. Custom fields aren't included since they may be private.
+//Logo is the URL of the team's logo relative to the public page
+type publicTeamResponse struct {
+	ID     string         `json:"id"`
+	Slug   string         `json:"slug"`
+	Name   string         `json:"name"`
+	Logo   string         `json:"logo,omitempty"`
+	Rank   int            `json:"rank"`
+	Total  int32          `json:"total"`
+	Teams  int            `json:"teams"`
+	Scores []*publicScore `json:"scores"`
+	Trend  []*publicTrend `json:"trend"`
+	Roster []string       `json:"roster"`
+}
+
+//standingOf returns the standing of the given team in c, or nil if it doesn't exist
+func standingOf(c *db.Competition, team int) *db.Standing {
+	for _, s := range c.Standings() {
+		if s.Team == team {
+			return s
+		}
+	}
+	return nil
+}
+
+//teamTrend returns the standing of the given team after each round of c
+func teamTrend(c *db.Competition, team int) []*publicTrend {
+	trend := make([]*publicTrend, 0, len(c.Rounds))
+	for k := range c.Rounds {
+		partial := c.Copy()
+		partial.Rounds, partial.RoundIDs = partial.Rounds[:k+1], partial.RoundIDs[:k+1]
+		for _, t := range partial.Teams {
+			t.Scores = t.Scores[:k+1]
+		}
+
+		s := standingOf(partial, team)
+		t := &publicTrend{Round: c.Rounds[k], RoundID: c.RoundIDs[k], Rank: s.Rank, Total: s.Total}
+		if k > 0 {
+			t.Movement = trend[k-1].Rank - s.Rank
+		}
+		trend = append(trend, t)
+	}
+	return trend
+}
+
+//getPublicTeam returns a spectator-friendly summary of the team given in the path by index, ID, or slug:
+//its scores, standing, standing after each round, roster, and logo
+func getPublicTeam(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		t := c.Teams[team]
+		s := standingOf(c, team)
+		resp := &publicTeamResponse{
+			ID:     t.ID,
+			Slug:   t.Slug,
+			Name:   t.Name,
+			Rank:   s.Rank,
+			Total:  s.Total,
+			Teams:  len(c.Teams),
+			Scores: make([]*publicScore, 0, len(c.Rounds)),
+			Trend:  teamTrend(c, team),
+			Roster: t.Roster,
+		}
+		if t.Logo != "" {
+			resp.Logo = "logo"
+		}
+		if resp.Roster == nil {
+			resp.Roster = make([]string, 0)
+		}
+		for i, round := range c.Rounds {
+			resp.Scores = append(resp.Scores, &publicScore{Round: round, RoundID: c.RoundIDs[i], Score: t.Scores[i]})
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+//maxRecordedBody is the most bytes of a request or response body that are recorded
+const maxRecordedBody = 64 * 1024
+
+//redacted replaces recorded credentials
+const redacted = "[redacted]"
+
+//redactedHeaders are headers whose values are never recorded
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-API-Key", "X-Setup-Token", "X-Twilio-Signature"}
+
+//redactedParams are query parameters whose values are never recorded
+var redactedParams = []string{"api_key", "token", "setup_token"}
+
+//redactedJSON matches the values of JSON members holding credentials
+var redactedJSON = regexp.MustCompile(`("(?:password|pass|hash|key|token|refresh_token|session_id|secret|setup_token)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+//Exchange is a recorded API request and its response. Credentials are redacted and bodies are truncated to maxRecordedBody
+type Exchange struct {
+	ID              uint64            `json:"id"`
+	Time            time.Time         `json:"time"`
+	Duration        float64           `json:"duration"`
+	RemoteIP        string            `json:"remote_ip"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+}
+
+//Recorder keeps the most recent API requests and responses in a ring buffer for debugging reports like
+//"the tablet said it saved but nothing changed"
+type Recorder struct {
+	exchanges []*Exchange
+	next      int
+	id        uint64
+	mu        *sync.Mutex
+}
+
+//NewRecorder returns a new Recorder that keeps the last size exchanges
+func NewRecorder(size int) *Recorder {
+	return &Recorder{exchanges: make([]*Exchange, size), mu: new(sync.Mutex)}
+}
+
+func (rec *Recorder) add(e *Exchange) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.id++
+	e.ID = rec.id
+	rec.exchanges[rec.next] = e
+	rec.next = (rec.next + 1) % len(rec.exchanges)
+}
+
+//Exchanges returns the recorded exchanges, oldest first
+func (rec *Recorder) Exchanges() []*Exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	exchanges := make([]*Exchange, 0, len(rec.exchanges))
+	for i := range rec.exchanges {
+		if e := rec.exchanges[(rec.next+i)%len(rec.exchanges)]; e != nil {
+			exchanges = append(exchanges, e)
+		}
+	}
+	return exchanges
+}
+
+//Clear removes the recorded exchanges
+func (rec *Recorder) Clear() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i := range rec.exchanges {
+		rec.exchanges[i] = nil
+	}
+}
+
+//recordingWriter is an http.ResponseWriter that keeps the status and the first maxRecordedBody bytes of the body
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if n := maxRecordedBody - w.body.Len(); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.body.Write(p[:n])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//recordedHeaders returns h with one value per header and credentials redacted
+func recordedHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		headers[k] = strings.Join(v, ", ")
+	}
+	for _, k := range redactedHeaders {
+		if _, ok := headers[k]; ok {
+			headers[k] = redacted
+		}
+	}
+	return headers
+}
+
+//recordedURL returns the request URI of r with credentials in the query redacted
+func recordedURL(r *http.Request) string {
+	u := *r.URL
+	q := u.Query()
+	for _, k := range redactedParams {
+		if _, ok := q[k]; ok {
+			q.Set(k, redacted)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+//recordedBody returns buf as recorded for the given headers: decompressed if it's gzip encoded, with JSON credentials redacted.
+//Bodies that aren't text are summarized
+func recordedBody(h http.Header, buf []byte) string {
+	if len(buf) == 0 {
+		return ""
+	}
+
+	if h.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return "[undecodable gzip body]"
+		}
+		//the body may have been truncated, so whatever can be decompressed is kept
+		buf, _ = ioutil.ReadAll(io.LimitReader(gz, maxRecordedBody))
+	}
+
+	typ := h.Get("Content-Type")
+	if typ != "" && !strings.Contains(typ, "json") && !strings.HasPrefix(typ, "text/") && !strings.Contains(typ, "form-urlencoded") {
+		return "[" + strconv.Itoa(len(buf)) + " byte " + typ + " body]"
+	}
+
+	return redactedJSON.ReplaceAllString(string(buf), `$1"`+redacted+`"`)
+}
+
+//record returns next, recording its requests and responses
+func (rec *Recorder) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//live update connections are long lived and aren't recorded
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e := &Exchange{
+			Time:           time.Now(),
+			RemoteIP:       remoteIP(r),
+			Method:         r.Method,
+			URL:            recordedURL(r),
+			RequestHeaders: recordedHeaders(r.Header),
+		}
+
+		var reqBody []byte
+		if r.Body != nil {
+			reqBody, _ = ioutil.ReadAll(io.LimitReader(r.Body, maxRecordedBody))
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(reqBody), r.Body))
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, body: new(bytes.Buffer)}
+		next.ServeHTTP(rw, r)
+
+		e.Duration = time.Since(e.Time).Seconds()
+		e.RequestBody = recordedBody(r.Header, reqBody)
+		e.Status = rw.status
+		e.ResponseHeaders = recordedHeaders(w.Header())
+		e.ResponseBody = recordedBody(w.Header(), rw.body.Bytes())
+		rec.add(e)
+	})
+}
+
+type recordingsResponse struct {
+	Exchanges []*Exchange `json:"exchanges"`
+}
+
+func getRecordings(rec *Recorder, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &recordingsResponse{Exchanges: rec.Exchanges()})
+	}
+}
+
+func deleteRecordings(rec *Recorder, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		rec.Clear()
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+//NewRecordingRouter returns an HTTP router that records every API request served by next in rec.
+//Admins of the main competition, whose sessions are in sess, can list the recordings at /admin/recordings
+//of API v1 and v2 (e.g. /api/1.0/admin/recordings) and clear them with DELETE. Requests for the recordings aren't recorded
+func NewRecordingRouter(rec *Recorder, sess *MemorySessionStore, next http.Handler) http.Handler {
+	r := mux.NewRouter()
+	r.Path("/api/{version:1\\.0|2\\.0}/admin/recordings").Methods("GET", "OPTIONS").Handler(logCORS(getRecordings(rec, sess)))
+	r.Path("/api/{version:1\\.0|2\\.0}/admin/recordings").Methods("DELETE").Handler(logCORS(deleteRecordings(rec, sess)))
+	r.NotFoundHandler = rec.record(next)
+
+	return r
+}
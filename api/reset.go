@@ -0,0 +1,243 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/mail"
+)
+
+//recoveryEmailSetting is the db setting key the admin's RecoveryEmail is stored under
+const recoveryEmailSetting = "recovery_email"
+
+//passwordResetSetting is the db setting key the pending passwordReset is stored under
+const passwordResetSetting = "password_reset"
+
+//resetTokenDuration is how long a password reset token can be used
+const resetTokenDuration = 30 * time.Minute
+
+//resetRequestInterval is how long after a token is sent before another can be requested, so the email can't be flooded
+const resetRequestInterval = time.Minute
+
+//resetMu serializes password reset requests and resets
+var resetMu = new(sync.Mutex)
+
+//RecoveryEmail is where password reset tokens are sent for the admin with the given Username
+type RecoveryEmail struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+//passwordReset is a pending password reset. Only the token's hash is stored
+type passwordReset struct {
+	Username string    `json:"username"`
+	Hash     string    `json:"hash"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//getRecoveryEmail returns the recovery email of the admin making the request
+func getRecoveryEmail(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		re := new(RecoveryEmail)
+		ok, err := d.ReadSetting(recoveryEmailSetting, re)
+		if err != nil {
+			log.Println("Unable to read recovery email:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if !ok || re.Username != session.Username {
+			re = &RecoveryEmail{Username: session.Username}
+		}
+
+		returnHTTP(w, http.StatusOK, re)
+	}
+}
+
+//putRecoveryEmail sets the address password reset tokens are sent to for the admin making the request.
+//An empty Email disables password resets
+func putRecoveryEmail(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		re := new(RecoveryEmail)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(re); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if re.Email != "" {
+			if _, err := netmail.ParseAddress(re.Email); err != nil {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "Invalid email address"})
+				return
+			}
+		}
+		re.Username = session.Username
+
+		var v interface{} = re
+		if re.Email == "" {
+			v = nil
+		}
+		if err := d.WriteSetting(recoveryEmailSetting, v); err != nil {
+			log.Println("Unable to write recovery email:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, re)
+	}
+}
+
+type forgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+//postForgotPassword emails a password reset token to the recovery email of the admin with the given username.
+//It always responds 202 Accepted so it can't be used to find the admin username or recovery email
+func postForgotPassword(d db.DB, smtp *mail.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(forgotPasswordRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if smtp == nil {
+			returnHTTP(w, http.StatusNotImplemented, &jsonError{Code: http.StatusNotImplemented, Description: "Password reset email isn't configured"})
+			return
+		}
+
+		if err := sendResetToken(d, smtp, req.Username); err != nil {
+			log.Println("Unable to send password reset token:", err)
+		}
+
+		returnHTTP(w, http.StatusAccepted, nil)
+	}
+}
+
+//sendResetToken stores a new password reset token for username and emails it, if username has a recovery email
+func sendResetToken(d db.DB, smtp *mail.Config, username string) error {
+	resetMu.Lock()
+	defer resetMu.Unlock()
+
+	re := new(RecoveryEmail)
+	ok, err := d.ReadSetting(recoveryEmailSetting, re)
+	if err != nil {
+		return fmt.Errorf("Unable to read recovery email: %v", err)
+	}
+	if !ok || re.Username == "" || re.Username != username {
+		return nil
+	}
+
+	pending := new(passwordReset)
+	ok, err = d.ReadSetting(passwordResetSetting, pending)
+	if err != nil {
+		return fmt.Errorf("Unable to read password reset: %v", err)
+	}
+
+	now := time.Now()
+	if ok && now.Sub(pending.Created) < resetRequestInterval {
+		return nil
+	}
+
+	token := randString(32)
+	reset := &passwordReset{Username: username, Hash: hashResetToken(token), Created: now, Expires: now.Add(resetTokenDuration)}
+	if err = d.WriteSetting(passwordResetSetting, reset); err != nil {
+		return fmt.Errorf("Unable to write password reset: %v", err)
+	}
+
+	m := &mail.Message{
+		To:      []string{re.Email},
+		Subject: "Password reset",
+		Body: fmt.Sprintf("A password reset was requested for %s.\n\nReset token: %s\n\nThe token expires at %s. If you didn't request a reset, ignore this email.\n",
+			username, token, reset.Expires.Format(time.RFC1123)),
+	}
+	return smtp.Send(m)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+//postResetPassword sets the admin password using an emailed password reset token, then signs out the admin's sessions.
+//The token can only be used once
+func postResetPassword(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(resetPasswordRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Token == "" || req.Password == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		resetMu.Lock()
+		defer resetMu.Unlock()
+
+		reset := new(passwordReset)
+		ok, err := d.ReadSetting(passwordResetSetting, reset)
+		if err != nil {
+			log.Println("Unable to read password reset:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if !ok || time.Now().After(reset.Expires) || subtle.ConstantTimeCompare([]byte(reset.Hash), []byte(hashResetToken(req.Token))) != 1 {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return
+		}
+
+		if err = d.WriteSetting(passwordResetSetting, nil); err != nil {
+			log.Println("Unable to clear password reset:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if err = db.WithActor(d, "reset:"+reset.Username).UpdateCredentials(reset.Username, req.Password); err != nil {
+			log.Println("Unable to update credentials:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		sess.RevokeUser(reset.Username, RoleAdmin)
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
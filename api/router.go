@@ -3,32 +3,257 @@ package api
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/assets"
 	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/mail"
 )
 
-//NewRouter returns an HTTP router for the HTTP API
-func NewRouter(db db.DB, sess *MemorySessionStore, sub *SubscribeService) http.Handler {
+//RouterOptions are the optional dependencies and settings of NewRouter. The zero value of each field disables what it configures
+type RouterOptions struct {
+	//Shaper paces large messages to subscribers, or is nil to send them immediately
+	Shaper *Shaper
+	//ControlTokens are the tokens accepted by the /control routes
+	ControlTokens []string
+	//SMS verifies requests from the SMS gateway, or is nil to disable it
+	SMS *SMSGateway
+	//SetupToken is required to create the first competition, if it isn't empty
+	SetupToken string
+	//Sunset is sent in the Sunset header of v1 responses, if it isn't zero
+	Sunset time.Time
+	//Features are the enabled features, or DefaultFeatures if nil. Routes of disabled features return 404 Not Found
+	Features Features
+	//ArchiveDir is the directory of archived competitions teams are compared across, or empty if there isn't one
+	ArchiveDir string
+	//SMTP sends password reset emails, or is nil to disable them
+	SMTP *mail.Config
+}
+
+//NewRouter returns an HTTP router for the HTTP API, serving v1 at /api/1.0 and v2 at /api/2.0.
+//v1 responses are marked deprecated and encode scores as numbers, or null if unscored, as v1 always has
+func NewRouter(db db.DB, sess *MemorySessionStore, sub *SubscribeService, limiter *ConnectionLimiter, cues *CueService, store assets.Store, opts RouterOptions) http.Handler {
+	shaper, controlTokens, sms, setupToken := opts.Shaper, opts.ControlTokens, opts.SMS, opts.SetupToken
+	sunset, features, archiveDir, smtp := opts.Sunset, opts.Features, opts.ArchiveDir, opts.SMTP
+	if sms == nil {
+		sms = new(SMSGateway)
+	}
+	if features == nil {
+		features = DefaultFeatures()
+	}
 
 	r := mux.NewRouter()
+	timer := NewTimer(sub)
+	stats := NewStats(limiter)
+	playlist := NewPlaylistService(db, sub)
+	reveal := NewReveal()
+	devices := NewDeviceRegistry(db)
+	announcements := NewAnnouncementService(db, sub)
+	highlights := NewHighlightService(db, sub)
+	finalizer := NewFinalizer(db, sub)
+	go watchStorage(db, sub)
 
+	r.Path("/features").Methods("GET").Handler(getFeatures(features))
 	r.Path("/auth").Methods("POST").Handler(postAuth(db, sess))
 	r.Path("/auth").Methods("PUT").Handler(putAuth(db, sess))
-	r.Path("/competition").Methods("GET").Handler(getCompetition(db))
-	r.Path("/competition").Methods("PUT").Handler(putCompetition(db, sess, sub))
-	r.Path("/competition/subscribe").Handler(subscribeCompetition(sub))
+	r.Path("/auth").Methods("DELETE").Handler(deleteAuth(sess))
+	r.Path("/auth/refresh").Methods("POST").Handler(postAuthRefresh(sess))
+	r.Path("/auth/forgot").Methods("POST").Handler(postForgotPassword(db, smtp))
+	r.Path("/auth/reset").Methods("POST").Handler(postResetPassword(db, sess))
+	r.Path("/auth/recovery-email").Methods("GET").Handler(getRecoveryEmail(db, sess))
+	r.Path("/auth/recovery-email").Methods("PUT").Handler(putRecoveryEmail(db, sess))
+	r.Path("/auth/me").Methods("GET").Handler(getAuth(sess))
+	r.Path("/auth/me/notifications").Methods("GET").Handler(getNotifications(db, sess))
+	r.Path("/auth/me/notifications").Methods("PUT").Handler(putNotifications(db, sess))
+	r.Path("/competition").Methods("GET").Handler(getCompetition(db, sess, limiter))
+	r.Path("/competition").Methods("POST").Handler(postCompetition(db, sess, setupToken))
+	r.Path("/competition").Methods("PUT").Handler(dryRunnable(db, sess, sub, putCompetition))
+	r.Path("/competition").Methods("DELETE").Handler(deleteCompetition(db, sess, sub))
+	r.Path("/competition/tags").Methods("GET").Handler(getTags(db, sess))
+	r.Path("/competition/archived").Methods("GET").Handler(getArchived(db, sess))
+	r.Path("/competition/archived/{id}/unarchive").Methods("POST").Handler(postUnarchive(db, sess, sub))
+	r.Path("/competition/meta").Methods("PATCH").Handler(dryRunnable(db, sess, sub, patchCompetitionMeta))
+	r.Path("/competition/fields").Methods("GET").Handler(getFieldDefinitions(db, sess))
+	r.Path("/competition/fields").Methods("PUT").Handler(putFieldDefinitions(db, sess))
+	r.Path("/competition/anomalies").Methods("GET").Handler(getAnomalies(db, sess))
+	r.Path("/competition/computed").Methods("GET").Handler(getComputed(db, sess))
+	r.Path("/competition/computed").Methods("PUT").Handler(dryRunnable(db, sess, sub, putComputed))
+	r.Path("/competition/precision").Methods("GET").Handler(getPrecision(db, sess))
+	r.Path("/competition/precision").Methods("PUT").Handler(dryRunnable(db, sess, sub, putPrecision))
+	r.Path("/competition/scoresheets").Methods("GET").Handler(getScoreSheets(db, sess))
+	r.Path("/competition/bracket").Methods("GET").Handler(getBracket(db, sess))
+	r.Path("/competition/bracket.svg").Methods("GET").Handler(getBracketSVG(db, sess))
+	r.Path("/competition/rooms").Methods("GET").Handler(getRooms(db, sess))
+	r.Path("/competition/rooms").Methods("PUT").Handler(putRooms(db, sess))
+	r.Path("/competition/assignments").Methods("GET").Handler(getAssignments(db, sess))
+	r.Path("/competition/assignments").Methods("POST").Handler(postAssignments(db, sess))
+	r.Path("/competition/assignments/rosters").Methods("GET").Handler(getRosters(db, sess))
+	r.Path("/competition/grid").Methods("GET").Handler(getGrid(db, sess))
+	r.Path("/competition/grid").Methods("PUT").Handler(scoreWrite(dryRunnable(db, sess, sub, putGrid)))
+	r.Path("/competition/locks").Methods("GET").Handler(getLocks(db, sess))
+	r.Path("/competition/rounds/{round}/lock").Methods("PUT").Handler(setLock(db, sess, true))
+	r.Path("/competition/rounds/{round}/lock").Methods("DELETE").Handler(setLock(db, sess, false))
+	r.Path("/competition/rounds/{round}/paste").Methods("POST").Handler(scoreWrite(dryRunnable(db, sess, sub, postPaste)))
+	r.Path("/competition/rules").Methods("GET").Handler(getRules(db, sess))
+	r.Path("/competition/rules").Methods("PUT").Handler(putRules(db, sess))
+	r.Path("/competition/state").Methods("GET").Handler(getState(db))
+	r.Path("/competition/state").Methods("PUT").Handler(putState(db, sess, sub))
+	r.Path("/competition/state/finalize").Methods("GET").Handler(getFinalizeSchedule(finalizer))
+	r.Path("/competition/state/finalize").Methods("PUT").Handler(putFinalizeSchedule(sess, finalizer))
+	r.Path("/competition/state/finalize").Methods("DELETE").Handler(deleteFinalizeSchedule(sess, finalizer))
+	r.Path("/competition/announcements").Methods("GET").Handler(getAnnouncements(announcements, sess))
+	r.Path("/competition/announcements").Methods("POST").Handler(postAnnouncement(announcements, sess))
+	r.Path("/competition/announcements/{id}").Methods("DELETE").Handler(deleteAnnouncement(announcements, sess))
+	r.Path("/competition/timer").Methods("PUT").Handler(putTimer(sess, timer))
+	r.Path("/competition/teams/{team}").Methods("GET").Handler(getTeam(db, sess))
+	r.Path("/competition/teams/{team}/public").Methods("GET").Handler(getPublicTeam(db, sess))
+	r.Path("/competition/handicaps").Methods("GET").Handler(getHandicaps(db, sess))
+	r.Path("/competition/teams/{team}/handicap").Methods("PUT").Handler(setHandicap(db, sess, sub, false))
+	r.Path("/competition/teams/{team}/handicap").Methods("DELETE").Handler(setHandicap(db, sess, sub, true))
+	r.Path("/competition/teams/{team}/logo").Methods("GET").Handler(getTeamLogo(db, store))
+	r.Path("/competition/teams/{team}/logo").Methods("PUT").Handler(putTeamLogo(db, store, sess, sub))
+	r.Path("/competition/teams/{team}/logo").Methods("DELETE").Handler(deleteTeamLogo(db, store, sess, sub))
+	r.Path("/competition/import").Methods("POST").Handler(importCompetition(db, sess, sub))
+	r.Path("/competition/archive").Methods("GET").Handler(getArchive(db, store, sess))
+	r.Path("/competition/archives").Methods("GET").Handler(getArchives(archiveDir, sess))
+	r.Path("/competition/compare").Methods("GET").Handler(getComparison(db, archiveDir, sess))
+	r.Path("/competition/archive").Methods("POST").Handler(postArchive(db, store, sess, sub))
+	r.Path("/competition/cues").Methods("GET").Handler(getCues(cues))
+	r.Path("/competition/highlights").Methods("GET").Handler(getHighlights(highlights))
+	r.Path("/competition/subscribe").Handler(subscribeCompetition(db, sub, limiter, shaper, stats))
 	r.Path("/competition/revisions").Methods("GET").Handler(getRevisions(db, sess))
 	r.Path("/competition/revisions/{id:[0-9]+}").Methods("GET").Handler(getRevision(db, sess))
+	r.Path("/competition/revisions/compare").Methods("GET").Handler(getRevisionCompare(db, sess))
+	r.Path("/competition/revisions/{a:[0-9]+}/diff/{b:[0-9]+}").Methods("GET").Handler(getRevisionDiff(db, sess))
+	r.Path("/competition/revisions/{id:[0-9]+}/restore").Methods("POST").Handler(postRestoreRevision(db, sess, sub))
+
+	r.Path("/playlist").Methods("GET").Handler(features.require(FeaturePlaylist, getPlaylist(db)))
+	r.Path("/playlist").Methods("PUT").Handler(features.require(FeaturePlaylist, putPlaylist(db, sess, playlist)))
+	r.Path("/playlist/current").Methods("GET").Handler(features.require(FeaturePlaylist, getPlaylistCurrent(playlist)))
+	r.Path("/assets").Methods("GET").Handler(getAssets(store, sess))
+	r.Path("/assets/{name}").Methods("PUT").Handler(putAsset(store, sess))
+	r.Path("/assets/{name}").Methods("DELETE").Handler(deleteAsset(store, sess))
+	r.Path("/branding").Methods("GET").Handler(getBranding(db))
+	r.Path("/branding").Methods("PUT").Handler(putBranding(db, sess))
+	r.Path("/control/reveal/next").Methods("GET", "POST").Handler(controlRevealNext(controlTokens, reveal, sub))
+	r.Path("/control/reveal/reset").Methods("GET", "POST").Handler(controlRevealReset(controlTokens, reveal, sub))
+	r.Path("/control/freeze").Methods("GET", "POST").Handler(controlFreeze(db, controlTokens, sub))
+	r.Path("/control/timer").Methods("GET", "POST").Handler(controlTimer(controlTokens, timer))
+	r.Path("/devices").Methods("POST").Handler(features.require(FeatureDevices, postDevice(devices)))
+	r.Path("/devices/{id}/heartbeat").Methods("PUT").Handler(features.require(FeatureDevices, putDeviceHeartbeat(devices)))
+	r.Path("/admin/devices").Methods("GET").Handler(features.require(FeatureDevices, getDevices(devices, sess)))
+	r.Path("/admin/devices/{id}/view").Methods("PUT").Handler(features.require(FeatureDevices, putDeviceView(devices, sess, sub)))
+	r.Path("/admin/devices/{id}").Methods("DELETE").Handler(features.require(FeatureDevices, deleteDevice(devices, sess)))
+	r.Path("/maintenance").Methods("GET").Handler(getMaintenance(db))
+	r.Path("/maintenance").Methods("PUT").Handler(putMaintenance(db, sess, sub))
+	r.Path("/judges").Methods("GET").Handler(features.require(FeatureJudges, getJudges(db, sess)))
+	r.Path("/judges").Methods("PUT").Handler(features.require(FeatureJudges, putJudge(db, sess)))
+	r.Path("/judges/{name}").Methods("DELETE").Handler(features.require(FeatureJudges, deleteJudge(db, sess)))
+	r.Path("/judges/double-entry").Methods("GET").Handler(features.require(FeatureJudges, getDoubleEntry(db, sess)))
+	r.Path("/judges/double-entry").Methods("PUT").Handler(features.require(FeatureJudges, putDoubleEntry(db, sess)))
+	r.Path("/judges/panel").Methods("GET").Handler(features.require(FeatureJudges, getPanel(db, sess)))
+	r.Path("/judges/panel").Methods("PUT").Handler(features.require(FeatureJudges, putPanel(db, sess)))
+	r.Path("/judges/calibration").Methods("GET").Handler(features.require(FeatureJudges, getCalibration(db, sess)))
+	r.Path("/judges/verifications").Methods("GET").Handler(features.require(FeatureJudges, getVerifications(db, sess)))
+	r.Path("/judges/verifications/{team}/{round}").Methods("PUT").Handler(features.require(FeatureJudges, putVerification(db, sess, sub)))
+	r.Path("/judges/verifications/{team}/{round}").Methods("DELETE").Handler(features.require(FeatureJudges, deleteVerification(db, sess)))
+	r.Path("/judge/drafts").Methods("GET").Handler(features.require(FeatureJudges, getDrafts(db, sess)))
+	r.Path("/judge/drafts").Methods("PUT").Handler(features.require(FeatureJudges, putDraft(db, sess)))
+	r.Path("/judge/drafts/submit").Methods("POST").Handler(features.require(FeatureJudges, dryRunnable(db, sess, sub, submitDrafts)))
+	r.Path("/competition/attributions").Methods("GET").Handler(getAttributions(db, sess))
+	r.Path("/gateway/sms").Methods("POST").Handler(features.require(FeatureSMSGateway, postSMS(db, sub, sms)))
+	r.Path("/gateway/numbers").Methods("GET").Handler(features.require(FeatureSMSGateway, getGatewayNumbers(db, sess)))
+	r.Path("/gateway/numbers").Methods("PUT").Handler(features.require(FeatureSMSGateway, putGatewayNumbers(db, sess)))
+	r.Path("/ingest/{system}").Methods("POST").Handler(features.require(FeatureIngest, postIngest(db, sub)))
+	r.Path("/admin/ingest").Methods("GET").Handler(features.require(FeatureIngest, getIngestSystems(db, sess)))
+	r.Path("/admin/ingest").Methods("PUT").Handler(features.require(FeatureIngest, putIngestSystems(db, sess)))
+	r.Path("/hooks/revisions").Methods("GET").Handler(features.require(FeatureHooks, getHookRevisions(db)))
+	r.Path("/hooks/score").Methods("POST").Handler(features.require(FeatureHooks, postHookScore(db, sub)))
+	r.Path("/admin/apikeys").Methods("GET").Handler(features.require(FeatureHooks, getAPIKeys(db, sess)))
+	r.Path("/admin/apikeys").Methods("POST").Handler(features.require(FeatureHooks, postAPIKey(db, sess)))
+	r.Path("/admin/apikeys/{id}").Methods("DELETE").Handler(features.require(FeatureHooks, deleteAPIKey(db, sess)))
+	r.Path("/admin/teams/rename").Methods("POST").Handler(postTeamRename(db, sess, sub))
+	r.Path("/admin/stats").Methods("GET").Handler(getStats(db, sess, sub, stats))
+	r.Path("/admin/subscribers").Methods("GET").Handler(getSubscribers(sub, sess))
+	r.Path("/admin/storage").Methods("GET").Handler(getStorage(db, sess))
+	r.Path("/admin/storage").Methods("PUT").Handler(putStorage(db, sess))
+	r.Path("/admin/backup").Methods("GET").Handler(getBackup(db, sess))
+	r.Path("/admin/restore").Methods("POST").Handler(postRestore(db, sess, sub))
+	r.Path("/admin/export").Methods("GET").Handler(getExport(db, sess))
+	r.Path("/admin/import").Methods("POST").Handler(postImport(db, sess, sub))
+	r.Path("/admin/recovery").Methods("DELETE").Handler(deleteRecovery(db, sess))
+	r.Path("/audit").Methods("GET").Handler(getAudit(db, sess))
+	r.Path("/competition/events").Methods("GET").Handler(getScoreEvents(db, sess))
+	r.Path("/search").Methods("GET").Handler(getSearch(db, announcements, archiveDir, sess))
+	r.Path("/admin/service-accounts").Methods("GET").Handler(getServiceAccounts(db, sess))
+	r.Path("/admin/service-accounts").Methods("POST").Handler(postServiceAccount(db, sess))
+	r.Path("/admin/service-accounts/{id}/rotate").Methods("POST").Handler(rotateServiceAccount(db, sess))
+	r.Path("/admin/service-accounts/{id}").Methods("DELETE").Handler(deleteServiceAccount(db, sess))
 
 	r.NotFoundHandler = http.HandlerFunc(notFound)
 
-	chain := handlers.LoggingHandler(os.Stdout, handlers.CompressHandler(handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Accept", "Authorization", "Content-Type", "Origin"}),
-	)(http.StripPrefix("/api/1.0", r))))
+	//v2 models teams, rounds, and scores as resources; routes it doesn't define are served by v1
+	v2 := mux.NewRouter()
+	v2.Path("/sessions").Methods("POST").Handler(postAuth(db, sess))
+	v2.Path("/sessions/current").Methods("GET").Handler(getAuth(sess))
+	v2.Path("/sessions/current").Methods("DELETE").Handler(deleteAuth(sess))
+	v2.Path("/sessions/refresh").Methods("POST").Handler(postAuthRefresh(sess))
+	v2.Path("/competition").Methods("GET").Handler(getCompetition(db, sess, limiter))
+	v2.Path("/competition").Methods("POST").Handler(postCompetition(db, sess, setupToken))
+	v2.Path("/competition").Methods("PUT").Handler(dryRunnable(db, sess, sub, putCompetition))
+	v2.Path("/competition").Methods("PATCH").Handler(dryRunnable(db, sess, sub, patchCompetitionMeta))
+	v2.Path("/grid").Methods("GET").Handler(getGrid(db, sess))
+	v2.Path("/grid").Methods("PUT").Handler(scoreWrite(dryRunnable(db, sess, sub, putGrid)))
+	v2.Path("/teams").Methods("GET").Handler(getTeams(db, sess))
+	v2.Path("/tags").Methods("GET").Handler(getTags(db, sess))
+	v2.Path("/teams").Methods("POST").Handler(postTeam(db, sess, sub))
+	v2.Path("/teams/{team}").Methods("GET").Handler(getTeam(db, sess))
+	v2.Path("/teams/{team}").Methods("PATCH").Handler(dryRunnable(db, sess, sub, patchTeam))
+	v2.Path("/teams/{team}").Methods("DELETE").Handler(deleteTeam(db, sess, sub))
+	v2.Path("/teams/{team}/public").Methods("GET").Handler(getPublicTeam(db, sess))
+	v2.Path("/handicaps").Methods("GET").Handler(getHandicaps(db, sess))
+	v2.Path("/teams/{team}/handicap").Methods("PUT").Handler(setHandicap(db, sess, sub, false))
+	v2.Path("/teams/{team}/handicap").Methods("DELETE").Handler(setHandicap(db, sess, sub, true))
+	v2.Path("/teams/{team}/logo").Methods("GET").Handler(getTeamLogo(db, store))
+	v2.Path("/teams/{team}/logo").Methods("PUT").Handler(putTeamLogo(db, store, sess, sub))
+	v2.Path("/teams/{team}/logo").Methods("DELETE").Handler(deleteTeamLogo(db, store, sess, sub))
+	v2.Path("/teams/{team}/scores").Methods("GET").Handler(getTeamScores(db, sess))
+	v2.Path("/teams/{team}/scores/{round}").Methods("GET").Handler(getTeamScore(db, sess))
+	v2.Path("/teams/{team}/scores/{round}").Methods("PUT").Handler(scoreWrite(dryRunnable(db, sess, sub, putTeamScore)))
+	v2.Path("/rounds").Methods("GET").Handler(getRounds(db, sess))
+	v2.Path("/rounds").Methods("POST").Handler(postRound(db, sess, sub))
+	v2.Path("/rounds/{round}").Methods("GET").Handler(getRound(db, sess))
+	v2.Path("/rounds/{round}").Methods("PATCH").Handler(dryRunnable(db, sess, sub, patchRound))
+	v2.Path("/rounds/{round}").Methods("DELETE").Handler(deleteRound(db, sess, sub))
+	v2.Path("/rounds/{round}/lock").Methods("PUT").Handler(setLock(db, sess, true))
+	v2.Path("/rounds/{round}/lock").Methods("DELETE").Handler(setLock(db, sess, false))
+	v2.Path("/rounds/{round}/paste").Methods("POST").Handler(scoreWrite(dryRunnable(db, sess, sub, postPaste)))
+	v2.Path("/revisions").Methods("GET").Handler(getRevisions(db, sess))
+	v2.Path("/revisions/{id:[0-9]+}").Methods("GET").Handler(getRevision(db, sess))
+	v2.Path("/revisions/compare").Methods("GET").Handler(getRevisionCompare(db, sess))
+	v2.Path("/revisions/{a:[0-9]+}/diff/{b:[0-9]+}").Methods("GET").Handler(getRevisionDiff(db, sess))
+	v2.Path("/revisions/{id:[0-9]+}/restore").Methods("POST").Handler(postRestoreRevision(db, sess, sub))
+	v2.NotFoundHandler = r
 
-	return chain
+	root := mux.NewRouter()
+	root.PathPrefix("/api/1.0/").Handler(deprecated(http.StripPrefix("/api/1.0", compress(v1Adapter(r))), "/api/2.0", sunset))
+	root.PathPrefix("/api/2.0/").Handler(features.require(FeatureAPIv2, http.StripPrefix("/api/2.0", compress(v2))))
+	root.NotFoundHandler = http.HandlerFunc(notFound)
+
+	if features.Enabled(FeatureBasicAuth) {
+		return logCORS(serviceAuth(db, basicAuth(db, root)))
+	}
+	return logCORS(serviceAuth(db, root))
+}
+
+//logCORS wraps h with request logging and the API's CORS policy
+func logCORS(h http.Handler) http.Handler {
+	return handlers.LoggingHandler(os.Stdout, handlers.CORS(
+		handlers.AllowedOrigins([]string{"*"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Accept", "Authorization", "Content-Type", "Origin", "X-API-Key", "X-Setup-Token", "X-Subscriber-ID"}),
+		handlers.ExposedHeaders([]string{"Deprecation", "Sunset", "Link", "X-Poll-Interval"}),
+	)(h))
 }
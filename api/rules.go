@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/rules"
+)
+
+//rulesSetting is the db setting key round validation rules are stored under, keyed by round ID
+const rulesSetting = "validation_rules"
+
+//ruleVariables are the variables rules can reference
+var ruleVariables = []string{"score"}
+
+//ruleError is returned if a score doesn't satisfy its round's validation rule
+type ruleError struct {
+	Round string
+	Rule  string
+	Score db.Score
+}
+
+func (e *ruleError) Error() string {
+	return fmt.Sprintf("%s score %s doesn't satisfy %s", e.Round, e.Score, e.Rule)
+}
+
+//applyErrorBody returns the response body for the status and error returned by applyScores.
+//Invalid scores are described to the client; other errors are logged with msg
+func applyErrorBody(code int, err error, msg string) interface{} {
+	if isInvalid(err) {
+		return &jsonError{Code: code, Description: err.Error()}
+	}
+	if err != nil {
+		log.Println(msg, err)
+	}
+	return nil
+}
+
+func readRules(d db.DB) (map[string]string, error) {
+	rs := make(map[string]string)
+	_, err := d.ReadSetting(rulesSetting, &rs)
+	return rs, err
+}
+
+//checkRules returns a *ruleError if a scored draft, which must be resolved against c, doesn't satisfy its round's rule,
+//or another error if one occurred. Unscored rounds and no-shows aren't checked
+func checkRules(d db.DB, c *db.Competition, scores []*Draft) error {
+	rs, err := readRules(d)
+	if err != nil {
+		return fmt.Errorf("Unable to read validation rules: %v", err)
+	}
+
+	if len(rs) == 0 {
+		return nil
+	}
+
+	parsed := make(map[string]*rules.Rule)
+	for _, s := range scores {
+		src, ok := rs[s.RoundID]
+		if !ok || !s.Score.Scored() {
+			continue
+		}
+
+		rule, ok := parsed[s.RoundID]
+		if !ok {
+			if rule, err = rules.Parse(src, ruleVariables...); err != nil {
+				return fmt.Errorf("Unable to parse validation rule for round %s: %v", s.RoundID, err)
+			}
+			parsed[s.RoundID] = rule
+		}
+
+		valid, err := rule.Check(map[string]int64{"score": int64(s.Score.Value)})
+		if err != nil || !valid {
+			return &ruleError{Round: c.Rounds[s.Round], Rule: src, Score: s.Score}
+		}
+	}
+
+	return nil
+}
+
+//changedScores returns the scores in c that differ from old, resolved against c
+func changedScores(old, c *db.Competition) []*Draft {
+	var scores []*Draft
+	for _, e := range competitionEvents(0, old, c) {
+		if p, ok := e.Payload.(*ScoreUpdatePayload); ok {
+			scores = append(scores, &Draft{Team: p.Team, TeamID: p.TeamID, Round: p.Round, RoundID: p.RoundID, Score: p.Score})
+		}
+	}
+	return scores
+}
+
+//rulesRequest sets the validation rule of each round by round ID. Rounds without a rule accept any score
+type rulesRequest struct {
+	Rules map[string]string `json:"rules"`
+}
+
+func getRules(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		rs, err := readRules(d)
+		if err != nil {
+			log.Println("Unable to read validation rules:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &rulesRequest{Rules: rs})
+	}
+}
+
+//putRules replaces the validation rules. Rules are checked when scores are submitted, not against existing scores
+func putRules(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(rulesRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if c == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		rs := make(map[string]string)
+		for id, src := range req.Rules {
+			if src == "" {
+				continue
+			}
+
+			if c.RoundIndex(id) < 0 {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Round %s doesn't exist", id)})
+				return
+			}
+
+			if _, err = rules.Parse(src, ruleVariables...); err != nil {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Invalid rule for %s: %v", c.Rounds[c.RoundIndex(id)], err)})
+				return
+			}
+
+			rs[id] = src
+		}
+
+		if err = d.WriteSetting(rulesSetting, rs); err != nil {
+			log.Println("Unable to write validation rules:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &rulesRequest{Rules: rs})
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/pdf"
+)
+
+//maxSheetJudges is the most judge signature lines a score sheet can have
+const maxSheetJudges = 10
+
+//Score sheet layout in points
+const (
+	sheetMargin     = 36
+	sheetRow        = 24
+	sheetFontSize   = 10
+	sheetIndex      = 28
+	sheetMinTeam    = 140
+	sheetMaxField   = 90
+	sheetScore      = 60
+	sheetInitials   = 48
+	sheetJudgeLine  = 32
+	sheetFooterSpan = 12
+)
+
+//sheetCell returns the text of a recorded score with p's decimal places on a score sheet, or empty if it's unscored
+func sheetCell(p *db.Precision, s db.Score) string {
+	switch s.State {
+	case db.ScoreScored:
+		return p.Format(s.Value)
+	case db.ScoreNoShow:
+		return "NS"
+	}
+	return ""
+}
+
+//renderScoreSheets returns a PDF with a score sheet for each of the given rounds of c. Each sheet lists every team with a
+//column for each score field, the score, and the judge's initials, and ends with a name and signature line for each judge.
+//If filled is true, recorded scores are printed on the sheet
+func renderScoreSheets(c *db.Competition, rounds []int, fields []*FieldDefinition, judges int, filled bool) []byte {
+	doc := pdf.New(c.Name + " Score Sheets")
+	width := doc.Width - 2*sheetMargin
+
+	fieldWidth := float64(sheetMaxField)
+	if len(fields) > 0 {
+		if w := (width - sheetIndex - sheetMinTeam - sheetScore - sheetInitials) / float64(len(fields)); w < fieldWidth {
+			fieldWidth = w
+		}
+	}
+	teamWidth := width - sheetIndex - sheetScore - sheetInitials - fieldWidth*float64(len(fields))
+	bottom := doc.Height - sheetMargin - float64(judges)*sheetJudgeLine - sheetFooterSpan
+
+	for _, round := range rounds {
+		var page *pdf.Page
+		var y float64
+		sheet := 0
+
+		header := func() {
+			page = doc.AddPage()
+			sheet++
+			page.Text(sheetMargin, sheetMargin+18, 18, true, pdf.Truncate(c.Rounds[round], width-80, 18, true))
+			page.TextRight(doc.Width-sheetMargin, sheetMargin+18, 10, false, fmt.Sprintf("Sheet %d", sheet))
+			page.Text(sheetMargin, sheetMargin+34, 10, false, pdf.Truncate(c.Name, width, 10, false))
+
+			y = sheetMargin + 48
+			page.Fill(sheetMargin, y, width, sheetRow, 0.85)
+			baseline := y + sheetRow - 8
+			x := float64(sheetMargin)
+			page.Text(x+4, baseline, sheetFontSize, true, "#")
+			x += sheetIndex
+			page.Text(x+4, baseline, sheetFontSize, true, "Team")
+			x += teamWidth
+			for _, f := range fields {
+				page.Text(x+4, baseline, sheetFontSize, true, pdf.Truncate(f.Name, fieldWidth-8, sheetFontSize, true))
+				x += fieldWidth
+			}
+			page.Text(x+4, baseline, sheetFontSize, true, "Score")
+			x += sheetScore
+			page.Text(x+4, baseline, sheetFontSize, true, "Initials")
+			y += sheetRow
+
+			//judge lines are printed on every sheet so pages can be verified independently
+			line := bottom + sheetFooterSpan
+			for j := 0; j < judges; j++ {
+				line += sheetJudgeLine
+				page.Text(sheetMargin, line, sheetFontSize, false, "Judge")
+				page.Line(sheetMargin+40, line+2, sheetMargin+width/2-12, line+2, 0.5)
+				page.Text(sheetMargin+width/2, line, sheetFontSize, false, "Signature")
+				page.Line(sheetMargin+width/2+56, line+2, sheetMargin+width, line+2, 0.5)
+			}
+		}
+
+		header()
+		for i, t := range c.Teams {
+			if y+sheetRow > bottom {
+				header()
+			}
+
+			page.Rect(sheetMargin, y, width, sheetRow, 0.5)
+			baseline := y + sheetRow - 8
+			x := float64(sheetMargin)
+			page.Text(x+4, baseline, sheetFontSize, false, strconv.Itoa(i+1))
+			x += sheetIndex
+			page.Line(x, y, x, y+sheetRow, 0.5)
+			page.Text(x+4, baseline, sheetFontSize, false, pdf.Truncate(t.Name, teamWidth-8, sheetFontSize, false))
+			x += teamWidth
+			for _, f := range fields {
+				page.Line(x, y, x, y+sheetRow, 0.5)
+				if v, ok := t.Scores[round].Fields[f.Name]; ok && filled && v != nil {
+					page.Text(x+4, baseline, sheetFontSize, false, pdf.Truncate(fmt.Sprint(v), fieldWidth-8, sheetFontSize, false))
+				}
+				x += fieldWidth
+			}
+			page.Line(x, y, x, y+sheetRow, 0.5)
+			if filled {
+				page.TextRight(x+sheetScore-4, baseline, sheetFontSize, false, sheetCell(c.Precision, t.Scores[round]))
+			}
+			x += sheetScore
+			page.Line(x, y, x, y+sheetRow, 0.5)
+			y += sheetRow
+		}
+	}
+
+	return doc.Bytes()
+}
+
+//getScoreSheets returns a PDF of printable score sheets. The round query parameter, which can be given more than once,
+//limits the sheets to the given rounds by ID or index; otherwise there is a sheet for every round that isn't computed.
+//The judges query parameter sets the number of judge signature lines (default 1), and scores=true prints recorded scores
+func getScoreSheets(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		judges := 1
+		if v := r.URL.Query().Get("judges"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > maxSheetJudges {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("judges must be between 0 and %d", maxSheetJudges)})
+				return
+			}
+			judges = n
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		var rounds []int
+		for _, ref := range r.URL.Query()["round"] {
+			round := c.FindRound(ref)
+			if round < 0 {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Unknown round %s", ref)})
+				return
+			}
+			rounds = append(rounds, round)
+		}
+		if rounds == nil {
+			for i := range c.Rounds {
+				if !c.IsComputed(i) {
+					rounds = append(rounds, i)
+				}
+			}
+		}
+
+		if len(rounds) == 0 {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		defs, err := readFieldDefinitions(d)
+		if err != nil {
+			log.Println("Unable to read custom fields:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		buf := renderScoreSheets(c, rounds, defs.Score, judges, r.URL.Query().Get("scores") == "true")
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-score-sheets-%s.pdf"`, db.Slug(c.Name), time.Now().Format("20060102-150405")))
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(buf); err != nil {
+			log.Println("Unable to write score sheets:", err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/archive"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//maxSearchResults is the most results returned by a search
+const maxSearchResults = 200
+
+//Search result kinds
+const (
+	SearchTeam         = "team"
+	SearchRoster       = "roster"
+	SearchField        = "field"
+	SearchAnnouncement = "announcement"
+	SearchAudit        = "audit"
+)
+
+//SearchResult is a match for a search query. Text is the matched text.
+//Archive is the file of the archived competition the match is in, or empty for the current competition.
+//Team and Round are set for matches in a team or score, ID is set for announcements and audit entries,
+//and Time is set for audit entries
+type SearchResult struct {
+	Kind    string     `json:"kind"`
+	Text    string     `json:"text"`
+	Archive string     `json:"archive,omitempty"`
+	TeamID  string     `json:"team_id,omitempty"`
+	Team    string     `json:"team,omitempty"`
+	RoundID string     `json:"round_id,omitempty"`
+	Round   string     `json:"round,omitempty"`
+	ID      string     `json:"id,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+}
+
+type searchResponse struct {
+	Query     string          `json:"query"`
+	Results   []*SearchResult `json:"results"`
+	Truncated bool            `json:"truncated"`
+}
+
+//search collects the results matching every term of a query
+type search struct {
+	terms     []string
+	results   []*SearchResult
+	truncated bool
+}
+
+func newSearch(q string) *search {
+	return &search{terms: strings.Fields(strings.ToLower(q)), results: make([]*SearchResult, 0)}
+}
+
+//matches returns whether text contains every term, ignoring case
+func (s *search) matches(text string) bool {
+	text = strings.ToLower(text)
+	for _, t := range s.terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+//add adds r if its text matches and returns false once the search is full
+func (s *search) add(r *SearchResult) bool {
+	if !s.matches(r.Text) {
+		return true
+	}
+	if len(s.results) >= maxSearchResults {
+		s.truncated = true
+		return false
+	}
+	s.results = append(s.results, r)
+	return true
+}
+
+//fieldsText returns fields as "key: value" strings, sorted by key
+func fieldsText(fields db.Fields) []string {
+	texts := make([]string, 0, len(fields))
+	for k, v := range fields {
+		texts = append(texts, fmt.Sprintf("%s: %v", k, v))
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+//competition searches the team names, rosters, and team and score fields of c, which is in the given archive file, or the current competition if it's empty
+func (s *search) competition(c *db.Competition, file string) bool {
+	for _, t := range c.Teams {
+		if !s.add(&SearchResult{Kind: SearchTeam, Text: t.Name, Archive: file, TeamID: t.ID, Team: t.Name}) {
+			return false
+		}
+		for _, member := range t.Roster {
+			if !s.add(&SearchResult{Kind: SearchRoster, Text: member, Archive: file, TeamID: t.ID, Team: t.Name}) {
+				return false
+			}
+		}
+		for _, text := range fieldsText(t.Fields) {
+			if !s.add(&SearchResult{Kind: SearchField, Text: text, Archive: file, TeamID: t.ID, Team: t.Name}) {
+				return false
+			}
+		}
+		for i, score := range t.Scores {
+			if i >= len(c.Rounds) {
+				break
+			}
+			for _, text := range fieldsText(score.Fields) {
+				r := &SearchResult{Kind: SearchField, Text: text, Archive: file, TeamID: t.ID, Team: t.Name, Round: c.Rounds[i]}
+				if i < len(c.RoundIDs) {
+					r.RoundID = c.RoundIDs[i]
+				}
+				if !s.add(r) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+//auditTexts returns the text of e that's searched: who made it, the usernames of credential changes,
+//and the names, renames, and score fields in the diff of a write
+func auditTexts(e *db.AuditEntry) []string {
+	texts := []string{e.Actor, e.Old, e.New}
+	d := e.Diff
+	if d == nil {
+		return texts
+	}
+
+	renames := append(append([]*db.Rename(nil), d.RenamedRounds...), d.RenamedTeams...)
+	if d.Name != nil {
+		renames = append(renames, d.Name)
+	}
+	for _, r := range renames {
+		texts = append(texts, fmt.Sprintf("renamed %s to %s", r.Old, r.New))
+	}
+
+	for _, items := range [][]*db.DiffItem{d.AddedRounds, d.RemovedRounds, d.AddedTeams, d.RemovedTeams} {
+		for _, item := range items {
+			texts = append(texts, item.Name)
+		}
+	}
+
+	for _, sc := range d.Scores {
+		texts = append(texts, fmt.Sprintf("%s %s", sc.Team, sc.Round))
+		for _, text := range fieldsText(sc.New.Fields) {
+			texts = append(texts, fmt.Sprintf("%s %s %s", sc.Team, sc.Round, text))
+		}
+	}
+	return texts
+}
+
+//audit searches entries, newest first, adding at most one result per entry
+func (s *search) audit(entries []*db.AuditEntry) bool {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		for _, text := range auditTexts(e) {
+			if text == "" || !s.matches(text) {
+				continue
+			}
+			t := e.Time
+			if !s.add(&SearchResult{Kind: SearchAudit, Text: text, ID: strconv.FormatUint(e.ID, 10), Time: &t}) {
+				return false
+			}
+			break
+		}
+	}
+	return true
+}
+
+//getSearch searches the current competition's team names, rosters, and team and score fields, the announcements, the audit entries,
+//and the competitions archived in archiveDir, newest first, for the q query parameter. Results match every word of q, ignoring case.
+//archives=false leaves out the archives
+func getSearch(d db.DB, a *AnnouncementService, archiveDir string, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "q is required"})
+			return
+		}
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		entries, err := d.AuditEntries(time.Time{})
+		if err != nil {
+			log.Println("Unable to read audit entries:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		var archives []*archive.Entry
+		if r.URL.Query().Get("archives") != "false" {
+			if archives, err = readArchives(archiveDir); err != nil {
+				log.Println(err)
+				returnHTTP(w, http.StatusInternalServerError, nil)
+				return
+			}
+		}
+
+		s := newSearch(q)
+		ok := c == nil || s.competition(c, "")
+		for _, ann := range a.List(false) {
+			if !ok {
+				break
+			}
+			ok = s.add(&SearchResult{Kind: SearchAnnouncement, Text: ann.Message, ID: ann.ID})
+		}
+		ok = ok && s.audit(entries)
+		for i := len(archives) - 1; ok && i >= 0; i-- {
+			ok = s.competition(archives[i].Competition, archives[i].File)
+		}
+
+		returnHTTP(w, http.StatusOK, &searchResponse{Query: q, Results: s.results, Truncated: s.truncated})
+	}
+}
@@ -0,0 +1,407 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//serviceAccountsSetting is the db setting key service accounts are stored under
+const serviceAccountsSetting = "service_accounts"
+
+//serviceTokenPrefix starts every service account token, so they can be told apart from other Bearer tokens
+const serviceTokenPrefix = "svc_"
+
+//maxRotationGrace is the longest a rotated token can keep working
+const maxRotationGrace = 24 * time.Hour
+
+//Service account scopes
+const (
+	//ScopeRead allows GET and HEAD requests, except reads of credentials and the whole database
+	ScopeRead = "read"
+	//ScopeScores allows ScopeRead requests and score writes
+	ScopeScores = "scores"
+	//ScopeAdmin allows every request an admin can make, except managing service accounts
+	ScopeAdmin = "admin"
+)
+
+//serviceAccountsMu serializes changes to service accounts
+var serviceAccountsMu = new(sync.Mutex)
+
+type serviceContextKey int
+
+//Request context keys set by serviceAuth and scoreWrite
+const (
+	serviceSessionKey serviceContextKey = iota
+	scoreWriteKey
+)
+
+//ServiceAccount is a non-interactive account for automation like registration systems and overlays.
+//Its token acts as an admin limited to Scope until Expires, if set. Only hashes of tokens are stored
+type ServiceAccount struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Scope   string     `json:"scope"`
+	Created time.Time  `json:"created"`
+	Rotated *time.Time `json:"rotated,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	//PreviousExpires is when the token replaced by the last rotation stops working
+	PreviousExpires *time.Time `json:"previous_expires,omitempty"`
+	Hash            string     `json:"-"`
+	PreviousHash    string     `json:"-"`
+}
+
+//storedServiceAccount is the stored form of a ServiceAccount
+type storedServiceAccount struct {
+	*ServiceAccount
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+}
+
+func validScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeScores || scope == ScopeAdmin
+}
+
+func readServiceAccounts(d db.DB) ([]*ServiceAccount, error) {
+	var stored []*storedServiceAccount
+	if _, err := d.ReadSetting(serviceAccountsSetting, &stored); err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*ServiceAccount, 0, len(stored))
+	for _, s := range stored {
+		s.ServiceAccount.Hash, s.ServiceAccount.PreviousHash = s.Hash, s.PreviousHash
+		accounts = append(accounts, s.ServiceAccount)
+	}
+	return accounts, nil
+}
+
+func writeServiceAccounts(d db.DB, accounts []*ServiceAccount) error {
+	stored := make([]*storedServiceAccount, 0, len(accounts))
+	for _, a := range accounts {
+		stored = append(stored, &storedServiceAccount{ServiceAccount: a, Hash: a.Hash, PreviousHash: a.PreviousHash})
+	}
+	return d.WriteSetting(serviceAccountsSetting, stored)
+}
+
+//findServiceAccount returns the unexpired ServiceAccount matching token as of now, or nil if there isn't one.
+//The token replaced by the account's last rotation matches until PreviousExpires
+func findServiceAccount(d db.DB, token string, now time.Time) (*ServiceAccount, error) {
+	accounts, err := readServiceAccounts(d)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := []byte(hashAPIKey(token))
+	for _, a := range accounts {
+		if a.Expires != nil && !now.Before(*a.Expires) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(a.Hash), hash) == 1 {
+			return a, nil
+		}
+		if a.PreviousHash != "" && a.PreviousExpires != nil && now.Before(*a.PreviousExpires) &&
+			subtle.ConstantTimeCompare([]byte(a.PreviousHash), hash) == 1 {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+//serviceAuth authenticates requests with a service account token given as a Bearer token. The request acts as an admin
+//session named service:<name>, limited to the account's scope. Invalid tokens return 401 Unauthorized.
+//Other requests, including ones with other Bearer tokens, are passed to h unchanged
+func serviceAuth(d db.DB, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer "+serviceTokenPrefix) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		a, err := findServiceAccount(d, strings.TrimPrefix(auth, "Bearer "), time.Now())
+		if err != nil {
+			log.Println("Unable to read service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if a == nil {
+			returnHTTP(w, http.StatusUnauthorized, nil)
+			return
+		}
+
+		sess := &Session{Username: "service:" + a.Name, Role: RoleAdmin, Scope: a.Scope}
+		if a.Expires != nil {
+			sess.Expires = *a.Expires
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serviceSessionKey, sess)))
+	})
+}
+
+//serviceSession returns the Session of the request's service account token, or nil if there isn't one
+func serviceSession(r *http.Request) *Session {
+	s, _ := r.Context().Value(serviceSessionKey).(*Session)
+	return s
+}
+
+//scoreWrite marks h as writing scores, which service accounts with ScopeScores can do
+func scoreWrite(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scoreWriteKey, true)))
+	})
+}
+
+//allows returns whether the session's Scope permits the request. Sessions of logins have no Scope and permit every request
+func (s *Session) allows(r *http.Request) bool {
+	switch s.Scope {
+	case "", ScopeAdmin:
+		return true
+	case ScopeScores:
+		if write, _ := r.Context().Value(scoreWriteKey).(bool); write {
+			return true
+		}
+		return r.Method == "GET" || r.Method == "HEAD"
+	case ScopeRead:
+		return r.Method == "GET" || r.Method == "HEAD"
+	}
+	return false
+}
+
+//checkLoginAdmin checks if the request is authorized as an admin who logged in, not a service account
+//If the request is not authorized checkLoginAdmin returns false and writes the error to w
+func checkLoginAdmin(w http.ResponseWriter, r *http.Request, sess *MemorySessionStore) bool {
+	session := checkSession(w, r, sess, RoleAdmin)
+	if session == nil {
+		return false
+	}
+
+	if session.Scope != "" {
+		returnHTTP(w, http.StatusForbidden, nil)
+		return false
+	}
+
+	return true
+}
+
+//checkAdminScope checks if the request is authorized as an admin who logged in or a service account with ScopeAdmin.
+//It guards reads of credentials and the whole database, like backups, exports, and the audit log, which ScopeRead doesn't allow.
+//If the request is not authorized checkAdminScope returns false and writes the error to w
+func checkAdminScope(w http.ResponseWriter, r *http.Request, sess *MemorySessionStore) bool {
+	session := checkSession(w, r, sess, RoleAdmin)
+	if session == nil {
+		return false
+	}
+
+	if session.Scope != "" && session.Scope != ScopeAdmin {
+		returnHTTP(w, http.StatusForbidden, nil)
+		return false
+	}
+
+	return true
+}
+
+type serviceAccountsResponse struct {
+	ServiceAccounts []*ServiceAccount `json:"service_accounts"`
+}
+
+type serviceAccountRequest struct {
+	Name    string     `json:"name"`
+	Scope   string     `json:"scope"`
+	Expires *time.Time `json:"expires"`
+}
+
+type rotateRequest struct {
+	//Expires replaces the account's expiration if set
+	Expires *time.Time `json:"expires"`
+	//Grace is how many seconds the replaced token keeps working, so services can be updated without downtime
+	Grace int `json:"grace"`
+}
+
+type serviceAccountResponse struct {
+	*ServiceAccount
+	Token string `json:"token"`
+}
+
+func newServiceToken() string {
+	return serviceTokenPrefix + randString(40)
+}
+
+func getServiceAccounts(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkLoginAdmin(w, r, sess) {
+			return
+		}
+
+		accounts, err := readServiceAccounts(d)
+		if err != nil {
+			log.Println("Unable to read service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		sort.Slice(accounts, func(i, j int) bool { return accounts[i].Created.Before(accounts[j].Created) })
+
+		returnHTTP(w, http.StatusOK, &serviceAccountsResponse{ServiceAccounts: accounts})
+	}
+}
+
+//postServiceAccount creates a new service account. The token is only returned in this response
+func postServiceAccount(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkLoginAdmin(w, r, sess) {
+			return
+		}
+
+		req := new(serviceAccountRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Name == "" || !validScope(req.Scope) {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		now := time.Now()
+		if req.Expires != nil && !req.Expires.After(now) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "Expiration must be in the future"})
+			return
+		}
+
+		serviceAccountsMu.Lock()
+		defer serviceAccountsMu.Unlock()
+
+		accounts, err := readServiceAccounts(d)
+		if err != nil {
+			log.Println("Unable to read service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		token := newServiceToken()
+		a := &ServiceAccount{ID: randString(12), Name: req.Name, Scope: req.Scope, Created: now, Expires: req.Expires, Hash: hashAPIKey(token)}
+		if err = writeServiceAccounts(d, append(accounts, a)); err != nil {
+			log.Println("Unable to write service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, &serviceAccountResponse{ServiceAccount: a, Token: token})
+	}
+}
+
+//rotateServiceAccount replaces a service account's token. The new token is only returned in this response.
+//The replaced token keeps working for the requested grace period, up to maxRotationGrace
+func rotateServiceAccount(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkLoginAdmin(w, r, sess) {
+			return
+		}
+
+		req := new(rotateRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || req.Grace < 0 {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		grace := time.Duration(req.Grace) * time.Second
+		if grace > maxRotationGrace {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "Grace period can't be longer than 24 hours"})
+			return
+		}
+
+		now := time.Now()
+		if req.Expires != nil && !req.Expires.After(now) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "Expiration must be in the future"})
+			return
+		}
+
+		serviceAccountsMu.Lock()
+		defer serviceAccountsMu.Unlock()
+
+		accounts, err := readServiceAccounts(d)
+		if err != nil {
+			log.Println("Unable to read service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		for _, a := range accounts {
+			if a.ID != id {
+				continue
+			}
+
+			token := newServiceToken()
+			a.PreviousHash, a.PreviousExpires = "", nil
+			if grace > 0 {
+				previous := now.Add(grace)
+				a.PreviousHash, a.PreviousExpires = a.Hash, &previous
+			}
+			a.Hash, a.Rotated = hashAPIKey(token), &now
+			if req.Expires != nil {
+				a.Expires = req.Expires
+			}
+
+			if err = writeServiceAccounts(d, accounts); err != nil {
+				log.Println("Unable to write service accounts:", err)
+				returnHTTP(w, http.StatusInternalServerError, nil)
+				return
+			}
+
+			returnHTTP(w, http.StatusOK, &serviceAccountResponse{ServiceAccount: a, Token: token})
+			return
+		}
+
+		returnHTTP(w, http.StatusNotFound, nil)
+	}
+}
+
+func deleteServiceAccount(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkLoginAdmin(w, r, sess) {
+			return
+		}
+
+		serviceAccountsMu.Lock()
+		defer serviceAccountsMu.Unlock()
+
+		accounts, err := readServiceAccounts(d)
+		if err != nil {
+			log.Println("Unable to read service accounts:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		for i, a := range accounts {
+			if a.ID == id {
+				if err = writeServiceAccounts(d, append(accounts[:i], accounts[i+1:]...)); err != nil {
+					log.Println("Unable to write service accounts:", err)
+					returnHTTP(w, http.StatusInternalServerError, nil)
+					return
+				}
+				returnHTTP(w, http.StatusOK, nil)
+				return
+			}
+		}
+
+		returnHTTP(w, http.StatusNotFound, nil)
+	}
+}
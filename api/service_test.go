@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//TestReadScopeSensitive checks that ScopeRead tokens can't read backups, exports, the audit log, or ingest tokens
+func TestReadScopeSensitive(t *testing.T) {
+	d := db.NewMemory()
+	if err := d.Init("Test", 2, []string{"Team 1"}, "admin", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := map[string]string{ScopeRead: newServiceToken(), ScopeScores: newServiceToken(), ScopeAdmin: newServiceToken()}
+	var accounts []*ServiceAccount
+	for scope, token := range tokens {
+		accounts = append(accounts, &ServiceAccount{ID: randString(8), Name: scope, Scope: scope, Created: time.Now(), Hash: hashAPIKey(token)})
+	}
+	if err := writeServiceAccounts(d, accounts); err != nil {
+		t.Fatal(err)
+	}
+
+	sess := NewMemorySessionStore(time.Hour, time.Hour, 0)
+	handlers := map[string]http.Handler{
+		"backup": getBackup(d, sess),
+		"export": getExport(d, sess),
+		"audit":  getAudit(d, sess),
+		"ingest": getIngestSystems(d, sess),
+	}
+
+	for name, h := range handlers {
+		for scope, token := range tokens {
+			r := httptest.NewRequest("GET", "/"+name, nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			serviceAuth(d, h).ServeHTTP(w, r)
+
+			forbidden := w.Code == http.StatusForbidden
+			if want := scope != ScopeAdmin; forbidden != want {
+				t.Errorf("%s with %s token: status = %d, want forbidden = %t", name, scope, w.Code, want)
+			}
+		}
+	}
+}
@@ -5,16 +5,40 @@ import (
 	"time"
 )
 
-//Session represents a login session
+//Session roles
+const (
+	RoleAdmin = "admin"
+	RoleJudge = "judge"
+)
+
+//Session represents a login session, or a service account's token. Scope limits a service account's requests and is empty for logins
 type Session struct {
-	Expires time.Time
+	Expires  time.Time `json:"expires"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Scope    string    `json:"scope,omitempty"`
+	family   string
+	created  time.Time
+}
+
+//refreshToken represents a refresh token that can be exchanged for a new session.
+//Sessions and refresh tokens created from the same login share a family so they can be revoked together
+type refreshToken struct {
+	Expires  time.Time
+	Username string
+	Role     string
+	family   string
+	created  time.Time
 }
 
 //MemorySessionStore represents a SessionStore that uses an in-memory map
 type MemorySessionStore struct {
-	store    map[string]*Session
-	duration time.Duration
-	mu       *sync.Mutex
+	store           map[string]*Session
+	refresh         map[string]*refreshToken
+	duration        time.Duration
+	refreshDuration time.Duration
+	maxSessions     int
+	mu              *sync.Mutex
 }
 
 //scavenge removes stale records every hour
@@ -28,42 +52,185 @@ func scavenge(m *MemorySessionStore) {
 				delete(m.store, id)
 			}
 		}
+		for token, t := range m.refresh {
+			if t.Expires.Before(now) {
+				delete(m.refresh, token)
+			}
+		}
 		m.mu.Unlock()
 	}
 }
 
-//NewMemorySessionStore returns a new MemorySessionStore with the given expiration duration.
-func NewMemorySessionStore(duration time.Duration) *MemorySessionStore {
+//NewMemorySessionStore returns a new MemorySessionStore with the given session and refresh token expiration durations.
+//If maxSessions is greater than 0, a user's oldest logins are logged out to keep at most maxSessions logins per user
+func NewMemorySessionStore(duration, refreshDuration time.Duration, maxSessions int) *MemorySessionStore {
 	m := &MemorySessionStore{
-		store:    make(map[string]*Session),
-		duration: duration,
-		mu:       new(sync.Mutex),
+		store:           make(map[string]*Session),
+		refresh:         make(map[string]*refreshToken),
+		duration:        duration,
+		refreshDuration: refreshDuration,
+		maxSessions:     maxSessions,
+		mu:              new(sync.Mutex),
 	}
 	go scavenge(m)
 	return m
 }
 
-//Create returns a new sessionID
-func (m *MemorySessionStore) Create() string {
+//create adds a new session and refresh token in the given family and returns the sessionID, a copy of the session, and the refresh token.
+//m.mu must be held
+func (m *MemorySessionStore) create(username, role, family string, created time.Time) (string, *Session, string) {
+	now := time.Now()
 	id := randString(22)
+	s := &Session{
+		Expires:  now.Add(m.duration),
+		Username: username,
+		Role:     role,
+		family:   family,
+		created:  created,
+	}
+	m.store[id] = s
+
+	token := randString(32)
+	m.refresh[token] = &refreshToken{
+		Expires:  now.Add(m.refreshDuration),
+		Username: username,
+		Role:     role,
+		family:   family,
+		created:  created,
+	}
+
+	sess := *s
+	return id, &sess, token
+}
+
+//revokeFamily removes every session and refresh token in the given family.
+//m.mu must be held
+func (m *MemorySessionStore) revokeFamily(family string) {
+	for id, s := range m.store {
+		if s.family == family {
+			delete(m.store, id)
+		}
+	}
+	for token, t := range m.refresh {
+		if t.family == family {
+			delete(m.refresh, token)
+		}
+	}
+}
+
+//limit logs out the given user's oldest logins until there is room for another login under maxSessions.
+//m.mu must be held
+func (m *MemorySessionStore) limit(username, role string) {
+	if m.maxSessions <= 0 {
+		return
+	}
+
+	now := time.Now()
+	logins := make(map[string]time.Time)
+	for _, s := range m.store {
+		if s.Username == username && s.Role == role && s.Expires.After(now) {
+			logins[s.family] = s.created
+		}
+	}
+	for _, t := range m.refresh {
+		if t.Username == username && t.Role == role && t.Expires.After(now) {
+			logins[t.family] = t.created
+		}
+	}
+
+	for len(logins) >= m.maxSessions {
+		var oldest string
+		for family, created := range logins {
+			if oldest == "" || created.Before(logins[oldest]) {
+				oldest = family
+			}
+		}
+		m.revokeFamily(oldest)
+		delete(logins, oldest)
+	}
+}
+
+//Create returns a new sessionID, a copy of the session, and a refresh token for the given user and role.
+//If logoutOthers is true, the user's other sessions are revoked
+func (m *MemorySessionStore) Create(username, role string, logoutOthers bool) (string, *Session, string) {
 	m.mu.Lock()
-	m.store[id] = &Session{
-		Expires: time.Now().Add(m.duration),
+	defer m.mu.Unlock()
+	if logoutOthers {
+		m.revokeUser(username, role)
+	} else {
+		m.limit(username, role)
 	}
-	m.mu.Unlock()
-	return id
+	return m.create(username, role, randString(22), time.Now())
 }
 
-//Check returns whether or not sessionID is a valid session
-func (m *MemorySessionStore) Check(sessionID string) bool {
+//Refresh exchanges the given refresh token for a new sessionID, session, and refresh token.
+//The given refresh token and the sessions created before it from the same login can't be used again.
+//If it's not a valid refresh token, Refresh returns an empty sessionID
+func (m *MemorySessionStore) Refresh(token string) (string, *Session, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.refresh[token]
+	if !ok {
+		return "", nil, ""
+	}
+	delete(m.refresh, token)
+	if t.Expires.Before(time.Now()) {
+		return "", nil, ""
+	}
+
+	//the refresh token is the family's only one, so revoking the family only removes its earlier sessions
+	m.revokeFamily(t.family)
+	return m.create(t.Username, t.Role, t.family, t.created)
+}
+
+//Revoke removes the session with the given sessionID and every session and refresh token from the same login
+func (m *MemorySessionStore) Revoke(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.store[sessionID]; ok {
+		m.revokeFamily(s.family)
+	}
+}
+
+//RevokeUser removes every session and refresh token for the given user and role
+func (m *MemorySessionStore) RevokeUser(username, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revokeUser(username, role)
+}
+
+//revokeUser removes every session and refresh token for the given user and role.
+//m.mu must be held
+func (m *MemorySessionStore) revokeUser(username, role string) {
+	for id, s := range m.store {
+		if s.Username == username && s.Role == role {
+			delete(m.store, id)
+		}
+	}
+	for token, t := range m.refresh {
+		if t.Username == username && t.Role == role {
+			delete(m.refresh, token)
+		}
+	}
+}
+
+//Get returns a copy of the session with the given sessionID, or nil if it's not a valid session.
+//Using a session extends it by the session duration, so clients that don't refresh stay logged in while they're used
+func (m *MemorySessionStore) Get(sessionID string) *Session {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if s, ok := m.store[sessionID]; ok {
 		if s.Expires.After(time.Now()) {
 			s.Expires = time.Now().Add(m.duration)
-			return true
+			sess := *s
+			return &sess
 		}
 		delete(m.store, sessionID)
 	}
-	return false
+	return nil
+}
+
+//Check returns whether or not sessionID is a valid session
+func (m *MemorySessionStore) Check(sessionID string) bool {
+	return m.Get(sessionID) != nil
 }
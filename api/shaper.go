@@ -0,0 +1,76 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+//DefaultShaperChunk is the default number of bytes written at a time by a Shaper
+const DefaultShaperChunk = 16 * 1024
+
+//pacer spreads bytes out over time at rate bytes per second. A rate of 0 means unlimited
+type pacer struct {
+	rate int
+	next time.Time
+}
+
+//reserve reserves n bytes at now and returns how long to wait before sending them
+func (p *pacer) reserve(now time.Time, n int) time.Duration {
+	if p.rate <= 0 {
+		return 0
+	}
+
+	if p.next.Before(now) {
+		p.next = now
+	}
+	wait := p.next.Sub(now)
+	p.next = p.next.Add(time.Duration(n) * time.Second / time.Duration(p.rate))
+	return wait
+}
+
+//Shaper paces large subscriber messages, like competition snapshots, so that many clients receiving them at once
+//don't send a synchronized burst that saturates the uplink. Messages larger than a chunk are written a chunk at a time,
+//each waiting for its share of the total rate and of the connection's rate. Smaller messages are sent immediately
+type Shaper struct {
+	chunk   int
+	perConn int
+
+	total *pacer
+	mu    *sync.Mutex
+}
+
+//NewShaper returns a new Shaper limiting large messages to rate bytes per second in total and perConn bytes per second per connection,
+//written chunk bytes at a time. A rate of 0 means unlimited, and a chunk of 0 or less uses DefaultShaperChunk
+func NewShaper(rate, perConn, chunk int) *Shaper {
+	if chunk <= 0 {
+		chunk = DefaultShaperChunk
+	}
+	return &Shaper{chunk: chunk, perConn: perConn, total: &pacer{rate: rate}, mu: new(sync.Mutex)}
+}
+
+//shapes returns whether or not a message of n bytes is paced
+func (s *Shaper) shapes(n int) bool {
+	return s != nil && n > s.chunk && (s.total.rate > 0 || s.perConn > 0)
+}
+
+//conn returns the pacer of a single connection
+func (s *Shaper) conn() *pacer {
+	if s == nil {
+		return &pacer{}
+	}
+	return &pacer{rate: s.perConn}
+}
+
+//wait reserves n bytes in the total rate and conn's rate and returns how long to wait before sending them
+func (s *Shaper) wait(conn *pacer, n int) time.Duration {
+	now := time.Now()
+
+	s.mu.Lock()
+	total := s.total.reserve(now, n)
+	s.mu.Unlock()
+
+	if c := conn.reserve(now, n); c > total {
+		return c
+	}
+	return total
+}
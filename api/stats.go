@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Stats holds server counters
+type Stats struct {
+	wsRawBytes  uint64
+	wsWireBytes uint64
+	wsRejected  uint64
+	//wsShapingDelay is the total time in nanoseconds subscriber messages waited for a Shaper
+	wsShapingDelay uint64
+
+	//typeBytes holds the raw bytes sent to subscribers by message type
+	typeBytes map[string]uint64
+	mu        *sync.Mutex
+
+	limiter *ConnectionLimiter
+}
+
+//StatsResponse is a snapshot of Stats.
+//WebSocketBytesByType is the raw bytes sent to subscribers by event type, including snapshot replies.
+//WebSocketShapingDelay is the total number of seconds subscriber messages were delayed to limit bandwidth.
+//Anomalies is the number of scores and teams flagged by GET /competition/anomalies.
+//StorageAlert is set while writes are failing because the disk is full or the filesystem is read-only.
+//Propagation is the latency from database writes to their live updates reaching every connected client
+type StatsResponse struct {
+	WebSocketConnections  int               `json:"websocket_connections"`
+	WebSocketRejected     uint64            `json:"websocket_rejected"`
+	WebSocketRawBytes     uint64            `json:"websocket_raw_bytes"`
+	WebSocketWireBytes    uint64            `json:"websocket_wire_bytes"`
+	WebSocketSavings      float64           `json:"websocket_savings"`
+	WebSocketBytesByType  map[string]uint64 `json:"websocket_bytes_by_type"`
+	WebSocketShapingDelay float64           `json:"websocket_shaping_delay"`
+	Anomalies             int               `json:"anomalies"`
+	StorageAlert          *db.StorageAlert  `json:"storage_alert,omitempty"`
+	Propagation           *PropagationStats `json:"propagation"`
+}
+
+//NewStats returns a new Stats reporting connections from the given ConnectionLimiter
+func NewStats(l *ConnectionLimiter) *Stats {
+	return &Stats{typeBytes: make(map[string]uint64), mu: new(sync.Mutex), limiter: l}
+}
+
+//addTypeBytes adds n raw bytes sent to a subscriber in a message of the given type
+func (s *Stats) addTypeBytes(typ string, n int) {
+	s.mu.Lock()
+	s.typeBytes[typ] += uint64(n)
+	s.mu.Unlock()
+}
+
+//Snapshot returns the current values of the Stats counters
+func (s *Stats) Snapshot() *StatsResponse {
+	r := &StatsResponse{
+		WebSocketConnections:  s.limiter.Count(),
+		WebSocketRejected:     atomic.LoadUint64(&s.wsRejected),
+		WebSocketRawBytes:     atomic.LoadUint64(&s.wsRawBytes),
+		WebSocketWireBytes:    atomic.LoadUint64(&s.wsWireBytes),
+		WebSocketBytesByType:  make(map[string]uint64),
+		WebSocketShapingDelay: time.Duration(atomic.LoadUint64(&s.wsShapingDelay)).Seconds(),
+	}
+
+	s.mu.Lock()
+	for typ, n := range s.typeBytes {
+		r.WebSocketBytesByType[typ] = n
+	}
+	s.mu.Unlock()
+
+	if r.WebSocketRawBytes > 0 {
+		r.WebSocketSavings = 1 - float64(r.WebSocketWireBytes)/float64(r.WebSocketRawBytes)
+	}
+	return r
+}
+
+//countingConn is a net.Conn that adds the number of bytes written to a counter
+type countingConn struct {
+	net.Conn
+	count *uint64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(c.count, uint64(n))
+	return n, err
+}
+
+//countingHijacker is an http.ResponseWriter whose hijacked connection counts bytes written
+type countingHijacker struct {
+	http.ResponseWriter
+	count *uint64
+}
+
+func (h *countingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := h.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &countingConn{Conn: conn, count: h.count}, brw, nil
+}
+
+func getStats(d db.DB, sess *MemorySessionStore, sub *SubscribeService, stats *Stats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		anomalies, err := findAnomalies(d)
+		if err != nil {
+			log.Println(err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		resp := stats.Snapshot()
+		resp.Anomalies = len(anomalies)
+		resp.Propagation = sub.Propagation()
+		if s, ok := d.(db.Storage); ok {
+			resp.StorageAlert = s.StorageAlert()
+		}
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+type subscribersResponse struct {
+	Subscribers []*SubscriberInfo `json:"subscribers"`
+	Reaped      uint64            `json:"reaped"`
+}
+
+//getSubscribers returns the current subscribers and the number of dropped or idle subscribers that have been removed
+func getSubscribers(sub *SubscribeService, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		subscribers, reaped := sub.Subscribers()
+		returnHTTP(w, http.StatusOK, &subscribersResponse{Subscribers: subscribers, Reaped: reaped})
+	}
+}
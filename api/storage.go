@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//storagePollInterval is how often the database is checked for a storage alert
+const storagePollInterval = 5 * time.Second
+
+//StorageAlertPayload is the Payload of an EventStorageAlert Event. Alert is nil when writes are succeeding again
+type StorageAlertPayload struct {
+	Alert *db.StorageAlert `json:"alert"`
+}
+
+//watchStorage publishes an EventStorageAlert when d's storage starts or stops failing, if d is a db.Storage.
+//Admin clients should subscribe to it
+func watchStorage(d db.DB, sub *SubscribeService) {
+	s, ok := d.(db.Storage)
+	if !ok {
+		return
+	}
+
+	var failing bool
+	for range time.Tick(storagePollInterval) {
+		alert := s.StorageAlert()
+		if (alert != nil) == failing {
+			continue
+		}
+		failing = alert != nil
+		if failing {
+			log.Printf("Unable to write database(%s): %s", alert.Path, alert.Error)
+		}
+		sub.Publish(&Event{Type: EventStorageAlert, Payload: &StorageAlertPayload{Alert: alert}})
+	}
+}
+
+type storageResponse struct {
+	Path  string           `json:"path"`
+	Alert *db.StorageAlert `json:"alert"`
+}
+
+//getStorage returns the path of the database file and the current storage alert
+func getStorage(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		s, ok := d.(db.Storage)
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &storageResponse{Path: s.Path(), Alert: s.StorageAlert()})
+	}
+}
+
+type storageRequest struct {
+	Path string `json:"path"`
+}
+
+//putStorage moves the database file to the given path without restarting
+func putStorage(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		s, ok := d.(db.Storage)
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		if !checkJSON(w, r) {
+			return
+		}
+
+		req := new(storageRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Path == "" {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := s.Relocate(req.Path); err != nil {
+			log.Println("Unable to relocate database:", err)
+			returnHTTP(w, http.StatusInternalServerError, &jsonError{Code: http.StatusInternalServerError, Description: err.Error()})
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &storageResponse{Path: s.Path(), Alert: s.StorageAlert()})
+	}
+}
+
+//getBackup streams a consistent copy of the database file without stopping writes
+func getBackup(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminScope(w, r, sess) {
+			return
+		}
+
+		s, ok := d.(db.Storage)
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="competition-%s.db"`, time.Now().Format("20060102-150405")))
+		w.Header().Set("Cache-Control", "no-store")
+
+		//the status is already sent, so a failed copy can only be logged and cut short
+		if err := s.Backup(w); err != nil {
+			log.Println("Unable to write backup:", err)
+		}
+	}
+}
+
+//postRestore replaces the database file with the backup in the request body and notifies subscribers of the restored competition
+func postRestore(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		s, ok := d.(db.Storage)
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		if err := s.RestoreBackup(r.Body); errors.Is(err, db.ErrInvalidBackup) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+			return
+		} else if err != nil {
+			log.Println("Unable to restore backup:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		state, err := d.State()
+		if err != nil {
+			log.Println("Unable to read competition state:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		id := subscriberID(r)
+		sub.Publish(&Event{Type: EventState, ID: id, Payload: &StatePayload{State: state}})
+		sub.NotifyCommitted(committed, id)
+
+		resp := new(versionResponse)
+		if c != nil {
+			resp.Version = c.Version
+		}
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/websocket"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//noCompress lists the routes whose responses are already compressed
+var noCompress = map[string]bool{
+	"/competition/subscribe": true,
+	"/competition/archive":   true,
+}
+
+//compress gzips responses except for WebSocket upgrades, which use per-message compression, and routes in noCompress
+func compress(h http.Handler) http.Handler {
+	gz := handlers.CompressHandler(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if noCompress[r.URL.Path] || websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gz.ServeHTTP(w, r)
+	})
+}
+
+//jsonField is an extra field written after a streamed Competition
+type jsonField struct {
+	Name  string
+	Value interface{}
+}
+
+//marshalTo writes v JSON encoded to w
+func marshalTo(w *bufio.Writer, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+//encodeCompetition writes c as a JSON object to w one team at a time so large competitions aren't encoded in memory at once.
+//fields are written as additional members of the object
+func encodeCompetition(w *bufio.Writer, c *db.Competition, fields ...jsonField) error {
+	fmt.Fprintf(w, `{"version":%d,"name":`, c.Version)
+	if err := marshalTo(w, c.Name); err != nil {
+		return err
+	}
+
+	w.WriteString(`,"rounds":`)
+	if err := marshalTo(w, c.Rounds); err != nil {
+		return err
+	}
+
+	w.WriteString(`,"round_ids":`)
+	if err := marshalTo(w, c.RoundIDs); err != nil {
+		return err
+	}
+
+	w.WriteString(`,"teams":[`)
+	for i, t := range c.Teams {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := marshalTo(w, t); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+
+	if len(c.Computed) > 0 {
+		w.WriteString(`,"computed":`)
+		if err := marshalTo(w, c.Computed); err != nil {
+			return err
+		}
+	}
+
+	if c.Precision != nil {
+		w.WriteString(`,"precision":`)
+		if err := marshalTo(w, c.Precision); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		w.WriteByte(',')
+		if err := marshalTo(w, f.Name); err != nil {
+			return err
+		}
+		w.WriteByte(':')
+		if err := marshalTo(w, f.Value); err != nil {
+			return err
+		}
+	}
+
+	w.WriteString("}\n")
+	return w.Flush()
+}
+
+//streamCompetition writes the status code and c as JSON to w with the given extra fields
+func streamCompetition(w http.ResponseWriter, code int, c *db.Competition, fields ...jsonField) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := encodeCompetition(bufio.NewWriter(w), c, fields...); err != nil {
+		log.Println("Unable to encode competition:", err)
+	}
+}
+
+//streamRevision writes the status code and rev as JSON to w, streaming its Competition
+func streamRevision(w http.ResponseWriter, code int, rev *db.Revision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	bw := bufio.NewWriter(w)
+	err := func() error {
+		if _, err := fmt.Fprintf(bw, `{"id":%d,"timestamp":`, rev.ID); err != nil {
+			return err
+		}
+		if err := marshalTo(bw, rev.Timestamp); err != nil {
+			return err
+		}
+		bw.WriteString(`,"competition":`)
+		if err := encodeCompetition(bw, rev.Competition); err != nil {
+			return err
+		}
+		bw.WriteString("}\n")
+		return bw.Flush()
+	}()
+	if err != nil {
+		log.Println("Unable to encode revision:", err)
+	}
+}
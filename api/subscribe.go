@@ -1,60 +1,435 @@
 package api
 
-import "sync"
+import (
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Event types sent to subscribers
+const (
+	EventConnect             = "connect"
+	EventUpdate              = "update"
+	EventState               = "state"
+	EventScoreUpdate         = "score_update"
+	EventTeamAdded           = "team_added"
+	EventRoundRenamed        = "round_renamed"
+	EventFreeze              = "freeze"
+	EventAnnouncement        = "announcement"
+	EventAnnouncementExpired = "announcement_expired"
+	EventTimerTick           = "timer_tick"
+	EventCue                 = "cue"
+	EventPlaylistCue         = "playlist_cue"
+	EventReveal              = "reveal"
+	EventDeviceView          = "device_view"
+	EventMaintenance         = "maintenance"
+	EventLeadChange          = "lead_change"
+	EventMover               = "mover"
+	EventFinalizeScheduled   = "finalize_scheduled"
+	EventStorageAlert        = "storage_alert"
+	EventDispute             = "dispute"
+)
+
+//Event represents a message sent to subscribers.
+//ID is the subscriber id of the client that caused the event.
+//Seq is assigned by the SubscribeService when the event is published
+type Event struct {
+	Type    string      `json:"type"`
+	ID      int         `json:"id"`
+	Seq     uint64      `json:"seq,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+
+	//committed is when the database write the event describes was committed, or when it was published if it doesn't describe one
+	committed time.Time
+	delivery  *delivery
+}
+
+//StatePayload is the Payload of an EventState Event
+type StatePayload struct {
+	State db.State `json:"state"`
+}
+
+//ScoreUpdatePayload is the Payload of an EventScoreUpdate Event
+type ScoreUpdatePayload struct {
+	Team    int      `json:"team"`
+	TeamID  string   `json:"team_id"`
+	Round   int      `json:"round"`
+	RoundID string   `json:"round_id"`
+	Score   db.Score `json:"score"`
+}
+
+//TeamAddedPayload is the Payload of an EventTeamAdded Event
+type TeamAddedPayload struct {
+	Team   int    `json:"team"`
+	TeamID string `json:"team_id"`
+	Name   string `json:"name"`
+}
+
+//RoundRenamedPayload is the Payload of an EventRoundRenamed Event
+type RoundRenamedPayload struct {
+	Round   int    `json:"round"`
+	RoundID string `json:"round_id"`
+	Name    string `json:"name"`
+}
+
+//FreezePayload is the Payload of an EventFreeze Event
+type FreezePayload struct {
+	Frozen bool `json:"frozen"`
+}
+
+//TimerTickPayload is the Payload of an EventTimerTick Event
+type TimerTickPayload struct {
+	Remaining int `json:"remaining"`
+}
+
+//subscriberBuffer is the number of events queued for a subscriber before it's considered too slow and dropped
+const subscriberBuffer = 64
+
+//reapInterval is how often dropped and idle subscribers are removed
+const reapInterval = time.Minute
+
+//subscriber is a single subscriber's event queue.
+//remote is the address of a client subscriber, or empty for subscribers inside the server, which are never idle.
+//lastActive is the UnixNano time the client last sent a message
+type subscriber struct {
+	c      chan *Event
+	mu     *sync.Mutex
+	closed bool
+
+	remote     string
+	created    time.Time
+	lastActive int64
+}
+
+func (s *subscriber) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+//send queues e without blocking and returns false if the queue is full or closed
+func (s *subscriber) send(e *Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	select {
+	case s.c <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+type sendJob struct {
+	id  int
+	sub *subscriber
+	e   *Event
+	wg  *sync.WaitGroup
+}
 
 //SubscribeService allows a client to subscribe to update messages
 type SubscribeService struct {
-	subscribers map[int]chan int
+	subscribers map[int]*subscriber
 	lastID      int
+	lastSeq     uint64
 	mu          *sync.Mutex
-	control     chan int
+	control     chan *Event
+	jobs        chan *sendJob
+
+	//idleTimeout is how long a client subscriber may go without sending a message before it's closed, or 0 to never close idle clients
+	idleTimeout time.Duration
+	reaped      uint64
+
+	propagation *propagationHistogram
 }
 
+//service fans each event out to all subscribers using the worker pool.
+//Each event is queued for every subscriber before the next event is sent so ordering is preserved
 func (s *SubscribeService) service() {
 	for {
-		id := <-s.control
+		e := <-s.control
 		s.mu.Lock()
-		for _, sub := range s.subscribers {
-			sub <- id
+		s.lastSeq++
+		e.Seq = s.lastSeq
+		jobs := make([]*sendJob, 0, len(s.subscribers))
+		wg := new(sync.WaitGroup)
+		for id, sub := range s.subscribers {
+			jobs = append(jobs, &sendJob{id: id, sub: sub, e: e, wg: wg})
+		}
+		if propagationEvents[e.Type] {
+			s.track(e, jobs)
 		}
 		s.mu.Unlock()
+
+		wg.Add(len(jobs))
+		for _, j := range jobs {
+			s.jobs <- j
+		}
+		wg.Wait()
+	}
+}
+
+//track sets the delivery of e to the client subscribers of jobs, so its propagation latency is observed once they've all been sent it
+func (s *SubscribeService) track(e *Event, jobs []*sendJob) {
+	var clients int32
+	for _, j := range jobs {
+		if j.sub.remote != "" {
+			clients++
+		}
+	}
+	if clients > 0 {
+		e.delivery = &delivery{committed: e.committed, pending: clients, hist: s.propagation}
+	}
+}
+
+//worker queues events for subscribers, dropping subscribers that can't keep up
+func (s *SubscribeService) worker() {
+	for j := range s.jobs {
+		if !j.sub.send(j.e) {
+			if j.sub.remote != "" {
+				j.e.delivery.done()
+			}
+			if !j.sub.isClosed() {
+				log.Printf("Subscriber %d unable to keep up; dropping", j.id)
+				j.sub.close()
+			}
+		}
+		j.wg.Done()
 	}
 }
 
 //NewSubscribeService creates a new SubscribeService
 func NewSubscribeService() *SubscribeService {
 	s := &SubscribeService{
-		subscribers: make(map[int]chan int),
+		subscribers: make(map[int]*subscriber),
 		lastID:      0,
 		mu:          new(sync.Mutex),
-		control:     make(chan int),
+		control:     make(chan *Event),
+		jobs:        make(chan *sendJob),
+		propagation: newPropagationHistogram(),
 	}
 	go s.service()
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go s.worker()
+	}
+	go s.reaper()
 
 	return s
 }
 
-//Subscribe subscribes a client and returns a chan to listen on
-func (s *SubscribeService) Subscribe() (id int, c chan int) {
+//SetIdleTimeout sets how long a client subscriber may go without sending a message before it's closed.
+//A timeout of 0 means idle clients are never closed
+func (s *SubscribeService) SetIdleTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idleTimeout = timeout
+}
+
+func (s *SubscribeService) reaper() {
+	for {
+		time.Sleep(reapInterval)
+		s.reap(time.Now())
+	}
+}
+
+//reap removes subscribers that were dropped for falling behind but never unsubscribed,
+//and closes and removes client subscribers that have been idle longer than the idle timeout
+func (s *SubscribeService) reap(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, sub := range s.subscribers {
+		if sub.isClosed() {
+			delete(s.subscribers, id)
+			s.reaped++
+			continue
+		}
+
+		if s.idleTimeout <= 0 || sub.remote == "" {
+			continue
+		}
+
+		if idle := now.Sub(time.Unix(0, atomic.LoadInt64(&sub.lastActive))); idle > s.idleTimeout {
+			log.Printf("Subscriber %d (%s) idle for %s; closing", id, sub.remote, idle.Round(time.Second))
+			delete(s.subscribers, id)
+			sub.close()
+			s.reaped++
+		}
+	}
+}
+
+//Subscribe subscribes a service inside the server and returns a chan to listen on.
+//The chan is closed when the subscriber is unsubscribed or if it falls too far behind
+func (s *SubscribeService) Subscribe() (id int, c <-chan *Event) {
+	id, c, _ = s.subscribe("")
+	return id, c
+}
+
+//SubscribeClient subscribes a client at the given remote address and returns a chan to listen on.
+//In addition to Subscribe, the chan is closed if the client doesn't call Touch within the idle timeout
+func (s *SubscribeService) SubscribeClient(remote string) (id int, c <-chan *Event) {
+	id, c, _ = s.subscribe(remote)
+	return id, c
+}
+
+//subscribe adds a subscriber and returns its id, its chan, and the Seq of the last event published before it subscribed.
+//The chan receives every event after that Seq
+func (s *SubscribeService) subscribe(remote string) (int, <-chan *Event, uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.lastID++
 
-	c = make(chan int)
-	s.subscribers[s.lastID] = c
+	now := time.Now()
+	sub := &subscriber{c: make(chan *Event, subscriberBuffer), mu: new(sync.Mutex), remote: remote, created: now, lastActive: now.UnixNano()}
+	s.subscribers[s.lastID] = sub
+
+	return s.lastID, sub.c, s.lastSeq
+}
+
+//Touch records activity by the client subscriber with the given id
+func (s *SubscribeService) Touch(id int) {
+	s.mu.Lock()
+	sub, ok := s.subscribers[id]
+	s.mu.Unlock()
+
+	if ok {
+		atomic.StoreInt64(&sub.lastActive, time.Now().UnixNano())
+	}
+}
+
+//SubscriberInfo describes a current subscriber. Remote and LastActive are only set for clients.
+//Queued is the number of events waiting to be read by the subscriber
+type SubscriberInfo struct {
+	ID         int        `json:"id"`
+	Remote     string     `json:"remote,omitempty"`
+	Created    time.Time  `json:"created"`
+	LastActive *time.Time `json:"last_active,omitempty"`
+	Queued     int        `json:"queued"`
+}
+
+//Subscribers returns the current subscribers in the order they subscribed and the number of subscribers that have been reaped
+func (s *SubscribeService) Subscribers() ([]*SubscriberInfo, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]*SubscriberInfo, 0, len(s.subscribers))
+	for id, sub := range s.subscribers {
+		info := &SubscriberInfo{ID: id, Remote: sub.remote, Created: sub.created, Queued: len(sub.c)}
+		if sub.remote != "" {
+			t := time.Unix(0, atomic.LoadInt64(&sub.lastActive))
+			info.LastActive = &t
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
 
-	return s.lastID, c
+	return infos, s.reaped
 }
 
-//Unsubscribe unsubscribes the client with the given id from the service
+//Unsubscribe unsubscribes the client with the given id from the service and closes its chan
 func (s *SubscribeService) Unsubscribe(id int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.subscribers, id)
+	if sub, ok := s.subscribers[id]; ok {
+		delete(s.subscribers, id)
+		sub.close()
+	}
+}
+
+//Publish causes the service to send the given events to all subscribers
+func (s *SubscribeService) Publish(events ...*Event) {
+	s.PublishCommitted(time.Now(), events...)
 }
 
-//Notify causes the service to notify all subscribers
+//PublishCommitted is Publish for events describing a database write committed at committed,
+//so their propagation latency is measured from the commit instead of from when they're published
+func (s *SubscribeService) PublishCommitted(committed time.Time, events ...*Event) {
+	//a nil SubscribeService, like the one used by dry runs, has no subscribers
+	if s == nil {
+		return
+	}
+	for _, e := range events {
+		e.committed = committed
+		s.control <- e
+	}
+}
+
+//Propagation returns the latencies from committing database writes to delivering their Events to every client subscriber
+func (s *SubscribeService) Propagation() *PropagationStats {
+	return s.propagation.snapshot()
+}
+
+//Notify causes the service to notify all subscribers of an update by the client with the given id
 func (s *SubscribeService) Notify(id int) {
-	s.control <- id
+	s.Publish(&Event{Type: EventUpdate, ID: id})
+}
+
+//NotifyCommitted is Notify for an update committed to the database at committed
+func (s *SubscribeService) NotifyCommitted(committed time.Time, id int) {
+	s.PublishCommitted(committed, &Event{Type: EventUpdate, ID: id})
+}
+
+//competitionEvents returns the Events describing the changes from old to c.
+//A nil old is an empty competition, and a cleared competition (nil c) has no events beyond the update
+func competitionEvents(id int, old, c *db.Competition) []*Event {
+	if c == nil {
+		return nil
+	}
+	if old == nil {
+		old = new(db.Competition)
+	}
+
+	var events []*Event
+
+	for i, name := range c.Rounds {
+		if i < len(old.Rounds) && old.Rounds[i] != name {
+			events = append(events, &Event{Type: EventRoundRenamed, ID: id, Payload: &RoundRenamedPayload{Round: i, RoundID: c.RoundIDs[i], Name: name}})
+		}
+	}
+
+	for i, t := range c.Teams {
+		if i >= len(old.Teams) {
+			events = append(events, &Event{Type: EventTeamAdded, ID: id, Payload: &TeamAddedPayload{Team: i, TeamID: t.ID, Name: t.Name}})
+			for j, score := range t.Scores {
+				if score.State != db.ScoreUnscored {
+					events = append(events, &Event{Type: EventScoreUpdate, ID: id, Payload: &ScoreUpdatePayload{Team: i, TeamID: t.ID, Round: j, RoundID: c.RoundIDs[j], Score: score}})
+				}
+			}
+			continue
+		}
+
+		for j, score := range t.Scores {
+			var oldScore db.Score
+			if j < len(old.Teams[i].Scores) {
+				oldScore = old.Teams[i].Scores[j]
+			}
+			if !scoreEqual(oldScore, score) {
+				events = append(events, &Event{Type: EventScoreUpdate, ID: id, Payload: &ScoreUpdatePayload{Team: i, TeamID: t.ID, Round: j, RoundID: c.RoundIDs[j], Score: score}})
+			}
+		}
+	}
+
+	return events
+}
+
+func scoreEqual(a, b db.Score) bool {
+	return a.String() == b.String()
 }
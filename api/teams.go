@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//checkDuplicates checks if c has duplicate team names that old doesn't have.
+//If it does and the allow_duplicates query parameter isn't set, checkDuplicates returns false and writes the error to w.
+//Otherwise checkDuplicates returns true. old can be nil
+func checkDuplicates(w http.ResponseWriter, r *http.Request, old, c *db.Competition) bool {
+	if c == nil || r.URL.Query().Get("allow_duplicates") != "" {
+		return true
+	}
+
+	existing := make(map[string]bool)
+	if old != nil {
+		for _, name := range old.DuplicateTeams() {
+			existing[strings.ToLower(name)] = true
+		}
+	}
+
+	var dups []string
+	for _, name := range c.DuplicateTeams() {
+		if !existing[strings.ToLower(name)] {
+			dups = append(dups, name)
+		}
+	}
+
+	if len(dups) == 0 {
+		return true
+	}
+
+	returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: fmt.Sprintf("Duplicate team names: %s", strings.Join(dups, ", "))})
+	return false
+}
+
+type teamResponse struct {
+	*db.Team
+	Index    int          `json:"index"`
+	Standing *db.Standing `json:"standing"`
+}
+
+//getTeam returns the team given in the path by index, ID, or slug with its standing
+func getTeam(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		resp := &teamResponse{Team: c.Teams[team], Index: team}
+		for _, s := range c.Standings() {
+			if s.Team == team {
+				resp.Standing = s
+			}
+		}
+
+		returnHTTP(w, http.StatusOK, resp)
+	}
+}
+
+//renameRequest changes team names. Prefix is removed from the start of names, then Find is replaced with Replace.
+//If Regexp is true, Find is a regular expression and Replace can reference its groups, e.g. $1.
+//Names are trimmed after renaming. Changes are only written if Apply is true
+type renameRequest struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+	Regexp  bool   `json:"regexp"`
+	Prefix  string `json:"prefix"`
+	Apply   bool   `json:"apply"`
+	ID      int    `json:"id"`
+}
+
+type teamRename struct {
+	Team   int    `json:"team"`
+	TeamID string `json:"team_id"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+type renameResponse struct {
+	Renames    []*teamRename `json:"renames"`
+	Duplicates []string      `json:"duplicates"`
+	Applied    bool          `json:"applied"`
+}
+
+//postTeamRename previews or applies a find/replace across team names
+func postTeamRename(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		req := new(renameRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil || (req.Find == "" && req.Prefix == "") {
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		replace := func(name string) string {
+			return strings.Replace(name, req.Find, req.Replace, -1)
+		}
+		if req.Find == "" {
+			replace = func(name string) string { return name }
+		} else if req.Regexp {
+			re, err := regexp.Compile(req.Find)
+			if err != nil {
+				returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: err.Error()})
+				return
+			}
+			replace = func(name string) string {
+				return re.ReplaceAllString(name, req.Replace)
+			}
+		}
+
+		if req.Apply && !checkEditable(w, d) {
+			return
+		}
+
+		old, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if old == nil {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		c := &db.Competition{Version: old.Version, Name: old.Name, Rounds: old.Rounds, RoundIDs: old.RoundIDs, Teams: make([]*db.Team, len(old.Teams))}
+		resp := &renameResponse{Renames: make([]*teamRename, 0)}
+		for i, t := range old.Teams {
+			name := strings.TrimSpace(replace(strings.TrimPrefix(t.Name, req.Prefix)))
+			if name == "" {
+				name = t.Name
+			}
+
+			team := *t
+			team.Name = name
+			c.Teams[i] = &team
+
+			if name != t.Name {
+				resp.Renames = append(resp.Renames, &teamRename{Team: i, TeamID: t.ID, Old: t.Name, New: name})
+			}
+		}
+		resp.Duplicates = c.DuplicateTeams()
+
+		if !req.Apply || len(resp.Renames) == 0 {
+			returnHTTP(w, http.StatusOK, resp)
+			return
+		}
+
+		if !checkDuplicates(w, r, old, c) {
+			return
+		}
+
+		if err = actorDB(d, r, sess).Write(c); err != nil {
+			log.Println("Unable to write database:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+		committed := time.Now()
+		resp.Applied = true
+
+		returnHTTP(w, http.StatusOK, resp)
+		sub.NotifyCommitted(committed, req.ID)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+//Timer is a countdown that publishes an EventTimerTick Event every second
+type Timer struct {
+	sub  *SubscribeService
+	stop chan struct{}
+	mu   *sync.Mutex
+}
+
+//NewTimer returns a new Timer publishing to the given SubscribeService
+func NewTimer(sub *SubscribeService) *Timer {
+	return &Timer{sub: sub, mu: new(sync.Mutex)}
+}
+
+func (t *Timer) run(id int, d time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	end := time.Now().Add(d)
+	t.sub.Publish(&Event{Type: EventTimerTick, ID: id, Payload: &TimerTickPayload{Remaining: int(d / time.Second)}})
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			remaining := int(end.Sub(now).Round(time.Second) / time.Second)
+			if remaining < 0 {
+				remaining = 0
+			}
+			t.sub.Publish(&Event{Type: EventTimerTick, ID: id, Payload: &TimerTickPayload{Remaining: remaining}})
+			if remaining == 0 {
+				return
+			}
+		}
+	}
+}
+
+//Start starts a countdown of the given duration, replacing any running countdown.
+//id is the subscriber id of the client that started the countdown
+func (t *Timer) Start(id int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stop != nil {
+		close(t.stop)
+	}
+
+	t.stop = make(chan struct{})
+	go t.run(id, d, t.stop)
+}
+
+//Stop stops the running countdown if there is one
+func (t *Timer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
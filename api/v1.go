@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//v1ContextKey is the type of v1Key
+type v1ContextKey int
+
+//v1Key is set in the request context of requests made to v1
+const v1Key v1ContextKey = 0
+
+//isV1 returns whether or not r was made to v1
+func isV1(r *http.Request) bool {
+	v1, _ := r.Context().Value(v1Key).(bool)
+	return v1
+}
+
+//v1Untranslated lists the routes whose JSON responses are documents to be imported again, which keep the full score objects
+var v1Untranslated = map[string]bool{
+	"/admin/export": true,
+}
+
+//v1Adapter serves h to v1 clients, which expect the v1 JSON shape: each score is a number, or null if unscored,
+//instead of a v2 score object, and competitions don't have round_ids.
+//JSON responses are buffered and translated with v1JSON; other responses, WebSocket upgrades,
+//and routes in v1Untranslated are written directly
+func v1Adapter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), v1Key, true))
+		if v1Untranslated[r.URL.Path] || websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		vw := &v1Writer{ResponseWriter: w}
+		h.ServeHTTP(vw, r)
+		vw.finish()
+	})
+}
+
+//v1Writer is an http.ResponseWriter that buffers JSON responses so they can be translated for v1 clients
+type v1Writer struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	//buf is nil unless the response is JSON
+	buf *bytes.Buffer
+}
+
+func (w *v1Writer) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); mediaType == "application/json" {
+		w.code, w.buf = code, new(bytes.Buffer)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *v1Writer) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+//Flush fulfills the http.Flusher interface. Buffered JSON responses aren't written until finish
+func (w *v1Writer) Flush() {
+	if w.buf != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//finish translates and writes a buffered JSON response. If it can't be translated it's written unchanged
+func (w *v1Writer) finish() {
+	if w.buf == nil {
+		return
+	}
+
+	buf, err := v1JSON(w.buf.Bytes())
+	if err != nil {
+		log.Println("Unable to translate v1 response:", err)
+		buf = w.buf.Bytes()
+	} else {
+		buf = append(buf, '\n')
+	}
+
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.code)
+	w.ResponseWriter.Write(buf)
+}
+
+//v1JSON returns the JSON document buf in the v1 shape, with each score object replaced by its v1 value and round_ids removed
+func v1JSON(buf []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v1Value(v))
+}
+
+//v1Value returns the decoded JSON value v in the v1 shape
+func v1Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if s, ok := v1Score(v); ok {
+			return s
+		}
+		//v1 clients send competitions back without round_ids, so rounds keep their IDs by name
+		delete(v, "round_ids")
+		for k, e := range v {
+			v[k] = v1Value(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = v1Value(e)
+		}
+	}
+	return v
+}
+
+//v1Score returns the v1 value of the score object o: its value if scored, 0 for a no-show, or nil if unscored.
+//ok is false if o isn't a score object
+func v1Score(o map[string]interface{}) (value interface{}, ok bool) {
+	state, _ := o["state"].(string)
+	if _, hasValue := o["value"]; !hasValue || !db.ScoreState(state).Valid() {
+		return nil, false
+	}
+	for k := range o {
+		if k != "value" && k != "state" && k != "fields" {
+			return nil, false
+		}
+	}
+
+	switch db.ScoreState(state) {
+	case db.ScoreScored:
+		return o["value"], true
+	case db.ScoreNoShow:
+		return json.Number("0"), true
+	}
+	return nil, true
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//newV1Router returns a router for a competition with a scored, a no-show, and an unscored score
+func newV1Router(t *testing.T) (http.Handler, db.DB, *MemorySessionStore) {
+	d := db.NewMemory()
+	if err := d.Init("Test", 3, []string{"Team 1"}, "admin", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Teams[0].Scores[0] = db.NewScore(5)
+	c.Teams[0].Scores[1] = db.Score{State: db.ScoreNoShow}
+	if err = d.Write(c); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewSubscribeService()
+	cues, err := NewCueService(d, sub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := NewMemorySessionStore(time.Hour, time.Hour, 0)
+	return NewRouter(d, sess, sub, NewConnectionLimiter(10, 10), cues, nil, RouterOptions{}), d, sess
+}
+
+//getV1Competition returns the decoded competition served at path
+func getV1Competition(t *testing.T, h http.Handler, path string) map[string]interface{} {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+	}
+
+	var c map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return c
+}
+
+//TestV1Shape pins the v1 JSON shape of a competition: scores are numbers, or null if unscored, and there are no round_ids
+func TestV1Shape(t *testing.T) {
+	h, _, _ := newV1Router(t)
+
+	c := getV1Competition(t, h, "/api/1.0/competition")
+	if _, ok := c["round_ids"]; ok {
+		t.Error("v1 competition has round_ids")
+	}
+
+	scores, _ := json.Marshal(c["teams"].([]interface{})[0].(map[string]interface{})["scores"])
+	if want := `[5,0,null]`; string(scores) != want {
+		t.Errorf("v1 scores = %s, want %s", scores, want)
+	}
+
+	c = getV1Competition(t, h, "/api/2.0/competition")
+	if _, ok := c["round_ids"]; !ok {
+		t.Error("v2 competition doesn't have round_ids")
+	}
+
+	scores, _ = json.Marshal(c["teams"].([]interface{})[0].(map[string]interface{})["scores"])
+	if want := `[{"state":"scored","value":5},{"state":"no_show","value":0},{"state":"unscored","value":0}]`; string(scores) != want {
+		t.Errorf("v2 scores = %s, want %s", scores, want)
+	}
+}
+
+//TestV1RoundTrip checks that a v1 client writing back the competition it read keeps its no-shows and round IDs
+func TestV1RoundTrip(t *testing.T) {
+	h, d, sess := newV1Router(t)
+	old, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"competition": getV1Competition(t, h, "/api/1.0/competition")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _, _ := sess.Create("admin", RoleAdmin, false)
+	r := httptest.NewRequest("PUT", "/api/1.0/competition", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "SESSION id="+id)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	c, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range old.RoundIDs {
+		if c.RoundIDs[i] != id {
+			t.Errorf("Round(%d) ID = %s, want %s", i, c.RoundIDs[i], id)
+		}
+	}
+	for i, s := range c.Teams[0].Scores {
+		if s.String() != old.Teams[0].Scores[i].String() {
+			t.Errorf("Round(%d) score = %s, want %s", i, s, old.Teams[0].Scores[i])
+		}
+	}
+}
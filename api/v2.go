@@ -0,0 +1,651 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//deprecated adds Deprecation, Link, and (if sunset isn't zero) Sunset headers to responses from h,
+//pointing clients to the successor API at successor
+func deprecated(h http.Handler, successor string, sunset time.Time) http.Handler {
+	link := "<" + successor + `>; rel="successor-version"`
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Link", link)
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+//subscriberID returns the client's subscriber ID from the X-Subscriber-ID header, or 0 if it isn't set.
+//Subscribers aren't notified of their own changes
+func subscriberID(r *http.Request) int {
+	id, _ := strconv.Atoi(r.Header.Get("X-Subscriber-ID"))
+	return id
+}
+
+//readCompetition reads the competition.
+//If it doesn't exist or an error occurs readCompetition returns nil and writes the error to w
+func readCompetition(w http.ResponseWriter, d db.DB) *db.Competition {
+	c, err := d.Read()
+	if err != nil {
+		log.Println("Unable to read database:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return nil
+	}
+
+	if c == nil {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return nil
+	}
+
+	return c
+}
+
+//readRound reads the competition and finds the round given in the path by ID or index.
+//If either doesn't exist or an error occurs readRound returns nil and writes the error to w
+func readRound(w http.ResponseWriter, r *http.Request, d db.DB) (*db.Competition, int) {
+	c := readCompetition(w, d)
+	if c == nil {
+		return nil, 0
+	}
+
+	round := c.FindRound(mux.Vars(r)["round"])
+	if round < 0 {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return nil, 0
+	}
+
+	return c, round
+}
+
+//without returns the indexes from 0 to n-1 except i
+func without(n, i int) []int {
+	order := make([]int, 0, n-1)
+	for j := 0; j < n; j++ {
+		if j != i {
+			order = append(order, j)
+		}
+	}
+	return order
+}
+
+//writeResource writes c, which user changed from old, and notifies subscribers.
+//If teamOrder or roundOrder is given, teams or rounds were removed, so attributions and drafts are remapped and only an update is published.
+//Otherwise c must only add to or change old's teams and rounds, changed scores and custom fields are validated,
+//and events are published for the changes.
+//If writeResource returns false it has written the error to w
+func writeResource(w http.ResponseWriter, r *http.Request, d db.DB, sub *SubscribeService, user string, old, c *db.Competition, teamOrder, roundOrder []int) bool {
+	if teamOrder == nil && roundOrder == nil {
+		c.AssignIDs()
+		err := compute(c)
+		if err == nil {
+			err = checkLocked(d, c, changedScores(old, c))
+		}
+		if err == nil {
+			err = checkRules(d, c, changedScores(old, c))
+		}
+		if err == nil {
+			err = checkCompetitionFields(d, old, c)
+		}
+		if err != nil {
+			returnInvalid(w, err)
+			return false
+		}
+	}
+
+	if err := db.WithActor(d, user).Write(c); err == db.ErrStaleVersion {
+		returnHTTP(w, http.StatusConflict, staleError)
+		return false
+	} else if err != nil {
+		log.Println("Unable to write database:", err)
+		returnHTTP(w, http.StatusInternalServerError, nil)
+		return false
+	}
+	committed := time.Now()
+
+	id := subscriberID(r)
+
+	if teamOrder != nil || roundOrder != nil {
+		if teamOrder == nil {
+			teamOrder, _ = permutation(nil, len(old.Teams))
+		}
+		if roundOrder == nil {
+			roundOrder, _ = permutation(nil, len(old.Rounds))
+		}
+		if err := remapCells(d, teamOrder, roundOrder); err != nil {
+			log.Println("Unable to remap attributions and drafts:", err)
+		}
+		sub.NotifyCommitted(committed, id)
+		return true
+	}
+
+	events := competitionEvents(id, old, c)
+	if err := attribute(d, user, events); err != nil {
+		log.Println("Unable to write score attributions:", err)
+	}
+
+	sub.PublishCommitted(committed, events...)
+	sub.NotifyCommitted(committed, id)
+	return true
+}
+
+type teamsResponse struct {
+	Teams []*teamResponse `json:"teams"`
+}
+
+//teamResponses returns each team in c with its standing
+func teamResponses(c *db.Competition) []*teamResponse {
+	teams := make([]*teamResponse, len(c.Teams))
+	for i, t := range c.Teams {
+		teams[i] = &teamResponse{Team: t, Index: i}
+	}
+	for _, s := range c.Standings() {
+		teams[s.Team].Standing = s
+	}
+	return teams
+}
+
+//requestTags returns the tags given in the tag query parameters
+func requestTags(r *http.Request) []string {
+	return db.NormalizeTags(r.URL.Query()["tag"])
+}
+
+//taggedTeamResponses returns the teams in c with every one of tags, ranked among themselves
+func taggedTeamResponses(c *db.Competition, tags []string) []*teamResponse {
+	teams := make([]*teamResponse, 0)
+	for _, t := range teamResponses(c) {
+		if t.HasTags(tags...) {
+			t.Standing = nil
+			teams = append(teams, t)
+		}
+	}
+
+	//the tagged teams are in the same order in the filtered competition
+	for _, s := range c.WithTags(tags...).Standings() {
+		t := teams[s.Team]
+		s.Team = t.Index
+		t.Standing = s
+	}
+	return teams
+}
+
+//teamRequest creates or changes a team. Omitted fields are unchanged.
+//Scores are only used when creating a team, and must have a score for each round if given
+type teamRequest struct {
+	Name   string     `json:"name"`
+	Scores []db.Score `json:"scores"`
+	Fields db.Fields  `json:"fields"`
+	Roster []string   `json:"roster"`
+	Tags   []string   `json:"tags"`
+}
+
+func getTeams(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		if tags := requestTags(r); len(tags) > 0 {
+			returnHTTP(w, http.StatusOK, &teamsResponse{Teams: taggedTeamResponses(c, tags)})
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &teamsResponse{Teams: teamResponses(c)})
+	}
+}
+
+type tagsResponse struct {
+	Tags []*db.TagCount `json:"tags"`
+}
+
+//getTags returns the tags of the teams with the number of teams that have each
+func getTags(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &tagsResponse{Tags: c.Tags()})
+	}
+}
+
+//postTeam adds a team to the end of the competition
+func postTeam(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(teamRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if strings.TrimSpace(req.Name) == "" {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "name can't be empty"})
+			return
+		}
+
+		old := readCompetition(w, d)
+		if old == nil {
+			return
+		}
+
+		scores := req.Scores
+		if scores == nil {
+			scores = make([]db.Score, len(old.Rounds))
+		}
+
+		if len(scores) != len(old.Rounds) {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "scores must have a score for each round"})
+			return
+		}
+
+		c := old.Copy()
+		c.Teams = append(c.Teams, &db.Team{Name: req.Name, Scores: scores, Fields: req.Fields, Roster: req.Roster, Tags: db.NormalizeTags(req.Tags)})
+
+		if !checkDuplicates(w, r, old, c) {
+			return
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, teamResponses(c)[len(c.Teams)-1])
+	}
+}
+
+//patchTeam renames or sets the custom fields, roster, or tags of the team given in the path by ID, slug, or index
+func patchTeam(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(teamRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		old, team := readTeam(w, r, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		if strings.TrimSpace(req.Name) != "" {
+			c.Teams[team].Name = req.Name
+		}
+		if req.Fields != nil {
+			c.Teams[team].Fields = req.Fields
+		}
+		if req.Roster != nil {
+			c.Teams[team].Roster = req.Roster
+		}
+		if req.Tags != nil {
+			c.Teams[team].Tags = db.NormalizeTags(req.Tags)
+		}
+
+		if !checkDuplicates(w, r, old, c) {
+			return
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, teamResponses(c)[team])
+	}
+}
+
+//deleteTeam removes the team given in the path by ID, slug, or index
+func deleteTeam(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		old, team := readTeam(w, r, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		c.Teams = append(c.Teams[:team], c.Teams[team+1:]...)
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, without(len(old.Teams), team), nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+//roundResponse is a round. Computed rounds have their definition and are read only.
+//Raw rounds are converted to placement points by a computed round and aren't counted in totals
+type roundResponse struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Index    int               `json:"index"`
+	Computed *db.ComputedRound `json:"computed,omitempty"`
+	ReadOnly bool              `json:"read_only"`
+	Raw      bool              `json:"raw"`
+}
+
+type roundsResponse struct {
+	Rounds []*roundResponse `json:"rounds"`
+}
+
+//roundRequest creates or renames a round
+type roundRequest struct {
+	Name string `json:"name"`
+}
+
+func newRoundResponse(c *db.Competition, round int) *roundResponse {
+	def := c.Computed[c.RoundIDs[round]]
+	return &roundResponse{ID: c.RoundIDs[round], Name: c.Rounds[round], Index: round, Computed: def, ReadOnly: def != nil, Raw: c.IsRaw(round)}
+}
+
+func getRounds(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		rounds := make([]*roundResponse, len(c.Rounds))
+		for i := range c.Rounds {
+			rounds[i] = newRoundResponse(c, i)
+		}
+
+		returnHTTP(w, http.StatusOK, &roundsResponse{Rounds: rounds})
+	}
+}
+
+//getRound returns the round given in the path by ID or index
+func getRound(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, round := readRound(w, r, d)
+		if c == nil {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, newRoundResponse(c, round))
+	}
+}
+
+//postRound adds an unscored round to the end of the competition
+func postRound(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(roundRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if strings.TrimSpace(req.Name) == "" {
+			returnHTTP(w, http.StatusBadRequest, &jsonError{Code: http.StatusBadRequest, Description: "name can't be empty"})
+			return
+		}
+
+		old := readCompetition(w, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		c.Rounds = append(c.Rounds, req.Name)
+		c.RoundIDs = append(c.RoundIDs, "")
+		for _, t := range c.Teams {
+			t.Scores = append(t.Scores, db.Score{State: db.ScoreUnscored})
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusCreated, newRoundResponse(c, len(c.Rounds)-1))
+	}
+}
+
+//patchRound renames the round given in the path by ID or index
+func patchRound(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		req := new(roundRequest)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		old, round := readRound(w, r, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		if strings.TrimSpace(req.Name) != "" {
+			c.Rounds[round] = req.Name
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, nil) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, newRoundResponse(c, round))
+	}
+}
+
+//deleteRound removes the round given in the path by ID or index and its scores
+func deleteRound(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		if !checkEditable(w, d) {
+			return
+		}
+
+		old, round := readRound(w, r, d)
+		if old == nil {
+			return
+		}
+
+		c := old.Copy()
+		c.Rounds = append(c.Rounds[:round], c.Rounds[round+1:]...)
+		c.RoundIDs = append(c.RoundIDs[:round], c.RoundIDs[round+1:]...)
+		for _, t := range c.Teams {
+			t.Scores = append(t.Scores[:round], t.Scores[round+1:]...)
+		}
+
+		if !writeResource(w, r, d, sub, session.Username, old, c, nil, without(len(old.Rounds), round)) {
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
+
+type scoreResponse struct {
+	Round   int      `json:"round"`
+	RoundID string   `json:"round_id"`
+	Score   db.Score `json:"score"`
+}
+
+type scoresResponse struct {
+	Scores []*scoreResponse `json:"scores"`
+}
+
+//getTeamScores returns each score of the team given in the path by ID, slug, or index
+func getTeamScores(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		scores := make([]*scoreResponse, len(c.Rounds))
+		for i, s := range c.Teams[team].Scores {
+			scores[i] = &scoreResponse{Round: i, RoundID: c.RoundIDs[i], Score: s}
+		}
+
+		returnHTTP(w, http.StatusOK, &scoresResponse{Scores: scores})
+	}
+}
+
+//getTeamScore returns the score of the team and round given in the path
+func getTeamScore(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkMaintenance(w, r, d, sess) {
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		round := c.FindRound(mux.Vars(r)["round"])
+		if round < 0 {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &scoreResponse{Round: round, RoundID: c.RoundIDs[round], Score: c.Teams[team].Scores[round]})
+	}
+}
+
+//putTeamScore sets the score of the team and round given in the path
+func putTeamScore(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		var score db.Score
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(&score); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		c, team := readTeam(w, r, d)
+		if c == nil {
+			return
+		}
+
+		round := c.FindRound(mux.Vars(r)["round"])
+		if round < 0 {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		draft := &Draft{Team: team, TeamID: c.Teams[team].ID, Round: round, RoundID: c.RoundIDs[round], Score: score}
+		code, err := applyScores(d, sub, session.Username, subscriberID(r), []*Draft{draft})
+		if code != http.StatusOK {
+			returnHTTP(w, code, applyErrorBody(code, err, "Unable to set score:"))
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &scoreResponse{Round: draft.Round, RoundID: draft.RoundID, Score: draft.Score})
+	}
+}
@@ -0,0 +1,380 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//doubleEntrySetting is the db setting key DoubleEntry is stored under
+const doubleEntrySetting = "double_entry"
+
+//verificationsSetting is the db setting key unverified scores are stored under, keyed by team and round ID
+const verificationsSetting = "verifications"
+
+//verifyMu serializes changes to unverified scores
+var verifyMu = new(sync.Mutex)
+
+//DoubleEntry is the double-entry verification configuration.
+//While Enabled, scores submitted by judges only become official once two judges have entered them independently and they match.
+//Scores set by admins are always official
+type DoubleEntry struct {
+	Enabled bool `json:"enabled"`
+}
+
+//Entry is a judge's independent entry of a score
+type Entry struct {
+	User  string    `json:"user"`
+	Score db.Score  `json:"score"`
+	Time  time.Time `json:"time"`
+}
+
+//Verification is a score waiting for a second entry, or with mismatched entries waiting for an admin to arbitrate.
+//Team and Round are resolved from the IDs when read
+type Verification struct {
+	Team     int      `json:"team"`
+	TeamID   string   `json:"team_id"`
+	Round    int      `json:"round"`
+	RoundID  string   `json:"round_id"`
+	Entries  []*Entry `json:"entries"`
+	Conflict bool     `json:"conflict"`
+}
+
+//DisputePayload is the Payload of an EventDispute Event, published when judges' entries of a score first conflict.
+//The entries aren't included since subscribers can't see unverified scores
+type DisputePayload struct {
+	Team    int    `json:"team"`
+	TeamID  string `json:"team_id"`
+	Round   int    `json:"round"`
+	RoundID string `json:"round_id"`
+}
+
+type verificationsResponse struct {
+	Verifications []*Verification `json:"verifications"`
+}
+
+func verificationKey(teamID, roundID string) string {
+	return teamID + "/" + roundID
+}
+
+func readDoubleEntry(d db.DB) (*DoubleEntry, error) {
+	de := new(DoubleEntry)
+	_, err := d.ReadSetting(doubleEntrySetting, de)
+	return de, err
+}
+
+//readVerifications returns the unverified scores resolved against c. Scores for teams or rounds that no longer exist are dropped
+func readVerifications(d db.DB, c *db.Competition) (map[string]*Verification, error) {
+	vs := make(map[string]*Verification)
+	if _, err := d.ReadSetting(verificationsSetting, &vs); err != nil {
+		return nil, err
+	}
+
+	for key, v := range vs {
+		v.Team, v.Round = c.TeamIndex(v.TeamID), c.RoundIndex(v.RoundID)
+		if v.Team < 0 || v.Round < 0 {
+			delete(vs, key)
+		}
+	}
+	return vs, nil
+}
+
+//entriesMatch returns whether or not two entries are for the same score
+func entriesMatch(a, b *Entry) bool {
+	return scoreEqual(a.Score, b.Score) && reflect.DeepEqual(a.Score.Fields, b.Score.Fields)
+}
+
+//add records e, replacing the user's previous entry. If another user's entry matches e, add returns true.
+//Otherwise, if another user has an entry, the verification is marked as a conflict
+func (v *Verification) add(e *Entry) bool {
+	entries := make([]*Entry, 0, len(v.Entries)+1)
+	for _, old := range v.Entries {
+		if old.User != e.User {
+			entries = append(entries, old)
+		}
+	}
+
+	for _, old := range entries {
+		if entriesMatch(old, e) {
+			return true
+		}
+	}
+
+	v.Entries = append(entries, e)
+	v.Conflict = len(v.Entries) > 1
+	return false
+}
+
+//verifyScores records the given scores as entries by user. Scores that match another user's entry are applied to the competition.
+//verifyScores returns http.StatusOK if the scores were recorded, or the HTTP status to return and an error if one occurred
+func verifyScores(d db.DB, sub *SubscribeService, user string, id int, scores []*Draft) (int, error) {
+	state, err := d.State()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read competition state: %v", err)
+	}
+
+	if !state.Editable() {
+		return http.StatusConflict, nil
+	}
+
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+
+	c, err := d.Read()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read database: %v", err)
+	}
+
+	if c == nil {
+		return http.StatusNotFound, nil
+	}
+
+	if code, err := checkDrafts(d, c, scores); code != http.StatusOK {
+		return code, err
+	}
+
+	vs, err := readVerifications(d, c)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to read unverified scores: %v", err)
+	}
+
+	var verified []*Draft
+	var disputes []*Event
+	now := time.Now()
+	for _, s := range scores {
+		key := verificationKey(s.TeamID, s.RoundID)
+		v, ok := vs[key]
+		if !ok {
+			v = &Verification{Team: s.Team, TeamID: s.TeamID, Round: s.Round, RoundID: s.RoundID}
+			vs[key] = v
+		}
+		conflict := v.Conflict
+		if v.add(&Entry{User: user, Score: s.Score, Time: now}) {
+			delete(vs, key)
+			verified = append(verified, s)
+		} else if v.Conflict && !conflict {
+			disputes = append(disputes, &Event{Type: EventDispute, ID: id, Payload: &DisputePayload{Team: v.Team, TeamID: v.TeamID, Round: v.Round, RoundID: v.RoundID}})
+		}
+	}
+
+	if len(verified) > 0 {
+		if code, err := applyScores(d, sub, user, id, verified); code != http.StatusOK {
+			return code, err
+		}
+	}
+
+	if err = d.WriteSetting(verificationsSetting, vs); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to write unverified scores: %v", err)
+	}
+
+	sub.Publish(disputes...)
+
+	return http.StatusOK, nil
+}
+
+func getDoubleEntry(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		de, err := readDoubleEntry(d)
+		if err != nil {
+			log.Println("Unable to read double entry:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, de)
+	}
+}
+
+//putDoubleEntry enables or disables double entry. Unverified scores are kept when it's disabled, and can still be arbitrated
+func putDoubleEntry(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		de := new(DoubleEntry)
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(de); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := d.WriteSetting(doubleEntrySetting, de); err != nil {
+			log.Println("Unable to write double entry:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, de)
+	}
+}
+
+//getVerifications returns the unverified scores, ordered by team and round. If the conflicts query parameter is set,
+//only scores waiting for arbitration are returned
+func getVerifications(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		c := readCompetition(w, d)
+		if c == nil {
+			return
+		}
+
+		verifyMu.Lock()
+		vs, err := readVerifications(d, c)
+		verifyMu.Unlock()
+		if err != nil {
+			log.Println("Unable to read unverified scores:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		_, conflicts := r.URL.Query()["conflicts"]
+		list := make([]*Verification, 0, len(vs))
+		for _, v := range vs {
+			if v.Conflict || !conflicts {
+				list = append(list, v)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Team != list[j].Team {
+				return list[i].Team < list[j].Team
+			}
+			return list[i].Round < list[j].Round
+		})
+
+		returnHTTP(w, http.StatusOK, &verificationsResponse{Verifications: list})
+	}
+}
+
+//readVerification returns the competition and the key of the unverified score given by the request's team and round,
+//or writes an error to w and returns nil
+func readVerification(w http.ResponseWriter, r *http.Request, d db.DB) (*db.Competition, string) {
+	c, team := readTeam(w, r, d)
+	if c == nil {
+		return nil, ""
+	}
+
+	round := c.FindRound(mux.Vars(r)["round"])
+	if round < 0 {
+		returnHTTP(w, http.StatusNotFound, nil)
+		return nil, ""
+	}
+
+	return c, verificationKey(c.Teams[team].ID, c.RoundIDs[round])
+}
+
+//putVerification arbitrates an unverified score, making the given score official
+func putVerification(d db.DB, sess *MemorySessionStore, sub *SubscribeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkJSON(w, r) {
+			return
+		}
+
+		session := checkSession(w, r, sess, RoleAdmin)
+		if session == nil {
+			return
+		}
+
+		var score db.Score
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(&score); err != nil {
+			log.Println("Unable to decode request body:", err)
+			returnHTTP(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		verifyMu.Lock()
+		defer verifyMu.Unlock()
+
+		c, key := readVerification(w, r, d)
+		if c == nil {
+			return
+		}
+
+		vs, err := readVerifications(d, c)
+		if err != nil {
+			log.Println("Unable to read unverified scores:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		v, ok := vs[key]
+		if !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		draft := &Draft{Team: v.Team, TeamID: v.TeamID, Round: v.Round, RoundID: v.RoundID, Score: score}
+		if code, err := applyScores(d, sub, session.Username, subscriberID(r), []*Draft{draft}); code != http.StatusOK {
+			returnHTTP(w, code, applyErrorBody(code, err, "Unable to arbitrate score:"))
+			return
+		}
+
+		delete(vs, key)
+		if err = d.WriteSetting(verificationsSetting, vs); err != nil {
+			log.Println("Unable to write unverified scores:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, &scoreResponse{Round: draft.Round, RoundID: draft.RoundID, Score: draft.Score})
+	}
+}
+
+//deleteVerification discards the entries of an unverified score without changing the official score
+func deleteVerification(d db.DB, sess *MemorySessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, sess) {
+			return
+		}
+
+		verifyMu.Lock()
+		defer verifyMu.Unlock()
+
+		c, key := readVerification(w, r, d)
+		if c == nil {
+			return
+		}
+
+		vs, err := readVerifications(d, c)
+		if err != nil {
+			log.Println("Unable to read unverified scores:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if _, ok := vs[key]; !ok {
+			returnHTTP(w, http.StatusNotFound, nil)
+			return
+		}
+
+		delete(vs, key)
+		if err = d.WriteSetting(verificationsSetting, vs); err != nil {
+			log.Println("Unable to write unverified scores:", err)
+			returnHTTP(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		returnHTTP(w, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,349 @@
+//Package archive reads and writes .scorerpkg competition archives.
+//
+//A .scorerpkg archive is a zip file containing:
+//
+//	manifest.json        Manifest describing the archive
+//	competition.json     the current Competition
+//	revisions/<id>.json  each Revision, including its Competition, with id starting at 0
+//	assets/<name>        each asset, described in the manifest
+//
+//Archives are versioned by Manifest.Version. Readers accept archives with any version up to Version
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/korylprince/competition-scorer/assets"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Format identifies .scorerpkg archives in Manifest.Format
+const Format = "scorerpkg"
+
+//Version is the current archive version
+const Version = 1
+
+//Extension is the file extension used for archives
+const Extension = ".scorerpkg"
+
+//Manifest describes the contents of an archive
+type Manifest struct {
+	Format    string         `json:"format"`
+	Version   int            `json:"version"`
+	Created   time.Time      `json:"created"`
+	Name      string         `json:"name"`
+	State     db.State       `json:"state"`
+	Revisions int            `json:"revisions"`
+	Assets    []*assets.Info `json:"assets"`
+}
+
+func writeJSON(z *zip.Writer, name string, v interface{}) error {
+	f, err := z.Create(name)
+	if err != nil {
+		return fmt.Errorf("Unable to create %s: %v", name, err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(v); err != nil {
+		return fmt.Errorf("Unable to write %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func revisionName(id int) string {
+	return fmt.Sprintf("revisions/%d.json", id)
+}
+
+//Export writes an archive of the competition, revisions, and assets to w
+func Export(w io.Writer, d db.DB, store assets.Store) error {
+	c, err := d.Read()
+	if err != nil {
+		return fmt.Errorf("Unable to read competition: %v", err)
+	}
+
+	if c == nil {
+		return fmt.Errorf("Competition has not been created")
+	}
+
+	state, err := d.State()
+	if err != nil {
+		return fmt.Errorf("Unable to read state: %v", err)
+	}
+
+	revs, err := d.Revisions()
+	if err != nil {
+		return fmt.Errorf("Unable to read revisions: %v", err)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		return fmt.Errorf("Unable to list assets: %v", err)
+	}
+
+	m := &Manifest{
+		Format:    Format,
+		Version:   Version,
+		Created:   time.Now(),
+		Name:      c.Name,
+		State:     state,
+		Revisions: len(revs),
+		Assets:    infos,
+	}
+
+	z := zip.NewWriter(w)
+
+	if err = writeJSON(z, "manifest.json", m); err != nil {
+		return err
+	}
+
+	if err = writeJSON(z, "competition.json", c); err != nil {
+		return err
+	}
+
+	for i, rev := range revs {
+		full, err := d.ReadRevision(rev.ID)
+		if err != nil {
+			return fmt.Errorf("Unable to read revision %d: %v", rev.ID, err)
+		}
+
+		if full == nil {
+			return fmt.Errorf("Revision %d does not exist", rev.ID)
+		}
+
+		full.ID = int32(i)
+		if err = writeJSON(z, revisionName(i), full); err != nil {
+			return err
+		}
+	}
+
+	for _, info := range infos {
+		a, err := store.Get(info.Name)
+		if err != nil {
+			return fmt.Errorf("Unable to read asset %s: %v", info.Name, err)
+		}
+
+		if a == nil {
+			continue
+		}
+
+		f, err := z.Create(path.Join("assets", info.Name))
+		if err != nil {
+			return fmt.Errorf("Unable to create asset %s: %v", info.Name, err)
+		}
+
+		if _, err = f.Write(a.Data); err != nil {
+			return fmt.Errorf("Unable to write asset %s: %v", info.Name, err)
+		}
+	}
+
+	return z.Close()
+}
+
+func readFile(files map[string]*zip.File, name string, limit int64) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("Archive is missing %s", name)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open %s: %v", name, err)
+	}
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %v", name, err)
+	}
+
+	if int64(len(buf)) > limit {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+
+	return buf, nil
+}
+
+func readJSON(files map[string]*zip.File, name string, v interface{}) error {
+	//competitions are small, so a JSON file this large isn't valid
+	buf, err := readFile(files, name, 16<<20)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(buf, v); err != nil {
+		return fmt.Errorf("Unable to decode %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func checkCompetition(c *db.Competition) error {
+	if c == nil || c.Name == "" {
+		return fmt.Errorf("Competition name is empty")
+	}
+
+	for _, t := range c.Teams {
+		if t == nil || t.Name == "" {
+			return fmt.Errorf("Team name is empty")
+		}
+		if len(t.Scores) != len(c.Rounds) {
+			return fmt.Errorf("Team %s has %d scores for %d rounds", t.Name, len(t.Scores), len(c.Rounds))
+		}
+	}
+
+	return nil
+}
+
+//open returns the files, Manifest, and Competition of the archive read from r, or an error if they aren't valid
+func open(r io.ReaderAt, size int64) (map[string]*zip.File, *Manifest, *db.Competition, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Unable to read archive: %v", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	m := new(Manifest)
+	if err = readJSON(files, "manifest.json", m); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if m.Format != Format {
+		return nil, nil, nil, fmt.Errorf("Unknown archive format: %s", m.Format)
+	}
+
+	if m.Version < 1 || m.Version > Version {
+		return nil, nil, nil, fmt.Errorf("Unsupported archive version: %d", m.Version)
+	}
+
+	if m.State != "" && !m.State.Valid() {
+		return nil, nil, nil, fmt.Errorf("Unknown state: %s", m.State)
+	}
+
+	c := new(db.Competition)
+	if err = readJSON(files, "competition.json", c); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err = checkCompetition(c); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return files, m, c, nil
+}
+
+//Read returns the Manifest and Competition of the archive read from r without importing it, or an error if one occurred
+func Read(r io.ReaderAt, size int64) (*Manifest, *db.Competition, error) {
+	_, m, c, err := open(r, size)
+	return m, c, err
+}
+
+//Import replaces the competition, revisions, and state with those in the archive read from r and stores its assets.
+//Import returns the archive's Manifest or an error if one occurred. Nothing is changed if the archive isn't valid
+func Import(r io.ReaderAt, size int64, d db.DB, store assets.Store) (*Manifest, error) {
+	files, m, c, err := open(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]*db.Revision, m.Revisions)
+	for i := range revs {
+		rev := new(db.Revision)
+		if err = readJSON(files, revisionName(i), rev); err != nil {
+			return nil, err
+		}
+
+		if err = checkCompetition(rev.Competition); err != nil {
+			return nil, fmt.Errorf("Revision %d: %v", i, err)
+		}
+
+		revs[i] = rev
+	}
+
+	as := make([]*assets.Asset, 0, len(m.Assets))
+	for _, info := range m.Assets {
+		if info == nil || !assets.ValidName(info.Name) {
+			return nil, fmt.Errorf("Invalid asset in manifest")
+		}
+
+		buf, err := readFile(files, path.Join("assets", info.Name), assets.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		as = append(as, &assets.Asset{Info: info, Data: buf})
+	}
+
+	if err = d.Restore(c, revs); err != nil {
+		return nil, fmt.Errorf("Unable to restore competition: %v", err)
+	}
+
+	if m.State != "" {
+		if err = d.SetState(m.State); err != nil {
+			return nil, fmt.Errorf("Unable to set state: %v", err)
+		}
+	}
+
+	for _, a := range as {
+		if err = store.Put(a.Name, a.ContentType, a.Data); err != nil {
+			return nil, fmt.Errorf("Unable to store asset %s: %v", a.Name, err)
+		}
+	}
+
+	return m, nil
+}
+
+//Entry is an archive in a directory
+type Entry struct {
+	File        string
+	Manifest    *Manifest
+	Competition *db.Competition
+}
+
+//ReadDir returns the archives in dir, oldest first. Files that aren't valid archives are skipped and returned in skipped
+func ReadDir(dir string) (entries []*Entry, skipped map[string]error, err error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read archive directory: %v", err)
+	}
+
+	skipped = make(map[string]error)
+	for _, info := range infos {
+		if info.IsDir() || path.Ext(info.Name()) != Extension {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, info.Name()))
+		if err != nil {
+			skipped[info.Name()] = err
+			continue
+		}
+
+		m, c, err := Read(f, info.Size())
+		f.Close()
+		if err != nil {
+			skipped[info.Name()] = err
+			continue
+		}
+
+		entries = append(entries, &Entry{File: info.Name(), Manifest: m, Competition: c})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Manifest.Created.Before(entries[j].Manifest.Created) })
+
+	return entries, skipped, nil
+}
@@ -0,0 +1,97 @@
+package assets
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//MaxSize is the largest asset that can be stored
+const MaxSize = 2 << 20
+
+//nameRegexp matches valid asset names
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
+
+//ErrInvalidName is returned if an asset name isn't valid
+var ErrInvalidName = errors.New("Invalid asset name")
+
+//ErrTooLarge is returned if an asset is larger than MaxSize
+var ErrTooLarge = errors.New("Asset too large")
+
+//Info describes a stored asset
+type Info struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Modified    time.Time `json:"modified"`
+}
+
+//Asset is a stored file
+type Asset struct {
+	*Info
+	Data []byte `json:"data"`
+}
+
+//Store stores assets
+type Store interface {
+	//Get returns the Asset with the given name or an error if one occurred.
+	//Get returns nil if the asset doesn't exist
+	Get(name string) (*Asset, error)
+
+	//Put stores the given data as the Asset with the given name or returns an error if one occurred
+	Put(name, contentType string, data []byte) error
+
+	//Delete removes the Asset with the given name or returns an error if one occurred
+	Delete(name string) error
+
+	//List returns the Info for all stored assets or an error if one occurred
+	List() ([]*Info, error)
+}
+
+//ValidName returns whether or not name can be used as an asset name
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+func check(name string, data []byte) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+	if len(data) > MaxSize {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+//Handler returns an http.Handler that serves assets from s with the given path prefix stripped
+func Handler(s Store, prefix string) http.Handler {
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if !ValidName(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		a, err := s.Get(name)
+		if err != nil {
+			log.Printf("Unable to read asset %s: %v", name, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if a == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(a.Data)))
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Header().Set("Last-Modified", a.Modified.UTC().Format(http.TimeFormat))
+		w.Write(a.Data)
+	}))
+}
@@ -0,0 +1,106 @@
+package assets
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//indexSetting is the db setting key the asset index is stored under
+const indexSetting = "assets"
+
+//assetSetting returns the db setting key the asset with the given name is stored under
+func assetSetting(name string) string {
+	return "asset/" + name
+}
+
+type dbStore struct {
+	d  db.DB
+	mu *sync.Mutex
+}
+
+//NewDBStore returns a new Store that stores assets in the given DB
+func NewDBStore(d db.DB) Store {
+	return &dbStore{d: d, mu: new(sync.Mutex)}
+}
+
+func (s *dbStore) index() (map[string]*Info, error) {
+	index := make(map[string]*Info)
+	if _, err := s.d.ReadSetting(indexSetting, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (s *dbStore) Get(name string) (*Asset, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+
+	a := new(Asset)
+	ok, err := s.d.ReadSetting(assetSetting(name), a)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *dbStore) Put(name, contentType string, data []byte) error {
+	if err := check(name, data); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return err
+	}
+
+	info := &Info{Name: name, ContentType: contentType, Size: len(data), Modified: time.Now()}
+	if err = s.d.WriteSetting(assetSetting(name), &Asset{Info: info, Data: data}); err != nil {
+		return err
+	}
+
+	index[name] = info
+	return s.d.WriteSetting(indexSetting, index)
+}
+
+func (s *dbStore) Delete(name string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return err
+	}
+
+	if err = s.d.WriteSetting(assetSetting(name), nil); err != nil {
+		return err
+	}
+
+	delete(index, name)
+	return s.d.WriteSetting(indexSetting, index)
+}
+
+func (s *dbStore) List() ([]*Info, error) {
+	index, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(index))
+	for _, info := range index {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos, nil
+}
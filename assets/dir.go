@@ -0,0 +1,111 @@
+package assets
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+type dirStore struct {
+	dir string
+}
+
+//NewDirStore returns a new Store that stores assets as files in the given directory
+func NewDirStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func contentType(name string, data []byte) string {
+	if typ := mime.TypeByExtension(filepath.Ext(name)); typ != "" {
+		return typ
+	}
+	return http.DetectContentType(data)
+}
+
+func (s *dirStore) Get(name string) (*Asset, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+
+	path := filepath.Join(s.dir, name)
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Asset{
+		Info: &Info{Name: name, ContentType: contentType(name, data), Size: len(data), Modified: stat.ModTime()},
+		Data: data,
+	}, nil
+}
+
+//Put fulfills the Store interface. contentType is ignored; the type is determined from the name or data when read
+func (s *dirStore) Put(name, contentType string, data []byte) error {
+	if err := check(name, data); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *dirStore) Delete(name string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirStore) List() ([]*Info, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !ValidName(f.Name()) {
+			continue
+		}
+		infos = append(infos, &Info{
+			Name:        f.Name(),
+			ContentType: mime.TypeByExtension(filepath.Ext(f.Name())),
+			Size:        int(f.Size()),
+			Modified:    f.ModTime(),
+		})
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,83 @@
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	//register image formats for decoding
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+//LogoSize is the largest width or height of a re-encoded logo
+const LogoSize = 256
+
+//ErrInvalidImage is returned if an uploaded image can't be decoded
+var ErrInvalidImage = errors.New("Invalid image")
+
+//scale returns img scaled down to fit within max x max pixels, averaging the source pixels covered by each destination pixel.
+//img is returned unchanged if it already fits
+func scale(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+
+	dw, dh := max, h*max/w
+	if h > w {
+		dw, dh = w*max/h, max
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+		}
+	}
+
+	return dst
+}
+
+//EncodeLogo decodes a PNG, JPEG, or GIF image from r, scales it to fit within LogoSize x LogoSize,
+//and returns it encoded as a PNG, or an error if one occurred
+func EncodeLogo(r io.Reader) ([]byte, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	buf := new(bytes.Buffer)
+	if err = png.Encode(buf, scale(img, LogoSize)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package chatbot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Chat is a stream chat the Bot can read from and post to
+type Chat interface {
+	//Run connects to the chat and calls handle for every message received until an error occurs
+	Run(handle func(message string)) error
+
+	//Send posts the given message to the chat
+	Send(message string) error
+}
+
+//standingsCount is the number of teams included in a !standings reply
+const standingsCount = 3
+
+//Bot answers "!standings" in a Chat and posts lead changes as the competition is updated
+type Bot struct {
+	d      db.DB
+	sub    *api.SubscribeService
+	chat   Chat
+	leader string
+}
+
+//New returns a new Bot for the given Chat
+func New(d db.DB, sub *api.SubscribeService, chat Chat) *Bot {
+	return &Bot{d: d, sub: sub, chat: chat}
+}
+
+func (b *Bot) standings() (string, error) {
+	c, err := b.d.Read()
+	if err != nil {
+		return "", err
+	}
+	if c == nil {
+		return "No competition is running", nil
+	}
+
+	standings := c.Standings()
+	if len(standings) > standingsCount {
+		standings = standings[:standingsCount]
+	}
+
+	parts := make([]string, 0, len(standings))
+	for _, s := range standings {
+		parts = append(parts, fmt.Sprintf("%d. %s (%s)", s.Rank, s.Name, c.Precision.Format(s.Total)))
+	}
+
+	return fmt.Sprintf("%s: %s", c.Name, strings.Join(parts, ", ")), nil
+}
+
+func (b *Bot) handle(message string) {
+	if strings.TrimSpace(strings.ToLower(message)) != "!standings" {
+		return
+	}
+
+	reply, err := b.standings()
+	if err != nil {
+		log.Println("Chat bot unable to read database:", err)
+		return
+	}
+
+	if err = b.chat.Send(reply); err != nil {
+		log.Println("Chat bot unable to send message:", err)
+	}
+}
+
+//checkLeader posts a message if the leader has changed since the last check
+func (b *Bot) checkLeader(post bool) {
+	c, err := b.d.Read()
+	if err != nil {
+		log.Println("Chat bot unable to read database:", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	l := db.Leader(c.Standings())
+	if l == nil || l.Name == b.leader {
+		return
+	}
+	b.leader = l.Name
+
+	if !post {
+		return
+	}
+
+	if err = b.chat.Send(fmt.Sprintf("%s takes the lead with %s points!", l.Name, c.Precision.Format(l.Total))); err != nil {
+		log.Println("Chat bot unable to send message:", err)
+	}
+}
+
+func (b *Bot) watch() {
+	for {
+		_, events := b.sub.Subscribe()
+		for e := range events {
+			if e.Type == api.EventUpdate {
+				b.checkLeader(true)
+			}
+		}
+	}
+}
+
+//Run starts the Bot, reconnecting to the Chat if the connection fails. Run never returns
+func (b *Bot) Run() {
+	b.checkLeader(false)
+	go b.watch()
+
+	for {
+		if err := b.chat.Run(b.handle); err != nil {
+			log.Println("Chat bot disconnected:", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
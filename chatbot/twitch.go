@@ -0,0 +1,94 @@
+package chatbot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+const twitchAddr = "irc.chat.twitch.tv:6697"
+
+//Twitch is a Chat using Twitch's IRC interface
+type Twitch struct {
+	user    string
+	token   string
+	channel string
+
+	conn net.Conn
+	mu   *sync.Mutex
+}
+
+//NewTwitch returns a new Twitch Chat for the given bot account, OAuth token, and channel
+func NewTwitch(user, token, channel string) *Twitch {
+	return &Twitch{
+		user:    strings.ToLower(user),
+		token:   strings.TrimPrefix(token, "oauth:"),
+		channel: strings.ToLower(strings.TrimPrefix(channel, "#")),
+		mu:      new(sync.Mutex),
+	}
+}
+
+func (t *Twitch) write(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	_, err := fmt.Fprintf(t.conn, "%s\r\n", line)
+	return err
+}
+
+//Run fulfills the Chat interface
+func (t *Twitch) Run(handle func(message string)) error {
+	conn, err := tls.Dial("tcp", twitchAddr, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to connect: %v", err)
+	}
+	defer conn.Close()
+
+	t.mu.Lock()
+	t.conn = conn
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.conn = nil
+		t.mu.Unlock()
+	}()
+
+	for _, line := range []string{"PASS oauth:" + t.token, "NICK " + t.user, "JOIN #" + t.channel} {
+		if err = t.write(line); err != nil {
+			return fmt.Errorf("Unable to write: %v", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "PING ") {
+			if err = t.write("PONG " + strings.TrimPrefix(line, "PING ")); err != nil {
+				return fmt.Errorf("Unable to write: %v", err)
+			}
+			continue
+		}
+
+		//:nick!nick@nick.tmi.twitch.tv PRIVMSG #channel :message
+		parts := strings.SplitN(line, " ", 4)
+		if len(parts) == 4 && parts[1] == "PRIVMSG" {
+			handle(strings.TrimPrefix(parts[3], ":"))
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("Unable to read: %v", err)
+	}
+	return fmt.Errorf("connection closed")
+}
+
+//Send fulfills the Chat interface
+func (t *Twitch) Send(message string) error {
+	return t.write(fmt.Sprintf("PRIVMSG #%s :%s", t.channel, message))
+}
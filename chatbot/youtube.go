@@ -0,0 +1,113 @@
+package chatbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const youTubeMessagesURL = "https://www.googleapis.com/youtube/v3/liveChat/messages"
+
+//YouTube is a Chat using the YouTube Live Streaming API
+type YouTube struct {
+	chatID string
+	token  string
+	client *http.Client
+}
+
+//NewYouTube returns a new YouTube Chat for the given live chat ID and OAuth access token
+func NewYouTube(chatID, token string) *YouTube {
+	return &YouTube{chatID: chatID, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type youTubeMessages struct {
+	NextPageToken         string `json:"nextPageToken"`
+	PollingIntervalMillis int    `json:"pollingIntervalMillis"`
+	Items                 []struct {
+		Snippet struct {
+			DisplayMessage string `json:"displayMessage"`
+		} `json:"snippet"`
+	} `json:"items"`
+}
+
+func (y *YouTube) do(method, u string, body interface{}, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+y.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := y.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+//Run fulfills the Chat interface. Messages sent before Run is called are ignored
+func (y *YouTube) Run(handle func(message string)) error {
+	var pageToken string
+	first := true
+
+	for {
+		q := url.Values{"liveChatId": {y.chatID}, "part": {"snippet"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+
+		msgs := new(youTubeMessages)
+		if err := y.do(http.MethodGet, youTubeMessagesURL+"?"+q.Encode(), nil, msgs); err != nil {
+			return fmt.Errorf("Unable to read messages: %v", err)
+		}
+
+		if !first {
+			for _, item := range msgs.Items {
+				handle(item.Snippet.DisplayMessage)
+			}
+		}
+		first = false
+		pageToken = msgs.NextPageToken
+
+		interval := time.Duration(msgs.PollingIntervalMillis) * time.Millisecond
+		if interval < time.Second {
+			interval = time.Second
+		}
+		time.Sleep(interval)
+	}
+}
+
+//Send fulfills the Chat interface
+func (y *YouTube) Send(message string) error {
+	body := map[string]interface{}{
+		"snippet": map[string]interface{}{
+			"liveChatId": y.chatID,
+			"type":       "textMessageEvent",
+			"textMessageDetails": map[string]string{
+				"messageText": message,
+			},
+		},
+	}
+	return y.do(http.MethodPost, youTubeMessagesURL+"?part=snippet", body, nil)
+}
@@ -1,20 +1,45 @@
 package db
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
-//Team represents a competition team
+//Team represents a competition team. Slug is generated from Name and isn't stored
 type Team struct {
-	Name   string   `json:"name"`
-	Scores []*int32 `json:"scores"`
+	ID     string  `json:"id"`
+	Slug   string  `json:"slug"`
+	Name   string  `json:"name"`
+	Scores []Score `json:"scores"`
+	Logo   string  `json:"logo,omitempty"`
+	Fields Fields  `json:"fields,omitempty"`
+	//Roster holds the names of the team's members
+	Roster []string `json:"roster,omitempty"`
+	//Handicap adjusts the team's total in the standings
+	Handicap *Handicap `json:"handicap,omitempty"`
+	//Tags group teams for filtering, like "rookie" or "region north"
+	Tags []string `json:"tags,omitempty"`
 }
 
-//Competition represents a competition
+//Competition represents a competition.
+//RoundIDs holds the stable ID of each round in Rounds. IDs are assigned when a competition is written.
+//Computed holds the definitions of computed rounds by round ID; their scores are recomputed when a competition is written.
+//Precision sets the decimal places of score values, or is nil for whole numbers.
+//Version is incremented each time the competition is written, and must be the stored competition's Version to write it
 type Competition struct {
-	Name   string   `json:"name"`
-	Rounds []string `json:"rounds"`
-	Teams  []*Team  `json:"teams"`
+	Version   int32                     `json:"version"`
+	Name      string                    `json:"name"`
+	Rounds    []string                  `json:"rounds"`
+	RoundIDs  []string                  `json:"round_ids"`
+	Teams     []*Team                   `json:"teams"`
+	Computed  map[string]*ComputedRound `json:"computed,omitempty"`
+	Precision *Precision                `json:"precision,omitempty"`
 }
 
+//ErrStaleVersion is returned by Write if the competition was changed since it was read
+var ErrStaleVersion = errors.New("competition was changed since it was read")
+
 //Revision represents a revision of a competition
 type Revision struct {
 	ID          int32        `json:"id"`
@@ -22,12 +47,59 @@ type Revision struct {
 	Competition *Competition `json:"competition,omitempty"`
 }
 
+//State represents the lifecycle state of a competition
+type State string
+
+//Competition lifecycle states
+const (
+	StateSetup      State = "setup"
+	StateInProgress State = "in_progress"
+	StateFrozen     State = "frozen"
+	StateFinalized  State = "finalized"
+	StateArchived   State = "archived"
+)
+
+var transitions = map[State][]State{
+	StateSetup:      {StateInProgress},
+	StateInProgress: {StateFrozen, StateFinalized},
+	StateFrozen:     {StateInProgress, StateFinalized},
+	StateFinalized:  {StateInProgress, StateArchived},
+	StateArchived:   {},
+}
+
+//Valid returns whether or not s is a known State
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+//CanTransition returns whether or not a competition in State s can move to State to
+func (s State) CanTransition(to State) bool {
+	for _, t := range transitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+//Editable returns whether or not a competition in State s accepts changes
+func (s State) Editable() bool {
+	return s == StateSetup || s == StateInProgress
+}
+
 //DB is a competition database
 type DB interface {
-	//Init initializes the database with the given parameters
+	//Init initializes the database with the given parameters.
+	//If username is empty, the stored credentials are unchanged
 	Init(name string, rounds int, teams []string, username, password string) error
 
-	//Authenticate returns if the given username and password is correct or an error if one occurred
+	//HasCredentials returns whether or not admin credentials have been stored or an error if one occurred
+	HasCredentials() (bool, error)
+
+	//Authenticate returns if the given username and password is correct or an error if one occurred.
+	//A correct password hashed with different PasswordOptions is rehashed, recording the user as who changed the credentials.
+	//If the rehash fails, Authenticate returns true with the error; the old hash still works
 	Authenticate(username, password string) (status bool, err error)
 
 	//UpdateCredentials updates the database with the given username and password or returns an error if one occurred
@@ -37,15 +109,72 @@ type DB interface {
 	//Note: Competition will be nil
 	Revisions() ([]*Revision, error)
 
+	//WalkRevisions calls fn with each revision in order or returns an error if one occurred.
+	//Revisions are read in batches, each in its own transaction, so the database isn't locked while fn runs.
+	//WalkRevisions stops and returns the error if fn returns one.
+	//Note: Competition will be nil
+	WalkRevisions(fn func(*Revision) error) error
+
 	//ReadRevisions returns the Revision with the given id or an error if one occurred
 	//If the revision with the given id doesn't exist, ReadRevision will return nil
 	ReadRevision(id int32) (*Revision, error)
 
+	//PruneRevisions removes the revisions outside the RetentionPolicy set with SetRetentionPolicy
+	//and returns how many were removed or an error if one occurred. Revisions are also pruned when a competition is written
+	PruneRevisions() (int, error)
+
+	//DiffRevisions returns the difference between the revisions with ids a and b or an error if one occurred.
+	//If either revision doesn't exist, DiffRevisions returns nil
+	DiffRevisions(a, b int32) (*RevisionDiff, error)
+
 	//Read returns the Competition stored in the database or an error if one occurred.
 	//Read returns a nil Competition if the database is empty
 	Read() (*Competition, error)
 
 	//Write stores the given Competition in the database or an error if one occurred.
+	//Write returns ErrStaleVersion if c.Version isn't the stored Competition's Version; otherwise c.Version is incremented.
 	//Write clears the database if Competition is nil
 	Write(c *Competition) error
+
+	//RestoreRevision replaces the Competition with the one in the Revision with the given id and returns it, or an error if one occurred.
+	//Like Write, the replaced Competition is stored as a new revision and the Version is incremented.
+	//If the revision with the given id doesn't exist, RestoreRevision returns nil
+	RestoreRevision(id int32) (*Competition, error)
+
+	//WriteScore sets the score of the team at index team for the round at index round and recomputes computed rounds,
+	//or returns an error if one occurred. Only the changed scores are stored, and unlike Write no revision is stored,
+	//though an audit entry is. The Competition's Version is incremented
+	WriteScore(team, round int, score Score) error
+
+	//Restore replaces the Competition and all revisions in the database or returns an error if one occurred.
+	//Revisions are stored with the given timestamps, renumbered starting at 0 in the given order.
+	//c.Version is set to the next version of the replaced Competition
+	Restore(c *Competition, revisions []*Revision) error
+
+	//State returns the current lifecycle State of the competition or an error if one occurred.
+	//State returns StateSetup if no state has been stored
+	State() (State, error)
+
+	//SetState stores the given State or returns an error if one occurred.
+	//SetState does not check if the transition is allowed
+	SetState(s State) error
+
+	//ReadSetting decodes the JSON encoded setting with the given key into v or returns an error if one occurred.
+	//ReadSetting returns false if the setting doesn't exist
+	ReadSetting(key string, v interface{}) (bool, error)
+
+	//WriteSetting stores v JSON encoded as the setting with the given key or returns an error if one occurred.
+	//WriteSetting deletes the setting if v is nil
+	WriteSetting(key string, v interface{}) error
+
+	//Settings returns all of the JSON encoded settings by key or an error if one occurred
+	Settings() (map[string]json.RawMessage, error)
+
+	//AuditEntries returns the audit entries recorded at or after since, oldest first, or an error if one occurred.
+	//An audit entry is recorded in the same transaction as each Write, WriteScore, RestoreRevision, Restore, and UpdateCredentials
+	AuditEntries(since time.Time) ([]*AuditEntry, error)
+
+	//Events returns the ScoreEvents with sequence numbers at or after fromSeq, oldest first, or an error if one occurred.
+	//A ScoreEvent is recorded in the same transaction as each score changed by Write, RestoreRevision, Restore, and WriteScore
+	Events(fromSeq uint64) ([]*ScoreEvent, error)
 }
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//archivedSetting is the setting key the ArchivedCompetitions are listed under.
+//Each archived competition is stored in the setting archivedSetting + "/" + its ID
+const archivedSetting = "archived_competitions"
+
+//ErrArchivedNotFound is the cause of the error returned by Unarchive if the archived competition doesn't exist
+var ErrArchivedNotFound = errors.New("archived competition not found")
+
+//archiveMu serializes archiving and unarchiving, which take several writes
+var archiveMu = new(sync.Mutex)
+
+//ArchivedCompetition describes a competition archived with Archive. State is the State it had when it was archived,
+//which is restored by Unarchive
+type ArchivedCompetition struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Archived  time.Time `json:"archived"`
+	State     State     `json:"state"`
+	Teams     int       `json:"teams"`
+	Rounds    int       `json:"rounds"`
+	Revisions int       `json:"revisions"`
+}
+
+//archivedDocument is an archived competition with its revisions
+type archivedDocument struct {
+	Competition *Competition `json:"competition"`
+	State       State        `json:"state"`
+	Revisions   []*Revision  `json:"revisions"`
+}
+
+func archivedKey(id string) string {
+	return archivedSetting + "/" + id
+}
+
+//ListArchived returns the competitions archived in d, oldest first, or an error if one occurred
+func ListArchived(d DB) ([]*ArchivedCompetition, error) {
+	archived := make([]*ArchivedCompetition, 0)
+	if _, err := d.ReadSetting(archivedSetting, &archived); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read archived competitions"}
+	}
+	return archived, nil
+}
+
+//Archive moves the competition in d and its revisions to the archived competitions, leaving d empty and in StateSetup
+//so a new competition can be created, and returns the ArchivedCompetition or an error if one occurred.
+//Settings and admin credentials are kept. Archive returns nil if d doesn't have a competition
+func Archive(d DB) (*ArchivedCompetition, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	c, err := d.Read()
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read Competition"}
+	}
+	if c == nil {
+		return nil, nil
+	}
+
+	doc := &archivedDocument{Competition: c}
+	if doc.State, err = d.State(); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read State"}
+	}
+	if doc.Revisions, err = readRevisions(d); err != nil {
+		return nil, err
+	}
+
+	archived, err := ListArchived(d)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ArchivedCompetition{
+		ID:        newID("a"),
+		Name:      c.Name,
+		Archived:  time.Now(),
+		State:     doc.State,
+		Teams:     len(c.Teams),
+		Rounds:    len(c.Rounds),
+		Revisions: len(doc.Revisions),
+	}
+
+	//the competition is stored before it's removed, so a failure can leave a copy but never lose it
+	if err = d.WriteSetting(archivedKey(a.ID), doc); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't write ArchivedCompetition(%s)", a.ID)}
+	}
+	if err = d.WriteSetting(archivedSetting, append(archived, a)); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't write archived competitions"}
+	}
+
+	if err = d.Restore(nil, nil); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't clear Competition"}
+	}
+	if err = d.SetState(StateSetup); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't write State(%s)", StateSetup)}
+	}
+
+	return a, nil
+}
+
+//Unarchive replaces the empty competition in d with the archived competition with the given id and its revisions, restoring its State,
+//and returns it or an error if one occurred. Unarchive returns ErrCompetitionExists if d has a competition,
+//and ErrArchivedNotFound if the archived competition doesn't exist
+func Unarchive(d DB, id string) (*Competition, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	current, err := d.Read()
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read Competition"}
+	}
+	if current != nil {
+		return nil, &Error{Err: ErrCompetitionExists, Description: "Competition must be archived before another is unarchived"}
+	}
+
+	archived, err := ListArchived(d)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, a := range archived {
+		if a.ID == id {
+			index = i
+		}
+	}
+
+	doc := new(archivedDocument)
+	ok, err := d.ReadSetting(archivedKey(id), doc)
+	if err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read ArchivedCompetition(%s)", id)}
+	}
+	if !ok || index < 0 || doc.Competition == nil {
+		return nil, &Error{Err: ErrArchivedNotFound, Description: fmt.Sprintf("ArchivedCompetition(%s) doesn't exist", id)}
+	}
+
+	if err = d.Restore(doc.Competition, doc.Revisions); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't restore ArchivedCompetition(%s)", id)}
+	}
+	if err = d.SetState(doc.State); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't write State(%s)", doc.State)}
+	}
+
+	//the competition is removed from the archive after it's restored, so a failure can leave a copy but never lose it
+	if err = d.WriteSetting(archivedSetting, append(archived[:index], archived[index+1:]...)); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't write archived competitions"}
+	}
+	if err = d.WriteSetting(archivedKey(id), nil); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't delete ArchivedCompetition(%s)", id)}
+	}
+
+	return d.Read()
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//Audit actions
+const (
+	AuditWrite       = "write"
+	AuditRestore     = "restore"
+	AuditCredentials = "credentials"
+)
+
+//AuditEntry records a change to the database. Entries are only appended, in the same transaction as the change.
+//Actor is who made the change, or empty if it isn't known. For AuditWrite and AuditRestore, Diff is the change to the competition, with From and To left 0.
+//For AuditCredentials, Old and New are the usernames; passwords aren't recorded
+type AuditEntry struct {
+	ID     uint64        `json:"id"`
+	Time   time.Time     `json:"time"`
+	Actor  string        `json:"actor"`
+	Action string        `json:"action"`
+	Diff   *RevisionDiff `json:"diff,omitempty"`
+	Old    string        `json:"old,omitempty"`
+	New    string        `json:"new,omitempty"`
+}
+
+//NewWriteAudit returns the AuditEntry for actor replacing the competition old with c
+func NewWriteAudit(actor string, old, c *Competition) *AuditEntry {
+	return &AuditEntry{Time: time.Now(), Actor: actor, Action: AuditWrite, Diff: Diff(old, c)}
+}
+
+//NewRestoreAudit returns the AuditEntry for actor restoring the competition c and its revisions over the competition old
+func NewRestoreAudit(actor string, old, c *Competition) *AuditEntry {
+	return &AuditEntry{Time: time.Now(), Actor: actor, Action: AuditRestore, Diff: Diff(old, c)}
+}
+
+//NewCredentialsAudit returns the AuditEntry for actor changing the admin username from old to username
+func NewCredentialsAudit(actor, old, username string) *AuditEntry {
+	return &AuditEntry{Time: time.Now(), Actor: actor, Action: AuditCredentials, Old: old, New: username}
+}
+
+//Auditor is implemented by a DB that records who made a change in its audit entries
+type Auditor interface {
+	//WriteAs is Write, recording actor as who made the change
+	WriteAs(actor string, c *Competition) error
+
+	//WriteScoreAs is WriteScore, recording actor as who made the change
+	WriteScoreAs(actor string, team, round int, score Score) error
+
+	//RestoreRevisionAs is RestoreRevision, recording actor as who made the change
+	RestoreRevisionAs(actor string, id int32) (*Competition, error)
+
+	//RestoreAs is Restore, recording actor as who made the change
+	RestoreAs(actor string, c *Competition, revisions []*Revision) error
+
+	//UpdateCredentialsAs is UpdateCredentials, recording actor as who made the change
+	UpdateCredentialsAs(actor, username, password string) error
+}
+
+//actorDB is a DB that records its actor in the audit entries of changes made with it
+type actorDB struct {
+	DB
+	auditor Auditor
+	actor   string
+}
+
+//WithActor returns a DB that records actor as who made changes made with it, or d if it doesn't implement Auditor
+func WithActor(d DB, actor string) DB {
+	a, ok := d.(Auditor)
+	if !ok {
+		return d
+	}
+	return &actorDB{DB: d, auditor: a, actor: actor}
+}
+
+func (d *actorDB) Write(c *Competition) error {
+	return d.auditor.WriteAs(d.actor, c)
+}
+
+func (d *actorDB) WriteScore(team, round int, score Score) error {
+	return d.auditor.WriteScoreAs(d.actor, team, round, score)
+}
+
+func (d *actorDB) RestoreRevision(id int32) (*Competition, error) {
+	return d.auditor.RestoreRevisionAs(d.actor, id)
+}
+
+func (d *actorDB) Restore(c *Competition, revisions []*Revision) error {
+	return d.auditor.RestoreAs(d.actor, c, revisions)
+}
+
+func (d *actorDB) UpdateCredentials(username, password string) error {
+	return d.auditor.UpdateCredentialsAs(d.actor, username, password)
+}
+
+//writeAudit appends e to the audit bucket, assigning its ID
+func writeAudit(tx *bolt.Tx, e *AuditEntry) error {
+	auditBucket, err := createTxBucketIfNotExists(tx, []byte("audit"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Database audit Bucket"}
+	}
+
+	if e.ID, err = auditBucket.NextSequence(); err != nil {
+		return &Error{Err: err, Description: "Couldn't get next AuditEntry ID"}
+	}
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode AuditEntry(%d)", e.ID)}
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, e.ID)
+	if err = put(auditBucket, key, buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write AuditEntry(%d)", e.ID)}
+	}
+
+	return nil
+}
+
+func (db *boltDB) AuditEntries(since time.Time) (entries []*AuditEntry, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	entries = make([]*AuditEntry, 0)
+
+	auditBucket := txBucket(tx, []byte("audit"))
+	if auditBucket == nil {
+		return entries, nil
+	}
+
+	err = auditBucket.ForEach(func(k, v []byte) error {
+		e := new(AuditEntry)
+		if err := json.Unmarshal(decrypt(auditBucket, k, v), e); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode AuditEntry(%d)", binary.BigEndian.Uint64(k))}
+		}
+		if !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
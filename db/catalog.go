@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//ErrCompetitionExists is returned by Catalog.Create if a competition with the slug already exists
+var ErrCompetitionExists = errors.New("competition already exists")
+
+//Catalog stores multiple competitions addressed by slug. Each competition has its own DB,
+//so revisions, credentials, state, and settings are kept separately
+type Catalog interface {
+	//List returns the slugs of the stored competitions in order or an error if one occurred
+	List() ([]string, error)
+
+	//Open returns the DB of the competition with the given slug or an error if one occurred.
+	//Open returns a nil DB if the competition doesn't exist
+	Open(slug string) (DB, error)
+
+	//Create creates the competition with the given slug and returns its empty DB or an error if one occurred.
+	//Create returns ErrCompetitionExists if the competition already exists
+	Create(slug string) (DB, error)
+}
+
+//ValidSlug returns whether or not s is a URL-safe slug as returned by Slug
+func ValidSlug(s string) bool {
+	return s != "" && Slug(s) == s
+}
+
+type dirCatalog struct {
+	dir  string
+	ext  string
+	open func(path string) (DB, error)
+
+	mu  *sync.Mutex
+	dbs map[string]DB
+}
+
+//NewDirCatalog returns a Catalog that stores each competition in the file <slug><ext> in dir, creating dir if needed.
+//Files are opened with open, and stay open once opened
+func NewDirCatalog(dir, ext string, open func(path string) (DB, error)) (Catalog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't create competitions directory(%s)", dir)}
+	}
+	return &dirCatalog{dir: dir, ext: ext, open: open, mu: new(sync.Mutex), dbs: make(map[string]DB)}, nil
+}
+
+func (c *dirCatalog) path(slug string) string {
+	return filepath.Join(c.dir, slug+c.ext)
+}
+
+func (c *dirCatalog) List() ([]string, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read competitions directory(%s)", c.dir)}
+	}
+
+	var slugs []string
+	for _, f := range files {
+		slug := strings.TrimSuffix(f.Name(), c.ext)
+		if !f.IsDir() && strings.HasSuffix(f.Name(), c.ext) && ValidSlug(slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+	sort.Strings(slugs)
+
+	return slugs, nil
+}
+
+func (c *dirCatalog) Open(slug string) (DB, error) {
+	if !ValidSlug(slug) {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d, ok := c.dbs[slug]; ok {
+		return d, nil
+	}
+
+	if _, err := os.Stat(c.path(slug)); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read Competition(%s) file", slug)}
+	}
+
+	return c.openLocked(slug)
+}
+
+func (c *dirCatalog) Create(slug string) (DB, error) {
+	if !ValidSlug(slug) {
+		return nil, &Error{Err: nil, Description: fmt.Sprintf("Invalid slug(%s)", slug)}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.dbs[slug]; ok {
+		return nil, ErrCompetitionExists
+	}
+
+	if _, err := os.Stat(c.path(slug)); err == nil {
+		return nil, ErrCompetitionExists
+	} else if !os.IsNotExist(err) {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read Competition(%s) file", slug)}
+	}
+
+	return c.openLocked(slug)
+}
+
+//openLocked opens the competition's file, creating it if it doesn't exist. The caller must hold c.mu
+func (c *dirCatalog) openLocked(slug string) (DB, error) {
+	d, err := c.open(c.path(slug))
+	if err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't open Competition(%s)", slug)}
+	}
+	c.dbs[slug] = d
+	return d, nil
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//Computed round functions
+const (
+	ComputeSum     = "sum"
+	ComputeAverage = "average"
+	ComputeMax     = "max"
+	//ComputePlacement converts the raw scores of a single round into placement points
+	ComputePlacement = "placement"
+)
+
+//DefaultPlacementPoints are the placement points used if a placement round doesn't set Points
+var DefaultPlacementPoints = []int32{10, 8, 6, 4, 2, 1}
+
+//ComputedRound defines a round whose scores are computed from other rounds instead of entered.
+//Only scored source rounds are used; if none are scored the computed round is unscored.
+//Averages are rounded with the competition's Precision.
+//
+//A placement round ranks the teams scored in its one source round, highest first or lowest first if LowestFirst is set,
+//and gives each the whole number of points in Points for its place (DefaultPlacementPoints if empty); places past the end of Points get 0.
+//Tied teams share the average of the points for the places they cover. The source round is a raw round:
+//it keeps the entered scores but isn't counted in totals
+type ComputedRound struct {
+	Func        string   `json:"func"`
+	Rounds      []string `json:"rounds"`
+	Points      []int32  `json:"points,omitempty"`
+	LowestFirst bool     `json:"lowest_first,omitempty"`
+}
+
+//IsComputed returns whether or not the round at the given index is computed
+func (c *Competition) IsComputed(round int) bool {
+	if round < 0 || round >= len(c.RoundIDs) {
+		return false
+	}
+	_, ok := c.Computed[c.RoundIDs[round]]
+	return ok
+}
+
+//IsRaw returns whether or not the round at the given index is the source of a placement round and so isn't counted in totals
+func (c *Competition) IsRaw(round int) bool {
+	if round < 0 || round >= len(c.RoundIDs) {
+		return false
+	}
+	for _, def := range c.Computed {
+		if def.Func == ComputePlacement && len(def.Rounds) == 1 && def.Rounds[0] == c.RoundIDs[round] {
+			return true
+		}
+	}
+	return false
+}
+
+//CountedScores returns the scores of the team at the given index with raw rounds unscored.
+//Scorers should total these instead of the team's Scores
+func (c *Competition) CountedScores(team int) []Score {
+	scores := c.Teams[team].Scores
+	var counted []Score
+	for i := range scores {
+		if !c.IsRaw(i) {
+			continue
+		}
+		if counted == nil {
+			counted = append([]Score(nil), scores...)
+		}
+		counted[i] = Score{State: ScoreUnscored}
+	}
+	if counted == nil {
+		return scores
+	}
+	return counted
+}
+
+//computeOrder returns the IDs of the computed rounds in c ordered so each comes after the computed rounds it uses,
+//or an error if a definition isn't valid
+func (c *Competition) computeOrder() ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	var order []string
+	state := make(map[string]int)
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("Computed round %s depends on itself", id)
+		case done:
+			return nil
+		}
+
+		def := c.Computed[id]
+		switch def.Func {
+		case ComputeSum, ComputeAverage, ComputeMax:
+		case ComputePlacement:
+			if len(def.Rounds) != 1 {
+				return fmt.Errorf("Computed round %s must use exactly one round to convert to placement points", id)
+			}
+			for _, p := range def.Points {
+				if p < 0 {
+					return fmt.Errorf("Computed round %s placement points can't be negative", id)
+				}
+			}
+		default:
+			return fmt.Errorf("Computed round %s func must be %s, %s, %s, or %s", id, ComputeSum, ComputeAverage, ComputeMax, ComputePlacement)
+		}
+
+		state[id] = visiting
+		for _, src := range def.Rounds {
+			if c.RoundIndex(src) < 0 {
+				return fmt.Errorf("Computed round %s uses unknown round %s", id, src)
+			}
+			if _, ok := c.Computed[src]; ok {
+				if err := visit(src); err != nil {
+					return err
+				}
+			}
+		}
+		state[id] = done
+		order = append(order, id)
+		return nil
+	}
+
+	//visit in round order so errors are deterministic
+	for _, id := range c.RoundIDs {
+		if _, ok := c.Computed[id]; ok {
+			if err := visit(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return order, nil
+}
+
+//ValidateComputed returns an error if a computed round doesn't exist, has an unknown func,
+//uses a round that doesn't exist, or depends on itself
+func (c *Competition) ValidateComputed() error {
+	for id := range c.Computed {
+		if c.RoundIndex(id) < 0 {
+			return fmt.Errorf("Computed round %s doesn't exist", id)
+		}
+	}
+	_, err := c.computeOrder()
+	return err
+}
+
+//Compute removes computed round definitions for rounds that no longer exist and the rounds they use that no longer exist,
+//then sets the score of each team in each computed round. Compute returns an error if a definition isn't valid
+func (c *Competition) Compute() error {
+	if len(c.Computed) == 0 {
+		c.Computed = nil
+		return nil
+	}
+
+	for id, def := range c.Computed {
+		if c.RoundIndex(id) < 0 {
+			delete(c.Computed, id)
+			continue
+		}
+		rounds := make([]string, 0, len(def.Rounds))
+		for _, src := range def.Rounds {
+			if c.RoundIndex(src) >= 0 {
+				rounds = append(rounds, src)
+			}
+		}
+		def.Rounds = rounds
+		//a placement round without its source round has nothing to convert
+		if def.Func == ComputePlacement && len(rounds) == 0 {
+			delete(c.Computed, id)
+		}
+	}
+
+	order, err := c.computeOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		def, round := c.Computed[id], c.RoundIndex(id)
+		if def.Func == ComputePlacement {
+			c.place(def, round)
+			continue
+		}
+		for _, t := range c.Teams {
+			var total, max int64
+			var n int
+			for _, src := range def.Rounds {
+				s := t.Scores[c.RoundIndex(src)]
+				if !s.Scored() {
+					continue
+				}
+				if n == 0 || int64(s.Value) > max {
+					max = int64(s.Value)
+				}
+				total += int64(s.Value)
+				n++
+			}
+
+			if n == 0 {
+				t.Scores[round] = Score{State: ScoreUnscored, Fields: t.Scores[round].Fields}
+				continue
+			}
+
+			var v int64
+			switch def.Func {
+			case ComputeSum:
+				v = total
+			case ComputeAverage:
+				v = c.Precision.Divide(total, int64(n))
+			case ComputeMax:
+				v = max
+			}
+			t.Scores[round] = Score{Value: int32(v), State: ScoreScored, Fields: t.Scores[round].Fields}
+		}
+	}
+
+	return nil
+}
+
+//place sets each team's score in the placement round at the given index from its place in def's source round
+func (c *Competition) place(def *ComputedRound, round int) {
+	points := def.Points
+	if len(points) == 0 {
+		points = DefaultPlacementPoints
+	}
+	scale := pow10(c.Precision.places())
+
+	src := c.RoundIndex(def.Rounds[0])
+	var placed []*Team
+	for _, t := range c.Teams {
+		if t.Scores[src].Scored() {
+			placed = append(placed, t)
+		} else {
+			t.Scores[round] = Score{State: ScoreUnscored, Fields: t.Scores[round].Fields}
+		}
+	}
+
+	sort.SliceStable(placed, func(i, j int) bool {
+		if def.LowestFirst {
+			return placed[i].Scores[src].Value < placed[j].Scores[src].Value
+		}
+		return placed[i].Scores[src].Value > placed[j].Scores[src].Value
+	})
+
+	for i := 0; i < len(placed); {
+		//tied teams cover places i through j-1
+		j := i + 1
+		for j < len(placed) && placed[j].Scores[src].Value == placed[i].Scores[src].Value {
+			j++
+		}
+
+		var total int64
+		for p := i; p < j && p < len(points); p++ {
+			total += int64(points[p]) * scale
+		}
+		v := c.Precision.Divide(total, int64(j-i))
+
+		for _, t := range placed[i:j] {
+			t.Scores[round] = Score{Value: int32(v), State: ScoreScored, Fields: t.Scores[round].Fields}
+		}
+		i = j
+	}
+}
+
+//copyComputed returns a deep copy of computed
+func copyComputed(computed map[string]*ComputedRound) map[string]*ComputedRound {
+	if computed == nil {
+		return nil
+	}
+	cp := make(map[string]*ComputedRound, len(computed))
+	for id, def := range computed {
+		cp[id] = &ComputedRound{Func: def.Func, Rounds: append([]string(nil), def.Rounds...), Points: append([]int32(nil), def.Points...), LowestFirst: def.LowestFirst}
+	}
+	return cp
+}
+
+func readComputed(b *bucket, c *Competition) error {
+	buf := get(b, []byte("computed"))
+	if buf == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &c.Computed); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Competition(%s) computed", c.Name)}
+	}
+	return nil
+}
+
+func writeComputed(b *bucket, c *Competition) error {
+	if len(c.Computed) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(c.Computed)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Competition(%s) computed", c.Name)}
+	}
+	if err = put(b, []byte("computed"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) computed", c.Name)}
+	}
+	return nil
+}
@@ -1,58 +1,118 @@
 package db
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/boltdb/bolt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type boltDB struct {
 	*bolt.DB
+
+	//snapshot holds a *snapshot of the current competition so reads don't need a transaction.
+	//A nil *snapshot means the competition must be read from the database
+	snapshot atomic.Value
+	//writeMu makes sure snapshots are stored in the same order as writes
+	writeMu sync.Mutex
+
+	//fileMu guards replacing DB when the database is relocated
+	fileMu sync.RWMutex
+
+	//alert is the *StorageAlert of the failing storage, or nil if writes are succeeding
+	alert   *StorageAlert
+	alertMu sync.Mutex
 }
 
-//New returns a new DB with the given file path
+//snapshot is an immutable copy of the current competition. c is nil if the database is empty
+type snapshot struct {
+	c *Competition
+}
+
+//New returns a new DB with the given file path, upgrading its schema if it was written by an earlier version.
+//An error is returned if the file is encrypted (use NewEncrypted) or was written by a newer version
 func New(path string) (DB, error) {
 	db, err := bolt.Open(path, 0644, nil)
-	return &boltDB{db}, err
+	if err != nil {
+		return &boltDB{DB: db}, err
+	}
+
+	if err = db.View(func(tx *bolt.Tx) error { return checkEncryption(tx, nil) }); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = migrateSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltDB{DB: db}, nil
 }
 
 func (db *boltDB) Init(name string, rounds int, teams []string, username, password string) error {
-	if err := db.UpdateCredentials(username, password); err != nil {
-		return &Error{Err: err, Description: "Couldn't update credentials"}
+	if username != "" {
+		if err := db.UpdateCredentials(username, password); err != nil {
+			return &Error{Err: err, Description: "Couldn't update credentials"}
+		}
 	}
 
-	c := &Competition{
-		Name:   name,
-		Rounds: make([]string, 0, rounds),
-		Teams:  make([]*Team, 0, len(teams)),
+	if err := db.Write(NewCompetition(name, rounds, teams)); err != nil {
+		return &Error{Err: err, Description: "Couldn't write competition to database"}
 	}
 
-	for r := 1; r <= rounds; r++ {
-		c.Rounds = append(c.Rounds, fmt.Sprintf("Round %d", r))
+	if err := db.SetState(StateSetup); err != nil {
+		return &Error{Err: err, Description: "Couldn't set competition state"}
 	}
 
-	for _, team := range teams {
-		t := &Team{
-			Name:   team,
-			Scores: make([]*int32, rounds),
+	return nil
+}
+
+func (db *boltDB) HasCredentials() (status bool, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return false, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: err, Description: "Couldn't end transaction"}
 		}
+	}()
+
+	configBucket := txBucket(tx, []byte("config"))
+	if configBucket == nil {
+		return false, nil
+	}
+
+	return get(configBucket, []byte("username")) != nil && get(configBucket, []byte("hash")) != nil, nil
+}
 
-		c.Teams = append(c.Teams, t)
+//Authenticate checks the credentials and rehashes the password if it was hashed with different PasswordOptions
+func (db *boltDB) Authenticate(username string, password string) (bool, error) {
+	status, hash, err := db.authenticate(username, password)
+	if err != nil || !status {
+		return status, err
 	}
 
-	if err := db.Write(c); err != nil {
-		return &Error{Err: err, Description: "Couldn't write competition to database"}
+	if NeedsRehash(hash) {
+		//the old hash is still valid, so a failed rehash is retried at the next login
+		if err := db.UpdateCredentialsAs(username, username, password); err != nil {
+			return true, &Error{Err: err, Description: "Couldn't rehash password"}
+		}
 	}
 
-	return nil
+	return true, nil
 }
 
-func (db *boltDB) Authenticate(username string, password string) (status bool, err error) {
+func (db *boltDB) authenticate(username string, password string) (status bool, hash []byte, err error) {
 	tx, err := db.Begin(false)
 	if err != nil {
-		return false, &Error{Err: err, Description: "Couldn't start transaction"}
+		return false, nil, &Error{Err: err, Description: "Couldn't start transaction"}
 	}
 	defer func() {
 		lErr := tx.Rollback()
@@ -61,20 +121,30 @@ func (db *boltDB) Authenticate(username string, password string) (status bool, e
 		}
 	}()
 
-	configBucket := tx.Bucket([]byte("config"))
+	configBucket := txBucket(tx, []byte("config"))
 	if configBucket == nil {
-		return false, &Error{Err: nil, Description: "Database config Bucket was nil"}
+		return false, nil, &Error{Err: nil, Description: "Database config Bucket was nil"}
 	}
 
-	if username != string(configBucket.Get([]byte("username"))) {
-		return false, nil
+	if username != string(get(configBucket, []byte("username"))) {
+		return false, nil, nil
 	}
 
-	hash := configBucket.Get([]byte("hash"))
-	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil, nil
+	//bolt values are only valid during the transaction
+	hash = append([]byte(nil), get(configBucket, []byte("hash"))...)
+	return CheckPassword(hash, password), hash, nil
+}
+
+func (db *boltDB) UpdateCredentials(username string, password string) error {
+	return db.UpdateCredentialsAs("", username, password)
 }
 
-func (db *boltDB) UpdateCredentials(username string, password string) (err error) {
+//UpdateCredentialsAs stores the credentials and an audit entry, retrying while storage is full or read-only
+func (db *boltDB) UpdateCredentialsAs(actor, username, password string) error {
+	return db.retry(func() error { return db.updateCredentials(actor, username, password) })
+}
+
+func (db *boltDB) updateCredentials(actor, username, password string) (err error) {
 	tx, err := db.Begin(true)
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't start transaction"}
@@ -89,38 +159,40 @@ func (db *boltDB) UpdateCredentials(username string, password string) (err error
 		}
 		lErr := tx.Commit()
 		if lErr != nil {
-			err = &Error{Err: err, Description: "Couldn't commit transaction"}
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
 		}
 	}()
 
-	configBucket, err := tx.CreateBucketIfNotExists([]byte("config"))
+	configBucket, err := createTxBucketIfNotExists(tx, []byte("config"))
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't create Database config Bucket"}
 	}
 
-	if err = configBucket.Put([]byte("username"), []byte(username)); err != nil {
+	audit := NewCredentialsAudit(actor, string(get(configBucket, []byte("username"))), username)
+
+	if err = put(configBucket, []byte("username"), []byte(username)); err != nil {
 		return &Error{Err: err, Description: "Couldn't update username"}
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hash, err := HashPassword(password)
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't hash password"}
 	}
 
-	if err = configBucket.Put([]byte("hash"), hash); err != nil {
+	if err = put(configBucket, []byte("hash"), hash); err != nil {
 		return &Error{Err: err, Description: "Couldn't update password hash"}
 	}
 
-	return nil
+	return writeAudit(tx, audit)
 }
 
 func (db *boltDB) getLatestRevision(tx *bolt.Tx) (int32, error) {
-	configBucket := tx.Bucket([]byte("config"))
+	configBucket := txBucket(tx, []byte("config"))
 	if configBucket == nil {
 		return 0, &Error{Err: nil, Description: "Database config Bucket was nil"}
 	}
 
-	last := configBucket.Get([]byte("current_revision"))
+	last := get(configBucket, []byte("current_revision"))
 	if last == nil {
 		return -1, nil
 	}
@@ -128,7 +200,12 @@ func (db *boltDB) getLatestRevision(tx *bolt.Tx) (int32, error) {
 	return bytesToInt(last)
 }
 
-func (db *boltDB) Revisions() ([]*Revision, error) {
+//revisionBatch is the number of revisions read in each transaction by WalkRevisions
+const revisionBatch = 256
+
+//readRevisionBatch returns up to revisionBatch revisions with IDs starting at start.
+//Revisions removed by PruneRevisions are skipped
+func (db *boltDB) readRevisionBatch(start int32) (revisions []*Revision, err error) {
 	tx, err := db.Begin(false)
 	if err != nil {
 		return nil, &Error{Err: err, Description: "Couldn't start transaction"}
@@ -140,30 +217,29 @@ func (db *boltDB) Revisions() ([]*Revision, error) {
 		}
 	}()
 
-	revisionsBucket := tx.Bucket([]byte("revisions"))
+	revisionsBucket := txBucket(tx, []byte("revisions"))
 	if revisionsBucket == nil {
 		return nil, nil
 	}
 
-	last, err := db.getLatestRevision(tx)
-	if err != nil {
-		return nil, &Error{Err: err, Description: "Couldn't get latest Revision"}
-	}
-
-	revisions := make([]*Revision, 0, last+1)
+	cur := revisionsBucket.Cursor()
+	for k, v := cur.Seek(intToBytes(start)); k != nil && len(revisions) < revisionBatch; k, v = cur.Next() {
+		//revisions are buckets
+		if v != nil {
+			continue
+		}
 
-	for i := 0; i <= int(last); i++ {
-		revisionBucket := revisionsBucket.Bucket(intToBytes(int32(i)))
-		if revisionBucket == nil {
-			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't get Revision(%d)", i)}
+		i, err := bytesToInt(k)
+		if err != nil {
+			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Revision ID(%#v)", k)}
 		}
 
-		configBucket := revisionBucket.Bucket([]byte("config"))
+		configBucket := revisionsBucket.child(k).child([]byte("config"))
 		if configBucket == nil {
-			return nil, &Error{Err: err, Description: fmt.Sprintf("Revision(%d) config Bucket was nil", i)}
+			return nil, &Error{Err: nil, Description: fmt.Sprintf("Revision(%d) config Bucket was nil", i)}
 		}
 
-		lastModified := configBucket.Get([]byte("last_modified"))
+		lastModified := get(configBucket, []byte("last_modified"))
 
 		var t time.Time
 		err = t.UnmarshalBinary(lastModified)
@@ -171,12 +247,42 @@ func (db *boltDB) Revisions() ([]*Revision, error) {
 			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Revision(%d) config.last_modified(%#v)", i, lastModified)}
 		}
 
-		revisions = append(revisions, &Revision{ID: int32(i), Timestamp: t})
+		revisions = append(revisions, &Revision{ID: i, Timestamp: t})
 	}
 
 	return revisions, nil
 }
 
+func (db *boltDB) WalkRevisions(fn func(*Revision) error) error {
+	var start int32
+	for {
+		revisions, err := db.readRevisionBatch(start)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range revisions {
+			if err = fn(r); err != nil {
+				return err
+			}
+		}
+
+		if len(revisions) < revisionBatch {
+			return nil
+		}
+		start = revisions[len(revisions)-1].ID + 1
+	}
+}
+
+func (db *boltDB) Revisions() ([]*Revision, error) {
+	var revisions []*Revision
+	err := db.WalkRevisions(func(r *Revision) error {
+		revisions = append(revisions, r)
+		return nil
+	})
+	return revisions, err
+}
+
 func (db *boltDB) ReadRevision(id int32) (*Revision, error) {
 	tx, err := db.Begin(false)
 	if err != nil {
@@ -189,22 +295,22 @@ func (db *boltDB) ReadRevision(id int32) (*Revision, error) {
 		}
 	}()
 
-	revisionsBucket := tx.Bucket([]byte("revisions"))
+	revisionsBucket := txBucket(tx, []byte("revisions"))
 	if revisionsBucket == nil {
 		return nil, nil
 	}
 
-	revisionBucket := revisionsBucket.Bucket(intToBytes(id))
+	revisionBucket := revisionsBucket.child(intToBytes(id))
 	if revisionBucket == nil {
 		return nil, nil
 	}
 
-	configBucket := revisionBucket.Bucket([]byte("config"))
+	configBucket := revisionBucket.child([]byte("config"))
 	if configBucket == nil {
 		return nil, &Error{Err: nil, Description: fmt.Sprintf("Revision(%d) config Bucket was nil", id)}
 	}
 
-	lastModified := configBucket.Get([]byte("last_modified"))
+	lastModified := get(configBucket, []byte("last_modified"))
 
 	var t time.Time
 	err = t.UnmarshalBinary(lastModified)
@@ -212,7 +318,7 @@ func (db *boltDB) ReadRevision(id int32) (*Revision, error) {
 		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Revision(%d) config.last_modified(%#v)", id, lastModified)}
 	}
 
-	competitionBucket := revisionBucket.Bucket([]byte("competition"))
+	competitionBucket := revisionBucket.child([]byte("competition"))
 	if competitionBucket == nil {
 		return nil, &Error{Err: nil, Description: fmt.Sprintf("Revision(%d) competition Bucket was nil", id)}
 	}
@@ -225,7 +331,114 @@ func (db *boltDB) ReadRevision(id int32) (*Revision, error) {
 	return &Revision{ID: id, Timestamp: t, Competition: c}, nil
 }
 
-func (db *boltDB) Read() (c *Competition, err error) {
+//PruneRevisions removes the revisions outside the RetentionPolicy.
+//Bolt reuses the freed space for later writes, but the file doesn't shrink
+func (db *boltDB) PruneRevisions() (n int, err error) {
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			lErr := tx.Rollback()
+			if lErr != nil {
+				err = &Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		lErr := tx.Commit()
+		if lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	return db.pruneRevisions(tx)
+}
+
+//pruneRevisions removes the oldest revisions while they're outside the RetentionPolicy and returns how many were removed
+func (db *boltDB) pruneRevisions(tx *bolt.Tx) (int, error) {
+	p := retentionPolicy
+	if !p.Limited() {
+		return 0, nil
+	}
+
+	revisionsBucket := txBucket(tx, []byte("revisions"))
+	if revisionsBucket == nil {
+		return 0, nil
+	}
+
+	last, err := db.getLatestRevision(tx)
+	if err != nil {
+		return 0, &Error{Err: err, Description: "Couldn't get latest Revision"}
+	}
+
+	var keys [][]byte
+	now := time.Now()
+	cur := revisionsBucket.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if v != nil {
+			continue
+		}
+
+		i, err := bytesToInt(k)
+		if err != nil {
+			return 0, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Revision ID(%#v)", k)}
+		}
+
+		var t time.Time
+		if configBucket := revisionsBucket.child(k).child([]byte("config")); configBucket != nil {
+			if err = t.UnmarshalBinary(get(configBucket, []byte("last_modified"))); err != nil {
+				return 0, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Revision(%d) config.last_modified", i)}
+			}
+		}
+
+		//only the oldest revisions are removed, so the rest are numbered up to last
+		if !p.expires(t, int(last-i)+1, now) {
+			break
+		}
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	//buckets can't be deleted while iterating over them
+	for _, k := range keys {
+		if err = revisionsBucket.DeleteBucket(k); err != nil {
+			return 0, &Error{Err: err, Description: fmt.Sprintf("Couldn't delete Revision(%#v) Bucket", k)}
+		}
+	}
+
+	return len(keys), nil
+}
+
+//Read returns a copy of the current competition snapshot, reading it from the database first if needed
+func (db *boltDB) Read() (*Competition, error) {
+	if s, ok := db.snapshot.Load().(*snapshot); ok && s != nil {
+		return s.c.Copy(), nil
+	}
+
+	//the competition is read under writeMu, so a read that started before a write can't store its older snapshot after it
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	return db.current()
+}
+
+//current is Read for callers holding writeMu
+func (db *boltDB) current() (*Competition, error) {
+	if s, ok := db.snapshot.Load().(*snapshot); ok && s != nil {
+		return s.c.Copy(), nil
+	}
+
+	c, err := db.read()
+	if err != nil {
+		return nil, err
+	}
+
+	db.snapshot.Store(&snapshot{c: c.Copy()})
+
+	return c, nil
+}
+
+func (db *boltDB) read() (c *Competition, err error) {
 	tx, err := db.Begin(false)
 	if err != nil {
 		return nil, &Error{Err: err, Description: "Couldn't start transaction"}
@@ -237,7 +450,7 @@ func (db *boltDB) Read() (c *Competition, err error) {
 		}
 	}()
 
-	competitionBucket := tx.Bucket([]byte("competition"))
+	competitionBucket := txBucket(tx, []byte("competition"))
 	if competitionBucket == nil {
 		return nil, nil
 	}
@@ -245,79 +458,109 @@ func (db *boltDB) Read() (c *Competition, err error) {
 	return readCompetition(competitionBucket)
 }
 
-func (db *boltDB) writeRevision(tx *bolt.Tx) (err error) {
+//writeRevision stores the current competition as a revision and returns it
+func (db *boltDB) writeRevision(tx *bolt.Tx) (old *Competition, err error) {
 	//read old competition
-	competitionBucket := tx.Bucket([]byte("competition"))
+	competitionBucket := txBucket(tx, []byte("competition"))
 	if competitionBucket == nil {
-		return nil
+		return nil, nil
 	}
 
-	old, err := readCompetition(competitionBucket)
+	old, err = readCompetition(competitionBucket)
 	if err != nil {
-		return &Error{Err: err, Description: "Couldn't read competition"}
+		return nil, &Error{Err: err, Description: "Couldn't read competition"}
 	}
 
 	//read old last modified
-	configBucket := competitionBucket.Bucket([]byte("config"))
+	configBucket := competitionBucket.child([]byte("config"))
 	if configBucket == nil {
-		return &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) config Bucket was nil", old.Name)}
+		return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) config Bucket was nil", old.Name)}
 	}
 
-	lastModified := configBucket.Get([]byte("last_modified"))
+	lastModified := get(configBucket, []byte("last_modified"))
 
 	//create revision bucket
-	revisionsBucket, err := tx.CreateBucketIfNotExists([]byte("revisions"))
+	revisionsBucket, err := createTxBucketIfNotExists(tx, []byte("revisions"))
 	if err != nil {
-		return &Error{Err: err, Description: "Couldn't create Database revisions Bucket"}
+		return nil, &Error{Err: err, Description: "Couldn't create Database revisions Bucket"}
 	}
 
 	last, err := db.getLatestRevision(tx)
 	if err != nil {
-		return &Error{Err: err, Description: "Couldn't get latest Revision"}
+		return nil, &Error{Err: err, Description: "Couldn't get latest Revision"}
 	}
 
-	revisionBucket, err := revisionsBucket.CreateBucketIfNotExists(intToBytes(last + 1))
+	revisionBucket, err := revisionsBucket.createChildIfNotExists(intToBytes(last + 1))
 	if err != nil {
-		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) bucket", last)}
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) bucket", last)}
 	}
 
 	//write config
-	configBucket, err = revisionBucket.CreateBucket([]byte("config"))
+	configBucket, err = revisionBucket.createChild([]byte("config"))
 	if err != nil {
-		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) config bucket", last)}
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) config bucket", last)}
 	}
 
-	err = configBucket.Put([]byte("last_modified"), lastModified)
+	err = put(configBucket, []byte("last_modified"), lastModified)
 	if err != nil {
-		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d) config.last_modified(%#v)", last, lastModified)}
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d) config.last_modified(%#v)", last, lastModified)}
 	}
 
 	//write competition
-	competitionBucket, err = revisionBucket.CreateBucket([]byte("competition"))
+	competitionBucket, err = revisionBucket.createChild([]byte("competition"))
 	if err != nil {
-		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) competition bucket", last)}
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) competition bucket", last)}
 	}
 
 	err = writeCompetition(competitionBucket, old)
 	if err != nil {
-		return &Error{Err: err, Description: "Couldn't write Revision"}
+		return nil, &Error{Err: err, Description: "Couldn't write Revision"}
 	}
 
 	//write current revision
-	configBucket = tx.Bucket([]byte("config"))
+	configBucket = txBucket(tx, []byte("config"))
 	if configBucket == nil {
-		return &Error{Err: nil, Description: "Database config Bucket was nil"}
+		return nil, &Error{Err: nil, Description: "Database config Bucket was nil"}
 	}
 
-	err = configBucket.Put([]byte("current_revision"), intToBytes(last+1))
+	err = put(configBucket, []byte("current_revision"), intToBytes(last+1))
 	if err != nil {
-		return &Error{Err: err, Description: "Couldn't write Database config.current_revision"}
+		return nil, &Error{Err: err, Description: "Couldn't write Database config.current_revision"}
 	}
 
+	return old, nil
+}
+
+func (db *boltDB) Write(c *Competition) error {
+	return db.WriteAs("", c)
+}
+
+//WriteAs stores c and an audit entry and updates the snapshot used by Read
+func (db *boltDB) WriteAs(actor string, c *Competition) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	if err := db.retry(func() error { return db.write(actor, c) }); err != nil {
+		//the stored competition is unknown, so read it again next time
+		db.snapshot.Store((*snapshot)(nil))
+		return err
+	}
+
+	db.snapshot.Store(&snapshot{c: c.Copy()})
 	return nil
 }
 
-func (db *boltDB) Write(c *Competition) (err error) {
+func (db *boltDB) write(actor string, c *Competition) (err error) {
+	if c != nil {
+		//a failed write can be retried with the same competition
+		version := c.Version
+		defer func() {
+			if err != nil {
+				c.Version = version
+			}
+		}()
+	}
+
 	tx, err := db.Begin(true)
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't start transaction"}
@@ -332,18 +575,33 @@ func (db *boltDB) Write(c *Competition) (err error) {
 		}
 		lErr := tx.Commit()
 		if lErr != nil {
-			err = &Error{Err: err, Description: "Couldn't commit transaction"}
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
 		}
 	}()
 
 	//store current competition as a revision
-	if competitionBucket := tx.Bucket([]byte("competition")); competitionBucket != nil {
+	var version int32
+	var old *Competition
+	if competitionBucket := txBucket(tx, []byte("competition")); competitionBucket != nil {
+		if configBucket := competitionBucket.child([]byte("config")); configBucket != nil {
+			if version, err = readVersion(configBucket); err != nil {
+				return err
+			}
+		}
+
+		if c != nil && c.Version != version {
+			return ErrStaleVersion
+		}
 
-		err = db.writeRevision(tx)
+		old, err = db.writeRevision(tx)
 		if err != nil {
 			return &Error{Err: err, Description: "Couldn't write Revision"}
 		}
 
+		if _, err = db.pruneRevisions(tx); err != nil {
+			return err
+		}
+
 		//clear competition
 		err = tx.DeleteBucket([]byte("competition"))
 		if err != nil {
@@ -356,19 +614,529 @@ func (db *boltDB) Write(c *Competition) (err error) {
 		return &Error{Err: err, Description: "Couldn't encode time"}
 	}
 
-	competitionBucket, err := tx.CreateBucket([]byte("competition"))
+	competitionBucket, err := createTxBucket(tx, []byte("competition"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create competition Bucket"}
+	}
+
+	configBucket, err := competitionBucket.createChild([]byte("config"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Competition config Bucket"}
+	}
+
+	if err = put(configBucket, []byte("last_modified"), t); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition config.last_modified(%v)", t)}
+	}
+
+	if c != nil {
+		c.Version = version + 1
+	}
+
+	if err = writeCompetition(competitionBucket, c); err != nil {
+		return err
+	}
+
+	e := NewWriteAudit(actor, old, c)
+	if err = writeAudit(tx, e); err != nil {
+		return err
+	}
+
+	return writeScoreEvents(tx, e.ScoreEvents())
+}
+
+//DiffRevisions returns the difference between the revisions with ids a and b
+func (db *boltDB) DiffRevisions(a, b int32) (*RevisionDiff, error) {
+	return CompareRevisions(db, a, b)
+}
+
+func (db *boltDB) RestoreRevision(id int32) (*Competition, error) {
+	return db.RestoreRevisionAs("", id)
+}
+
+//RestoreRevisionAs writes a copy of the revision with the given id and updates the snapshot used by Read
+func (db *boltDB) RestoreRevisionAs(actor string, id int32) (*Competition, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	rev, err := db.ReadRevision(id)
+	if err != nil || rev == nil {
+		return nil, err
+	}
+
+	current, err := db.current()
+	if err != nil {
+		return nil, err
+	}
+
+	c := rev.Competition
+	if current != nil {
+		c.Version = current.Version
+	}
+
+	if err = db.retry(func() error { return db.write(actor, c) }); err != nil {
+		db.snapshot.Store((*snapshot)(nil))
+		return nil, err
+	}
+
+	db.snapshot.Store(&snapshot{c: c.Copy()})
+	return c, nil
+}
+
+func (db *boltDB) WriteScore(team, round int, score Score) error {
+	return db.WriteScoreAs("", team, round, score)
+}
+
+//WriteScoreAs sets a single score, rewriting only the stored scores of the teams that changed, stores an audit entry,
+//and updates the snapshot used by Read. Databases with a legacy layout are written in full with Write
+func (db *boltDB) WriteScoreAs(actor string, team, round int, score Score) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	c, err := db.current()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return &Error{Err: nil, Description: "Competition doesn't exist"}
+	}
+
+	old := c.Copy()
+	teams, err := c.SetScore(team, round, score)
+	if err != nil {
+		return err
+	}
+
+	e := NewWriteAudit(actor, old, c)
+	err = db.retry(func() error {
+		if err := db.writeScores(c, teams, e); err != errLegacyLayout {
+			return err
+		}
+		return db.write(actor, c)
+	})
+	if err != nil {
+		db.snapshot.Store((*snapshot)(nil))
+		return err
+	}
+
+	db.snapshot.Store(&snapshot{c: c.Copy()})
+	return nil
+}
+
+//errLegacyLayout is returned by writeScores if the competition is stored in a layout without team IDs
+var errLegacyLayout = errors.New("legacy layout")
+
+func (db *boltDB) writeScores(c *Competition, teams []int, e *AuditEntry) (err error) {
+	//a failed write can be retried with the same competition
+	version := c.Version
+	defer func() {
+		if err != nil {
+			c.Version = version
+		}
+	}()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			lErr := tx.Rollback()
+			if lErr != nil {
+				err = &Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		lErr := tx.Commit()
+		if lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	competitionBucket := txBucket(tx, []byte("competition"))
+	if competitionBucket == nil {
+		return &Error{Err: nil, Description: "Database competition Bucket was nil"}
+	}
+
+	teamsBucket := competitionBucket.child([]byte("teams"))
+	teamOrderBucket := competitionBucket.child([]byte("team_order"))
+	if teamsBucket == nil || teamOrderBucket == nil || competitionBucket.child([]byte("round_order")) == nil {
+		return errLegacyLayout
+	}
+
+	configBucket := competitionBucket.child([]byte("config"))
+	if configBucket == nil {
+		return &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) config Bucket was nil", c.Name)}
+	}
+
+	stored, err := readVersion(configBucket)
+	if err != nil {
+		return err
+	}
+
+	//only the changed teams are written, so the rest of c must be the stored competition
+	if stored != c.Version {
+		return ErrStaleVersion
+	}
+
+	for _, i := range teams {
+		t := c.Teams[i]
+		teamBucket := teamsBucket.child(get(teamOrderBucket, intToBytes(int32(i))))
+		if teamBucket == nil {
+			return &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) Team(%d) Bucket was nil", c.Name, i)}
+		}
+
+		if err = writeScores(teamBucket, t); err != nil {
+			return err
+		}
+
+		if err = writeScoreFields(teamBucket, t); err != nil {
+			return err
+		}
+	}
+
+	t, err := time.Now().MarshalBinary()
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't encode time"}
+	}
+
+	if err = put(configBucket, []byte("last_modified"), t); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition config.last_modified(%v)", t)}
+	}
+
+	if err = put(configBucket, []byte("version"), intToBytes(stored+1)); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) config.version(%d)", c.Name, stored+1)}
+	}
+	c.Version = stored + 1
+
+	if err = writeAudit(tx, e); err != nil {
+		return err
+	}
+
+	return writeScoreEvents(tx, e.ScoreEvents())
+}
+
+func (db *boltDB) State() (s State, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return "", &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: err, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	configBucket := txBucket(tx, []byte("config"))
+	if configBucket == nil {
+		return StateSetup, nil
+	}
+
+	state := get(configBucket, []byte("state"))
+	if state == nil {
+		return StateSetup, nil
+	}
+
+	return State(state), nil
+}
+
+//SetState stores s, retrying while storage is full or read-only
+func (db *boltDB) SetState(s State) error {
+	if !s.Valid() {
+		return &Error{Err: nil, Description: fmt.Sprintf("Unknown State(%s)", s)}
+	}
+
+	return db.retry(func() error { return db.setState(s) })
+}
+
+func (db *boltDB) setState(s State) (err error) {
+	tx, err := db.Begin(true)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			lErr := tx.Rollback()
+			if lErr != nil {
+				err = &Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		lErr := tx.Commit()
+		if lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	configBucket, err := createTxBucketIfNotExists(tx, []byte("config"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Database config Bucket"}
+	}
+
+	if err = put(configBucket, []byte("state"), []byte(s)); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Database config.state(%s)", s)}
+	}
+
+	return nil
+}
+
+func (db *boltDB) ReadSetting(key string, v interface{}) (ok bool, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return false, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: err, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	settingsBucket := txBucket(tx, []byte("settings"))
+	if settingsBucket == nil {
+		return false, nil
+	}
+
+	buf := get(settingsBucket, []byte(key))
+	if buf == nil {
+		return false, nil
+	}
+
+	if err = json.Unmarshal(buf, v); err != nil {
+		return false, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Setting(%s)", key)}
+	}
+
+	return true, nil
+}
+
+func (db *boltDB) Settings() (settings map[string]json.RawMessage, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	settings = make(map[string]json.RawMessage)
+
+	settingsBucket := txBucket(tx, []byte("settings"))
+	if settingsBucket == nil {
+		return settings, nil
+	}
+
+	err = settingsBucket.ForEach(func(k, v []byte) error {
+		//bolt values are only valid for the life of the transaction
+		settings[string(k)] = append(json.RawMessage(nil), decrypt(settingsBucket, k, v)...)
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read Settings"}
+	}
+
+	return settings, nil
+}
+
+//WriteSetting stores v, retrying while storage is full or read-only
+func (db *boltDB) WriteSetting(key string, v interface{}) error {
+	return db.retry(func() error { return db.writeSetting(key, v) })
+}
+
+func (db *boltDB) writeSetting(key string, v interface{}) (err error) {
+	tx, err := db.Begin(true)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			lErr := tx.Rollback()
+			if lErr != nil {
+				err = &Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		lErr := tx.Commit()
+		if lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	settingsBucket, err := createTxBucketIfNotExists(tx, []byte("settings"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Database settings Bucket"}
+	}
+
+	if v == nil {
+		if err = settingsBucket.Delete([]byte(key)); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't delete Setting(%s)", key)}
+		}
+		return nil
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Setting(%s)", key)}
+	}
+
+	if err = put(settingsBucket, []byte(key), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Setting(%s)", key)}
+	}
+
+	return nil
+}
+
+//Restore replaces the competition and revisions and updates the snapshot used by Read
+func (db *boltDB) Restore(c *Competition, revisions []*Revision) error {
+	return db.RestoreAs("", c, revisions)
+}
+
+//RestoreAs replaces the competition and revisions, stores an audit entry and the restore's score events,
+//and updates the snapshot used by Read
+func (db *boltDB) RestoreAs(actor string, c *Competition, revisions []*Revision) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	//a competition that can't be read is restored over like any other, so it's audited as empty
+	old, err := db.current()
+	if err != nil {
+		old = nil
+	}
+
+	e := NewRestoreAudit(actor, old, c)
+	if err = db.retry(func() error { return db.restore(c, revisions, e) }); err != nil {
+		db.snapshot.Store((*snapshot)(nil))
+		return err
+	}
+
+	db.snapshot.Store(&snapshot{c: c.Copy()})
+	return nil
+}
+
+func (db *boltDB) restore(c *Competition, revisions []*Revision, e *AuditEntry) (err error) {
+	tx, err := db.Begin(true)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			lErr := tx.Rollback()
+			if lErr != nil {
+				err = &Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		lErr := tx.Commit()
+		if lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	var version int32
+	if competitionBucket := txBucket(tx, []byte("competition")); competitionBucket != nil {
+		if configBucket := competitionBucket.child([]byte("config")); configBucket != nil {
+			if version, err = readVersion(configBucket); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = writeAudit(tx, e); err != nil {
+		return err
+	}
+
+	if err = writeScoreEvents(tx, e.ScoreEvents()); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"competition", "revisions"} {
+		if txBucket(tx, []byte(name)) != nil {
+			if err = tx.DeleteBucket([]byte(name)); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't clear %s Bucket", name)}
+			}
+		}
+	}
+
+	configBucket, err := createTxBucketIfNotExists(tx, []byte("config"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Database config Bucket"}
+	}
+
+	if err = configBucket.Delete([]byte("current_revision")); err != nil {
+		return &Error{Err: err, Description: "Couldn't clear Database config.current_revision"}
+	}
+
+	if len(revisions) > 0 {
+		revisionsBucket, err := createTxBucket(tx, []byte("revisions"))
+		if err != nil {
+			return &Error{Err: err, Description: "Couldn't create Database revisions Bucket"}
+		}
+
+		for i, rev := range revisions {
+			if rev.Competition == nil {
+				return &Error{Err: nil, Description: fmt.Sprintf("Revision(%d) Competition was nil", i)}
+			}
+
+			revisionBucket, err := revisionsBucket.createChild(intToBytes(int32(i)))
+			if err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) bucket", i)}
+			}
+
+			t, err := rev.Timestamp.MarshalBinary()
+			if err != nil {
+				return &Error{Err: err, Description: "Couldn't encode time"}
+			}
+
+			revisionConfigBucket, err := revisionBucket.createChild([]byte("config"))
+			if err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) config bucket", i)}
+			}
+
+			if err = put(revisionConfigBucket, []byte("last_modified"), t); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d) config.last_modified(%v)", i, rev.Timestamp)}
+			}
+
+			competitionBucket, err := revisionBucket.createChild([]byte("competition"))
+			if err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Revision(%d) competition bucket", i)}
+			}
+
+			if err = writeCompetition(competitionBucket, rev.Competition); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d)", i)}
+			}
+		}
+
+		if err = put(configBucket, []byte("current_revision"), intToBytes(int32(len(revisions)-1))); err != nil {
+			return &Error{Err: err, Description: "Couldn't write Database config.current_revision"}
+		}
+	}
+
+	if c == nil {
+		return nil
+	}
+
+	t, err := time.Now().MarshalBinary()
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't encode time"}
+	}
+
+	competitionBucket, err := createTxBucket(tx, []byte("competition"))
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't create competition Bucket"}
 	}
 
-	configBucket, err := competitionBucket.CreateBucket([]byte("config"))
+	competitionConfigBucket, err := competitionBucket.createChild([]byte("config"))
 	if err != nil {
 		return &Error{Err: err, Description: "Couldn't create Competition config Bucket"}
 	}
 
-	if err = configBucket.Put([]byte("last_modified"), t); err != nil {
+	if err = put(competitionConfigBucket, []byte("last_modified"), t); err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition config.last_modified(%v)", t)}
 	}
 
+	c.Version = version + 1
+
 	return writeCompetition(competitionBucket, c)
 }
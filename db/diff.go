@@ -0,0 +1,211 @@
+package db
+
+//RevisionDiff is the difference between the competitions of revisions From and To.
+//Teams and rounds are matched by ID, so renamed and reordered teams and rounds aren't reported as removed and added.
+//Name is set if the competition was renamed. Scores holds the changed scores of teams and rounds in both revisions
+//and the set scores of added teams and rounds
+type RevisionDiff struct {
+	From          int32          `json:"from"`
+	To            int32          `json:"to"`
+	Name          *Rename        `json:"name,omitempty"`
+	AddedRounds   []*DiffItem    `json:"added_rounds,omitempty"`
+	RemovedRounds []*DiffItem    `json:"removed_rounds,omitempty"`
+	RenamedRounds []*Rename      `json:"renamed_rounds,omitempty"`
+	AddedTeams    []*DiffItem    `json:"added_teams,omitempty"`
+	RemovedTeams  []*DiffItem    `json:"removed_teams,omitempty"`
+	RenamedTeams  []*Rename      `json:"renamed_teams,omitempty"`
+	Scores        []*ScoreChange `json:"scores,omitempty"`
+}
+
+//DiffItem is a team or round added or removed between revisions. Index is its index in the revision it's in
+type DiffItem struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+}
+
+//Rename is a competition, team, or round renamed between revisions
+type Rename struct {
+	ID  string `json:"id,omitempty"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+//ScoreChange is a score changed between revisions. Team and Round are the names in the later revision
+type ScoreChange struct {
+	TeamID  string `json:"team_id"`
+	Team    string `json:"team"`
+	RoundID string `json:"round_id"`
+	Round   string `json:"round"`
+	Old     Score  `json:"old"`
+	New     Score  `json:"new"`
+}
+
+//roundID returns the ID of the round at index i, or its legacy ID if it doesn't have one
+func (c *Competition) roundID(i int) string {
+	if i < len(c.RoundIDs) && c.RoundIDs[i] != "" {
+		return c.RoundIDs[i]
+	}
+	return legacyRoundID(i)
+}
+
+//teamID returns the ID of the team at index i, or its legacy ID if it doesn't have one
+func (c *Competition) teamID(i int) string {
+	if c.Teams[i].ID != "" {
+		return c.Teams[i].ID
+	}
+	return legacyTeamID(i)
+}
+
+//Diff returns the difference between the competitions from and to, where nil is an empty competition.
+//From and To are left zero
+func Diff(from, to *Competition) *RevisionDiff {
+	if from == nil {
+		from = new(Competition)
+	}
+	if to == nil {
+		to = new(Competition)
+	}
+
+	d := new(RevisionDiff)
+	if from.Name != to.Name {
+		d.Name = &Rename{Old: from.Name, New: to.Name}
+	}
+
+	fromRounds := make(map[string]int, len(from.Rounds))
+	for i := range from.Rounds {
+		fromRounds[from.roundID(i)] = i
+	}
+	toRounds := make(map[string]int, len(to.Rounds))
+	for i, name := range to.Rounds {
+		id := to.roundID(i)
+		toRounds[id] = i
+		old, ok := fromRounds[id]
+		if !ok {
+			d.AddedRounds = append(d.AddedRounds, &DiffItem{ID: id, Index: i, Name: name})
+		} else if from.Rounds[old] != name {
+			d.RenamedRounds = append(d.RenamedRounds, &Rename{ID: id, Old: from.Rounds[old], New: name})
+		}
+	}
+	for i, name := range from.Rounds {
+		id := from.roundID(i)
+		if _, ok := toRounds[id]; !ok {
+			d.RemovedRounds = append(d.RemovedRounds, &DiffItem{ID: id, Index: i, Name: name})
+		}
+	}
+
+	fromTeams := make(map[string]int, len(from.Teams))
+	for i := range from.Teams {
+		fromTeams[from.teamID(i)] = i
+	}
+	toTeams := make(map[string]bool, len(to.Teams))
+	for i, t := range to.Teams {
+		id := to.teamID(i)
+		toTeams[id] = true
+
+		var oldTeam *Team
+		if old, ok := fromTeams[id]; ok {
+			oldTeam = from.Teams[old]
+			if oldTeam.Name != t.Name {
+				d.RenamedTeams = append(d.RenamedTeams, &Rename{ID: id, Old: oldTeam.Name, New: t.Name})
+			}
+		} else {
+			d.AddedTeams = append(d.AddedTeams, &DiffItem{ID: id, Index: i, Name: t.Name})
+		}
+
+		for j, score := range t.Scores {
+			if j >= len(to.Rounds) {
+				break
+			}
+			var oldScore Score
+			if oldRound, ok := fromRounds[to.roundID(j)]; ok && oldTeam != nil && oldRound < len(oldTeam.Scores) {
+				oldScore = oldTeam.Scores[oldRound]
+			}
+			if oldScore.normalize().String() != score.normalize().String() {
+				d.Scores = append(d.Scores, &ScoreChange{
+					TeamID: id, Team: t.Name, RoundID: to.roundID(j), Round: to.Rounds[j],
+					Old: oldScore.normalize(), New: score.normalize(),
+				})
+			}
+		}
+	}
+	for i, t := range from.Teams {
+		if id := from.teamID(i); !toTeams[id] {
+			d.RemovedTeams = append(d.RemovedTeams, &DiffItem{ID: id, Index: i, Name: t.Name})
+		}
+	}
+
+	return d
+}
+
+//CompareRevisions returns the difference between the revisions with ids a and b read from d, or an error if one occurred.
+//CompareRevisions returns nil if either revision doesn't exist
+func CompareRevisions(d DB, a, b int32) (*RevisionDiff, error) {
+	from, err := d.ReadRevision(a)
+	if err != nil || from == nil {
+		return nil, err
+	}
+
+	to, err := d.ReadRevision(b)
+	if err != nil || to == nil {
+		return nil, err
+	}
+
+	diff := Diff(from.Competition, to.Competition)
+	diff.From, diff.To = a, b
+	return diff, nil
+}
+
+//RevisionRangeDiff is the aggregate difference across the revisions from From to To.
+//Diff is the net difference between From and To. Steps are the differences between each revision in the range and the next,
+//so changes that were later undone are included
+type RevisionRangeDiff struct {
+	From  int32           `json:"from"`
+	To    int32           `json:"to"`
+	Diff  *RevisionDiff   `json:"diff"`
+	Steps []*RevisionDiff `json:"steps"`
+}
+
+//CompareRevisionRange returns the aggregate difference across the revisions with ids from to to read from d,
+//or an error if one occurred. Revisions removed by PruneRevisions are skipped.
+//CompareRevisionRange returns nil if from or to doesn't exist
+func CompareRevisionRange(d DB, from, to int32) (*RevisionRangeDiff, error) {
+	var ids []int32
+	err := d.WalkRevisions(func(r *Revision) error {
+		if r.ID >= from && r.ID <= to {
+			ids = append(ids, r.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 || ids[0] != from || ids[len(ids)-1] != to {
+		return nil, nil
+	}
+
+	rd := &RevisionRangeDiff{From: from, To: to, Steps: make([]*RevisionDiff, 0, len(ids)-1)}
+
+	first, err := d.ReadRevision(from)
+	if err != nil || first == nil {
+		return nil, err
+	}
+
+	prev := first
+	for _, id := range ids[1:] {
+		rev, err := d.ReadRevision(id)
+		if err != nil || rev == nil {
+			return nil, err
+		}
+
+		step := Diff(prev.Competition, rev.Competition)
+		step.From, step.To = prev.ID, rev.ID
+		rd.Steps = append(rd.Steps, step)
+		prev = rev
+	}
+
+	rd.Diff = Diff(first.Competition, prev.Competition)
+	rd.Diff.From, rd.Diff.To = from, to
+	return rd, nil
+}
@@ -0,0 +1,404 @@
+package db
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//EncryptionKeySize is the size of an encryption key. Keys are used with AES-256-GCM
+const EncryptionKeySize = 32
+
+//encryptionBucket marks an encrypted database and holds a value used to check the key
+var encryptionBucket = []byte("encryption")
+
+//encryptionCheck is sealed in encryptionBucket when a database is encrypted, and opened to check the key
+var encryptionCheck = []byte("competition-scorer")
+
+//encryptionPaths is set in encryptionBucket once values are authenticated with their full path.
+//Databases encrypted before then authenticated values with only their key, and are resealed when they're opened
+var encryptionPaths = []byte("paths")
+
+//ErrEncryptionKey is the cause of the error returned when opening an encrypted database without its key, or with the wrong key
+var ErrEncryptionKey = errors.New("wrong encryption key")
+
+//ciphers holds the cipher.AEAD of each encrypted database by *bolt.DB. Databases without one aren't encrypted
+var ciphers sync.Map
+
+//ParseEncryptionKey returns the EncryptionKeySize key encoded in s as hex or base64, or an error if s isn't a valid key
+func ParseEncryptionKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, errors.New("key must be hex or base64 encoded")
+		}
+	}
+
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, not %d", EncryptionKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//seal encrypts v with aead, authenticating it with ad so it can't be moved to another key. The nonce is prepended to the result
+func seal(aead cipher.AEAD, ad, v []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(v)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, v, ad), nil
+}
+
+//unseal decrypts v sealed by seal with the same ad
+func unseal(aead cipher.AEAD, ad, v []byte) ([]byte, error) {
+	if len(v) < aead.NonceSize() {
+		return nil, errors.New("value is too short")
+	}
+	return aead.Open(nil, v[:aead.NonceSize()], v[aead.NonceSize():], ad)
+}
+
+//bucket is a bolt.Bucket with its path from the root of the database.
+//Values are authenticated with their path and key, so they can't be moved to another bucket or key
+type bucket struct {
+	*bolt.Bucket
+	path []byte
+}
+
+//appendPath returns path with name appended. Each name is prefixed with its length, so different paths never encode the same
+func appendPath(path, name []byte) []byte {
+	n := make([]byte, binary.MaxVarintLen64)
+	p := make([]byte, 0, len(path)+len(n)+len(name))
+	p = append(p, path...)
+	p = append(p, n[:binary.PutUvarint(n, uint64(len(name)))]...)
+	return append(p, name...)
+}
+
+func wrapBucket(b *bolt.Bucket, path []byte) *bucket {
+	if b == nil {
+		return nil
+	}
+	return &bucket{Bucket: b, path: path}
+}
+
+//txBucket returns the top level bucket with the given name, or nil if it doesn't exist
+func txBucket(tx *bolt.Tx, name []byte) *bucket {
+	return wrapBucket(tx.Bucket(name), appendPath(nil, name))
+}
+
+//createTxBucket creates the top level bucket with the given name
+func createTxBucket(tx *bolt.Tx, name []byte) (*bucket, error) {
+	b, err := tx.CreateBucket(name)
+	return wrapBucket(b, appendPath(nil, name)), err
+}
+
+//createTxBucketIfNotExists creates the top level bucket with the given name if it doesn't exist
+func createTxBucketIfNotExists(tx *bolt.Tx, name []byte) (*bucket, error) {
+	b, err := tx.CreateBucketIfNotExists(name)
+	return wrapBucket(b, appendPath(nil, name)), err
+}
+
+//child returns the nested bucket with the given name, or nil if it doesn't exist
+func (b *bucket) child(name []byte) *bucket {
+	return wrapBucket(b.Bucket.Bucket(name), appendPath(b.path, name))
+}
+
+//createChild creates the nested bucket with the given name
+func (b *bucket) createChild(name []byte) (*bucket, error) {
+	c, err := b.Bucket.CreateBucket(name)
+	return wrapBucket(c, appendPath(b.path, name)), err
+}
+
+//createChildIfNotExists creates the nested bucket with the given name if it doesn't exist
+func (b *bucket) createChildIfNotExists(name []byte) (*bucket, error) {
+	c, err := b.Bucket.CreateBucketIfNotExists(name)
+	return wrapBucket(c, appendPath(b.path, name)), err
+}
+
+func lookupAEAD(d *bolt.DB) cipher.AEAD {
+	if aead, ok := ciphers.Load(d); ok {
+		return aead.(cipher.AEAD)
+	}
+	return nil
+}
+
+//get returns the value of k in b, decrypted if the database is encrypted.
+//get returns nil if k doesn't exist or its value can't be decrypted, which the key check when the database is opened makes a sign of corruption
+func get(b *bucket, k []byte) []byte {
+	v := b.Get(k)
+	if v == nil {
+		return nil
+	}
+	return decrypt(b, k, v)
+}
+
+//decrypt returns v, the value of k in b, decrypted if the database is encrypted
+func decrypt(b *bucket, k, v []byte) []byte {
+	aead := lookupAEAD(b.Tx().DB())
+	if aead == nil {
+		return v
+	}
+
+	buf, err := unseal(aead, appendPath(b.path, k), v)
+	if err != nil {
+		return nil
+	}
+	return buf
+}
+
+//put sets k to v in b, encrypting v if the database is encrypted
+func put(b *bucket, k, v []byte) error {
+	aead := lookupAEAD(b.Tx().DB())
+	if aead == nil {
+		return b.Put(k, v)
+	}
+
+	buf, err := seal(aead, appendPath(b.path, k), v)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, buf)
+}
+
+//checkEncryption returns an error if the database of tx isn't encrypted with aead, or is encrypted and aead is nil
+func checkEncryption(tx *bolt.Tx, aead cipher.AEAD) error {
+	b := tx.Bucket(encryptionBucket)
+	if aead == nil {
+		if b != nil {
+			return &Error{Err: ErrEncryptionKey, Description: "Database is encrypted; an encryption key is required"}
+		}
+		return nil
+	}
+
+	if b == nil {
+		return &Error{Err: ErrEncryptionKey, Description: "Database isn't encrypted"}
+	}
+
+	check, err := unseal(aead, encryptionCheck, b.Get(encryptionCheck))
+	if err != nil || !bytes.Equal(check, encryptionCheck) {
+		return &Error{Err: ErrEncryptionKey, Description: "Encryption key doesn't match the database"}
+	}
+
+	return nil
+}
+
+//resealPaths reseals the values of a database encrypted before values were authenticated with their full path.
+//Values that can't be opened are left as they are
+func resealPaths(tx *bolt.Tx, aead cipher.AEAD) error {
+	err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if bytes.Equal(name, encryptionBucket) {
+			return nil
+		}
+		return resealBucket(wrapBucket(b, appendPath(nil, name)), aead)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Bucket(encryptionBucket).Put(encryptionPaths, []byte{1}); err != nil {
+		return &Error{Err: err, Description: "Couldn't write Database encryption.paths"}
+	}
+	return nil
+}
+
+//resealBucket reseals the values of b and its nested buckets, authenticated with only their key, with their full path
+func resealBucket(b *bucket, aead cipher.AEAD) error {
+	//b can't be changed while it's iterated
+	var keys, values, children [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			children = append(children, append([]byte(nil), k...))
+			return nil
+		}
+		keys = append(keys, append([]byte(nil), k...))
+		values = append(values, append([]byte(nil), v...))
+		return nil
+	})
+
+	for i, k := range keys {
+		v, err := unseal(aead, k, values[i])
+		if err != nil {
+			continue
+		}
+		if v, err = seal(aead, appendPath(b.path, k), v); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't reseal Bucket(%q) Key(%q)", b.path, k)}
+		}
+		if err = b.Put(k, v); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't reseal Bucket(%q) Key(%q)", b.path, k)}
+		}
+	}
+
+	for _, name := range children {
+		if err := resealBucket(b.child(name), aead); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//NewEncrypted returns a new DB with the given file path whose values are encrypted with key using AES-256-GCM.
+//A new or empty file is encrypted with key. An error is returned if the file isn't encrypted or was encrypted with a different key.
+//The schema is upgraded like New, and values encrypted before they were authenticated with their bucket path are resealed.
+//Bucket names and keys, like setting keys, aren't encrypted
+func NewEncrypted(path string, key []byte) (DB, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, &Error{Err: ErrEncryptionKey, Description: fmt.Sprintf("Encryption key must be %d bytes", EncryptionKeySize)}
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't create cipher"}
+	}
+
+	b, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.Update(func(tx *bolt.Tx) error {
+		if eb := tx.Bucket(encryptionBucket); eb != nil {
+			if err := checkEncryption(tx, aead); err != nil {
+				return err
+			}
+			if eb.Get(encryptionPaths) != nil {
+				return nil
+			}
+			return resealPaths(tx, aead)
+		}
+
+		empty := true
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			empty = false
+			return nil
+		})
+		if !empty {
+			return &Error{Err: ErrEncryptionKey, Description: "Database isn't encrypted"}
+		}
+
+		eb, err := tx.CreateBucket(encryptionBucket)
+		if err != nil {
+			return &Error{Err: err, Description: "Couldn't create Database encryption Bucket"}
+		}
+
+		check, err := seal(aead, encryptionCheck, encryptionCheck)
+		if err != nil {
+			return &Error{Err: err, Description: "Couldn't encrypt key check"}
+		}
+
+		if err = eb.Put(encryptionCheck, check); err != nil {
+			return &Error{Err: err, Description: "Couldn't write key check"}
+		}
+
+		if err = eb.Put(encryptionPaths, []byte{1}); err != nil {
+			return &Error{Err: err, Description: "Couldn't write Database encryption.paths"}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	ciphers.Store(b, aead)
+
+	if err = migrateSchema(b); err != nil {
+		b.Close()
+		ciphers.Delete(b)
+		return nil, err
+	}
+
+	return &boltDB{DB: b}, nil
+}
+
+//Encrypt copies the unencrypted database at src to a new database at dst encrypted with key
+func Encrypt(src, dst string, key []byte) error {
+	if _, err := os.Stat(dst); err == nil {
+		return &Error{Err: nil, Description: fmt.Sprintf("File(%s) already exists", dst)}
+	} else if !os.IsNotExist(err) {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't check File(%s)", dst)}
+	}
+
+	s, err := bolt.Open(src, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't open File(%s)", src)}
+	}
+	defer s.Close()
+
+	d, err := NewEncrypted(dst, key)
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	target := d.(*boltDB).DB
+
+	err = s.View(func(stx *bolt.Tx) error {
+		if err := checkEncryption(stx, nil); err != nil {
+			return err
+		}
+
+		return target.Update(func(dtx *bolt.Tx) error {
+			return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				//dst already has the buckets of a new database
+				nb, err := createTxBucketIfNotExists(dtx, name)
+				if err != nil {
+					return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Bucket(%s)", name)}
+				}
+				return copyBucket(b, nb)
+			})
+		})
+	})
+
+	cErr := target.Close()
+	ciphers.Delete(target)
+	if err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return nil
+}
+
+//copyBucket copies the values and nested buckets of src to dst, encrypting values if dst's database is encrypted
+func copyBucket(src *bolt.Bucket, dst *bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return &Error{Err: err, Description: "Couldn't copy Bucket sequence"}
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return put(dst, k, v)
+		}
+
+		nb, err := dst.createChild(k)
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Bucket(%s)", k)}
+		}
+		return copyBucket(src.Bucket(k), nb)
+	})
+}
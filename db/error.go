@@ -17,3 +17,8 @@ func (e *Error) Error() string {
 	}
 	return e.Description
 }
+
+//Unwrap returns the error that caused e
+func (e *Error) Unwrap() error {
+	return e.Err
+}
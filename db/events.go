@@ -0,0 +1,98 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//ScoreEvent records a change to a single score. Events are only appended, in the same transaction as the change,
+//and Seq numbers them in the order they were recorded, starting at 1. Actor is who made the change, or empty if it isn't known.
+//Replaying the events after a revision's scores gives the scores after each change
+type ScoreEvent struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	ScoreChange
+}
+
+//ScoreEvents returns the ScoreEvents for the score changes in e, without sequence numbers
+func (e *AuditEntry) ScoreEvents() []*ScoreEvent {
+	if e.Diff == nil {
+		return nil
+	}
+
+	events := make([]*ScoreEvent, 0, len(e.Diff.Scores))
+	for _, sc := range e.Diff.Scores {
+		events = append(events, &ScoreEvent{Time: e.Time, Actor: e.Actor, ScoreChange: *sc})
+	}
+	return events
+}
+
+//writeScoreEvents appends events to the score_events bucket, assigning their sequence numbers
+func writeScoreEvents(tx *bolt.Tx, events []*ScoreEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	eventsBucket, err := createTxBucketIfNotExists(tx, []byte("score_events"))
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create Database score_events Bucket"}
+	}
+
+	for _, e := range events {
+		if e.Seq, err = eventsBucket.NextSequence(); err != nil {
+			return &Error{Err: err, Description: "Couldn't get next ScoreEvent sequence number"}
+		}
+
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode ScoreEvent(%d)", e.Seq)}
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, e.Seq)
+		if err = put(eventsBucket, key, buf); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write ScoreEvent(%d)", e.Seq)}
+		}
+	}
+
+	return nil
+}
+
+func (db *boltDB) Events(fromSeq uint64) (events []*ScoreEvent, err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	events = make([]*ScoreEvent, 0)
+
+	eventsBucket := txBucket(tx, []byte("score_events"))
+	if eventsBucket == nil {
+		return events, nil
+	}
+
+	from := make([]byte, 8)
+	binary.BigEndian.PutUint64(from, fromSeq)
+
+	cur := eventsBucket.Cursor()
+	for k, v := cur.Seek(from); k != nil; k, v = cur.Next() {
+		e := new(ScoreEvent)
+		if err = json.Unmarshal(decrypt(eventsBucket, k, v), e); err != nil {
+			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode ScoreEvent(%d)", binary.BigEndian.Uint64(k))}
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+//ExportFormat identifies exported documents in ExportDocument.Format
+const ExportFormat = "competition-scorer-export"
+
+//ExportVersion is the current export document version. Import accepts documents with any version up to ExportVersion
+const ExportVersion = 1
+
+//ErrInvalidExport is the cause of the error returned by Import if the document can't be decoded or isn't valid
+var ErrInvalidExport = errors.New("invalid export")
+
+//ExportDocument is a portable JSON copy of a DB that can be imported into any DB.
+//Revisions are numbered from 0 in order and include their Competition. Admin credentials aren't exported
+type ExportDocument struct {
+	Format      string                     `json:"format"`
+	Version     int                        `json:"version"`
+	Exported    time.Time                  `json:"exported"`
+	Competition *Competition               `json:"competition"`
+	State       State                      `json:"state"`
+	Settings    map[string]json.RawMessage `json:"settings"`
+	Revisions   []*Revision                `json:"revisions"`
+}
+
+//Export writes the competition, state, settings, and revisions of d to w as an ExportDocument or returns an error if one occurred
+func Export(d DB, w io.Writer) error {
+	doc := &ExportDocument{Format: ExportFormat, Version: ExportVersion, Exported: time.Now(), Revisions: []*Revision{}}
+
+	var err error
+	if doc.Competition, err = d.Read(); err != nil {
+		return &Error{Err: err, Description: "Couldn't read Competition"}
+	}
+
+	if doc.State, err = d.State(); err != nil {
+		return &Error{Err: err, Description: "Couldn't read State"}
+	}
+
+	if doc.Settings, err = d.Settings(); err != nil {
+		return &Error{Err: err, Description: "Couldn't read Settings"}
+	}
+
+	if doc.Revisions, err = readRevisions(d); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(doc); err != nil {
+		return &Error{Err: err, Description: "Couldn't write export"}
+	}
+
+	return nil
+}
+
+//readRevisions returns the revisions of d with their Competitions, numbered from 0 in order, or an error if one occurred
+func readRevisions(d DB) ([]*Revision, error) {
+	var ids []int32
+	if err := d.WalkRevisions(func(rev *Revision) error {
+		ids = append(ids, rev.ID)
+		return nil
+	}); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read revisions"}
+	}
+
+	revisions := make([]*Revision, 0, len(ids))
+	for _, id := range ids {
+		rev, err := d.ReadRevision(id)
+		if err != nil {
+			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read Revision(%d)", id)}
+		}
+
+		//the revision was pruned while reading
+		if rev == nil {
+			continue
+		}
+
+		rev.ID = int32(len(revisions))
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+//checkExport returns an error if doc can't be imported
+func checkExport(doc *ExportDocument) error {
+	if doc.Format != ExportFormat {
+		return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Unknown export Format(%s)", doc.Format)}
+	}
+
+	if doc.Version < 1 || doc.Version > ExportVersion {
+		return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Unsupported export Version(%d)", doc.Version)}
+	}
+
+	if doc.State != "" && !doc.State.Valid() {
+		return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Unknown State(%s)", doc.State)}
+	}
+
+	if doc.Competition != nil {
+		if err := checkExportCompetition(doc.Competition); err != nil {
+			return err
+		}
+	}
+
+	for i, rev := range doc.Revisions {
+		if rev == nil || rev.Competition == nil {
+			return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Revision(%d) has no Competition", i)}
+		}
+		if err := checkExportCompetition(rev.Competition); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Revision(%d) isn't valid", i)}
+		}
+	}
+
+	for key, v := range doc.Settings {
+		if !json.Valid(v) || string(v) == "null" {
+			return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Setting(%s) isn't valid", key)}
+		}
+	}
+
+	return nil
+}
+
+//checkExportCompetition returns an error if c doesn't have a score for each team and round
+func checkExportCompetition(c *Competition) error {
+	for _, t := range c.Teams {
+		if t == nil {
+			return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Competition(%s) has an empty Team", c.Name)}
+		}
+		if len(t.Scores) != len(c.Rounds) {
+			return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Team(%s) has %d scores for %d rounds", t.Name, len(t.Scores), len(c.Rounds))}
+		}
+	}
+	return nil
+}
+
+//Import replaces the competition, state, settings, and revisions of d with the ExportDocument read from r
+//or returns an error if one occurred. Settings that aren't in the document are removed. Admin credentials are unchanged.
+//Nothing is changed if the document isn't valid
+func Import(d DB, r io.Reader) error {
+	doc := new(ExportDocument)
+	if err := json.NewDecoder(r).Decode(doc); err != nil {
+		return &Error{Err: ErrInvalidExport, Description: fmt.Sprintf("Couldn't decode export: %v", err)}
+	}
+
+	if err := checkExport(doc); err != nil {
+		return err
+	}
+
+	current, err := d.Settings()
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't read Settings"}
+	}
+
+	if err = d.Restore(doc.Competition, doc.Revisions); err != nil {
+		return &Error{Err: err, Description: "Couldn't restore Competition"}
+	}
+
+	state := doc.State
+	if state == "" {
+		state = StateSetup
+	}
+	if err = d.SetState(state); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write State(%s)", state)}
+	}
+
+	for key := range current {
+		if _, ok := doc.Settings[key]; ok {
+			continue
+		}
+		if err = d.WriteSetting(key, nil); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't delete Setting(%s)", key)}
+		}
+	}
+
+	for key, v := range doc.Settings {
+		if err = d.WriteSetting(key, v); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Setting(%s)", key)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//Fields holds custom field values by name. Values are strings, numbers (float64), or bools
+type Fields map[string]interface{}
+
+//Copy returns a copy of f, or nil if f is empty
+func (f Fields) Copy() Fields {
+	if len(f) == 0 {
+		return nil
+	}
+	cp := make(Fields, len(f))
+	for k, v := range f {
+		cp[k] = v
+	}
+	return cp
+}
+
+//readFields reads a team's custom fields and the custom fields of each of its scores from b
+func readFields(b *bucket, t *Team) error {
+	if buf := get(b, []byte("fields")); buf != nil {
+		if err := json.Unmarshal(buf, &t.Fields); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) fields", t.Name)}
+		}
+	}
+
+	buf := get(b, []byte("score_fields"))
+	if buf == nil {
+		return nil
+	}
+
+	var fields []Fields
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) score_fields", t.Name)}
+	}
+
+	if len(fields) != len(t.Scores) {
+		return &Error{Err: nil, Description: fmt.Sprintf("Team(%s) score_fields length(%d) doesn't match Rounds(%d)", t.Name, len(fields), len(t.Scores))}
+	}
+
+	for i, f := range fields {
+		t.Scores[i].Fields = f
+	}
+
+	return nil
+}
+
+//writeFields writes a team's custom fields and the custom fields of each of its scores to b if any are set
+func writeFields(b *bucket, t *Team) error {
+	if len(t.Fields) > 0 {
+		buf, err := json.Marshal(t.Fields)
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Team(%s) fields", t.Name)}
+		}
+		if err = put(b, []byte("fields"), buf); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) fields", t.Name)}
+		}
+	}
+
+	return writeScoreFields(b, t)
+}
+
+//writeScoreFields writes the custom fields of each of the team's scores to b, removing them if none are set
+func writeScoreFields(b *bucket, t *Team) error {
+	fields := make([]Fields, len(t.Scores))
+	var set bool
+	for i, s := range t.Scores {
+		if len(s.Fields) > 0 {
+			fields[i], set = s.Fields, true
+		}
+	}
+
+	if !set {
+		if err := b.Delete([]byte("score_fields")); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't delete Team(%s) score_fields", t.Name)}
+		}
+		return nil
+	}
+
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Team(%s) score_fields", t.Name)}
+	}
+
+	if err = put(b, []byte("score_fields"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) score_fields", t.Name)}
+	}
+
+	return nil
+}
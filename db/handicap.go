@@ -0,0 +1,57 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//Handicap adjusts a team's total, e.g. for a younger team in a division with older teams.
+//Value is in units of the competition's Precision and can be negative. Reason justifies the adjustment and User set it
+type Handicap struct {
+	Value  int32  `json:"value"`
+	Reason string `json:"reason"`
+	User   string `json:"user,omitempty"`
+}
+
+//Points returns the value h adds to a team's total, which is 0 if h is nil
+func (h *Handicap) Points() int32 {
+	if h == nil {
+		return 0
+	}
+	return h.Value
+}
+
+func copyHandicap(h *Handicap) *Handicap {
+	if h == nil {
+		return nil
+	}
+	cp := *h
+	return &cp
+}
+
+//readHandicap reads a team's handicap from b
+func readHandicap(b *bucket, t *Team) error {
+	buf := get(b, []byte("handicap"))
+	if buf == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &t.Handicap); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) handicap", t.Name)}
+	}
+	return nil
+}
+
+//writeHandicap writes a team's handicap to b if it has one
+func writeHandicap(b *bucket, t *Team) error {
+	if t.Handicap == nil {
+		return nil
+	}
+	buf, err := json.Marshal(t.Handicap)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Team(%s) handicap", t.Name)}
+	}
+	if err = put(b, []byte("handicap"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) handicap", t.Name)}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+//newID returns a random ID with the given prefix
+func newID(prefix string) string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Errorf("Couldn't read random bytes: %v", err))
+	}
+	return prefix + hex.EncodeToString(buf)
+}
+
+//legacyTeamID returns the ID given to the team at index i in databases written before IDs were stored
+func legacyTeamID(i int) string {
+	return fmt.Sprintf("t%d", i)
+}
+
+//legacyRoundID returns the ID given to the round at index i in databases written before IDs were stored
+func legacyRoundID(i int) string {
+	return fmt.Sprintf("r%d", i)
+}
+
+//NewCompetition returns a new Competition with the given name, the given number of rounds named Round 1, Round 2, etc.,
+//and the given teams, all unscored
+func NewCompetition(name string, rounds int, teams []string) *Competition {
+	c := &Competition{
+		Name:   name,
+		Rounds: make([]string, 0, rounds),
+		Teams:  make([]*Team, 0, len(teams)),
+	}
+
+	for r := 1; r <= rounds; r++ {
+		c.Rounds = append(c.Rounds, fmt.Sprintf("Round %d", r))
+	}
+
+	for _, team := range teams {
+		c.Teams = append(c.Teams, &Team{Name: team, Scores: make([]Score, rounds)})
+	}
+
+	return c
+}
+
+//AssignIDs gives new IDs to rounds and teams without an ID or with an ID already in use.
+//RoundIDs is extended or truncated to match Rounds
+func (c *Competition) AssignIDs() {
+	ids := make([]string, len(c.Rounds))
+	copy(ids, c.RoundIDs)
+	c.RoundIDs = ids
+
+	seen := make(map[string]bool)
+	for i, id := range c.RoundIDs {
+		if id == "" || seen[id] {
+			id = newID("r")
+			c.RoundIDs[i] = id
+		}
+		seen[id] = true
+	}
+
+	for _, t := range c.Teams {
+		if t.ID == "" || seen[t.ID] {
+			t.ID = newID("t")
+		}
+		seen[t.ID] = true
+	}
+}
+
+//Copy returns a deep copy of c, or nil if c is nil
+func (c *Competition) Copy() *Competition {
+	if c == nil {
+		return nil
+	}
+
+	cp := &Competition{
+		Version:   c.Version,
+		Name:      c.Name,
+		Rounds:    append([]string(nil), c.Rounds...),
+		RoundIDs:  append([]string(nil), c.RoundIDs...),
+		Teams:     make([]*Team, len(c.Teams)),
+		Computed:  copyComputed(c.Computed),
+		Precision: copyPrecision(c.Precision),
+	}
+
+	for i, t := range c.Teams {
+		team := *t
+		team.Fields = t.Fields.Copy()
+		team.Roster = append([]string(nil), t.Roster...)
+		team.Tags = append([]string(nil), t.Tags...)
+		team.Handicap = copyHandicap(t.Handicap)
+		team.Scores = append([]Score(nil), t.Scores...)
+		for j := range team.Scores {
+			team.Scores[j].Fields = team.Scores[j].Fields.Copy()
+		}
+		cp.Teams[i] = &team
+	}
+
+	return cp
+}
+
+//TeamIndex returns the index of the team with the given ID, or -1 if it doesn't exist
+func (c *Competition) TeamIndex(id string) int {
+	for i, t := range c.Teams {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+//RoundIndex returns the index of the round with the given ID, or -1 if it doesn't exist
+func (c *Competition) RoundIndex(id string) int {
+	for i, rid := range c.RoundIDs {
+		if rid == id {
+			return i
+		}
+	}
+	return -1
+}
+
+//FindRound returns the index of the round referenced by ref, which can be a round ID or index,
+//or -1 if it doesn't exist
+func (c *Competition) FindRound(ref string) int {
+	if i := c.RoundIndex(ref); i != -1 {
+		return i
+	}
+
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(c.Rounds) {
+		return i
+	}
+
+	return -1
+}
@@ -1,192 +1,364 @@
 package db
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
-
-	"github.com/boltdb/bolt"
+	"io"
 )
 
 func bytesToInt(data []byte) (int32, error) {
-	b := bytes.NewBuffer(data)
-	var i int32
-	err := binary.Read(b, binary.BigEndian, &i)
-	return i, err
+	if len(data) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int32(binary.BigEndian.Uint32(data)), nil
 }
 
 func intToBytes(i int32) []byte {
-	b := new(bytes.Buffer)
-	err := binary.Write(b, binary.BigEndian, i)
-	if err != nil {
-		panic(fmt.Errorf("Couldn't convert int to []byte: %v", err))
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(i))
+	return b
+}
+
+//roundKeys returns the keys round scores are stored under. Legacy layouts use round indexes
+func roundKeys(c *Competition, legacy bool) [][]byte {
+	keys := make([][]byte, len(c.Rounds))
+	for i := range keys {
+		if legacy {
+			keys[i] = intToBytes(int32(i))
+		} else {
+			keys[i] = []byte(c.RoundIDs[i])
+		}
 	}
-	return b.Bytes()
+	return keys
 }
 
-func readTeam(b *bolt.Bucket, rounds int) (*Team, error) {
+func readTeam(b *bucket, rounds [][]byte) (*Team, error) {
 	t := &Team{
-		Name:   string(b.Get([]byte("name"))),
-		Scores: make([]*int32, rounds),
+		ID:     string(get(b, []byte("id"))),
+		Name:   string(get(b, []byte("name"))),
+		Scores: make([]Score, len(rounds)),
+		Logo:   string(get(b, []byte("logo"))),
 	}
 	if t.Name == "" {
 		return nil, &Error{Err: nil, Description: "Team name was empty"}
 	}
 
-	scoresBucket := b.Bucket([]byte("scores"))
-	if scoresBucket == nil {
-		return nil, &Error{Err: nil, Description: fmt.Sprintf("Team(%s) scores Bucket was nil", t.Name)}
+	if err := readRoster(b, t); err != nil {
+		return nil, err
+	}
+
+	if err := readHandicap(b, t); err != nil {
+		return nil, err
+	}
+
+	if err := readTags(b, t); err != nil {
+		return nil, err
 	}
 
-	for i := 0; i < rounds; i++ {
-		if score := scoresBucket.Get(intToBytes(int32(i))); score != nil {
-			val, err := bytesToInt(score)
+	if packed := get(b, []byte("packed_scores")); packed != nil {
+		if len(packed) != len(rounds)*packedScoreSize {
+			return nil, &Error{Err: nil, Description: fmt.Sprintf("Team(%s) packed_scores length(%d) doesn't match Rounds(%d)", t.Name, len(packed), len(rounds))}
+		}
+
+		for i := range rounds {
+			score, err := unpackScore(packed[i*packedScoreSize : (i+1)*packedScoreSize])
 			if err != nil {
-				return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) Round(%d) score(%#v)", t.Name, i, score)}
+				return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) Round(%d) score", t.Name, i)}
 			}
-			t.Scores[i] = &val
-		} else {
-			t.Scores[i] = nil
+			t.Scores[i] = score
 		}
+
+		return t, readFields(b, t)
+	}
+
+	//teams written before scores were packed store each score in the scores bucket
+	scoresBucket := b.child([]byte("scores"))
+	if scoresBucket == nil {
+		return nil, &Error{Err: nil, Description: fmt.Sprintf("Team(%s) scores Bucket was nil", t.Name)}
 	}
 
-	return t, nil
+	for i, key := range rounds {
+		score, err := decodeScore(get(scoresBucket, key))
+		if err != nil {
+			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) Round(%d) score", t.Name, i)}
+		}
+		t.Scores[i] = score
+	}
+
+	return t, readFields(b, t)
 }
 
-func writeTeam(b *bolt.Bucket, t *Team, rounds int) error {
-	err := b.Put([]byte("name"), []byte(t.Name))
+func writeTeam(b *bucket, t *Team, rounds [][]byte) error {
+	err := put(b, []byte("id"), []byte(t.ID))
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) id", t.Name)}
+	}
+
+	err = put(b, []byte("name"), []byte(t.Name))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) name", t.Name)}
 	}
 
-	if len(t.Scores) != rounds {
-		return &Error{Err: nil, Description: fmt.Sprintf("Team(%s) Rounds(%d) doesn't match Competition Rounds(%d)", t.Name, len(t.Scores), rounds)}
+	if t.Logo != "" {
+		err = put(b, []byte("logo"), []byte(t.Logo))
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) logo", t.Name)}
+		}
 	}
 
-	scoresBucket, err := b.CreateBucketIfNotExists([]byte("scores"))
-	if err != nil {
-		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Team(%s) scores Bucket", t.Name)}
+	if err = writeRoster(b, t); err != nil {
+		return err
 	}
 
-	for i := 0; i < rounds; i++ {
-		if t.Scores[i] == nil {
-			continue
-		}
+	if err = writeHandicap(b, t); err != nil {
+		return err
+	}
 
-		err = scoresBucket.Put(intToBytes(int32(i)), intToBytes(*t.Scores[i]))
-		if err != nil {
-			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) Round(%d) Score(%d)", t.Name, i, t.Scores[i])}
-		}
+	if err = writeTags(b, t); err != nil {
+		return err
+	}
+
+	if len(t.Scores) != len(rounds) {
+		return &Error{Err: nil, Description: fmt.Sprintf("Team(%s) Rounds(%d) doesn't match Competition Rounds(%d)", t.Name, len(t.Scores), len(rounds))}
+	}
+
+	if err = writeScores(b, t); err != nil {
+		return err
+	}
+
+	return writeFields(b, t)
+}
+
+//writeScores writes the team's scores to b as packed_scores
+func writeScores(b *bucket, t *Team) error {
+	packed := make([]byte, len(t.Scores)*packedScoreSize)
+	for i, s := range t.Scores {
+		packScore(packed[i*packedScoreSize:], s)
+	}
+
+	if err := put(b, []byte("packed_scores"), packed); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) packed_scores", t.Name)}
 	}
 
 	return nil
 }
 
-func readCompetition(b *bolt.Bucket) (*Competition, error) {
-	name := string(b.Get([]byte("name")))
+//readVersion returns the competition version stored in the competition's config bucket b. Competitions stored without a version are version 0
+func readVersion(b *bucket) (int32, error) {
+	versionBytes := get(b, []byte("version"))
+	if versionBytes == nil {
+		return 0, nil
+	}
+
+	version, err := bytesToInt(versionBytes)
+	if err != nil {
+		return 0, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode config.version(%#v)", versionBytes)}
+	}
+	return version, nil
+}
+
+//readCompetition reads the Competition stored in b.
+//Rounds and teams are stored keyed by ID with their order stored in the round_order and team_order buckets.
+//Legacy layouts without order buckets key rounds, teams, and scores by index and are given IDs based on their index
+func readCompetition(b *bucket) (*Competition, error) {
+	name := string(get(b, []byte("name")))
 	if name == "" {
 		return nil, &Error{Err: nil, Description: "Competition name was empty"}
 	}
 
-	configBucket := b.Bucket([]byte("config"))
+	configBucket := b.child([]byte("config"))
 	if configBucket == nil {
 		return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) config Bucket was nil", name)}
 	}
 
-	roundsBytes := configBucket.Get([]byte("rounds"))
+	roundsBytes := get(configBucket, []byte("rounds"))
 	rounds, err := bytesToInt(roundsBytes)
 	if err != nil {
 		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Competition(%s) config.rounds(%#v)", name, roundsBytes)}
 	}
 
-	teamsBytes := configBucket.Get([]byte("teams"))
+	teamsBytes := get(configBucket, []byte("teams"))
 	teams, err := bytesToInt(teamsBytes)
 	if err != nil {
 		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Competition(%s) config.teams(%#v)", name, teamsBytes)}
 	}
 
+	version, err := readVersion(configBucket)
+	if err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read Competition(%s) version", name)}
+	}
+
 	c := &Competition{
-		Name:   name,
-		Rounds: make([]string, rounds),
-		Teams:  make([]*Team, teams),
+		Version:  version,
+		Name:     name,
+		Rounds:   make([]string, rounds),
+		RoundIDs: make([]string, rounds),
+		Teams:    make([]*Team, teams),
 	}
 
-	roundsBucket := b.Bucket([]byte("rounds"))
+	roundsBucket := b.child([]byte("rounds"))
 	if roundsBucket == nil {
 		return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) rounds Bucket was nil", name)}
 	}
 
+	roundOrderBucket := b.child([]byte("round_order"))
+	teamOrderBucket := b.child([]byte("team_order"))
+	legacy := roundOrderBucket == nil || teamOrderBucket == nil
+
 	for i := 0; i < int(rounds); i++ {
-		c.Rounds[i] = string(roundsBucket.Get(intToBytes(int32(i))))
+		key := intToBytes(int32(i))
+		c.RoundIDs[i] = legacyRoundID(i)
+		if !legacy {
+			c.RoundIDs[i] = string(get(roundOrderBucket, key))
+			key = []byte(c.RoundIDs[i])
+		}
+
+		c.Rounds[i] = string(get(roundsBucket, key))
 		if c.Rounds[i] == "" {
 			return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) Round(%d) was empty", name, i)}
 		}
 	}
 
-	teamsBucket := b.Bucket([]byte("teams"))
+	teamsBucket := b.child([]byte("teams"))
 	if teamsBucket == nil {
 		return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) teams Bucket was nil", name)}
 	}
 
+	keys := roundKeys(c, legacy)
 	for i := 0; i < int(teams); i++ {
-		team, err := readTeam(teamsBucket.Bucket(intToBytes(int32(i))), int(rounds))
+		key := intToBytes(int32(i))
+		if !legacy {
+			key = get(teamOrderBucket, key)
+		}
+
+		teamBucket := teamsBucket.child(key)
+		if teamBucket == nil {
+			return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) Team(%d) Bucket was nil", name, i)}
+		}
+
+		team, err := readTeam(teamBucket, keys)
 		if err != nil {
 			return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't read Competition(%s) Team (%d)", name, i)}
 		}
 
+		if legacy {
+			team.ID = legacyTeamID(i)
+		}
+
 		c.Teams[i] = team
 	}
 
+	c.assignSlugs()
+
+	if err = readComputed(b, c); err != nil {
+		return nil, err
+	}
+
+	if err = readPrecision(b, c); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
-func writeCompetition(b *bolt.Bucket, c *Competition) error {
-	err := b.Put([]byte("name"), []byte(c.Name))
+//Prepare readies c to be stored by assigning IDs to rounds and teams that don't have them, updating slugs, and computing computed rounds.
+//DB implementations call Prepare before storing a competition
+func (c *Competition) Prepare() error {
+	c.AssignIDs()
+	c.assignSlugs()
+
+	if err := c.Compute(); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't compute Competition(%s) computed rounds", c.Name)}
+	}
+	return nil
+}
+
+//writeCompetition writes c to b, preparing it first
+func writeCompetition(b *bucket, c *Competition) error {
+	if err := c.Prepare(); err != nil {
+		return err
+	}
+
+	if err := writeComputed(b, c); err != nil {
+		return err
+	}
+
+	if err := writePrecision(b, c); err != nil {
+		return err
+	}
+
+	err := put(b, []byte("name"), []byte(c.Name))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) name", c.Name)}
 	}
 
-	configBucket, err := b.CreateBucketIfNotExists([]byte("config"))
+	configBucket, err := b.createChildIfNotExists([]byte("config"))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) config Bucket", c.Name)}
 	}
 
-	err = configBucket.Put([]byte("rounds"), intToBytes(int32(len(c.Rounds))))
+	err = put(configBucket, []byte("rounds"), intToBytes(int32(len(c.Rounds))))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) config.rounds(%d)", c.Name, len(c.Rounds))}
 	}
 
-	err = configBucket.Put([]byte("teams"), intToBytes(int32(len(c.Teams))))
+	err = put(configBucket, []byte("teams"), intToBytes(int32(len(c.Teams))))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) config.teams(%d)", c.Name, len(c.Teams))}
 	}
 
-	roundsBucket, err := b.CreateBucketIfNotExists([]byte("rounds"))
+	err = put(configBucket, []byte("version"), intToBytes(c.Version))
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) config.version(%d)", c.Name, c.Version)}
+	}
+
+	roundsBucket, err := b.createChildIfNotExists([]byte("rounds"))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) rounds Bucket", c.Name)}
 	}
 
+	roundOrderBucket, err := b.createChildIfNotExists([]byte("round_order"))
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) round_order Bucket", c.Name)}
+	}
+
 	for i := 0; i < len(c.Rounds); i++ {
-		err = roundsBucket.Put(intToBytes(int32(i)), []byte(c.Rounds[i]))
+		err = put(roundsBucket, []byte(c.RoundIDs[i]), []byte(c.Rounds[i]))
 		if err != nil {
 			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) Round(%d) name(%s)", c.Name, i, c.Rounds[i])}
 		}
+
+		err = put(roundOrderBucket, intToBytes(int32(i)), []byte(c.RoundIDs[i]))
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) Round(%d) order", c.Name, i)}
+		}
 	}
 
-	teamsBucket, err := b.CreateBucketIfNotExists([]byte("teams"))
+	teamsBucket, err := b.createChildIfNotExists([]byte("teams"))
 	if err != nil {
 		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) teams Bucket", c.Name)}
 	}
 
+	teamOrderBucket, err := b.createChildIfNotExists([]byte("team_order"))
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) team_order Bucket", c.Name)}
+	}
+
+	keys := roundKeys(c, false)
 	for i := 0; i < len(c.Teams); i++ {
-		teamBucket, err := teamsBucket.CreateBucketIfNotExists(intToBytes(int32(i)))
+		teamBucket, err := teamsBucket.createChildIfNotExists([]byte(c.Teams[i].ID))
 		if err != nil {
 			return &Error{Err: err, Description: fmt.Sprintf("Couldn't create Competition(%s) Team(%d) Bucket", c.Name, i)}
 		}
 
-		err = writeTeam(teamBucket, c.Teams[i], len(c.Rounds))
+		err = writeTeam(teamBucket, c.Teams[i], keys)
+		if err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) Team(%d)", c.Name, i)}
+		}
+
+		err = put(teamOrderBucket, intToBytes(int32(i)), []byte(c.Teams[i].ID))
 		if err != nil {
-			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) Time(%d)", c.Name, i)}
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) Team(%d) order", c.Name, i)}
 		}
 	}
 
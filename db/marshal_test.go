@@ -0,0 +1,192 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+//The benchmarks compare storing each team's scores as packed_scores with the per-round scores bucket used before
+
+const (
+	benchTeams  = 100
+	benchRounds = 20
+)
+
+//scoreFormat writes a team's scores to its bucket b
+type scoreFormat struct {
+	name  string
+	write func(b *bucket, t *Team, rounds [][]byte) error
+}
+
+var scoreFormats = []scoreFormat{
+	{name: "packed", write: func(b *bucket, t *Team, rounds [][]byte) error { return writeScores(b, t) }},
+	{name: "per-round", write: writeRoundScores},
+}
+
+//writeRoundScores writes the team's scores to a scores bucket with a value per scored round, the layout read for teams written before scores were packed
+func writeRoundScores(b *bucket, t *Team, rounds [][]byte) error {
+	if err := b.Delete([]byte("packed_scores")); err != nil {
+		return err
+	}
+
+	scoresBucket, err := b.createChildIfNotExists([]byte("scores"))
+	if err != nil {
+		return err
+	}
+
+	for i, key := range rounds {
+		var buf []byte
+		switch s := t.Scores[i].normalize(); s.State {
+		case ScoreScored:
+			buf = intToBytes(s.Value)
+		case ScoreNoShow:
+			buf = []byte(ScoreNoShow)
+		default:
+			continue
+		}
+
+		if err = put(scoresBucket, key, buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//benchCompetition returns a competition with benchTeams teams and benchRounds rounds, with a mix of scored, unscored, and no-show scores
+func benchCompetition(b *testing.B) *Competition {
+	c := &Competition{Name: "Benchmark", Rounds: make([]string, benchRounds), Teams: make([]*Team, benchTeams)}
+	for i := range c.Rounds {
+		c.Rounds[i] = fmt.Sprintf("Round %d", i+1)
+	}
+
+	for i := range c.Teams {
+		t := &Team{Name: fmt.Sprintf("Team %d", i+1), Scores: make([]Score, benchRounds)}
+		for j := range t.Scores {
+			switch {
+			case (i+j)%10 == 0:
+				t.Scores[j] = Score{State: ScoreNoShow}
+			case (i+j)%7 == 0:
+				t.Scores[j] = Score{State: ScoreUnscored}
+			default:
+				t.Scores[j] = NewScore(int32(i*benchRounds + j))
+			}
+		}
+		c.Teams[i] = t
+	}
+
+	if err := c.Prepare(); err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func openBench(b *testing.B) *bolt.DB {
+	d, err := bolt.Open(filepath.Join(b.TempDir(), "bench.db"), 0644, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { d.Close() })
+	return d
+}
+
+//BenchmarkWrite measures writing the scores of every team in a transaction
+func BenchmarkWrite(b *testing.B) {
+	for _, format := range scoreFormats {
+		b.Run(format.name, func(b *testing.B) {
+			d := openBench(b)
+			c := benchCompetition(b)
+			keys := roundKeys(c, false)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := d.Update(func(tx *bolt.Tx) error {
+					if err := tx.DeleteBucket([]byte("teams")); err != nil && err != bolt.ErrBucketNotFound {
+						return err
+					}
+
+					teamsBucket, err := createTxBucket(tx, []byte("teams"))
+					if err != nil {
+						return err
+					}
+
+					for _, t := range c.Teams {
+						teamBucket, err := teamsBucket.createChild([]byte(t.ID))
+						if err != nil {
+							return err
+						}
+						if err = format.write(teamBucket, t, keys); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+//BenchmarkRead measures reading the competition with its teams' scores stored in each format
+func BenchmarkRead(b *testing.B) {
+	for _, format := range scoreFormats {
+		b.Run(format.name, func(b *testing.B) {
+			d := openBench(b)
+			c := benchCompetition(b)
+			keys := roundKeys(c, false)
+
+			err := d.Update(func(tx *bolt.Tx) error {
+				competitionBucket, err := createTxBucket(tx, []byte("competition"))
+				if err != nil {
+					return err
+				}
+				if err = writeCompetition(competitionBucket, c); err != nil {
+					return err
+				}
+
+				teamsBucket := competitionBucket.child([]byte("teams"))
+				for _, t := range c.Teams {
+					if err = format.write(teamsBucket.child([]byte(t.ID)), t, keys); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			read := func() *Competition {
+				var rc *Competition
+				err := d.View(func(tx *bolt.Tx) error {
+					var err error
+					rc, err = readCompetition(txBucket(tx, []byte("competition")))
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				return rc
+			}
+
+			//both formats must read back the same scores
+			for i, t := range read().Teams {
+				for j, s := range t.Scores {
+					if s.String() != c.Teams[i].Scores[j].String() {
+						b.Fatalf("Team(%d) Round(%d) score = %s, want %s", i, j, s, c.Teams[i].Scores[j])
+					}
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				read()
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//memoryDB is a DB that keeps everything in memory. Competitions are copied in and out so callers can't change stored data
+type memoryDB struct {
+	mu sync.RWMutex
+
+	username string
+	hash     []byte
+	state    State
+
+	c            *Competition
+	lastModified time.Time
+	//revisions is indexed by ID. Revisions removed by PruneRevisions are nil, and always come before the rest
+	revisions []*Revision
+	pruned    int
+
+	//settings holds JSON encoded settings so they are decoded the same as other DBs
+	settings map[string][]byte
+
+	audit  []*AuditEntry
+	events []*ScoreEvent
+}
+
+//NewMemory returns a new empty DB that keeps everything in memory and is lost when the process exits
+func NewMemory() DB {
+	return &memoryDB{settings: make(map[string][]byte)}
+}
+
+func (db *memoryDB) Init(name string, rounds int, teams []string, username, password string) error {
+	if username != "" {
+		if err := db.UpdateCredentials(username, password); err != nil {
+			return &Error{Err: err, Description: "Couldn't update credentials"}
+		}
+	}
+
+	if err := db.Write(NewCompetition(name, rounds, teams)); err != nil {
+		return &Error{Err: err, Description: "Couldn't write competition to database"}
+	}
+
+	if err := db.SetState(StateSetup); err != nil {
+		return &Error{Err: err, Description: "Couldn't set competition state"}
+	}
+
+	return nil
+}
+
+func (db *memoryDB) HasCredentials() (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.username != "" && db.hash != nil, nil
+}
+
+//Authenticate checks the credentials and rehashes the password if it was hashed with different PasswordOptions
+func (db *memoryDB) Authenticate(username, password string) (bool, error) {
+	db.mu.RLock()
+	stored, hash := db.username, db.hash
+	db.mu.RUnlock()
+
+	if hash == nil || stored != username || !CheckPassword(hash, password) {
+		return false, nil
+	}
+
+	if NeedsRehash(hash) {
+		//the old hash is still valid, so a failed rehash is retried at the next login
+		if err := db.UpdateCredentialsAs(username, username, password); err != nil {
+			return true, &Error{Err: err, Description: "Couldn't rehash password"}
+		}
+	}
+
+	return true, nil
+}
+
+func (db *memoryDB) UpdateCredentials(username, password string) error {
+	return db.UpdateCredentialsAs("", username, password)
+}
+
+func (db *memoryDB) UpdateCredentialsAs(actor, username, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't hash password"}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.appendAudit(NewCredentialsAudit(actor, db.username, username))
+	db.username, db.hash = username, hash
+	return nil
+}
+
+//appendAudit assigns e the next ID and appends it and its ScoreEvents. db.mu must be held
+func (db *memoryDB) appendAudit(e *AuditEntry) {
+	e.ID = uint64(len(db.audit) + 1)
+	db.audit = append(db.audit, e)
+	db.appendScoreEvents(e.ScoreEvents())
+}
+
+//appendScoreEvents assigns events the next sequence numbers and appends them. db.mu must be held
+func (db *memoryDB) appendScoreEvents(events []*ScoreEvent) {
+	for _, e := range events {
+		e.Seq = uint64(len(db.events) + 1)
+		db.events = append(db.events, e)
+	}
+}
+
+func (db *memoryDB) Events(fromSeq uint64) ([]*ScoreEvent, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	//events aren't changed after they're appended, so they can be shared
+	events := make([]*ScoreEvent, 0)
+	for _, e := range db.events {
+		if e.Seq >= fromSeq {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (db *memoryDB) AuditEntries(since time.Time) ([]*AuditEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	//entries aren't changed after they're appended, so they can be shared
+	entries := make([]*AuditEntry, 0)
+	for _, e := range db.audit {
+		if !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (db *memoryDB) WalkRevisions(fn func(*Revision) error) error {
+	//fn may call other methods, so revisions are copied in batches without holding the lock while fn runs
+	for start := 0; ; start += revisionBatch {
+		db.mu.RLock()
+		if start < db.pruned {
+			start = db.pruned
+		}
+		var revisions []*Revision
+		for i := start; i < len(db.revisions) && i < start+revisionBatch; i++ {
+			r := db.revisions[i]
+			revisions = append(revisions, &Revision{ID: r.ID, Timestamp: r.Timestamp})
+		}
+		db.mu.RUnlock()
+
+		for _, r := range revisions {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+
+		if len(revisions) < revisionBatch {
+			return nil
+		}
+	}
+}
+
+func (db *memoryDB) Revisions() ([]*Revision, error) {
+	var revisions []*Revision
+	err := db.WalkRevisions(func(r *Revision) error {
+		revisions = append(revisions, r)
+		return nil
+	})
+	return revisions, err
+}
+
+func (db *memoryDB) ReadRevision(id int32) (*Revision, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if int(id) < db.pruned || int(id) >= len(db.revisions) {
+		return nil, nil
+	}
+
+	r := db.revisions[id]
+	return &Revision{ID: r.ID, Timestamp: r.Timestamp, Competition: r.Competition.Copy()}, nil
+}
+
+func (db *memoryDB) Read() (*Competition, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.c.Copy(), nil
+}
+
+//Write stores the current competition as a revision and replaces it with a copy of c
+func (db *memoryDB) Write(c *Competition) error {
+	return db.WriteAs("", c)
+}
+
+func (db *memoryDB) WriteAs(actor string, c *Competition) error {
+	if c != nil {
+		if err := c.Prepare(); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	version := db.version()
+	if db.c != nil && c != nil && c.Version != version {
+		return ErrStaleVersion
+	}
+
+	if db.c != nil {
+		db.revisions = append(db.revisions, &Revision{ID: int32(len(db.revisions)), Timestamp: db.lastModified, Competition: db.c})
+		db.prune()
+	}
+
+	if c != nil {
+		c.Version = version + 1
+	}
+
+	db.appendAudit(NewWriteAudit(actor, db.c, c))
+	db.c, db.lastModified = c.Copy(), time.Now()
+	return nil
+}
+
+//version returns the stored competition's Version, or 0 if there isn't one. db.mu must be held
+func (db *memoryDB) version() int32 {
+	if db.c == nil {
+		return 0
+	}
+	return db.c.Version
+}
+
+//PruneRevisions removes the revisions outside the RetentionPolicy
+func (db *memoryDB) PruneRevisions() (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.prune(), nil
+}
+
+//prune removes the oldest revisions while they're outside the RetentionPolicy and returns how many were removed. db.mu must be held
+func (db *memoryDB) prune() int {
+	p := retentionPolicy
+	if !p.Limited() {
+		return 0
+	}
+
+	start, now := db.pruned, time.Now()
+	for db.pruned < len(db.revisions) && p.expires(db.revisions[db.pruned].Timestamp, len(db.revisions)-db.pruned, now) {
+		db.revisions[db.pruned] = nil
+		db.pruned++
+	}
+	return db.pruned - start
+}
+
+//DiffRevisions returns the difference between the revisions with ids a and b
+func (db *memoryDB) DiffRevisions(a, b int32) (*RevisionDiff, error) {
+	return CompareRevisions(db, a, b)
+}
+
+func (db *memoryDB) RestoreRevision(id int32) (*Competition, error) {
+	return db.RestoreRevisionAs("", id)
+}
+
+//RestoreRevisionAs stores the current competition as a revision and replaces it with a copy of the revision with the given id
+func (db *memoryDB) RestoreRevisionAs(actor string, id int32) (*Competition, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if int(id) < db.pruned || int(id) >= len(db.revisions) {
+		return nil, nil
+	}
+
+	c := db.revisions[id].Competition.Copy()
+	c.Version = db.version() + 1
+	db.appendAudit(NewWriteAudit(actor, db.c, c))
+
+	if db.c != nil {
+		db.revisions = append(db.revisions, &Revision{ID: int32(len(db.revisions)), Timestamp: db.lastModified, Competition: db.c})
+		db.prune()
+	}
+
+	db.c, db.lastModified = c, time.Now()
+	return c.Copy(), nil
+}
+
+func (db *memoryDB) WriteScore(team, round int, score Score) error {
+	return db.WriteScoreAs("", team, round, score)
+}
+
+//WriteScoreAs sets the score on the stored competition and stores an audit entry without storing a revision
+func (db *memoryDB) WriteScoreAs(actor string, team, round int, score Score) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.c == nil {
+		return &Error{Err: nil, Description: "Competition doesn't exist"}
+	}
+
+	c := db.c.Copy()
+	if _, err := c.SetScore(team, round, score); err != nil {
+		return err
+	}
+	c.Version++
+
+	db.appendAudit(NewWriteAudit(actor, db.c, c))
+	db.c, db.lastModified = c, time.Now()
+	return nil
+}
+
+func (db *memoryDB) Restore(c *Competition, revisions []*Revision) error {
+	return db.RestoreAs("", c, revisions)
+}
+
+//RestoreAs replaces the competition and revisions with copies, renumbering revisions from 0, and stores an audit entry
+func (db *memoryDB) RestoreAs(actor string, c *Competition, revisions []*Revision) error {
+	stored := make([]*Revision, len(revisions))
+	for i, rev := range revisions {
+		if rev.Competition == nil {
+			return &Error{Err: nil, Description: fmt.Sprintf("Revision(%d) Competition was nil", i)}
+		}
+		if err := rev.Competition.Prepare(); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d)", i)}
+		}
+		stored[i] = &Revision{ID: int32(i), Timestamp: rev.Timestamp, Competition: rev.Competition.Copy()}
+	}
+
+	if c != nil {
+		if err := c.Prepare(); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if c != nil {
+		c.Version = db.version() + 1
+	}
+	db.appendAudit(NewRestoreAudit(actor, db.c, c))
+	db.c, db.lastModified, db.revisions, db.pruned = c.Copy(), time.Now(), stored, 0
+	return nil
+}
+
+func (db *memoryDB) State() (State, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.state == "" {
+		return StateSetup, nil
+	}
+	return db.state, nil
+}
+
+func (db *memoryDB) SetState(s State) error {
+	if !s.Valid() {
+		return &Error{Err: nil, Description: fmt.Sprintf("Unknown State(%s)", s)}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.state = s
+	return nil
+}
+
+func (db *memoryDB) ReadSetting(key string, v interface{}) (bool, error) {
+	db.mu.RLock()
+	buf, ok := db.settings[key]
+	db.mu.RUnlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
+		return false, &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Setting(%s)", key)}
+	}
+	return true, nil
+}
+
+func (db *memoryDB) WriteSetting(key string, v interface{}) error {
+	if v == nil {
+		db.mu.Lock()
+		delete(db.settings, key)
+		db.mu.Unlock()
+		return nil
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Setting(%s)", key)}
+	}
+
+	db.mu.Lock()
+	db.settings[key] = buf
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memoryDB) Settings() (map[string]json.RawMessage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	settings := make(map[string]json.RawMessage, len(db.settings))
+	for k, v := range db.settings {
+		settings[k] = append(json.RawMessage(nil), v...)
+	}
+	return settings, nil
+}
@@ -0,0 +1,276 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//legacyInt decodes a score or count stored by an earlier version, which may be an int32 or int64
+func legacyInt(data []byte) (int32, bool) {
+	switch len(data) {
+	case 4:
+		i, err := bytesToInt(data)
+		return i, err == nil
+	case 8:
+		var i int64
+		if err := binary.Read(bytes.NewBuffer(data), binary.BigEndian, &i); err != nil {
+			return 0, false
+		}
+		return int32(i), true
+	}
+	return 0, false
+}
+
+//countBuckets returns the number of consecutive int keyed children in b starting at 0
+func countBuckets(b *bolt.Bucket, buckets bool) int32 {
+	var i int32
+	for ; ; i++ {
+		if buckets && b.Bucket(intToBytes(i)) == nil {
+			return i
+		}
+		if !buckets && b.Get(intToBytes(i)) == nil {
+			return i
+		}
+	}
+}
+
+type migration struct {
+	clearZeros bool
+	changes    []string
+}
+
+func (m *migration) change(format string, a ...interface{}) {
+	m.changes = append(m.changes, fmt.Sprintf(format, a...))
+}
+
+//count makes sure config.key holds an int32, falling back to the number of children in the given bucket
+func (m *migration) count(label string, config, b *bolt.Bucket, key string, buckets bool) (int32, error) {
+	val := config.Get([]byte(key))
+	if len(val) == 4 {
+		return bytesToInt(val)
+	}
+
+	n, ok := legacyInt(val)
+	if !ok {
+		n = 0
+		if b != nil {
+			n = countBuckets(b, buckets)
+		}
+	}
+
+	if err := config.Put([]byte(key), intToBytes(n)); err != nil {
+		return 0, &Error{Err: err, Description: fmt.Sprintf("Couldn't write %s config.%s", label, key)}
+	}
+	m.change("%s: set config.%s to %d", label, key, n)
+
+	return n, nil
+}
+
+func (m *migration) migrateTeam(label string, b *bolt.Bucket, rounds int32) error {
+	scoresBucket := b.Bucket([]byte("scores"))
+	if scoresBucket == nil {
+		var err error
+		if scoresBucket, err = b.CreateBucket([]byte("scores")); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't create %s scores Bucket", label)}
+		}
+		m.change("%s: created missing scores", label)
+	}
+
+	for i := int32(0); i < rounds; i++ {
+		score := scoresBucket.Get(intToBytes(i))
+		if score == nil || string(score) == string(ScoreNoShow) {
+			continue
+		}
+
+		val, ok := legacyInt(score)
+		if !ok {
+			return &Error{Err: nil, Description: fmt.Sprintf("Couldn't decode %s Round(%d) score(%#v)", label, i, score)}
+		}
+
+		if m.clearZeros && val == 0 {
+			if err := scoresBucket.Delete(intToBytes(i)); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't clear %s Round(%d) score", label, i)}
+			}
+			m.change("%s: cleared zero score in Round(%d)", label, i)
+			continue
+		}
+
+		if len(score) != 4 {
+			if err := scoresBucket.Put(intToBytes(i), intToBytes(val)); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't write %s Round(%d) score", label, i)}
+			}
+			m.change("%s: converted Round(%d) score %d", label, i, val)
+		}
+	}
+
+	return nil
+}
+
+func (m *migration) migrateCompetition(label string, b *bolt.Bucket) error {
+	//competitions with stored IDs are already in the current layout
+	if b.Bucket([]byte("round_order")) != nil && b.Bucket([]byte("team_order")) != nil {
+		return nil
+	}
+
+	configBucket := b.Bucket([]byte("config"))
+	if configBucket == nil {
+		var err error
+		if configBucket, err = b.CreateBucket([]byte("config")); err != nil {
+			return &Error{Err: err, Description: fmt.Sprintf("Couldn't create %s config Bucket", label)}
+		}
+		m.change("%s: created missing config", label)
+	}
+
+	rounds, err := m.count(label, configBucket, b.Bucket([]byte("rounds")), "rounds", false)
+	if err != nil {
+		return err
+	}
+
+	teams, err := m.count(label, configBucket, b.Bucket([]byte("teams")), "teams", true)
+	if err != nil {
+		return err
+	}
+
+	teamsBucket := b.Bucket([]byte("teams"))
+	if teamsBucket == nil {
+		if teams == 0 {
+			return nil
+		}
+		return &Error{Err: nil, Description: fmt.Sprintf("%s teams Bucket was nil", label)}
+	}
+
+	for i := int32(0); i < teams; i++ {
+		teamBucket := teamsBucket.Bucket(intToBytes(i))
+		if teamBucket == nil {
+			return &Error{Err: nil, Description: fmt.Sprintf("%s Team(%d) Bucket was nil", label, i)}
+		}
+
+		if err = m.migrateTeam(fmt.Sprintf("%s Team(%d)", label, i), teamBucket, rounds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//lastModified makes sure the config bucket has a last_modified time
+func (m *migration) lastModified(label string, config *bolt.Bucket) error {
+	var t time.Time
+	if t.UnmarshalBinary(config.Get([]byte("last_modified"))) == nil {
+		return nil
+	}
+
+	buf, err := time.Now().MarshalBinary()
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't encode time"}
+	}
+
+	if err = config.Put([]byte("last_modified"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write %s config.last_modified", label)}
+	}
+	m.change("%s: set missing last_modified", label)
+
+	return nil
+}
+
+//Migrate upgrades the database at path created by an earlier version to the current layout.
+//Legacy int64 encoded scores and counts are converted, and missing buckets and config values are recreated.
+//Earlier versions stored unscored cells as 0; if clearZeros is true, zero scores are cleared.
+//Migrate returns a description of each change made or an error if one occurred. No changes are made if an error occurs
+func Migrate(path string, clearZeros bool) (changes []string, err error) {
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't open database"}
+	}
+	defer db.Close()
+
+	//encrypted databases were created after the layout Migrate upgrades, and their values can't be read here
+	if db.View(func(tx *bolt.Tx) error { return checkEncryption(tx, nil) }) != nil {
+		return nil, &Error{Err: ErrEncryptionKey, Description: "Encrypted databases don't need to be migrated"}
+	}
+
+	var version int32
+	err = db.View(func(tx *bolt.Tx) (err error) {
+		version, err = readSchemaVersion(tx)
+		return err
+	})
+	if err == nil {
+		err = checkSchemaVersion(version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &migration{clearZeros: clearZeros}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		configBucket, err := tx.CreateBucketIfNotExists([]byte("config"))
+		if err != nil {
+			return &Error{Err: err, Description: "Couldn't create Database config Bucket"}
+		}
+
+		if competitionBucket := tx.Bucket([]byte("competition")); competitionBucket != nil {
+			if err = m.migrateCompetition("Competition", competitionBucket); err != nil {
+				return err
+			}
+
+			if err = m.lastModified("Competition", competitionBucket.Bucket([]byte("config"))); err != nil {
+				return err
+			}
+		}
+
+		revisionsBucket := tx.Bucket([]byte("revisions"))
+		if revisionsBucket == nil {
+			return nil
+		}
+
+		revisions := countBuckets(revisionsBucket, true)
+		for i := int32(0); i < revisions; i++ {
+			label := fmt.Sprintf("Revision(%d)", i)
+			revisionBucket := revisionsBucket.Bucket(intToBytes(i))
+
+			revisionConfigBucket := revisionBucket.Bucket([]byte("config"))
+			if revisionConfigBucket == nil {
+				if revisionConfigBucket, err = revisionBucket.CreateBucket([]byte("config")); err != nil {
+					return &Error{Err: err, Description: fmt.Sprintf("Couldn't create %s config Bucket", label)}
+				}
+				m.change("%s: created missing config", label)
+			}
+
+			if err = m.lastModified(label, revisionConfigBucket); err != nil {
+				return err
+			}
+
+			competitionBucket := revisionBucket.Bucket([]byte("competition"))
+			if competitionBucket == nil {
+				return &Error{Err: nil, Description: fmt.Sprintf("%s competition Bucket was nil", label)}
+			}
+
+			if err = m.migrateCompetition(label+" Competition", competitionBucket); err != nil {
+				return err
+			}
+		}
+
+		if last := configBucket.Get([]byte("current_revision")); len(last) != 4 {
+			if revisions == 0 {
+				return nil
+			}
+			if err = configBucket.Put([]byte("current_revision"), intToBytes(revisions-1)); err != nil {
+				return &Error{Err: err, Description: "Couldn't write Database config.current_revision"}
+			}
+			m.change("Database: set config.current_revision to %d", revisions-1)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.changes, nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//Password hash algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+//argon2 salt and key lengths in bytes
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+//PasswordOptions configure how new password hashes are made.
+//Argon2Memory is in KiB
+type PasswordOptions struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+//DefaultPasswordOptions are the PasswordOptions used if SetPasswordOptions isn't called
+var DefaultPasswordOptions = PasswordOptions{
+	Algorithm:     AlgorithmBcrypt,
+	BcryptCost:    12,
+	Argon2Time:    1,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 2,
+}
+
+var passwordOptions = DefaultPasswordOptions
+
+//SetPasswordOptions sets the options used to hash passwords or returns an error if they aren't valid.
+//It should be called before the DB is used
+func SetPasswordOptions(o PasswordOptions) error {
+	switch o.Algorithm {
+	case AlgorithmBcrypt:
+		if o.BcryptCost < bcrypt.MinCost || o.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		if o.Argon2Time < 1 || o.Argon2Memory < 8*uint32(o.Argon2Threads) || o.Argon2Threads < 1 {
+			return fmt.Errorf("argon2id time and threads must be at least 1 and memory at least 8KiB per thread")
+		}
+	default:
+		return fmt.Errorf("Unknown password hash algorithm: %s", o.Algorithm)
+	}
+
+	passwordOptions = o
+	return nil
+}
+
+//argon2Params are the parameters encoded in an argon2id hash
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+//parseArgon2 parses an argon2id hash in the PHC string format: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func parseArgon2(hash []byte) (*argon2Params, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, fmt.Errorf("Invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("Unsupported argon2id version: %s", parts[2])
+	}
+
+	p := new(argon2Params)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, fmt.Errorf("Invalid argon2id parameters: %v", err)
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("Invalid argon2id salt: %v", err)
+	}
+
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("Invalid argon2id key: %v", err)
+	}
+
+	return p, nil
+}
+
+//HashPassword returns a hash of the given password or an error if one occurred
+func HashPassword(password string) ([]byte, error) {
+	o := passwordOptions
+	if o.Algorithm != AlgorithmArgon2id {
+		return bcrypt.GenerateFromPassword([]byte(password), o.BcryptCost)
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, o.Argon2Time, o.Argon2Memory, o.Argon2Threads, argon2KeyLen)
+
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgorithmArgon2id, argon2.Version,
+		o.Argon2Memory, o.Argon2Time, o.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+//CheckPassword returns whether or not password matches the given bcrypt or argon2id hash
+func CheckPassword(hash []byte, password string) bool {
+	if !bytes.HasPrefix(hash, []byte("$"+AlgorithmArgon2id+"$")) {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	}
+
+	p, err := parseArgon2(hash)
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+//NeedsRehash returns whether or not hash was made with a different algorithm or parameters than the current PasswordOptions
+func NeedsRehash(hash []byte) bool {
+	o := passwordOptions
+
+	if o.Algorithm != AlgorithmArgon2id {
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost != o.BcryptCost
+	}
+
+	p, err := parseArgon2(hash)
+	return err != nil || p.time != o.Argon2Time || p.memory != o.Argon2Memory || p.threads != o.Argon2Threads
+}
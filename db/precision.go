@@ -0,0 +1,218 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//Rounding modes
+const (
+	RoundHalfUp   = "half_up"
+	RoundHalfEven = "half_even"
+	RoundDown     = "down"
+)
+
+//MaxPlaces is the most decimal places a competition can have
+const MaxPlaces = 4
+
+//Precision sets how many decimal places scores have and how values with more places are rounded.
+//Score values are stored as integers in units of 10^-Places, so 12.5 is stored as 125 with 1 place; totals are exact.
+//Rounding applies to computed averages and decimal input with more places, and is one of RoundHalfUp (half away from zero),
+//RoundHalfEven, or RoundDown (toward zero). A nil Precision has 0 places and rounds half up
+type Precision struct {
+	Places   int    `json:"places"`
+	Rounding string `json:"rounding"`
+}
+
+//Validate returns an error if p's places or rounding mode aren't valid
+func (p *Precision) Validate() error {
+	if p.Places < 0 || p.Places > MaxPlaces {
+		return fmt.Errorf("places must be between 0 and %d", MaxPlaces)
+	}
+	switch p.Rounding {
+	case RoundHalfUp, RoundHalfEven, RoundDown:
+		return nil
+	}
+	return fmt.Errorf("rounding must be %s, %s, or %s", RoundHalfUp, RoundHalfEven, RoundDown)
+}
+
+func (p *Precision) places() int {
+	if p == nil {
+		return 0
+	}
+	return p.Places
+}
+
+func (p *Precision) rounding() string {
+	if p == nil || p.Rounding == "" {
+		return RoundHalfUp
+	}
+	return p.Rounding
+}
+
+func pow10(n int) int64 {
+	v := int64(1)
+	for i := 0; i < n; i++ {
+		v *= 10
+	}
+	return v
+}
+
+//Divide returns num / den rounded with p's rounding mode. den must be positive
+func (p *Precision) Divide(num, den int64) int64 {
+	q, r := num/den, num%den
+	if r == 0 {
+		return q
+	}
+
+	sign := int64(1)
+	if num < 0 {
+		sign, r = -1, -r
+	}
+
+	switch p.rounding() {
+	case RoundDown:
+		return q
+	case RoundHalfEven:
+		if 2*r > den || (2*r == den && q%2 != 0) {
+			return q + sign
+		}
+		return q
+	}
+	if 2*r >= den {
+		return q + sign
+	}
+	return q
+}
+
+//Format returns a score value with p's decimal places, e.g. 125 is "12.5" with 1 place
+func (p *Precision) Format(v int32) string {
+	places := p.places()
+	if places == 0 {
+		return strconv.Itoa(int(v))
+	}
+
+	abs := int64(v)
+	if abs < 0 {
+		abs = -abs
+	}
+	s := strconv.FormatInt(abs, 10)
+	if len(s) <= places {
+		s = strings.Repeat("0", places-len(s)+1) + s
+	}
+	s = s[:len(s)-places] + "." + s[len(s)-places:]
+	if v < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+//Parse returns the score value of a decimal number, e.g. "12.5" is 125 with 1 place.
+//Digits past p's places are rounded with p's rounding mode
+func (p *Precision) Parse(s string) (int32, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	parts := strings.SplitN(s, ".", 2)
+	whole, frac := parts[0], ""
+	if len(parts) == 2 {
+		frac = parts[1]
+	}
+	if whole == "" && frac == "" {
+		return 0, errors.New("not a number")
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, errors.New("not a number")
+		}
+	}
+
+	//drop trailing zeros so long but exact inputs don't overflow
+	frac = strings.TrimRight(frac, "0")
+	places := p.places()
+	extra := 0
+	if len(frac) > places {
+		extra = len(frac) - places
+	} else {
+		frac += strings.Repeat("0", places-len(frac))
+	}
+	if len(whole)+len(frac) > 18 {
+		return 0, errors.New("out of range")
+	}
+
+	digits := strings.TrimLeft(whole+frac, "0")
+	var v int64
+	if digits != "" {
+		v, _ = strconv.ParseInt(digits, 10, 64)
+	}
+	if neg {
+		v = -v
+	}
+	v = p.Divide(v, pow10(extra))
+
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		return 0, errors.New("out of range")
+	}
+	return int32(v), nil
+}
+
+//Rescale returns v, which has the given number of decimal places, with p's places, rounding if p has fewer places
+func (p *Precision) Rescale(v int32, places int) (int32, error) {
+	var scaled int64
+	if diff := p.places() - places; diff >= 0 {
+		scaled = int64(v) * pow10(diff)
+	} else {
+		scaled = p.Divide(int64(v), pow10(-diff))
+	}
+	if scaled > math.MaxInt32 || scaled < math.MinInt32 {
+		return 0, errors.New("out of range")
+	}
+	return int32(scaled), nil
+}
+
+//FormatScore returns the value of s with p's decimal places if it's scored, or its state otherwise
+func (p *Precision) FormatScore(s Score) string {
+	s = s.normalize()
+	if s.Scored() {
+		return p.Format(s.Value)
+	}
+	return string(s.State)
+}
+
+func copyPrecision(p *Precision) *Precision {
+	if p == nil {
+		return nil
+	}
+	cp := *p
+	return &cp
+}
+
+func readPrecision(b *bucket, c *Competition) error {
+	buf := get(b, []byte("precision"))
+	if buf == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &c.Precision); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Competition(%s) precision", c.Name)}
+	}
+	return nil
+}
+
+func writePrecision(b *bucket, c *Competition) error {
+	if c.Precision == nil {
+		return nil
+	}
+	buf, err := json.Marshal(c.Precision)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Competition(%s) precision", c.Name)}
+	}
+	if err = put(b, []byte("precision"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s) precision", c.Name)}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+//RecoverySetting is the setting a Recovery is stored under until it's cleared
+const RecoverySetting = "recovery"
+
+//Recovery describes a competition that couldn't be read and was replaced with the latest readable revision.
+//Error is why the competition couldn't be read. Revision is the ID of the revision the competition was restored from,
+//or -1 if no revision was readable and the competition was cleared.
+//Revisions that couldn't be read are listed in Skipped, and the remaining revisions are renumbered from 0
+type Recovery struct {
+	Time     time.Time `json:"time"`
+	Error    string    `json:"error"`
+	Revision int32     `json:"revision"`
+	Skipped  []int32   `json:"skipped,omitempty"`
+}
+
+//CheckConsistency reads the competition from d and, if it can't be read, replaces it with the latest revision that can be read.
+//The Recovery is stored as the RecoverySetting setting and returned, or CheckConsistency returns nil if the competition was readable.
+//An error is returned if the competition couldn't be recovered
+func CheckConsistency(d DB) (*Recovery, error) {
+	_, readErr := d.Read()
+	if readErr == nil {
+		return nil, nil
+	}
+
+	r := &Recovery{Time: time.Now(), Error: readErr.Error(), Revision: -1}
+
+	var ids []int32
+	if err := d.WalkRevisions(func(rev *Revision) error {
+		ids = append(ids, rev.ID)
+		return nil
+	}); err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't read revisions"}
+	}
+
+	var revisions []*Revision
+	for _, id := range ids {
+		rev, err := d.ReadRevision(id)
+		if err != nil || rev == nil || rev.Competition == nil {
+			r.Skipped = append(r.Skipped, id)
+			continue
+		}
+		revisions = append(revisions, rev)
+	}
+
+	var c *Competition
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		c, r.Revision = latest.Competition.Copy(), latest.ID
+	}
+
+	if err := d.Restore(c, revisions); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't restore Revision(%d)", r.Revision)}
+	}
+
+	if err := d.WriteSetting(RecoverySetting, r); err != nil {
+		return r, &Error{Err: err, Description: "Couldn't store recovery"}
+	}
+
+	return r, nil
+}
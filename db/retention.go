@@ -0,0 +1,39 @@
+package db
+
+import "time"
+
+//RetentionPolicy limits the revisions kept, removing the oldest revisions first. The latest revision is always kept.
+//MaxRevisions is the most revisions kept and MaxAge is how old a revision can be before it's removed; zero means no limit
+type RetentionPolicy struct {
+	MaxRevisions int
+	MaxAge       time.Duration
+}
+
+var retentionPolicy RetentionPolicy
+
+//SetRetentionPolicy sets the RetentionPolicy enforced when a competition is written and by PruneRevisions.
+//It should be called before the DB is used
+func SetRetentionPolicy(p RetentionPolicy) {
+	retentionPolicy = p
+}
+
+//CurrentRetentionPolicy returns the RetentionPolicy set with SetRetentionPolicy
+func CurrentRetentionPolicy() RetentionPolicy {
+	return retentionPolicy
+}
+
+//Limited returns whether or not p removes any revisions
+func (p RetentionPolicy) Limited() bool {
+	return p.MaxRevisions > 0 || p.MaxAge > 0
+}
+
+//expires returns whether or not the oldest of remaining revisions, stored at t, is removed by p
+func (p RetentionPolicy) expires(t time.Time, remaining int, now time.Time) bool {
+	if remaining <= 1 {
+		return false
+	}
+	if p.MaxRevisions > 0 && remaining > p.MaxRevisions {
+		return true
+	}
+	return p.MaxAge > 0 && now.Sub(t) > p.MaxAge
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//readRoster reads a team's roster from b
+func readRoster(b *bucket, t *Team) error {
+	buf := get(b, []byte("roster"))
+	if buf == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &t.Roster); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) roster", t.Name)}
+	}
+	return nil
+}
+
+//writeRoster writes a team's roster to b if it has one
+func writeRoster(b *bucket, t *Team) error {
+	if len(t.Roster) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(t.Roster)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Team(%s) roster", t.Name)}
+	}
+	if err = put(b, []byte("roster"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) roster", t.Name)}
+	}
+	return nil
+}
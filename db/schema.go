@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+//SchemaVersion is the version of the database layout this version reads and writes. It's stored in config.schema_version
+const SchemaVersion int32 = 1
+
+//ErrSchemaVersion is the cause of the error returned when opening a database written by a newer version
+var ErrSchemaVersion = errors.New("unsupported schema version")
+
+//schemaMigration upgrades a database from one schema version to the next
+type schemaMigration struct {
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+//schemaMigrations are the migrations of the database layout. schemaMigrations[i] upgrades a database at version i to version i+1,
+//so a layout change appends its migration here and increments SchemaVersion. Migrations also run on new, empty databases
+var schemaMigrations = []schemaMigration{
+	//databases written before schema_version was stored have the version 1 layout.
+	//Older layouts with int64 scores are upgraded by Migrate
+	{description: "store schema version", migrate: func(tx *bolt.Tx) error { return nil }},
+}
+
+//readSchemaVersion returns the schema version stored in the database config bucket, or 0 if it isn't stored
+func readSchemaVersion(tx *bolt.Tx) (int32, error) {
+	configBucket := txBucket(tx, []byte("config"))
+	if configBucket == nil {
+		return 0, nil
+	}
+
+	buf := get(configBucket, []byte("schema_version"))
+	if buf == nil {
+		return 0, nil
+	}
+
+	version, err := bytesToInt(buf)
+	if err != nil {
+		return 0, &Error{Err: err, Description: "Couldn't decode Database config.schema_version"}
+	}
+	return version, nil
+}
+
+//checkSchemaVersion returns an error if version is newer than SchemaVersion
+func checkSchemaVersion(version int32) error {
+	if version > SchemaVersion {
+		return &Error{Err: ErrSchemaVersion, Description: fmt.Sprintf("Database schema version %d is newer than supported version %d; upgrade to open it", version, SchemaVersion)}
+	}
+	return nil
+}
+
+//migrateSchema upgrades the database to SchemaVersion in a single transaction, running each migration after its stored version.
+//An error is returned if the database was written by a newer version. Current databases aren't written to, so they can be opened on read-only storage
+func migrateSchema(d *bolt.DB) error {
+	var version int32
+	err := d.View(func(tx *bolt.Tx) (err error) {
+		version, err = readSchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = checkSchemaVersion(version); err != nil || version == SchemaVersion {
+		return err
+	}
+
+	return d.Update(func(tx *bolt.Tx) error {
+		for v := version; v < SchemaVersion; v++ {
+			m := schemaMigrations[v]
+			if err := m.migrate(tx); err != nil {
+				return &Error{Err: err, Description: fmt.Sprintf("Couldn't migrate schema from version %d to %d: %s", v, v+1, m.description)}
+			}
+		}
+
+		configBucket, err := createTxBucketIfNotExists(tx, []byte("config"))
+		if err != nil {
+			return &Error{Err: err, Description: "Couldn't create Database config Bucket"}
+		}
+
+		if err = put(configBucket, []byte("schema_version"), intToBytes(SchemaVersion)); err != nil {
+			return &Error{Err: err, Description: "Couldn't write Database config.schema_version"}
+		}
+		return nil
+	})
+}
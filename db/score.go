@@ -0,0 +1,199 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+//ScoreState represents whether or not a round has been scored
+type ScoreState string
+
+//Score states
+const (
+	ScoreUnscored ScoreState = "unscored"
+	ScoreScored   ScoreState = "scored"
+	ScoreNoShow   ScoreState = "no_show"
+)
+
+//Valid returns whether or not s is a known ScoreState
+func (s ScoreState) Valid() bool {
+	return s == ScoreUnscored || s == ScoreScored || s == ScoreNoShow
+}
+
+//Score represents a team's score for a round. The zero value is unscored.
+//Value is only meaningful if State is ScoreScored; no-shows count as 0.
+//Fields holds custom fields submitted with the score
+type Score struct {
+	Value  int32      `json:"value"`
+	State  ScoreState `json:"state"`
+	Fields Fields     `json:"fields,omitempty"`
+}
+
+//NewScore returns a scored Score with the given value
+func NewScore(value int32) Score {
+	return Score{Value: value, State: ScoreScored}
+}
+
+//Scored returns whether or not s has a value
+func (s Score) Scored() bool {
+	return s.State == ScoreScored
+}
+
+//Points returns the value s contributes to a team's total
+func (s Score) Points() int32 {
+	if s.Scored() {
+		return s.Value
+	}
+	return 0
+}
+
+//normalize returns s with the zero value State set to ScoreUnscored and Value cleared if not scored
+func (s Score) normalize() Score {
+	if s.State == "" {
+		s.State = ScoreUnscored
+	}
+	if !s.Scored() {
+		s.Value = 0
+	}
+	return s
+}
+
+//String returns the value of a scored Score, or its state otherwise
+func (s Score) String() string {
+	s = s.normalize()
+	if s.Scored() {
+		return fmt.Sprintf("%d", s.Value)
+	}
+	return string(s.State)
+}
+
+//MarshalJSON fulfills the json.Marshaler interface
+func (s Score) MarshalJSON() ([]byte, error) {
+	type score Score
+	return json.Marshal(score(s.normalize()))
+}
+
+//UnmarshalJSON fulfills the json.Unmarshaler interface.
+//For compatibility with earlier versions, a number is decoded as a scored Score and null as unscored
+func (s *Score) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		*s = Score{State: ScoreUnscored}
+		return nil
+	}
+
+	if len(data) > 0 && data[0] != '{' {
+		var v int32
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = NewScore(v)
+		return nil
+	}
+
+	type score Score
+	var val score
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+
+	if val.State != "" && !ScoreState(val.State).Valid() {
+		return fmt.Errorf("Unknown score state: %s", val.State)
+	}
+
+	*s = Score(val).normalize()
+	return nil
+}
+
+//SetScore sets the score of the team at index team for the round at index round and recomputes computed rounds.
+//SetScore returns the indexes of the teams whose scores changed, or an error if the team or round doesn't exist
+//or a computed round definition isn't valid
+func (c *Competition) SetScore(team, round int, s Score) ([]int, error) {
+	if team < 0 || team >= len(c.Teams) || round < 0 || round >= len(c.Rounds) {
+		return nil, &Error{Err: nil, Description: fmt.Sprintf("Competition(%s) Team(%d) Round(%d) doesn't exist", c.Name, team, round)}
+	}
+
+	old := make([][]Score, len(c.Teams))
+	for i, t := range c.Teams {
+		old[i] = append([]Score(nil), t.Scores...)
+	}
+
+	c.Teams[team].Scores[round] = s
+	if err := c.Compute(); err != nil {
+		return nil, &Error{Err: err, Description: fmt.Sprintf("Couldn't compute Competition(%s) computed rounds", c.Name)}
+	}
+
+	changed := []int{team}
+	for i, t := range c.Teams {
+		if i == team {
+			continue
+		}
+		for r, score := range t.Scores {
+			a, b := score.normalize(), old[i][r].normalize()
+			if a.State != b.State || a.Value != b.Value {
+				changed = append(changed, i)
+				break
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+//packedScoreSize is the size of a score in a team's packed_scores: a state byte followed by an int32 value
+const packedScoreSize = 5
+
+//packed score states
+const (
+	packedUnscored byte = iota
+	packedScored
+	packedNoShow
+)
+
+//packScore writes s to the first packedScoreSize bytes of b
+func packScore(b []byte, s Score) {
+	switch s.normalize().State {
+	case ScoreScored:
+		b[0] = packedScored
+	case ScoreNoShow:
+		b[0] = packedNoShow
+	default:
+		b[0] = packedUnscored
+	}
+	binary.BigEndian.PutUint32(b[1:], uint32(s.Points()))
+}
+
+//unpackScore returns the Score written to b by packScore or an error if one occurred
+func unpackScore(b []byte) (Score, error) {
+	switch b[0] {
+	case packedUnscored:
+		return Score{State: ScoreUnscored}, nil
+	case packedScored:
+		return NewScore(int32(binary.BigEndian.Uint32(b[1:]))), nil
+	case packedNoShow:
+		return Score{State: ScoreNoShow}, nil
+	}
+	return Score{}, &Error{Err: nil, Description: fmt.Sprintf("Unknown packed score state(%d)", b[0])}
+}
+
+//decodeScore returns the Score stored in a team's scores bucket or an error if one occurred.
+//Scored values are stored as an int32; other states are stored as their name
+func decodeScore(data []byte) (Score, error) {
+	if data == nil {
+		return Score{State: ScoreUnscored}, nil
+	}
+
+	if string(data) == string(ScoreNoShow) {
+		return Score{State: ScoreNoShow}, nil
+	}
+
+	v, err := bytesToInt(data)
+	if err != nil || len(data) != 4 {
+		return Score{}, &Error{Err: err, Description: fmt.Sprintf("Unknown score encoding(%#v)", data)}
+	}
+
+	return NewScore(v), nil
+}
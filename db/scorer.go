@@ -0,0 +1,220 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Scorer computes team totals and breaks ties in the standings. Scorers should use Competition.CountedScores so raw rounds aren't counted.
+//Leagues with custom scoring can implement Scorer and register it with RegisterScorer,
+//either in their own build or from a Go plugin loaded at startup
+type Scorer interface {
+	//Total returns the total of the team at the given index in c
+	Total(c *Competition, team int) int32
+	//Tiebreak returns a positive number if team a should be ranked ahead of team b when their totals are equal,
+	//a negative number if b should be ranked ahead, or 0 if they're tied
+	Tiebreak(c *Competition, a, b int) int
+}
+
+//ScorerFactory returns a Scorer configured with the given argument, which is empty if none was given,
+//or an error if the argument isn't valid
+type ScorerFactory func(arg string) (Scorer, error)
+
+var scorerFactories = map[string]ScorerFactory{
+	"sum":      newSumScorer,
+	"best":     newBestScorer,
+	"weighted": newWeightedScorer,
+}
+
+var (
+	scorer   Scorer = sumScorer{}
+	scorerMu sync.RWMutex
+)
+
+//RegisterScorer makes a Scorer available to NewScorer by name.
+//It should be called from an init function, and panics if name is already registered
+func RegisterScorer(name string, f ScorerFactory) {
+	scorerMu.Lock()
+	defer scorerMu.Unlock()
+	if _, ok := scorerFactories[name]; ok {
+		panic(fmt.Sprintf("Scorer %s is already registered", name))
+	}
+	scorerFactories[name] = f
+}
+
+//Scorers returns the names of the registered Scorers
+func Scorers() []string {
+	scorerMu.RLock()
+	defer scorerMu.RUnlock()
+	names := make([]string, 0, len(scorerFactories))
+	for name := range scorerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//NewScorer returns the registered Scorer given by spec, in the form name or name:argument,
+//or an error if one occurred
+func NewScorer(spec string) (Scorer, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	var arg string
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	scorerMu.RLock()
+	f, ok := scorerFactories[parts[0]]
+	scorerMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown scorer %s; scorers are %s", parts[0], strings.Join(Scorers(), ", "))
+	}
+
+	s, err := f(arg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s scorer: %v", parts[0], err)
+	}
+	return s, nil
+}
+
+//SetScorer sets the Scorer used to compute standings. It should be called before the DB is used
+func SetScorer(s Scorer) {
+	scorerMu.Lock()
+	defer scorerMu.Unlock()
+	scorer = s
+}
+
+func activeScorer() Scorer {
+	scorerMu.RLock()
+	defer scorerMu.RUnlock()
+	return scorer
+}
+
+//sumScorer totals every round. Its argument breaks ties: highest compares each team's highest round,
+//and latest compares the most recent round where the teams' scores differ
+type sumScorer struct {
+	tiebreak string
+}
+
+func newSumScorer(arg string) (Scorer, error) {
+	switch arg {
+	case "", "highest", "latest":
+		return sumScorer{tiebreak: arg}, nil
+	}
+	return nil, fmt.Errorf("tiebreak must be highest or latest")
+}
+
+func (s sumScorer) Total(c *Competition, team int) int32 {
+	return sum(c.CountedScores(team))
+}
+
+func (s sumScorer) Tiebreak(c *Competition, a, b int) int {
+	sa, sb := c.CountedScores(a), c.CountedScores(b)
+	switch s.tiebreak {
+	case "highest":
+		return compare(highest(sa), highest(sb))
+	case "latest":
+		for i := len(sa) - 1; i >= 0 && i < len(sb); i-- {
+			if cmp := compare(sa[i].Points(), sb[i].Points()); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+	return 0
+}
+
+//bestScorer totals a team's n highest rounds. Ties are broken by the total of every round
+type bestScorer struct {
+	n int
+}
+
+func newBestScorer(arg string) (Scorer, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("number of rounds must be at least 1")
+	}
+	return bestScorer{n: n}, nil
+}
+
+func (s bestScorer) Total(c *Competition, team int) int32 {
+	scores := c.CountedScores(team)
+	points := make([]int32, len(scores))
+	for i, score := range scores {
+		points[i] = score.Points()
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] > points[j] })
+
+	var total int32
+	for i := 0; i < len(points) && i < s.n; i++ {
+		total += points[i]
+	}
+	return total
+}
+
+func (s bestScorer) Tiebreak(c *Competition, a, b int) int {
+	return compare(sum(c.CountedScores(a)), sum(c.CountedScores(b)))
+}
+
+//weightedScorer multiplies each round by its weight before totaling. Rounds without a weight have a weight of 1
+type weightedScorer struct {
+	weights []int32
+}
+
+func newWeightedScorer(arg string) (Scorer, error) {
+	var weights []int32
+	for _, w := range strings.Split(arg, ",") {
+		i, err := strconv.ParseInt(strings.TrimSpace(w), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("weights must be comma separated integers")
+		}
+		weights = append(weights, int32(i))
+	}
+	return weightedScorer{weights: weights}, nil
+}
+
+func (s weightedScorer) Total(c *Competition, team int) int32 {
+	var total int32
+	for i, score := range c.CountedScores(team) {
+		w := int32(1)
+		if i < len(s.weights) {
+			w = s.weights[i]
+		}
+		total += w * score.Points()
+	}
+	return total
+}
+
+func (s weightedScorer) Tiebreak(c *Competition, a, b int) int {
+	return 0
+}
+
+func sum(scores []Score) int32 {
+	var total int32
+	for _, s := range scores {
+		total += s.Points()
+	}
+	return total
+}
+
+func highest(scores []Score) int32 {
+	var max int32
+	for i, s := range scores {
+		if i == 0 || s.Points() > max {
+			max = s.Points()
+		}
+	}
+	return max
+}
+
+func compare(a, b int32) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//Slug returns a URL-safe version of name: lowercase letters and digits separated by dashes
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	if b.Len() == 0 {
+		return "team"
+	}
+	return b.String()
+}
+
+//assignSlugs sets each team's Slug from its name, adding a number to make duplicates unique
+func (c *Competition) assignSlugs() {
+	used := make(map[string]bool)
+	for _, t := range c.Teams {
+		slug := Slug(t.Name)
+		for i := 2; used[slug]; i++ {
+			slug = fmt.Sprintf("%s-%d", Slug(t.Name), i)
+		}
+		used[slug] = true
+		t.Slug = slug
+	}
+}
+
+//normalizeName returns name in the form used to compare team names
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+//DuplicateTeams returns the team names that are used by more than one team, ignoring case and spacing
+func (c *Competition) DuplicateTeams() []string {
+	counts := make(map[string]int)
+	names := make(map[string]string)
+	for _, t := range c.Teams {
+		n := normalizeName(t.Name)
+		counts[n]++
+		if _, ok := names[n]; !ok {
+			names[n] = t.Name
+		}
+	}
+
+	var dups []string
+	for n, count := range counts {
+		if count > 1 {
+			dups = append(dups, names[n])
+		}
+	}
+	sort.Strings(dups)
+
+	return dups
+}
+
+//FindTeam returns the index of the team referenced by ref, which can be a team ID, slug, or index,
+//or -1 if it doesn't exist
+func (c *Competition) FindTeam(ref string) int {
+	if i := c.TeamIndex(ref); i != -1 {
+		return i
+	}
+
+	for i, t := range c.Teams {
+		if t.Slug == ref {
+			return i
+		}
+	}
+
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(c.Teams) {
+		return i
+	}
+
+	return -1
+}
@@ -0,0 +1,816 @@
+//Package sqlite implements db.DB with a SQLite database file so data can be inspected with standard SQL tools.
+//
+//The competition and its revisions are stored as JSON like the postgres package. The rounds, teams, and scores views
+//expand the current competition into rows, e.g.
+//
+//	SELECT team, round, state, value FROM scores ORDER BY team_position, round_position;
+//
+//Score values are stored as integers scaled by the competition's precision.
+//The schema is created and upgraded when the database is opened
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+
+	//register the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//revisionBatch is the number of revisions read in each query by WalkRevisions
+const revisionBatch = 256
+
+//migrations are applied in order; the index of a migration plus one is its schema version
+var migrations = []string{
+	`CREATE TABLE config (
+		key text PRIMARY KEY,
+		value blob NOT NULL
+	);
+	CREATE TABLE settings (
+		key text PRIMARY KEY,
+		value text NOT NULL
+	);
+	CREATE TABLE competition (
+		id integer PRIMARY KEY CHECK (id = 1),
+		last_modified timestamp NOT NULL,
+		competition text NOT NULL
+	);
+	CREATE TABLE revisions (
+		id integer PRIMARY KEY,
+		last_modified timestamp NOT NULL,
+		competition text NOT NULL
+	);
+	CREATE VIEW rounds AS
+		SELECT CAST(r.key AS integer) AS position,
+			json_extract(c.competition, '$.round_ids[' || r.key || ']') AS id,
+			r.value AS name
+		FROM competition c, json_each(c.competition, '$.rounds') r;
+	CREATE VIEW teams AS
+		SELECT CAST(t.key AS integer) AS position,
+			json_extract(t.value, '$.id') AS id,
+			json_extract(t.value, '$.name') AS name
+		FROM competition c, json_each(c.competition, '$.teams') t;
+	CREATE VIEW scores AS
+		SELECT CAST(t.key AS integer) AS team_position,
+			json_extract(t.value, '$.id') AS team_id,
+			json_extract(t.value, '$.name') AS team,
+			CAST(s.key AS integer) AS round_position,
+			json_extract(c.competition, '$.round_ids[' || s.key || ']') AS round_id,
+			json_extract(c.competition, '$.rounds[' || s.key || ']') AS round,
+			json_extract(s.value, '$.state') AS state,
+			json_extract(s.value, '$.value') AS value
+		FROM competition c, json_each(c.competition, '$.teams') t, json_each(t.value, '$.scores') s;`,
+	`CREATE TABLE audit (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		time timestamp NOT NULL,
+		entry text NOT NULL
+	);`,
+	`CREATE TABLE score_events (
+		seq integer PRIMARY KEY AUTOINCREMENT,
+		time timestamp NOT NULL,
+		event text NOT NULL
+	);`,
+}
+
+type sqliteDB struct {
+	*sql.DB
+}
+
+//New returns a new DB with the given file path, migrating the schema to the latest version
+func New(path string) (db.DB, error) {
+	//WAL lets other tools read the file while the server writes to it
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't open database"}
+	}
+
+	//a single connection serializes transactions so competition writes can't interleave
+	conn.SetMaxOpenConns(1)
+
+	d := &sqliteDB{DB: conn}
+	if err = d.migrate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+//transact runs fn in a transaction, committing if fn returns nil and rolling back otherwise
+func (d *sqliteDB) transact(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return &db.Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		if err != nil {
+			if lErr := tx.Rollback(); lErr != nil {
+				err = &db.Error{Err: lErr, Description: fmt.Sprintf("Couldn't rollback transaction; error causing rollback: %s", err)}
+			}
+			return
+		}
+		if lErr := tx.Commit(); lErr != nil {
+			err = &db.Error{Err: lErr, Description: "Couldn't commit transaction"}
+		}
+	}()
+
+	return fn(tx)
+}
+
+//migrate applies the migrations newer than the database's schema version
+func (d *sqliteDB) migrate() error {
+	return d.transact(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version integer NOT NULL)"); err != nil {
+			return &db.Error{Err: err, Description: "Couldn't create schema_migrations table"}
+		}
+
+		var version int
+		if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+			return &db.Error{Err: err, Description: "Couldn't read schema version"}
+		}
+
+		if version > len(migrations) {
+			return &db.Error{Err: nil, Description: fmt.Sprintf("Database schema version(%d) is newer than this version supports(%d)", version, len(migrations))}
+		}
+
+		for i := version; i < len(migrations); i++ {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't migrate schema to version %d", i+1)}
+			}
+			if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1); err != nil {
+				return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write schema version %d", i+1)}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (d *sqliteDB) Init(name string, rounds int, teams []string, username, password string) error {
+	if username != "" {
+		if err := d.UpdateCredentials(username, password); err != nil {
+			return &db.Error{Err: err, Description: "Couldn't update credentials"}
+		}
+	}
+
+	if err := d.Write(db.NewCompetition(name, rounds, teams)); err != nil {
+		return &db.Error{Err: err, Description: "Couldn't write competition to database"}
+	}
+
+	if err := d.SetState(db.StateSetup); err != nil {
+		return &db.Error{Err: err, Description: "Couldn't set competition state"}
+	}
+
+	return nil
+}
+
+//config returns the config value with the given key, or nil if it doesn't exist
+func (d *sqliteDB) config(key string) ([]byte, error) {
+	var value []byte
+	err := d.QueryRow("SELECT value FROM config WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read config.%s", key)}
+	}
+	return value, nil
+}
+
+func setConfig(tx *sql.Tx, key string, value []byte) error {
+	if _, err := tx.Exec("INSERT INTO config (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value); err != nil {
+		return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write config.%s", key)}
+	}
+	return nil
+}
+
+func (d *sqliteDB) HasCredentials() (bool, error) {
+	var n int
+	if err := d.QueryRow("SELECT COUNT(*) FROM config WHERE key IN ('username', 'hash')").Scan(&n); err != nil {
+		return false, &db.Error{Err: err, Description: "Couldn't read credentials"}
+	}
+	return n == 2, nil
+}
+
+//Authenticate checks the credentials and rehashes the password if it was hashed with different PasswordOptions
+func (d *sqliteDB) Authenticate(username, password string) (bool, error) {
+	stored, err := d.config("username")
+	if err != nil {
+		return false, err
+	}
+	if stored == nil || string(stored) != username {
+		return false, nil
+	}
+
+	hash, err := d.config("hash")
+	if err != nil {
+		return false, err
+	}
+	if !db.CheckPassword(hash, password) {
+		return false, nil
+	}
+
+	if db.NeedsRehash(hash) {
+		//the old hash is still valid, so a failed rehash is retried at the next login
+		if err := d.UpdateCredentialsAs(username, username, password); err != nil {
+			return true, &db.Error{Err: err, Description: "Couldn't rehash password"}
+		}
+	}
+
+	return true, nil
+}
+
+func (d *sqliteDB) UpdateCredentials(username, password string) error {
+	return d.UpdateCredentialsAs("", username, password)
+}
+
+//UpdateCredentialsAs stores the credentials and an audit entry
+func (d *sqliteDB) UpdateCredentialsAs(actor, username, password string) error {
+	hash, err := db.HashPassword(password)
+	if err != nil {
+		return &db.Error{Err: err, Description: "Couldn't hash password"}
+	}
+
+	return d.transact(func(tx *sql.Tx) error {
+		var old []byte
+		err := tx.QueryRow("SELECT value FROM config WHERE key = 'username'").Scan(&old)
+		if err != nil && err != sql.ErrNoRows {
+			return &db.Error{Err: err, Description: "Couldn't read config.username"}
+		}
+
+		if err = setConfig(tx, "username", []byte(username)); err != nil {
+			return err
+		}
+		if err = setConfig(tx, "hash", hash); err != nil {
+			return err
+		}
+		return audit(tx, db.NewCredentialsAudit(actor, string(old), username))
+	})
+}
+
+func (d *sqliteDB) WalkRevisions(fn func(*db.Revision) error) error {
+	start := int32(0)
+	for {
+		rows, err := d.Query("SELECT id, last_modified FROM revisions WHERE id >= ? ORDER BY id LIMIT ?", start, revisionBatch)
+		if err != nil {
+			return &db.Error{Err: err, Description: "Couldn't read revisions"}
+		}
+
+		var revisions []*db.Revision
+		for rows.Next() {
+			r := new(db.Revision)
+			if err = rows.Scan(&r.ID, &r.Timestamp); err != nil {
+				rows.Close()
+				return &db.Error{Err: err, Description: "Couldn't decode revision"}
+			}
+			revisions = append(revisions, r)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return &db.Error{Err: err, Description: "Couldn't read revisions"}
+		}
+
+		for _, r := range revisions {
+			if err = fn(r); err != nil {
+				return err
+			}
+		}
+
+		if len(revisions) < revisionBatch {
+			return nil
+		}
+		start = revisions[len(revisions)-1].ID + 1
+	}
+}
+
+func (d *sqliteDB) Revisions() ([]*db.Revision, error) {
+	var revisions []*db.Revision
+	err := d.WalkRevisions(func(r *db.Revision) error {
+		revisions = append(revisions, r)
+		return nil
+	})
+	return revisions, err
+}
+
+//decode decodes a competition stored as JSON
+func decode(buf []byte) (*db.Competition, error) {
+	c := new(db.Competition)
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't decode competition"}
+	}
+	for _, t := range c.Teams {
+		if len(t.Scores) != len(c.Rounds) {
+			return nil, &db.Error{Err: nil, Description: fmt.Sprintf("Team(%s) Rounds(%d) doesn't match Competition Rounds(%d)", t.Name, len(t.Scores), len(c.Rounds))}
+		}
+	}
+	return c, nil
+}
+
+//encode prepares c and encodes it as JSON text, which SQLite's JSON functions require
+func encode(c *db.Competition) (string, error) {
+	if err := c.Prepare(); err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", &db.Error{Err: err, Description: fmt.Sprintf("Couldn't encode Competition(%s)", c.Name)}
+	}
+	return string(buf), nil
+}
+
+func (d *sqliteDB) ReadRevision(id int32) (*db.Revision, error) {
+	r := &db.Revision{ID: id}
+	var buf []byte
+	err := d.QueryRow("SELECT last_modified, competition FROM revisions WHERE id = ?", id).Scan(&r.Timestamp, &buf)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read Revision(%d)", id)}
+	}
+
+	if r.Competition, err = decode(buf); err != nil {
+		return nil, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read Revision(%d) Competition", id)}
+	}
+
+	return r, nil
+}
+
+func (d *sqliteDB) Read() (*db.Competition, error) {
+	var buf []byte
+	err := d.QueryRow("SELECT competition FROM competition WHERE id = 1").Scan(&buf)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read competition"}
+	}
+	return decode(buf)
+}
+
+//version returns the stored competition's Version and whether or not there is a stored competition.
+//A competition that isn't valid JSON has Version 0 so it can be replaced by db.CheckConsistency
+func version(tx *sql.Tx) (int32, bool, error) {
+	var v int32
+	err := tx.QueryRow("SELECT CASE WHEN json_valid(competition) THEN COALESCE(json_extract(competition, '$.version'), 0) ELSE 0 END FROM competition WHERE id = 1").Scan(&v)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, &db.Error{Err: err, Description: "Couldn't read competition version"}
+	}
+	return v, true, nil
+}
+
+func (d *sqliteDB) Write(c *db.Competition) error {
+	return d.WriteAs("", c)
+}
+
+//WriteAs stores the current competition as a revision, replaces it with c, and stores an audit entry
+func (d *sqliteDB) WriteAs(actor string, c *db.Competition) error {
+	return d.transact(func(tx *sql.Tx) error {
+		v, ok, err := version(tx)
+		if err != nil {
+			return err
+		}
+
+		var buf string
+		if c != nil {
+			if ok && c.Version != v {
+				return db.ErrStaleVersion
+			}
+
+			c.Version = v + 1
+			if buf, err = encode(c); err != nil {
+				return err
+			}
+		}
+
+		if err = auditWrite(tx, db.NewWriteAudit, actor, c); err != nil {
+			return err
+		}
+
+		return replace(tx, c, buf)
+	})
+}
+
+//audit appends e to the audit table
+func audit(tx *sql.Tx, e *db.AuditEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return &db.Error{Err: err, Description: "Couldn't encode AuditEntry"}
+	}
+
+	if _, err = tx.Exec("INSERT INTO audit (time, entry) VALUES (?, ?)", e.Time, string(buf)); err != nil {
+		return &db.Error{Err: err, Description: "Couldn't write AuditEntry"}
+	}
+	return nil
+}
+
+//auditWrite appends the AuditEntry returned by newAudit for actor replacing the stored competition with c, and must be called after c is encoded.
+//A stored competition that can't be decoded is replaced like any other, so it's audited as empty
+func auditWrite(tx *sql.Tx, newAudit func(actor string, old, c *db.Competition) *db.AuditEntry, actor string, c *db.Competition) error {
+	var buf []byte
+	err := tx.QueryRow("SELECT competition FROM competition WHERE id = 1").Scan(&buf)
+	if err != nil && err != sql.ErrNoRows {
+		return &db.Error{Err: err, Description: "Couldn't read competition"}
+	}
+
+	var old *db.Competition
+	if err == nil {
+		old, _ = decode(buf)
+	}
+
+	e := newAudit(actor, old, c)
+	if err = audit(tx, e); err != nil {
+		return err
+	}
+	return scoreEvents(tx, e.ScoreEvents())
+}
+
+//scoreEvents appends events to the score_events table
+func scoreEvents(tx *sql.Tx, events []*db.ScoreEvent) error {
+	for _, e := range events {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return &db.Error{Err: err, Description: "Couldn't encode ScoreEvent"}
+		}
+
+		if _, err = tx.Exec("INSERT INTO score_events (time, event) VALUES (?, ?)", e.Time, string(buf)); err != nil {
+			return &db.Error{Err: err, Description: "Couldn't write ScoreEvent"}
+		}
+	}
+	return nil
+}
+
+//replace stores the current competition as a revision and replaces it with c, encoded in buf
+func replace(tx *sql.Tx, c *db.Competition, buf string) error {
+	_, err := tx.Exec(`INSERT INTO revisions (id, last_modified, competition)
+		SELECT (SELECT COALESCE(MAX(id), -1) + 1 FROM revisions), last_modified, competition FROM competition WHERE id = 1`)
+	if err != nil {
+		return &db.Error{Err: err, Description: "Couldn't write Revision"}
+	}
+
+	if _, err = prune(tx); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM competition"); err != nil {
+		return &db.Error{Err: err, Description: "Couldn't clear competition"}
+	}
+
+	if c == nil {
+		return nil
+	}
+
+	if _, err = tx.Exec("INSERT INTO competition (id, last_modified, competition) VALUES (1, ?, ?)", time.Now(), buf); err != nil {
+		return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s)", c.Name)}
+	}
+	return nil
+}
+
+//prune removes the revisions outside the db.RetentionPolicy, oldest first and always keeping the latest revision,
+//and returns how many were removed
+func prune(tx *sql.Tx) (int, error) {
+	p := db.CurrentRetentionPolicy()
+	var removed int64
+
+	if p.MaxRevisions > 0 {
+		res, err := tx.Exec("DELETE FROM revisions WHERE id <= (SELECT MAX(id) FROM revisions) - ?", p.MaxRevisions)
+		if err != nil {
+			return 0, &db.Error{Err: err, Description: "Couldn't prune revisions"}
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+
+	if p.MaxAge > 0 {
+		res, err := tx.Exec("DELETE FROM revisions WHERE last_modified < ? AND id < (SELECT MAX(id) FROM revisions)", time.Now().Add(-p.MaxAge))
+		if err != nil {
+			return 0, &db.Error{Err: err, Description: "Couldn't prune revisions"}
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+
+	return int(removed), nil
+}
+
+//PruneRevisions removes the revisions outside the db.RetentionPolicy
+func (d *sqliteDB) PruneRevisions() (int, error) {
+	var n int
+	err := d.transact(func(tx *sql.Tx) error {
+		var err error
+		n, err = prune(tx)
+		return err
+	})
+	return n, err
+}
+
+//DiffRevisions returns the difference between the revisions with ids a and b
+func (d *sqliteDB) DiffRevisions(a, b int32) (*db.RevisionDiff, error) {
+	return db.CompareRevisions(d, a, b)
+}
+
+func (d *sqliteDB) RestoreRevision(id int32) (*db.Competition, error) {
+	return d.RestoreRevisionAs("", id)
+}
+
+//RestoreRevisionAs stores the current competition as a revision and replaces it with the revision with the given id
+func (d *sqliteDB) RestoreRevisionAs(actor string, id int32) (*db.Competition, error) {
+	var c *db.Competition
+	err := d.transact(func(tx *sql.Tx) error {
+		var rev []byte
+		err := tx.QueryRow("SELECT competition FROM revisions WHERE id = ?", id).Scan(&rev)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read Revision(%d)", id)}
+		}
+
+		restored, err := decode(rev)
+		if err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read Revision(%d) Competition", id)}
+		}
+
+		v, _, err := version(tx)
+		if err != nil {
+			return err
+		}
+
+		restored.Version = v + 1
+		buf, err := encode(restored)
+		if err != nil {
+			return err
+		}
+
+		if err = auditWrite(tx, db.NewWriteAudit, actor, restored); err != nil {
+			return err
+		}
+
+		if err = replace(tx, restored, buf); err != nil {
+			return err
+		}
+
+		c = restored
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *sqliteDB) WriteScore(team, round int, score db.Score) error {
+	return d.WriteScoreAs("", team, round, score)
+}
+
+//WriteScoreAs replaces the competition with one with the score set and stores an audit entry, without storing a revision
+func (d *sqliteDB) WriteScoreAs(actor string, team, round int, score db.Score) error {
+	return d.transact(func(tx *sql.Tx) error {
+		var buf []byte
+		err := tx.QueryRow("SELECT competition FROM competition WHERE id = 1").Scan(&buf)
+		if err == sql.ErrNoRows {
+			return &db.Error{Err: nil, Description: "Competition doesn't exist"}
+		}
+		if err != nil {
+			return &db.Error{Err: err, Description: "Couldn't read competition"}
+		}
+
+		c, err := decode(buf)
+		if err != nil {
+			return err
+		}
+
+		old := c.Copy()
+		if _, err = c.SetScore(team, round, score); err != nil {
+			return err
+		}
+		c.Version++
+
+		enc, err := encode(c)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec("UPDATE competition SET last_modified = ?, competition = ? WHERE id = 1", time.Now(), enc); err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s)", c.Name)}
+		}
+
+		e := db.NewWriteAudit(actor, old, c)
+		if err = audit(tx, e); err != nil {
+			return err
+		}
+		return scoreEvents(tx, e.ScoreEvents())
+	})
+}
+
+func (d *sqliteDB) Restore(c *db.Competition, revisions []*db.Revision) error {
+	return d.RestoreAs("", c, revisions)
+}
+
+//RestoreAs replaces the competition and revisions, renumbering revisions from 0, and stores an audit entry
+func (d *sqliteDB) RestoreAs(actor string, c *db.Competition, revisions []*db.Revision) error {
+	bufs := make([]string, len(revisions))
+	for i, rev := range revisions {
+		if rev.Competition == nil {
+			return &db.Error{Err: nil, Description: fmt.Sprintf("Revision(%d) Competition was nil", i)}
+		}
+		var err error
+		if bufs[i], err = encode(rev.Competition); err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d)", i)}
+		}
+	}
+
+	return d.transact(func(tx *sql.Tx) error {
+		var buf string
+		if c != nil {
+			v, _, err := version(tx)
+			if err != nil {
+				return err
+			}
+
+			c.Version = v + 1
+			if buf, err = encode(c); err != nil {
+				return err
+			}
+		}
+
+		if err := auditWrite(tx, db.NewRestoreAudit, actor, c); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"competition", "revisions"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't clear %s", table)}
+			}
+		}
+
+		for i, rev := range revisions {
+			if _, err := tx.Exec("INSERT INTO revisions (id, last_modified, competition) VALUES (?, ?, ?)", i, rev.Timestamp, bufs[i]); err != nil {
+				return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Revision(%d)", i)}
+			}
+		}
+
+		if c == nil {
+			return nil
+		}
+
+		if _, err := tx.Exec("INSERT INTO competition (id, last_modified, competition) VALUES (1, ?, ?)", time.Now(), buf); err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Competition(%s)", c.Name)}
+		}
+		return nil
+	})
+}
+
+func (d *sqliteDB) State() (db.State, error) {
+	s, err := d.config("state")
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return db.StateSetup, nil
+	}
+	return db.State(s), nil
+}
+
+func (d *sqliteDB) SetState(s db.State) error {
+	if !s.Valid() {
+		return &db.Error{Err: nil, Description: fmt.Sprintf("Unknown State(%s)", s)}
+	}
+	return d.transact(func(tx *sql.Tx) error {
+		return setConfig(tx, "state", []byte(s))
+	})
+}
+
+func (d *sqliteDB) ReadSetting(key string, v interface{}) (bool, error) {
+	var buf []byte
+	err := d.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&buf)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't read Setting(%s)", key)}
+	}
+
+	if err = json.Unmarshal(buf, v); err != nil {
+		return false, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't decode Setting(%s)", key)}
+	}
+	return true, nil
+}
+
+func (d *sqliteDB) WriteSetting(key string, v interface{}) error {
+	if v == nil {
+		if _, err := d.Exec("DELETE FROM settings WHERE key = ?", key); err != nil {
+			return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't delete Setting(%s)", key)}
+		}
+		return nil
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't encode Setting(%s)", key)}
+	}
+
+	if _, err = d.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, string(buf)); err != nil {
+		return &db.Error{Err: err, Description: fmt.Sprintf("Couldn't write Setting(%s)", key)}
+	}
+	return nil
+}
+
+func (d *sqliteDB) Settings() (map[string]json.RawMessage, error) {
+	rows, err := d.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read Settings"}
+	}
+	defer rows.Close()
+
+	settings := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var (
+			key string
+			buf []byte
+		)
+		if err = rows.Scan(&key, &buf); err != nil {
+			return nil, &db.Error{Err: err, Description: "Couldn't read Settings"}
+		}
+		settings[key] = json.RawMessage(buf)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read Settings"}
+	}
+	return settings, nil
+}
+
+func (d *sqliteDB) AuditEntries(since time.Time) ([]*db.AuditEntry, error) {
+	//times are stored as text, so they're compared after decoding
+	rows, err := d.Query("SELECT id, entry FROM audit ORDER BY id")
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read AuditEntries"}
+	}
+	defer rows.Close()
+
+	entries := make([]*db.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			id  uint64
+			buf []byte
+		)
+		if err = rows.Scan(&id, &buf); err != nil {
+			return nil, &db.Error{Err: err, Description: "Couldn't read AuditEntries"}
+		}
+
+		e := new(db.AuditEntry)
+		if err = json.Unmarshal(buf, e); err != nil {
+			return nil, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't decode AuditEntry(%d)", id)}
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		e.ID = id
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read AuditEntries"}
+	}
+	return entries, nil
+}
+
+func (d *sqliteDB) Events(fromSeq uint64) ([]*db.ScoreEvent, error) {
+	rows, err := d.Query("SELECT seq, event FROM score_events WHERE seq >= ? ORDER BY seq", int64(fromSeq))
+	if err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read ScoreEvents"}
+	}
+	defer rows.Close()
+
+	events := make([]*db.ScoreEvent, 0)
+	for rows.Next() {
+		var (
+			seq uint64
+			buf []byte
+		)
+		if err = rows.Scan(&seq, &buf); err != nil {
+			return nil, &db.Error{Err: err, Description: "Couldn't read ScoreEvents"}
+		}
+
+		e := new(db.ScoreEvent)
+		if err = json.Unmarshal(buf, e); err != nil {
+			return nil, &db.Error{Err: err, Description: fmt.Sprintf("Couldn't decode ScoreEvent(%d)", seq)}
+		}
+		e.Seq = seq
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &db.Error{Err: err, Description: "Couldn't read ScoreEvents"}
+	}
+	return events, nil
+}
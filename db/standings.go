@@ -0,0 +1,60 @@
+package db
+
+import "sort"
+
+//Standing represents a team's position in a competition
+type Standing struct {
+	Rank  int    `json:"rank"`
+	Team  int    `json:"team"`
+	Name  string `json:"name"`
+	Total int32  `json:"total"`
+}
+
+//Total returns the sum of the team's scores. Unscored rounds and no-shows are ignored
+func (t *Team) Total() int32 {
+	var total int32
+	for _, s := range t.Scores {
+		total += s.Points()
+	}
+	return total
+}
+
+//Standings returns the teams ordered by total score, highest first, using the Scorer set with SetScorer.
+//Each team's handicap is added to the total the Scorer computes. Teams with the same total are ordered by the Scorer's tiebreak, and share a rank if still tied
+func (c *Competition) Standings() []*Standing {
+	sc := activeScorer()
+
+	standings := make([]*Standing, 0, len(c.Teams))
+	for i, t := range c.Teams {
+		standings = append(standings, &Standing{Team: i, Name: t.Name, Total: sc.Total(c, i) + t.Handicap.Points()})
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Total != standings[j].Total {
+			return standings[i].Total > standings[j].Total
+		}
+		return sc.Tiebreak(c, standings[i].Team, standings[j].Team) > 0
+	})
+
+	for i, s := range standings {
+		if i > 0 && s.Total == standings[i-1].Total && sc.Tiebreak(c, s.Team, standings[i-1].Team) == 0 {
+			s.Rank = standings[i-1].Rank
+		} else {
+			s.Rank = i + 1
+		}
+	}
+
+	return standings
+}
+
+//Leader returns the Standing of the team in sole possession of first place with a non-zero total,
+//or nil if there isn't one
+func Leader(standings []*Standing) *Standing {
+	if len(standings) == 0 || standings[0].Total == 0 {
+		return nil
+	}
+	if len(standings) > 1 && standings[1].Rank == standings[0].Rank {
+		return nil
+	}
+	return standings[0]
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//storageRetry is how long a write is retried while storage is full or read-only before its error is returned
+const storageRetry = 10 * time.Second
+
+//storageRetryInterval is how long to wait between retries
+const storageRetryInterval = 500 * time.Millisecond
+
+//StorageAlert describes a storage failure that is stopping writes.
+//Path is the database file and Since is when writes started failing
+type StorageAlert struct {
+	Path  string    `json:"path"`
+	Error string    `json:"error"`
+	Since time.Time `json:"since"`
+}
+
+//Storage is implemented by a DB stored in a local file
+type Storage interface {
+	//Path returns the path of the database file
+	Path() string
+
+	//StorageAlert returns the current storage failure, or nil if writes are succeeding
+	StorageAlert() *StorageAlert
+
+	//Relocate copies the database to the file at path and switches to it without stopping, or returns an error if one occurred.
+	//Writes wait until the copy is finished. The old file is left in place
+	Relocate(path string) error
+
+	//Backup writes a consistent copy of the database file to w or returns an error if one occurred.
+	//Writes aren't blocked while the copy is written
+	Backup(w io.Writer) error
+
+	//RestoreBackup replaces the database file with the backup read from r or returns an error if one occurred.
+	//The backup is checked before it replaces the database, and the database is unchanged if it's invalid
+	RestoreBackup(r io.Reader) error
+}
+
+//ErrInvalidBackup is the cause of the error returned by RestoreBackup if the backup is empty, corrupt, or can't be read
+var ErrInvalidBackup = errors.New("invalid backup")
+
+//IsStorageError returns whether or not err was caused by a full disk or read-only filesystem
+func IsStorageError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EROFS) {
+		return true
+	}
+
+	//some bolt errors are formatted without wrapping the cause
+	msg := err.Error()
+	return strings.Contains(msg, syscall.ENOSPC.Error()) || strings.Contains(msg, syscall.EROFS.Error())
+}
+
+//Begin starts a transaction on the current database file
+func (db *boltDB) Begin(writable bool) (*bolt.Tx, error) {
+	db.fileMu.RLock()
+	defer db.fileMu.RUnlock()
+	return db.DB.Begin(writable)
+}
+
+//Path returns the path of the current database file
+func (db *boltDB) Path() string {
+	db.fileMu.RLock()
+	defer db.fileMu.RUnlock()
+	return db.DB.Path()
+}
+
+//StorageAlert returns the current storage failure, or nil if writes are succeeding
+func (db *boltDB) StorageAlert() *StorageAlert {
+	db.alertMu.Lock()
+	defer db.alertMu.Unlock()
+	if db.alert == nil {
+		return nil
+	}
+	a := *db.alert
+	return &a
+}
+
+func (db *boltDB) setAlert(err error) {
+	db.alertMu.Lock()
+	defer db.alertMu.Unlock()
+	if err == nil {
+		db.alert = nil
+		return
+	}
+	if db.alert == nil {
+		db.alert = &StorageAlert{Since: time.Now()}
+	}
+	db.alert.Path, db.alert.Error = db.Path(), err.Error()
+}
+
+//retry calls fn until it returns nil or an error that isn't a storage error, or storageRetry has passed.
+//Writes made while retrying wait behind fn, so they're queued until storage recovers or the database is relocated
+func (db *boltDB) retry(fn func() error) error {
+	deadline := time.Now().Add(storageRetry)
+	for {
+		err := fn()
+		if !IsStorageError(err) {
+			if err == nil {
+				db.setAlert(nil)
+			}
+			return err
+		}
+
+		db.setAlert(err)
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(storageRetryInterval)
+	}
+}
+
+//Relocate copies the database to path while holding the write lock, then switches to the copy and closes the old file
+func (db *boltDB) Relocate(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't resolve path(%s)", path)}
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		return &Error{Err: nil, Description: fmt.Sprintf("File(%s) already exists", path)}
+	} else if !os.IsNotExist(err) {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't check File(%s)", path)}
+	}
+
+	//new transactions wait until the database is relocated
+	db.fileMu.Lock()
+	old := db.DB
+
+	//a write transaction waits for the current writer and keeps the copy from missing a commit
+	tx, err := old.Begin(true)
+	if err != nil {
+		db.fileMu.Unlock()
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+
+	err = tx.CopyFile(path, 0644)
+	tx.Rollback()
+	if err != nil {
+		db.fileMu.Unlock()
+		os.Remove(path)
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't copy database to File(%s)", path)}
+	}
+
+	relocated, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		db.fileMu.Unlock()
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't open File(%s)", path)}
+	}
+
+	//the copy is encrypted with the same key
+	if aead := lookupAEAD(old); aead != nil {
+		ciphers.Store(relocated, aead)
+	}
+
+	db.DB = relocated
+	db.fileMu.Unlock()
+
+	db.setAlert(nil)
+
+	//Close waits for open read transactions on the old file, which may still be decrypting values
+	err = old.Close()
+	ciphers.Delete(old)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't close old database file"}
+	}
+
+	return nil
+}
+
+//Backup writes the database file as of a single read transaction to w
+func (db *boltDB) Backup(w io.Writer) (err error) {
+	tx, err := db.Begin(false)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+	defer func() {
+		lErr := tx.Rollback()
+		if err == nil && lErr != nil {
+			err = &Error{Err: lErr, Description: "Couldn't end transaction"}
+		}
+	}()
+
+	if _, err = tx.WriteTo(w); err != nil {
+		return &Error{Err: err, Description: "Couldn't write backup"}
+	}
+
+	return nil
+}
+
+//RestoreBackup writes r to a file next to the database, checks it, then renames it over the database file and switches to it
+func (db *boltDB) RestoreBackup(r io.Reader) error {
+	path := db.Path()
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".restore-")
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't create temporary file"}
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't write backup"}
+	}
+
+	//bolt would initialize an empty file as a new database
+	if n == 0 {
+		return &Error{Err: ErrInvalidBackup, Description: "Backup is empty"}
+	}
+
+	db.fileMu.RLock()
+	aead := lookupAEAD(db.DB)
+	db.fileMu.RUnlock()
+
+	if err = checkBackup(tmp, aead); err != nil {
+		return err
+	}
+
+	//snapshots and new transactions wait until the database is replaced
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.fileMu.Lock()
+	old := db.DB
+
+	//holding a write transaction keeps writers that already started from committing to the replaced file
+	tx, err := old.Begin(true)
+	if err != nil {
+		db.fileMu.Unlock()
+		return &Error{Err: err, Description: "Couldn't start transaction"}
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		tx.Rollback()
+		db.fileMu.Unlock()
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't replace File(%s)", path)}
+	}
+
+	restored, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	tx.Rollback()
+	if err != nil {
+		db.fileMu.Unlock()
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't open File(%s)", path)}
+	}
+
+	if aead := lookupAEAD(old); aead != nil {
+		ciphers.Store(restored, aead)
+	}
+
+	db.DB = restored
+	db.snapshot.Store((*snapshot)(nil))
+	db.fileMu.Unlock()
+
+	//Close waits for open read transactions, which may still be decrypting values
+	err = old.Close()
+	ciphers.Delete(old)
+	if err != nil {
+		return &Error{Err: err, Description: "Couldn't close old database file"}
+	}
+
+	return nil
+}
+
+//checkBackup checks the consistency of the database file at path, that it's encrypted with aead (or not encrypted if aead is nil), and that its competition can be read.
+//The backup's schema is upgraded if it was written by an earlier version
+func checkBackup(path string, aead cipher.AEAD) error {
+	b, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Couldn't open backup: %v", err)}
+	}
+	defer b.Close()
+
+	err = b.View(func(tx *bolt.Tx) error {
+		//the channel must be drained so the check can finish
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = err
+			}
+		}
+		return checkErr
+	})
+	if err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Backup is corrupt: %v", err)}
+	}
+
+	if err = b.View(func(tx *bolt.Tx) error { return checkEncryption(tx, aead) }); err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Backup encryption doesn't match the database: %v", err)}
+	}
+	if aead != nil {
+		ciphers.Store(b, aead)
+		defer ciphers.Delete(b)
+	}
+
+	//a backup from an earlier version is upgraded before it replaces the database
+	if err = migrateSchema(b); err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Couldn't migrate backup schema: %v", err)}
+	}
+
+	backup := &boltDB{DB: b}
+	if _, err = backup.read(); err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Couldn't read backup competition: %v", err)}
+	}
+
+	if _, err = backup.State(); err != nil {
+		return &Error{Err: ErrInvalidBackup, Description: fmt.Sprintf("Couldn't read backup state: %v", err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//NormalizeTags returns tags with surrounding space trimmed and empty tags and duplicates, ignoring case, removed.
+//NormalizeTags returns nil if there are no tags
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+//HasTags returns whether or not t has every one of tags, ignoring case
+func (t *Team) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, tt := range t.Tags {
+			if strings.EqualFold(tt, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//WithTags returns a copy of c with only the teams that have every one of tags
+func (c *Competition) WithTags(tags ...string) *Competition {
+	cp := c.Copy()
+	teams := cp.Teams[:0]
+	for _, t := range cp.Teams {
+		if t.HasTags(tags...) {
+			teams = append(teams, t)
+		}
+	}
+	cp.Teams = teams
+	return cp
+}
+
+//TagCount is a tag and the number of teams that have it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Teams int    `json:"teams"`
+}
+
+//Tags returns the tags of the teams in c, sorted ignoring case. Tags that differ only by case are counted together
+func (c *Competition) Tags() []*TagCount {
+	counts := make(map[string]*TagCount)
+	tags := make([]*TagCount, 0)
+	for _, t := range c.Teams {
+		for _, tag := range t.Tags {
+			tc, ok := counts[strings.ToLower(tag)]
+			if !ok {
+				tc = &TagCount{Tag: tag}
+				counts[strings.ToLower(tag)] = tc
+				tags = append(tags, tc)
+			}
+			tc.Teams++
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Tag) < strings.ToLower(tags[j].Tag) })
+	return tags
+}
+
+//readTags reads a team's tags from b
+func readTags(b *bucket, t *Team) error {
+	buf := get(b, []byte("tags"))
+	if buf == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &t.Tags); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't decode Team(%s) tags", t.Name)}
+	}
+	return nil
+}
+
+//writeTags writes a team's tags to b if it has any
+func writeTags(b *bucket, t *Team) error {
+	if len(t.Tags) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(t.Tags)
+	if err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't encode Team(%s) tags", t.Name)}
+	}
+	if err = put(b, []byte("tags"), buf); err != nil {
+		return &Error{Err: err, Description: fmt.Sprintf("Couldn't write Team(%s) tags", t.Name)}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//verification collects the problems found by Verify
+type verification struct {
+	problems []string
+}
+
+func (v *verification) problem(format string, a ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, a...))
+}
+
+//countKeys returns the number of keys, including nested buckets, directly in b
+func countKeys(b *bucket) int {
+	n := 0
+	b.ForEach(func(k, val []byte) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+//Verify checks the integrity of the database at path without changing it, returning a description of each problem found.
+//The file's pages are checked, then every bucket is walked checking that round and team counts match the stored rounds and teams,
+//that every team has a score for each round, and that revisions, settings, audit entries, and score events can be decoded.
+//key is the encryption key of an encrypted database, or nil. An error is returned if the database can't be opened or decrypted
+func Verify(path string, key []byte) (problems []string, err error) {
+	b, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, &Error{Err: err, Description: "Couldn't open database"}
+	}
+	defer b.Close()
+
+	if key != nil {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, &Error{Err: err, Description: "Couldn't create cipher"}
+		}
+		resealed := false
+		err = b.View(func(tx *bolt.Tx) error {
+			resealed = tx.Bucket(encryptionBucket) != nil && tx.Bucket(encryptionBucket).Get(encryptionPaths) != nil
+			return checkEncryption(tx, aead)
+		})
+		if err != nil {
+			return nil, err
+		}
+		//values can only be checked once they're authenticated with their path
+		if !resealed {
+			return []string{"Encryption: values haven't been resealed with their bucket paths; opening the database reseals them"}, nil
+		}
+		ciphers.Store(b, aead)
+		defer ciphers.Delete(b)
+	} else if err = b.View(func(tx *bolt.Tx) error { return checkEncryption(tx, nil) }); err != nil {
+		return nil, err
+	}
+
+	v := new(verification)
+	err = b.View(func(tx *bolt.Tx) error {
+		//the channel must be drained so the check can finish
+		for err := range tx.Check() {
+			v.problem("File: %v", err)
+		}
+
+		v.verifyConfig(tx)
+
+		if competitionBucket := txBucket(tx, []byte("competition")); competitionBucket != nil {
+			v.verifyCompetition("Competition", competitionBucket)
+		}
+
+		v.verifyRevisions(tx)
+
+		if settingsBucket := txBucket(tx, []byte("settings")); settingsBucket != nil {
+			settingsBucket.ForEach(func(k, val []byte) error {
+				if !json.Valid(decrypt(settingsBucket, k, val)) {
+					v.problem("Setting(%s): value isn't valid JSON", k)
+				}
+				return nil
+			})
+		}
+
+		if auditBucket := txBucket(tx, []byte("audit")); auditBucket != nil {
+			auditBucket.ForEach(func(k, val []byte) error {
+				if err := json.Unmarshal(decrypt(auditBucket, k, val), new(AuditEntry)); err != nil {
+					v.problem("AuditEntry(%x): %v", k, err)
+				}
+				return nil
+			})
+		}
+
+		if eventsBucket := txBucket(tx, []byte("score_events")); eventsBucket != nil {
+			eventsBucket.ForEach(func(k, val []byte) error {
+				if err := json.Unmarshal(decrypt(eventsBucket, k, val), new(ScoreEvent)); err != nil {
+					v.problem("ScoreEvent(%x): %v", k, err)
+				}
+				return nil
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.problems, nil
+}
+
+//verifyConfig checks the database config bucket
+func (v *verification) verifyConfig(tx *bolt.Tx) {
+	version, err := readSchemaVersion(tx)
+	if err != nil {
+		v.problem("Database: %v", err)
+	} else if err = checkSchemaVersion(version); err != nil {
+		v.problem("Database: %v", err)
+	}
+
+	configBucket := txBucket(tx, []byte("config"))
+	if configBucket == nil {
+		if txBucket(tx, []byte("competition")) != nil {
+			v.problem("Database: config Bucket is missing")
+		}
+		return
+	}
+
+	if state := get(configBucket, []byte("state")); state != nil {
+		if !State(state).Valid() {
+			v.problem("Database: config.state(%s) isn't a known state", state)
+		}
+	}
+}
+
+//verifyRevisions checks that every revision is readable and that config.current_revision is the latest revision
+func (v *verification) verifyRevisions(tx *bolt.Tx) {
+	revisionsBucket := txBucket(tx, []byte("revisions"))
+	if revisionsBucket == nil {
+		return
+	}
+
+	latest := int32(-1)
+	revisionsBucket.ForEach(func(k, val []byte) error {
+		if val != nil {
+			v.problem("Revisions: key %x isn't a Revision Bucket", k)
+			return nil
+		}
+
+		id, err := bytesToInt(k)
+		if err != nil || len(k) != 4 {
+			v.problem("Revisions: Revision key %x isn't a Revision ID", k)
+			return nil
+		}
+		if id > latest {
+			latest = id
+		}
+
+		label := fmt.Sprintf("Revision(%d)", id)
+		revisionBucket := revisionsBucket.child(k)
+
+		if configBucket := revisionBucket.child([]byte("config")); configBucket == nil {
+			v.problem("%s: config Bucket is missing", label)
+		} else {
+			var t time.Time
+			if err = t.UnmarshalBinary(get(configBucket, []byte("last_modified"))); err != nil {
+				v.problem("%s: config.last_modified can't be decoded: %v", label, err)
+			}
+		}
+
+		if competitionBucket := revisionBucket.child([]byte("competition")); competitionBucket == nil {
+			v.problem("%s: competition Bucket is missing", label)
+		} else {
+			v.verifyCompetition(label+" Competition", competitionBucket)
+		}
+
+		return nil
+	})
+
+	current := int32(-1)
+	if configBucket := txBucket(tx, []byte("config")); configBucket != nil {
+		if buf := get(configBucket, []byte("current_revision")); buf != nil {
+			var err error
+			if current, err = bytesToInt(buf); err != nil || len(buf) != 4 {
+				v.problem("Database: config.current_revision(%#v) can't be decoded", buf)
+				return
+			}
+		}
+	}
+
+	if current != latest {
+		v.problem("Database: config.current_revision is %d but the latest Revision is %d", current, latest)
+	}
+}
+
+//readCount decodes the count stored at key in the config bucket b
+func (v *verification) readCount(label string, b *bucket, key string) (int32, bool) {
+	buf := get(b, []byte(key))
+	n, err := bytesToInt(buf)
+	if err != nil || len(buf) != 4 || n < 0 {
+		v.problem("%s: config.%s(%#v) isn't a valid count", label, key, buf)
+		return 0, false
+	}
+	return n, true
+}
+
+//verifyOrder checks that the order bucket b holds exactly n IDs keyed 0 through n-1 and returns them
+func (v *verification) verifyOrder(label, name string, b *bucket, n int32) []string {
+	ids := make([]string, 0, n)
+	seen := make(map[string]bool)
+	for i := int32(0); i < n; i++ {
+		id := get(b, intToBytes(i))
+		if len(id) == 0 {
+			v.problem("%s: %s is missing entry %d", label, name, i)
+			continue
+		}
+		if seen[string(id)] {
+			v.problem("%s: %s has duplicate ID(%s)", label, name, id)
+		}
+		seen[string(id)] = true
+		ids = append(ids, string(id))
+	}
+
+	if count := countKeys(b); count != int(n) {
+		v.problem("%s: %s has %d entries but the count is %d", label, name, count, n)
+	}
+
+	return ids
+}
+
+//verifyCompetition checks the competition stored in b
+func (v *verification) verifyCompetition(label string, b *bucket) {
+	if len(get(b, []byte("name"))) == 0 {
+		v.problem("%s: name is empty", label)
+	}
+
+	buckets := make([]*bucket, 3)
+	for i, name := range []string{"config", "rounds", "teams"} {
+		if buckets[i] = b.child([]byte(name)); buckets[i] == nil {
+			v.problem("%s: %s Bucket is missing", label, name)
+			return
+		}
+	}
+	configBucket, roundsBucket, teamsBucket := buckets[0], buckets[1], buckets[2]
+
+	rounds, ok := v.readCount(label, configBucket, "rounds")
+	teams, tok := v.readCount(label, configBucket, "teams")
+	if !ok || !tok {
+		return
+	}
+
+	roundOrderBucket := b.child([]byte("round_order"))
+	teamOrderBucket := b.child([]byte("team_order"))
+	if roundOrderBucket == nil || teamOrderBucket == nil {
+		//legacy layouts are keyed by index, and are checked by reading them
+		if _, err := readCompetition(b); err != nil {
+			v.problem("%s: legacy layout can't be read: %v", label, err)
+		}
+		return
+	}
+
+	roundIDs := v.verifyOrder(label, "round_order", roundOrderBucket, rounds)
+	for _, id := range roundIDs {
+		if len(get(roundsBucket, []byte(id))) == 0 {
+			v.problem("%s: Round(%s) name is missing", label, id)
+		}
+	}
+	if count := countKeys(roundsBucket); count != int(rounds) {
+		v.problem("%s: rounds Bucket has %d rounds but config.rounds is %d", label, count, rounds)
+	}
+
+	teamIDs := v.verifyOrder(label, "team_order", teamOrderBucket, teams)
+	for _, id := range teamIDs {
+		teamBucket := teamsBucket.child([]byte(id))
+		if teamBucket == nil {
+			v.problem("%s: Team(%s) Bucket is missing", label, id)
+			continue
+		}
+		v.verifyTeam(fmt.Sprintf("%s Team(%s)", label, id), id, teamBucket, roundIDs, rounds)
+	}
+
+	if count := countKeys(teamsBucket); count != int(teams) {
+		v.problem("%s: teams Bucket has %d teams but config.teams is %d", label, count, teams)
+	}
+
+	//anything the checks above missed, like computed rounds or fields that can't be decoded, fails the read
+	if _, err := readCompetition(b); err != nil {
+		v.problem("%s: can't be read: %v", label, err)
+	}
+}
+
+//verifyTeam checks that the team stored in b has the given ID and a score for each round
+func (v *verification) verifyTeam(label, id string, b *bucket, roundIDs []string, rounds int32) {
+	if len(get(b, []byte("name"))) == 0 {
+		v.problem("%s: name is empty", label)
+	}
+	if stored := string(get(b, []byte("id"))); stored != id {
+		v.problem("%s: id(%s) doesn't match its key", label, stored)
+	}
+
+	if packed := get(b, []byte("packed_scores")); packed != nil {
+		if len(packed) != int(rounds)*packedScoreSize {
+			v.problem("%s: packed_scores has %d scores but config.rounds is %d", label, len(packed)/packedScoreSize, rounds)
+			return
+		}
+		for i := 0; i < int(rounds); i++ {
+			if _, err := unpackScore(packed[i*packedScoreSize : (i+1)*packedScoreSize]); err != nil {
+				v.problem("%s: score %d can't be decoded: %v", label, i, err)
+			}
+		}
+		return
+	}
+
+	scoresBucket := b.child([]byte("scores"))
+	if scoresBucket == nil {
+		v.problem("%s: has neither packed_scores nor a scores Bucket", label)
+		return
+	}
+
+	//missing keys are unscored rounds
+	for _, round := range roundIDs {
+		if _, err := decodeScore(get(scoresBucket, []byte(round))); err != nil {
+			v.problem("%s: Round(%s) score can't be decoded: %v", label, round, err)
+		}
+	}
+}
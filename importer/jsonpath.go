@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//JSONPath returns the value at path in v, a value decoded by encoding/json.
+//path supports a subset of JSONPath: a leading $, .field member access, and [n] array indexes, e.g. $.results[0].team.name
+func JSONPath(v interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+			key := path[:end]
+			path = path[end:]
+
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Cannot access field %s of non-object", key)
+			}
+			if v, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("Field %s doesn't exist", key)
+			}
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated index")
+			}
+			idx, err := strconv.Atoi(strings.TrimSpace(path[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid index %s", path[1:end])
+			}
+			path = path[end+1:]
+
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Cannot index non-array")
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("Index %d out of range", idx)
+			}
+			v = arr[idx]
+		default:
+			return nil, fmt.Errorf("Unexpected character %q in path", path[0])
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//columnAliases are the normalized header names used by tournament software for each column.
+//Headers are normalized by lowercasing and removing spaces, underscores, and dashes
+var columnAliases = map[string][]string{
+	"match":     {"match", "matchname", "matchnum", "matchnumber", "number"},
+	"red1":      {"red1", "redteam1", "red"},
+	"red2":      {"red2", "redteam2"},
+	"red3":      {"red3", "redteam3"},
+	"blue1":     {"blue1", "blueteam1", "blue"},
+	"blue2":     {"blue2", "blueteam2"},
+	"blue3":     {"blue3", "blueteam3"},
+	"redscore":  {"redscore", "redtotal", "redpoints"},
+	"bluescore": {"bluescore", "bluetotal", "bluepoints"},
+}
+
+func normalize(header string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+//columns returns the index of each known column in header
+func columns(header []string) map[string]int {
+	cols := make(map[string]int)
+	for i, h := range header {
+		h = normalize(h)
+		for col, aliases := range columnAliases {
+			if _, ok := cols[col]; ok {
+				continue
+			}
+			for _, alias := range aliases {
+				if h == alias {
+					cols[col] = i
+				}
+			}
+		}
+	}
+	return cols
+}
+
+//MatchResults returns a Competition with the given name built from a match results CSV export,
+//such as those produced by VEX Tournament Manager or the FIRST Tech Challenge scoring system.
+//Each team's matches become its rounds in the order they appear; unplayed matches (blank scores) are skipped
+func MatchResults(name string, r io.Reader) (*db.Competition, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read header: %v", err)
+	}
+
+	cols := columns(header)
+	for _, required := range []string{"red1", "blue1", "redscore", "bluescore"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("Missing %s column", required)
+		}
+	}
+
+	var teams []string
+	scores := make(map[string][]int32)
+
+	field := func(record []string, col string) string {
+		i, ok := cols[col]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read line %d: %v", line, err)
+		}
+
+		for _, alliance := range []string{"red", "blue"} {
+			scoreStr := field(record, alliance+"score")
+			if scoreStr == "" {
+				continue
+			}
+
+			score, err := strconv.ParseInt(scoreStr, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s score on line %d: %v", alliance, line, err)
+			}
+
+			for i := 1; i <= 3; i++ {
+				team := field(record, fmt.Sprintf("%s%d", alliance, i))
+				if team == "" {
+					continue
+				}
+				if _, ok := scores[team]; !ok {
+					teams = append(teams, team)
+				}
+				scores[team] = append(scores[team], int32(score))
+			}
+		}
+	}
+
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("No match results found")
+	}
+
+	rounds := 0
+	for _, s := range scores {
+		if len(s) > rounds {
+			rounds = len(s)
+		}
+	}
+
+	c := &db.Competition{Name: name, Rounds: make([]string, rounds), Teams: make([]*db.Team, 0, len(teams))}
+	for i := range c.Rounds {
+		c.Rounds[i] = fmt.Sprintf("Match %d", i+1)
+	}
+
+	for _, team := range teams {
+		t := &db.Team{Name: team, Scores: make([]db.Score, rounds)}
+		for i := range scores[team] {
+			t.Scores[i] = db.NewScore(scores[team][i])
+		}
+		c.Teams = append(c.Teams, t)
+	}
+
+	return c, nil
+}
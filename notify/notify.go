@@ -0,0 +1,147 @@
+//Package notify sends users the email and Slack notifications they've chosen in their notification preferences
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/mail"
+)
+
+//httpClient is used to post Slack notifications
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+//Notifier watches for disputes, lead changes, and finalization and notifies the users whose preferences include them
+type Notifier struct {
+	d    db.DB
+	sub  *api.SubscribeService
+	smtp *mail.Config
+
+	state db.State
+}
+
+//New returns a new Notifier. If smtp is nil, email notifications aren't sent
+func New(d db.DB, sub *api.SubscribeService, smtp *mail.Config) *Notifier {
+	return &Notifier{d: d, sub: sub, smtp: smtp}
+}
+
+//Run sends notifications as events are published. Run never returns
+func (n *Notifier) Run() {
+	state, err := n.d.State()
+	if err != nil {
+		log.Println("Notifier unable to read competition state:", err)
+	}
+	n.state = state
+
+	for {
+		_, events := n.sub.Subscribe()
+		for e := range events {
+			n.handle(e)
+		}
+	}
+}
+
+//message returns the notification kind, subject, and body for e, or an empty kind if e isn't notified
+func (n *Notifier) message(e *api.Event, c *db.Competition) (kind, subject, body string) {
+	switch p := e.Payload.(type) {
+	case *api.DisputePayload:
+		if p.Team < 0 || p.Team >= len(c.Teams) || p.Round < 0 || p.Round >= len(c.Rounds) {
+			return "", "", ""
+		}
+		return api.NotifyDispute, c.Name + ": score disputed",
+			fmt.Sprintf("Judges entered different scores for %s in %s. The score is waiting to be arbitrated.", c.Teams[p.Team].Name, c.Rounds[p.Round])
+	case *api.Highlight:
+		if e.Type != api.EventLeadChange {
+			return "", "", ""
+		}
+		return api.NotifyLeadChange, c.Name + ": lead change",
+			fmt.Sprintf("%s takes the lead with %s points.", p.Name, c.Precision.Format(p.Total))
+	case *api.StatePayload:
+		//restores and imports also publish the state, so only a change to finalized is notified
+		previous := n.state
+		n.state = p.State
+		if p.State != db.StateFinalized || previous == db.StateFinalized {
+			return "", "", ""
+		}
+		return api.NotifyFinalized, c.Name + ": results finalized", fmt.Sprintf("The results of %s have been finalized.", c.Name)
+	}
+	return "", "", ""
+}
+
+func (n *Notifier) handle(e *api.Event) {
+	if e.Type != api.EventDispute && e.Type != api.EventLeadChange && e.Type != api.EventState {
+		return
+	}
+
+	c, err := n.d.Read()
+	if err != nil {
+		log.Println("Notifier unable to read database:", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	kind, subject, body := n.message(e, c)
+	if kind == "" {
+		return
+	}
+
+	prefs, err := api.ReadNotificationPreferences(n.d)
+	if err != nil {
+		log.Println("Notifier unable to read notification preferences:", err)
+		return
+	}
+
+	for user, p := range prefs {
+		if p.Wants(kind) {
+			//sending can be slow, so it doesn't hold up events
+			go n.send(user, p, subject, body)
+		}
+	}
+}
+
+//send delivers the notification to each of p's destinations
+func (n *Notifier) send(user string, p *api.NotificationPreferences, subject, body string) {
+	if p.Email != "" && n.smtp != nil {
+		if err := n.smtp.Send(&mail.Message{To: []string{p.Email}, Subject: subject, Body: body + "\n"}); err != nil {
+			log.Printf("Notifier unable to email %s: %v", user, err)
+		}
+	}
+
+	if p.Slack != "" {
+		if err := postSlack(p.Slack, subject+"\n"+body); err != nil {
+			log.Printf("Notifier unable to post to Slack for %s: %v", user, err)
+		}
+	}
+}
+
+//postSlack posts text to a Slack incoming webhook
+func postSlack(u, text string) error {
+	buf, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(u, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Slack returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+//Package pdf writes simple PDF documents of text, lines, and boxes using the standard Helvetica fonts.
+//
+//Coordinates are in points (1/72 inch) measured from the top left corner of the page
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//Page sizes in points
+const (
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+//Document is a PDF document
+type Document struct {
+	Width  float64
+	Height float64
+	Title  string
+	pages  []*Page
+}
+
+//Page is a page of a Document
+type Page struct {
+	height float64
+	buf    bytes.Buffer
+}
+
+//New returns a new Document with US Letter pages
+func New(title string) *Document {
+	return &Document{Width: LetterWidth, Height: LetterHeight, Title: title}
+}
+
+//AddPage adds a page to the end of the document and returns it
+func (d *Document) AddPage() *Page {
+	p := &Page{height: d.Height}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+//Pages returns the number of pages in the document
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+//encode returns s in the PDF string syntax using WinAnsiEncoding, replacing characters that can't be encoded with ?
+func encode(s string) string {
+	b := new(strings.Builder)
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || (r > 126 && r < 160) || r > 255:
+			b.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func font(bold bool) string {
+	if bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+//Text draws s with the given font size with its baseline starting at x, y
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	fmt.Fprintf(&p.buf, "BT /%s %.2f Tf %.2f %.2f Td %s Tj ET\n", font(bold), size, x, p.height-y, encode(s))
+}
+
+//TextRight draws s with the given font size with its baseline ending at x, y
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size, bold), y, size, bold, s)
+}
+
+//Line draws a line from x1, y1 to x2, y2 with the given width
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.buf, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, p.height-y1, x2, p.height-y2)
+}
+
+//Rect draws the outline of a box with its top left corner at x, y
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.buf, "%.2f w %.2f %.2f %.2f %.2f re S\n", width, x, p.height-y-h, w, h)
+}
+
+//Fill fills a box with its top left corner at x, y with the given gray level, from 0 (black) to 1 (white)
+func (p *Page) Fill(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.buf, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, p.height-y-h, w, h)
+}
+
+//Write writes the document to w
+func (d *Document) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var offset int
+	var offsets []int
+
+	write := func(format string, args ...interface{}) {
+		n, _ := fmt.Fprintf(bw, format, args...)
+		offset += n
+	}
+	object := func(body string) {
+		offsets = append(offsets, offset)
+		write("%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	write("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	//objects 1-5 are the catalog, page tree, fonts, and info; each page is followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %.2f %.2f] >>", strings.Join(kids, " "), len(d.pages), d.Width, d.Height))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title %s /Producer (competition-scorer) >>", encode(d.Title)))
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.buf.Len(), p.buf.String()))
+	}
+
+	xref := offset
+	write("xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		write("%010d 00000 n \n", o)
+	}
+	write("trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return bw.Flush()
+}
+
+//Bytes returns the encoded document
+func (d *Document) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	d.Write(buf)
+	return buf.Bytes()
+}
+
+//widths of the printable ASCII characters in thousandths of the font size, starting at space
+var (
+	helveticaWidths = []int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = []int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+//TextWidth returns the width of s in points when drawn with the given font size
+func TextWidth(s string, size float64, bold bool) float64 {
+	widths := helveticaWidths
+	if bold {
+		widths = helveticaBoldWidths
+	}
+
+	var total int
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			total += widths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+//Truncate returns s shortened with an ellipsis to fit in width points when drawn with the given font size
+func Truncate(s string, width, size float64, bold bool) string {
+	if TextWidth(s, size, bold) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && TextWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,144 @@
+//Package reports renders competition standings and delivers them to disk, S3, or email on a schedule
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/pdf"
+)
+
+//Report formats
+const (
+	FormatCSV = "csv"
+	FormatPDF = "pdf"
+)
+
+//Report is a rendered report
+type Report struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+//cell returns the text of s in a report: its value with p's decimal places if scored, NS for no-shows, or empty if unscored
+func cell(p *db.Precision, s db.Score) string {
+	switch s.State {
+	case db.ScoreScored:
+		return p.Format(s.Value)
+	case db.ScoreNoShow:
+		return "NS"
+	}
+	return ""
+}
+
+//Render returns the standings of c in the given format, generated at t
+func Render(c *db.Competition, format string, t time.Time) (*Report, error) {
+	name := fmt.Sprintf("%s-standings-%s.%s", db.Slug(c.Name), t.Format("20060102-150405"), format)
+	switch format {
+	case FormatCSV:
+		return &Report{Name: name, ContentType: "text/csv", Data: renderCSV(c)}, nil
+	case FormatPDF:
+		return &Report{Name: name, ContentType: "application/pdf", Data: renderPDF(c, t)}, nil
+	}
+	return nil, fmt.Errorf("Unknown report format %s; formats are %s and %s", format, FormatCSV, FormatPDF)
+}
+
+func renderCSV(c *db.Competition) []byte {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+
+	header := append([]string{"Rank", "Team"}, c.Rounds...)
+	w.Write(append(header, "Total"))
+
+	for _, s := range c.Standings() {
+		row := []string{strconv.Itoa(s.Rank), s.Name}
+		for _, score := range c.Teams[s.Team].Scores {
+			row = append(row, cell(c.Precision, score))
+		}
+		w.Write(append(row, c.Precision.Format(s.Total)))
+	}
+
+	w.Flush()
+	return buf.Bytes()
+}
+
+//PDF layout in points
+const (
+	pdfMargin   = 36
+	pdfRow      = 16
+	pdfFontSize = 9
+	pdfRank     = 36
+	pdfTotal    = 48
+	pdfMinTeam  = 120
+	pdfMaxRound = 54
+)
+
+func renderPDF(c *db.Competition, t time.Time) []byte {
+	doc := pdf.New(c.Name + " Standings")
+	width := doc.Width - 2*pdfMargin
+
+	//rounds share the space left after the rank, team, and total columns
+	roundWidth := float64(pdfMaxRound)
+	if len(c.Rounds) > 0 {
+		if w := (width - pdfRank - pdfTotal - pdfMinTeam) / float64(len(c.Rounds)); w < roundWidth {
+			roundWidth = w
+		}
+	}
+	teamWidth := width - pdfRank - pdfTotal - roundWidth*float64(len(c.Rounds))
+
+	var page *pdf.Page
+	var y float64
+
+	header := func() {
+		page = doc.AddPage()
+		page.Text(pdfMargin, pdfMargin+18, 18, true, pdf.Truncate(c.Name, width, 18, true))
+		page.Text(pdfMargin, pdfMargin+34, 10, false, "Standings as of "+t.Format("Jan 2, 2006 3:04 PM MST"))
+		page.TextRight(doc.Width-pdfMargin, pdfMargin+34, 10, false, fmt.Sprintf("Page %d", doc.Pages()))
+
+		y = pdfMargin + 48
+		page.Fill(pdfMargin, y, width, pdfRow, 0.85)
+		x := float64(pdfMargin)
+		baseline := y + pdfRow - 4
+		page.Text(x+4, baseline, pdfFontSize, true, "Rank")
+		x += pdfRank
+		page.Text(x+4, baseline, pdfFontSize, true, "Team")
+		x += teamWidth
+		for _, r := range c.Rounds {
+			page.TextRight(x+roundWidth-4, baseline, pdfFontSize, true, pdf.Truncate(r, roundWidth-8, pdfFontSize, true))
+			x += roundWidth
+		}
+		page.TextRight(x+pdfTotal-4, baseline, pdfFontSize, true, "Total")
+		y += pdfRow
+	}
+
+	header()
+	for i, s := range c.Standings() {
+		if y+pdfRow > doc.Height-pdfMargin {
+			header()
+		}
+
+		if i%2 == 1 {
+			page.Fill(pdfMargin, y, width, pdfRow, 0.95)
+		}
+
+		x := float64(pdfMargin)
+		baseline := y + pdfRow - 4
+		page.Text(x+4, baseline, pdfFontSize, false, strconv.Itoa(s.Rank))
+		x += pdfRank
+		page.Text(x+4, baseline, pdfFontSize, false, pdf.Truncate(s.Name, teamWidth-8, pdfFontSize, false))
+		x += teamWidth
+		for _, score := range c.Teams[s.Team].Scores {
+			page.TextRight(x+roundWidth-4, baseline, pdfFontSize, false, cell(c.Precision, score))
+			x += roundWidth
+		}
+		page.TextRight(x+pdfTotal-4, baseline, pdfFontSize, true, c.Precision.Format(s.Total))
+		y += pdfRow
+	}
+
+	return doc.Bytes()
+}
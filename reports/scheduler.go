@@ -0,0 +1,166 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//Schedule is when reports are generated
+type Schedule struct {
+	//Times are the times of day, in minutes after midnight local time
+	Times []int
+	//Every is the interval reports are generated at, if not zero
+	Every time.Duration
+	//Finalize generates reports when the competition is finalized
+	Finalize bool
+}
+
+//ParseSchedule returns the Schedule for a comma separated list of times of day (e.g. 18:00),
+//intervals (e.g. every 30m), and finalize
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := new(Schedule)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case item == "finalize":
+			s.Finalize = true
+		case strings.HasPrefix(item, "every "):
+			d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(item, "every ")))
+			if err != nil || d < time.Minute {
+				return nil, fmt.Errorf("Invalid interval %q: must be a duration of at least 1m", item)
+			}
+			s.Every = d
+		default:
+			t, err := time.Parse("15:04", item)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid time %q: must be HH:MM, every <duration>, or finalize", item)
+			}
+			s.Times = append(s.Times, t.Hour()*60+t.Minute())
+		}
+	}
+
+	if len(s.Times) == 0 && s.Every == 0 && !s.Finalize {
+		return nil, errors.New("Schedule is empty")
+	}
+	return s, nil
+}
+
+//next returns the next scheduled time of day after now, or the zero time if there are no times of day
+func (s *Schedule) next(now time.Time) time.Time {
+	var next time.Time
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, m := range s.Times {
+		t := midnight.Add(time.Duration(m) * time.Minute)
+		if !t.After(now) {
+			t = time.Date(now.Year(), now.Month(), now.Day()+1, m/60, m%60, 0, 0, now.Location())
+		}
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
+
+//Scheduler generates reports on a Schedule
+type Scheduler struct {
+	d        db.DB
+	sub      *api.SubscribeService
+	schedule *Schedule
+	formats  []string
+	targets  []Target
+}
+
+//NewScheduler returns a new Scheduler sending reports in the given formats to targets
+func NewScheduler(d db.DB, sub *api.SubscribeService, schedule *Schedule, formats []string, targets []Target) (*Scheduler, error) {
+	for _, f := range formats {
+		if f != FormatCSV && f != FormatPDF {
+			return nil, fmt.Errorf("Unknown report format %s; formats are %s and %s", f, FormatCSV, FormatPDF)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("No report formats given")
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("No report targets given")
+	}
+	return &Scheduler{d: d, sub: sub, schedule: schedule, formats: formats, targets: targets}, nil
+}
+
+//Generate renders the reports and sends them to every target, logging errors
+func (s *Scheduler) Generate() {
+	c, err := s.d.Read()
+	if err != nil {
+		log.Println("Reports: Unable to read database:", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	var reports []*Report
+	for _, f := range s.formats {
+		r, err := Render(c, f, now)
+		if err != nil {
+			log.Println("Reports:", err)
+			return
+		}
+		reports = append(reports, r)
+	}
+
+	for _, t := range s.targets {
+		if err = t.Send(c, reports); err != nil {
+			log.Printf("Reports: Unable to send reports to %s: %v", t, err)
+			continue
+		}
+		log.Printf("Reports: Sent %d reports to %s", len(reports), t)
+	}
+}
+
+//Run generates reports on the schedule. Run never returns
+func (s *Scheduler) Run() {
+	var every <-chan time.Time
+	if s.schedule.Every > 0 {
+		ticker := time.NewTicker(s.schedule.Every)
+		defer ticker.Stop()
+		every = ticker.C
+	}
+
+	var daily <-chan time.Time
+	resetDaily := func() {
+		if next := s.schedule.next(time.Now()); !next.IsZero() {
+			daily = time.After(time.Until(next))
+		}
+	}
+	resetDaily()
+
+	var events <-chan *api.Event
+	if s.schedule.Finalize {
+		_, events = s.sub.Subscribe()
+	}
+
+	for {
+		select {
+		case <-every:
+			s.Generate()
+		case <-daily:
+			s.Generate()
+			resetDaily()
+		case e, ok := <-events:
+			if !ok {
+				_, events = s.sub.Subscribe()
+				continue
+			}
+			if p, isState := e.Payload.(*api.StatePayload); e.Type == api.EventState && isState && p.State == db.StateFinalized {
+				s.Generate()
+			}
+		}
+	}
+}
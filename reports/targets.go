@@ -0,0 +1,121 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/mail"
+	"github.com/korylprince/competition-scorer/s3"
+)
+
+//Target delivers reports
+type Target interface {
+	Send(c *db.Competition, reports []*Report) error
+	String() string
+}
+
+//ParseTarget returns the Target for the given URL:
+//
+//	file:///path/to/dir                          write reports to a directory
+//	s3://access:secret@host/bucket/prefix        upload reports to S3 (see package s3)
+//	mailto:a@example.com,b@example.com           email reports as attachments (requires smtp)
+func ParseTarget(rawurl string, smtp *mail.Config) (Target, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid report target %s: %v", rawurl, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir := u.Path
+		if u.Opaque != "" {
+			dir = u.Opaque
+		}
+		if dir == "" {
+			return nil, errors.New("Invalid file report target: path is required")
+		}
+		return dirTarget(dir), nil
+	case "s3":
+		c, err := s3.Parse(rawurl)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid s3 report target: %v", err)
+		}
+		return &s3Target{c}, nil
+	case "mailto":
+		if smtp == nil {
+			return nil, errors.New("Invalid mailto report target: an SMTP server isn't configured")
+		}
+		to := strings.Split(u.Opaque, ",")
+		if u.Opaque == "" {
+			return nil, errors.New("Invalid mailto report target: an address is required")
+		}
+		return &mailTarget{config: smtp, to: to}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown report target scheme %q; schemes are file, s3, and mailto", u.Scheme)
+}
+
+//dirTarget writes reports to a directory, creating it if necessary
+type dirTarget string
+
+func (t dirTarget) Send(c *db.Competition, reports []*Report) error {
+	if err := os.MkdirAll(string(t), 0750); err != nil {
+		return err
+	}
+	for _, r := range reports {
+		if err := ioutil.WriteFile(filepath.Join(string(t), r.Name), r.Data, 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t dirTarget) String() string {
+	return "file://" + string(t)
+}
+
+//s3Target uploads reports to S3
+type s3Target struct {
+	client *s3.Client
+}
+
+func (t *s3Target) Send(c *db.Competition, reports []*Report) error {
+	for _, r := range reports {
+		if err := t.client.Put(r.Name, r.ContentType, r.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *s3Target) String() string {
+	return t.client.String()
+}
+
+//mailTarget emails reports as attachments of a single message
+type mailTarget struct {
+	config *mail.Config
+	to     []string
+}
+
+func (t *mailTarget) Send(c *db.Competition, reports []*Report) error {
+	m := &mail.Message{
+		To:      t.to,
+		Subject: c.Name + " standings",
+		Body:    fmt.Sprintf("The current standings of %s are attached.\n", c.Name),
+	}
+	for _, r := range reports {
+		m.Attachments = append(m.Attachments, &mail.Attachment{Name: r.Name, ContentType: r.ContentType, Data: r.Data})
+	}
+	return t.config.Send(m)
+}
+
+func (t *mailTarget) String() string {
+	return "mailto:" + strings.Join(t.to, ",")
+}
@@ -0,0 +1,394 @@
+//Package rules parses and evaluates score validation rules.
+//
+//A rule is an expression over integer variables that must evaluate to true, e.g.
+//
+//	score % 5 == 0 && score <= 150
+//
+//Expressions support integer literals, variables, parentheses, the arithmetic operators + - * / %,
+//the comparison operators == != < <= > >=, and the logical operators && || !
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//MaxLength is the longest rule that can be parsed
+const MaxLength = 1024
+
+//Rule is a parsed validation rule
+type Rule struct {
+	src  string
+	root node
+}
+
+//String returns the rule's source
+func (r *Rule) String() string {
+	return r.src
+}
+
+//Parse parses src, which may only reference the given variables, or returns an error if it isn't valid
+func Parse(src string, vars ...string) (*Rule, error) {
+	if len(src) > MaxLength {
+		return nil, fmt.Errorf("rule is longer than %d characters", MaxLength)
+	}
+
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		allowed[v] = true
+	}
+
+	p := &parser{toks: toks, vars: allowed}
+	root, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("rule must be a comparison, not a number")
+	}
+
+	return &Rule{src: src, root: root}, nil
+}
+
+//Check returns whether or not the rule is true for the given variable values,
+//or an error if it can't be evaluated, e.g. dividing by zero or a missing variable
+func (r *Rule) Check(vars map[string]int64) (bool, error) {
+	v, err := r.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return v.b, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of rule"
+	}
+	return strconv.Quote(t.text)
+}
+
+//operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!"}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[i:j], pos: i})
+			i = j
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i
+			for j < len(src) && (src[j] == '_' || (src[j] >= 'a' && src[j] <= 'z') || (src[j] >= 'A' && src[j] <= 'Z') || (src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		default:
+			var op string
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+//precedence of binary operators; higher binds tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+type parser struct {
+	toks []token
+	i    int
+	vars map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+//parse parses a binary expression whose operators have at least the given precedence
+func (p *parser) parse(min int) (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec <= min {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parse(prec)
+		if err != nil {
+			return nil, err
+		}
+
+		b := &binary{op: t.text, left: left, right: right}
+		if err = b.check(t.pos); err != nil {
+			return nil, err
+		}
+		left = b
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		i, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("number %s at %d is too large", t.text, t.pos)
+		}
+		return literal(i), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return boolean(true), nil
+		case "false":
+			return boolean(false), nil
+		}
+		if !p.vars[t.text] {
+			return nil, fmt.Errorf("unknown variable %s at %d", t.text, t.pos)
+		}
+		return variable(t.text), nil
+	case tokLParen:
+		n, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, fmt.Errorf("expected \")\" at %d, found %s", c.pos, c)
+		}
+		return n, nil
+	case tokOp:
+		if t.text == "!" || t.text == "-" {
+			operand, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			u := &unaryOp{op: t.text, operand: operand}
+			if (t.text == "!") != (operand.typ() == typeBool) {
+				return nil, fmt.Errorf("invalid operand for %s at %d", t.text, t.pos)
+			}
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+type valueType int
+
+const (
+	typeInt valueType = iota
+	typeBool
+)
+
+type value struct {
+	i int64
+	b bool
+}
+
+type node interface {
+	typ() valueType
+	eval(vars map[string]int64) (value, error)
+}
+
+type literal int64
+
+func (l literal) typ() valueType { return typeInt }
+
+func (l literal) eval(map[string]int64) (value, error) { return value{i: int64(l)}, nil }
+
+type boolean bool
+
+func (b boolean) typ() valueType { return typeBool }
+
+func (b boolean) eval(map[string]int64) (value, error) { return value{b: bool(b)}, nil }
+
+type variable string
+
+func (v variable) typ() valueType { return typeInt }
+
+func (v variable) eval(vars map[string]int64) (value, error) {
+	i, ok := vars[string(v)]
+	if !ok {
+		return value{}, fmt.Errorf("%s isn't set", string(v))
+	}
+	return value{i: i}, nil
+}
+
+type unaryOp struct {
+	op      string
+	operand node
+}
+
+func (u *unaryOp) typ() valueType {
+	if u.op == "!" {
+		return typeBool
+	}
+	return typeInt
+}
+
+func (u *unaryOp) eval(vars map[string]int64) (value, error) {
+	v, err := u.operand.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+	if u.op == "!" {
+		return value{b: !v.b}, nil
+	}
+	return value{i: -v.i}, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+//check returns an error if the operands have the wrong types for the operator at pos
+func (b *binary) check(pos int) error {
+	l, r := b.left.typ(), b.right.typ()
+	switch b.op {
+	case "&&", "||":
+		if l == typeBool && r == typeBool {
+			return nil
+		}
+	case "==", "!=":
+		if l == r {
+			return nil
+		}
+	default:
+		if l == typeInt && r == typeInt {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid operands for %s at %d", b.op, pos)
+}
+
+func (b *binary) typ() valueType {
+	switch b.op {
+	case "+", "-", "*", "/", "%":
+		return typeInt
+	}
+	return typeBool
+}
+
+func (b *binary) eval(vars map[string]int64) (value, error) {
+	l, err := b.left.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+
+	//short circuit logical operators
+	switch {
+	case b.op == "&&" && !l.b:
+		return value{b: false}, nil
+	case b.op == "||" && l.b:
+		return value{b: true}, nil
+	}
+
+	r, err := b.right.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch b.op {
+	case "&&", "||":
+		return value{b: r.b}, nil
+	case "==":
+		return value{b: l == r}, nil
+	case "!=":
+		return value{b: l != r}, nil
+	case "<":
+		return value{b: l.i < r.i}, nil
+	case "<=":
+		return value{b: l.i <= r.i}, nil
+	case ">":
+		return value{b: l.i > r.i}, nil
+	case ">=":
+		return value{b: l.i >= r.i}, nil
+	case "+":
+		return value{i: l.i + r.i}, nil
+	case "-":
+		return value{i: l.i - r.i}, nil
+	case "*":
+		return value{i: l.i * r.i}, nil
+	case "/", "%":
+		if r.i == 0 {
+			return value{}, fmt.Errorf("division by zero")
+		}
+		if b.op == "/" {
+			return value{i: l.i / r.i}, nil
+		}
+		return value{i: l.i % r.i}, nil
+	}
+	return value{}, fmt.Errorf("unknown operator %s", b.op)
+}
@@ -0,0 +1,184 @@
+//Package s3 uploads objects to Amazon S3 or an S3-compatible service (e.g. MinIO) using Signature Version 4
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+//Client writes objects under a prefix in a bucket. Buckets are addressed path-style so any endpoint works
+type Client struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+
+	client *http.Client
+}
+
+//Parse returns the Client for s3://access:secret@host[:port]/bucket[/prefix]?region=us-east-1.
+//The insecure query parameter connects to the endpoint with HTTP instead of HTTPS
+func Parse(rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "s3" {
+		return nil, errors.New("scheme must be s3")
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("host is required")
+	}
+
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.New("bucket is required")
+	}
+
+	scheme := "https"
+	if _, ok := u.Query()["insecure"]; ok {
+		scheme = "http"
+	}
+
+	c := &Client{
+		Endpoint: scheme + "://" + u.Host,
+		Region:   u.Query().Get("region"),
+		Bucket:   parts[0],
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+	if len(parts) == 2 {
+		c.Prefix = parts[1]
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if u.User != nil {
+		c.AccessKey = u.User.Username()
+		c.SecretKey, _ = u.User.Password()
+	}
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return nil, errors.New("access key and secret key are required")
+	}
+
+	return c, nil
+}
+
+//String returns the location of the client's objects without credentials
+func (c *Client) String() string {
+	return fmt.Sprintf("%s/%s", c.Endpoint, path.Join(c.Bucket, c.Prefix))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//escapePath escapes each segment of an object path as required by Signature Version 4
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+//do sends a signed request for the object with the given key (relative to the prefix) and returns the response
+func (c *Client) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	objectPath := "/" + c.Bucket
+	if k := path.Join(c.Prefix, key); k != "" && k != "." {
+		objectPath += "/" + k
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = objectPath
+	u.RawPath = escapePath(objectPath)
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", u.Host, payloadHash, stamp)
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		signed = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+		canonicalHeaders = fmt.Sprintf("content-type:%s\n", ct) + canonicalHeaders
+	}
+
+	canonical := strings.Join([]string{method, u.RawPath, u.RawQuery, canonicalHeaders, strings.Join(signed, ";"), payloadHash}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, c.Region)
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key4 := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key4 = hmacSHA256(key4, c.Region)
+	key4 = hmacSHA256(key4, "s3")
+	key4 = hmacSHA256(key4, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key4, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, strings.Join(signed, ";"), signature))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, objectPath, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+//Put writes an object with the given key (relative to the prefix), returning an error if one occurred
+func (c *Client) Put(key, contentType string, body []byte) error {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.do(http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
@@ -0,0 +1,165 @@
+package scoreboard
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//DefaultTemplate is the protocol template used if none is configured.
+//It writes each selected team's total as a zero-padded 4 digit number, framed by STX and ETX
+const DefaultTemplate = `{{byte 2}}{{range .Teams}}{{printf "%04d" .Total}}{{end}}{{byte 3}}`
+
+//Data is passed to protocol templates.
+//Teams contains the Standings of the selected teams in the configured order
+type Data struct {
+	Competition *db.Competition
+	Standings   []*db.Standing
+	Teams       []*db.Standing
+}
+
+var funcs = template.FuncMap{
+	//byte writes a raw byte, e.g. {{byte 2}} for STX
+	"byte": func(b int) string { return string([]byte{byte(b)}) },
+	//pad left pads s with spaces to n characters, truncating if s is longer
+	"pad": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return strings.Repeat(" ", n-len(s)) + s
+	},
+	//trunc truncates s to n characters
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+}
+
+//Driver mirrors selected team scores to a hardware scoreboard
+type Driver struct {
+	d      db.DB
+	sub    *api.SubscribeService
+	target string
+	teams  []int
+	tmpl   *template.Template
+	w      io.WriteCloser
+}
+
+//New returns a new Driver writing to target using the given protocol template.
+//target is a device path (e.g. /dev/ttyUSB0, configured with stty beforehand) or tcp://host:port for serial servers.
+//teams are the indexes of the teams to mirror; if empty the teams are mirrored in standings order
+func New(d db.DB, sub *api.SubscribeService, target, protocol string, teams []int) (*Driver, error) {
+	if protocol == "" {
+		protocol = DefaultTemplate
+	}
+
+	tmpl, err := template.New("protocol").Funcs(funcs).Parse(protocol)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse protocol template: %v", err)
+	}
+
+	return &Driver{d: d, sub: sub, target: target, teams: teams, tmpl: tmpl}, nil
+}
+
+func (dr *Driver) open() (io.WriteCloser, error) {
+	if strings.HasPrefix(dr.target, "tcp://") {
+		return net.DialTimeout("tcp", strings.TrimPrefix(dr.target, "tcp://"), 10*time.Second)
+	}
+	return os.OpenFile(dr.target, os.O_WRONLY, 0)
+}
+
+//render executes the protocol template for the current competition
+func (dr *Driver) render() ([]byte, error) {
+	c, err := dr.d.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read database: %v", err)
+	}
+	if c == nil {
+		return nil, nil
+	}
+
+	data := &Data{Competition: c, Standings: c.Standings()}
+	if len(dr.teams) == 0 {
+		data.Teams = data.Standings
+	} else {
+		byTeam := make(map[int]*db.Standing)
+		for _, s := range data.Standings {
+			byTeam[s.Team] = s
+		}
+		for _, t := range dr.teams {
+			if s, ok := byTeam[t]; ok {
+				data.Teams = append(data.Teams, s)
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err = dr.tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("Unable to execute protocol template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+//update writes the current scores to the scoreboard, reopening the target if necessary
+func (dr *Driver) update() {
+	buf, err := dr.render()
+	if err != nil {
+		log.Println("Scoreboard:", err)
+		return
+	}
+	if buf == nil {
+		return
+	}
+
+	if dr.w == nil {
+		if dr.w, err = dr.open(); err != nil {
+			log.Printf("Scoreboard: Unable to open %s: %v", dr.target, err)
+			dr.w = nil
+			return
+		}
+	}
+
+	if _, err = dr.w.Write(buf); err != nil {
+		log.Printf("Scoreboard: Unable to write to %s: %v", dr.target, err)
+		dr.w.Close()
+		dr.w = nil
+	}
+}
+
+//Run writes the scores to the scoreboard on start and after every update. Run never returns
+func (dr *Driver) Run() {
+	dr.update()
+
+	//resend periodically so scoreboards that were power cycled or reconnected catch up
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		_, events := dr.sub.Subscribe()
+	loop:
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					break loop
+				}
+				if e.Type == api.EventUpdate {
+					dr.update()
+				}
+			case <-ticker.C:
+				dr.update()
+			}
+		}
+	}
+}
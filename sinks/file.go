@@ -0,0 +1,54 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+)
+
+//fileSink appends records to a file as JSON lines
+type fileSink struct {
+	path string
+}
+
+//newFileSink returns a sink for file:///absolute/path or file:relative/path
+func newFileSink(u *url.URL) (Sink, error) {
+	path := u.Path
+	if u.Opaque != "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Write(records []*Record) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,52 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//kafkaSink produces records to a Kafka topic through a Kafka REST Proxy (v2 API).
+//Each record is keyed by its event type so events of the same type stay in order within a partition
+type kafkaSink struct {
+	url string
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value *Record `json:"value"`
+}
+
+type kafkaRequest struct {
+	Records []*kafkaRecord `json:"records"`
+}
+
+//newKafkaSink returns a sink for kafka://host:port/topic (or kafkas:// for HTTPS), where host:port is the REST Proxy
+func newKafkaSink(u *url.URL) (Sink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" || strings.Contains(topic, "/") {
+		return nil, fmt.Errorf("URL must be %s://host:port/topic", u.Scheme)
+	}
+
+	scheme := "http"
+	if u.Scheme == "kafkas" {
+		scheme = "https"
+	}
+
+	proxy := &url.URL{Scheme: scheme, User: u.User, Host: u.Host, Path: "/topics/" + topic}
+	return &kafkaSink{url: proxy.String()}, nil
+}
+
+func (s *kafkaSink) Write(records []*Record) error {
+	req := &kafkaRequest{Records: make([]*kafkaRecord, len(records))}
+	for i, r := range records {
+		req.Records[i] = &kafkaRecord{Key: r.Type, Value: r}
+	}
+
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return post(s.url, "application/vnd.kafka.json.v2+json", buf)
+}
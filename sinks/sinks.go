@@ -0,0 +1,237 @@
+//Package sinks streams competition events to external systems so every change can be archived as it happens.
+//
+//Sinks are configured by URL:
+//
+//	file:///var/log/scorer/events.jsonl        append JSON lines to a file
+//	https://example.com/events                POST batches as a JSON array
+//	kafka://rest-proxy:8082/scores            produce to a topic through a Kafka REST Proxy (kafkas:// for HTTPS)
+//
+//Other sinks can be added with Register
+package sinks
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+)
+
+//Record is an event as sent to a sink
+type Record struct {
+	Time time.Time `json:"time"`
+	*api.Event
+}
+
+//Sink writes batches of records to an external system
+type Sink interface {
+	//Write writes records, returning an error if they weren't all written. Failed batches are retried
+	Write(records []*Record) error
+}
+
+//Factory returns a Sink for the given URL, or an error if the URL isn't valid
+type Factory func(u *url.URL) (Sink, error)
+
+var (
+	factories = map[string]Factory{
+		"file":   newFileSink,
+		"http":   newWebhookSink,
+		"https":  newWebhookSink,
+		"kafka":  newKafkaSink,
+		"kafkas": newKafkaSink,
+	}
+	factoriesMu sync.RWMutex
+)
+
+//Register makes a Sink available to New by URL scheme.
+//It should be called from an init function, and panics if scheme is already registered
+func Register(scheme string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[scheme]; ok {
+		panic(fmt.Sprintf("Sink %s is already registered", scheme))
+	}
+	factories[scheme] = f
+}
+
+//Schemes returns the registered URL schemes
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	schemes := make([]string, 0, len(factories))
+	for s := range factories {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+//New returns the Sink for the given URL, or an error if one occurred
+func New(rawurl string) (Sink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sink URL %s: %v", rawurl, err)
+	}
+
+	factoriesMu.RLock()
+	f, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown sink scheme %q; schemes are %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	s, err := f(u)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s sink: %v", u.Scheme, err)
+	}
+	return s, nil
+}
+
+//Redact returns rawurl with any password removed, for logging
+func Redact(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+//Options configure a Forwarder
+type Options struct {
+	//BatchSize is the most records written at once
+	BatchSize int
+	//Interval is how long records are collected before they're written if a batch isn't full
+	Interval time.Duration
+	//QueueSize is the most records held while a sink is failing. The oldest records are dropped when it's full
+	QueueSize int
+}
+
+//DefaultOptions are the Options used for zero values
+var DefaultOptions = Options{BatchSize: 100, Interval: time.Second, QueueSize: 10000}
+
+//Forwarder streams published events to a Sink
+type Forwarder struct {
+	name string
+	sub  *api.SubscribeService
+	sink Sink
+	opts Options
+
+	mu      *sync.Mutex
+	queue   []*Record
+	dropped uint64
+	ready   chan struct{}
+}
+
+//NewForwarder returns a new Forwarder writing events published to sub to sink. name identifies the sink in logs
+func NewForwarder(name string, sub *api.SubscribeService, sink Sink, opts Options) *Forwarder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultOptions.BatchSize
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultOptions.Interval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultOptions.QueueSize
+	}
+	return &Forwarder{name: name, sub: sub, sink: sink, opts: opts, mu: new(sync.Mutex), ready: make(chan struct{}, 1)}
+}
+
+//forwarded returns whether or not events of type t are sent to sinks. Timer ticks aren't changes, so they're skipped
+func forwarded(t string) bool {
+	return t != api.EventTimerTick
+}
+
+//enqueue adds r to the queue, dropping the oldest record if it's full
+func (f *Forwarder) enqueue(r *Record) {
+	f.mu.Lock()
+	if len(f.queue) >= f.opts.QueueSize {
+		log.Printf("Event sink %s: queue full; dropping event %d", f.name, f.queue[0].Seq)
+		f.queue = f.queue[1:]
+		f.dropped++
+	}
+	f.queue = append(f.queue, r)
+	full := len(f.queue) >= f.opts.BatchSize
+	f.mu.Unlock()
+
+	if full {
+		select {
+		case f.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//receive queues published events. Events are read as soon as they're published so the subscription isn't dropped while the sink is slow
+func (f *Forwarder) receive() {
+	for {
+		_, events := f.sub.Subscribe()
+		for e := range events {
+			if forwarded(e.Type) {
+				f.enqueue(&Record{Time: time.Now(), Event: e})
+			}
+		}
+		log.Printf("Event sink %s: subscription dropped; events may have been missed", f.name)
+	}
+}
+
+//flush writes queued records in batches until the queue is empty or the sink fails
+func (f *Forwarder) flush() error {
+	for {
+		f.mu.Lock()
+		n := len(f.queue)
+		if n > f.opts.BatchSize {
+			n = f.opts.BatchSize
+		}
+		batch := f.queue[:n:n]
+		dropped := f.dropped
+		f.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		if err := f.sink.Write(batch); err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		//records of the batch may have been dropped from the front while writing
+		if n -= int(f.dropped - dropped); n > 0 {
+			f.queue = f.queue[n:]
+		}
+		f.mu.Unlock()
+	}
+}
+
+//Run forwards events to the sink, retrying with backoff while it fails. Run never returns
+func (f *Forwarder) Run() {
+	go f.receive()
+
+	ticker := time.NewTicker(f.opts.Interval)
+	defer ticker.Stop()
+
+	backoff := f.opts.Interval
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.ready:
+		}
+
+		if err := f.flush(); err != nil {
+			log.Printf("Event sink %s: Unable to write events: %v; retrying in %s", f.name, err, backoff)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+			continue
+		}
+		backoff = f.opts.Interval
+	}
+}
@@ -0,0 +1,50 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//httpClient is used by sinks that post to HTTP endpoints
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+//post sends body to u with the given content type, returning an error if the response isn't a 2xx status
+func post(u, contentType string, body []byte) error {
+	resp, err := httpClient.Post(u, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	return nil
+}
+
+//webhookSink posts each batch of records to a URL as a JSON array
+type webhookSink struct {
+	url string
+}
+
+func newWebhookSink(u *url.URL) (Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	return &webhookSink{url: u.String()}, nil
+}
+
+func (s *webhookSink) Write(records []*Record) error {
+	buf, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return post(s.url, "application/json", buf)
+}
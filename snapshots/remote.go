@@ -0,0 +1,149 @@
+package snapshots
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+	"github.com/korylprince/competition-scorer/s3"
+)
+
+//writeEvents are the Event types published after the competition is written
+var writeEvents = map[string]bool{
+	api.EventUpdate:       true,
+	api.EventScoreUpdate:  true,
+	api.EventTeamAdded:    true,
+	api.EventRoundRenamed: true,
+}
+
+//Remote uploads snapshots of a database to an S3-compatible bucket, so a copy survives the loss of the machine running the server.
+//Snapshots are named like those written by Snapshotter. Old snapshots aren't removed; use the bucket's lifecycle rules to expire them
+type Remote struct {
+	d      db.DB
+	client *s3.Client
+	sub    *api.SubscribeService
+	every  time.Duration
+	writes int32
+
+	//version is the competition version when the last snapshot was uploaded
+	version int32
+}
+
+//NewRemote returns a new Remote uploading a snapshot of d with client every interval (0 to disable) and after every writes writes
+//of the competition (0 to disable), which are counted from the events published by sub
+func NewRemote(d db.DB, client *s3.Client, sub *api.SubscribeService, every time.Duration, writes int) (*Remote, error) {
+	if every != 0 && every < time.Minute {
+		return nil, errors.New("Interval must be at least 1m")
+	}
+	if writes < 0 {
+		return nil, errors.New("Number of writes can't be negative")
+	}
+	if every == 0 && writes == 0 {
+		return nil, errors.New("An interval or a number of writes is required")
+	}
+
+	r := &Remote{d: d, client: client, sub: sub, every: every, writes: int32(writes)}
+	version, err := r.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+	r.version = version
+	return r, nil
+}
+
+//currentVersion returns the version of the competition, or 0 if there isn't one
+func (r *Remote) currentVersion() (int32, error) {
+	c, err := r.d.Read()
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read database: %v", err)
+	}
+	if c == nil {
+		return 0, nil
+	}
+	return c.Version, nil
+}
+
+//Push uploads a new snapshot and returns its key. The snapshot is written to memory first, so a partial snapshot is never uploaded
+func (r *Remote) Push() (string, error) {
+	version, err := r.currentVersion()
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err = write(r.d, buf); err != nil {
+		return "", fmt.Errorf("Unable to write snapshot: %v", err)
+	}
+
+	contentType := "application/octet-stream"
+	if ext(r.d) == ".json" {
+		contentType = "application/json"
+	}
+
+	key := name(r.d, time.Now())
+	if err = r.client.Put(key, contentType, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("Unable to upload snapshot: %v", err)
+	}
+
+	r.version = version
+	return key, nil
+}
+
+//due returns whether the competition has been written at least writes times since the last upload
+func (r *Remote) due() bool {
+	version, err := r.currentVersion()
+	if err != nil {
+		log.Println("Remote snapshots:", err)
+		return false
+	}
+
+	//a restored or replaced competition can have an older version
+	if version < r.version {
+		r.version = version
+	}
+	return version-r.version >= r.writes
+}
+
+func (r *Remote) push() {
+	key, err := r.Push()
+	if err != nil {
+		log.Println("Remote snapshots:", err)
+		return
+	}
+	log.Printf("Remote snapshots: Uploaded %s to %s", key, r.client)
+}
+
+//Run uploads a snapshot every interval and after every writes writes, logging errors. Run never returns
+func (r *Remote) Run() {
+	var every <-chan time.Time
+	if r.every > 0 {
+		ticker := time.NewTicker(r.every)
+		defer ticker.Stop()
+		every = ticker.C
+	}
+
+	var events <-chan *api.Event
+	if r.writes > 0 {
+		_, events = r.sub.Subscribe()
+	}
+
+	for {
+		select {
+		case <-every:
+			r.push()
+		case e, ok := <-events:
+			if !ok {
+				//the subscriber was dropped while uploading; writes are counted by version, so none are missed
+				_, events = r.sub.Subscribe()
+				continue
+			}
+			if writeEvents[e.Type] && r.due() {
+				r.push()
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+//Package snapshots copies the database to a directory on an interval, keeping the most recent copies as wall-clock recovery points.
+//Revisions only capture writes; snapshots are taken whether or not the competition changed
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//prefix starts the name of every snapshot file, so other files in the directory are never rotated
+const prefix = "snapshot-"
+
+//Snapshotter takes snapshots of a database. Databases that implement db.Storage are copied as database files that can be restored
+//with the restore command; others are written as JSON exports that can be loaded with the import command
+type Snapshotter struct {
+	d     db.DB
+	dir   string
+	every time.Duration
+	keep  int
+}
+
+//New returns a new Snapshotter writing a snapshot of d to dir every interval and keeping the newest keep snapshots (0 keeps all)
+func New(d db.DB, dir string, every time.Duration, keep int) (*Snapshotter, error) {
+	if every < time.Minute {
+		return nil, errors.New("Interval must be at least 1m")
+	}
+	if keep < 0 {
+		return nil, errors.New("Number of snapshots kept can't be negative")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create directory %s: %v", dir, err)
+	}
+	return &Snapshotter{d: d, dir: dir, every: every, keep: keep}, nil
+}
+
+//ext returns the file extension of snapshots of d
+func ext(d db.DB) string {
+	if _, ok := d.(db.Storage); ok {
+		return ".db"
+	}
+	return ".json"
+}
+
+//write writes a snapshot of d to w
+func write(d db.DB, w io.Writer) error {
+	if storage, ok := d.(db.Storage); ok {
+		return storage.Backup(w)
+	}
+	return db.Export(d, w)
+}
+
+//name returns the name of a snapshot of d taken at t
+func name(d db.DB, t time.Time) string {
+	return prefix + t.UTC().Format("20060102T150405Z") + ext(d)
+}
+
+//Snapshot writes a new snapshot, then removes the oldest snapshots beyond the number kept. It returns the path of the new snapshot.
+//The snapshot is written to a temporary file first, so a partial snapshot never replaces a complete one
+func (s *Snapshotter) Snapshot() (string, error) {
+	f, err := ioutil.TempFile(s.dir, ".snapshot-")
+	if err != nil {
+		return "", fmt.Errorf("Unable to create temporary file: %v", err)
+	}
+	tmp := f.Name()
+
+	err = write(s.d, f)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("Unable to write snapshot: %v", err)
+	}
+
+	path := filepath.Join(s.dir, name(s.d, time.Now()))
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("Unable to rename snapshot: %v", err)
+	}
+
+	return path, s.rotate()
+}
+
+//Snapshots returns the paths of the snapshots in the directory, oldest first
+func (s *Snapshotter) Snapshots() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ext(s.d)) {
+			paths = append(paths, filepath.Join(s.dir, e.Name()))
+		}
+	}
+
+	//names are UTC timestamps, so they sort by age
+	sort.Strings(paths)
+	return paths, nil
+}
+
+//rotate removes the oldest snapshots beyond the number kept
+func (s *Snapshotter) rotate() error {
+	if s.keep == 0 {
+		return nil
+	}
+
+	paths, err := s.Snapshots()
+	if err != nil {
+		return fmt.Errorf("Unable to list snapshots: %v", err)
+	}
+
+	for len(paths) > s.keep {
+		if err = os.Remove(paths[0]); err != nil {
+			return fmt.Errorf("Unable to remove snapshot: %v", err)
+		}
+		paths = paths[1:]
+	}
+
+	return nil
+}
+
+//Run takes a snapshot every interval, logging errors. Run never returns
+func (s *Snapshotter) Run() {
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		path, err := s.Snapshot()
+		if err != nil {
+			log.Println("Snapshots:", err)
+			continue
+		}
+		log.Println("Snapshots: Wrote", path)
+	}
+}
@@ -0,0 +1,75 @@
+package widget
+
+import (
+	"html/template"
+	texttemplate "text/template"
+)
+
+var pageTmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} Standings</title>
+<style>
+html, body { margin: 0; padding: 0; }
+body {
+	width: {{.Width}}px; height: {{.Height}}px; overflow: hidden;
+	background: {{.Theme.Background}}; color: {{.Theme.Foreground}};
+	font-family: Roboto, Helvetica, Arial, sans-serif;
+}
+h1 { margin: 0; padding: 8px; font-size: 1.2em; color: {{.Theme.Accent}}; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 8px; border-bottom: 1px solid {{.Theme.Border}}; }
+td.rank, td.total { width: 1%; white-space: nowrap; text-align: right; }
+p.maintenance { padding: 8px; font-size: 1.2em; text-align: center; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Maintenance}}<p class="maintenance">{{.Maintenance}}</p>
+{{end}}<table>
+{{range .Standings}}<tr><td class="rank">{{.Rank}}</td><td class="name">{{.Name}}</td><td class="total">{{$.Precision.Format .Total}}</td></tr>
+{{end}}</table>
+<script>
+(function() {
+	var proto = location.protocol === "https:" ? "wss://" : "ws://";
+	var timeout = null;
+	function connect() {
+		var ws = new WebSocket(proto + location.host + "{{.APIBase}}/competition/subscribe");
+		ws.onmessage = function(msg) {
+			var e = JSON.parse(msg.data);
+			if (e.type === "update" || e.type === "state" || e.type === "maintenance") {
+				clearTimeout(timeout);
+				timeout = setTimeout(function() { location.reload(); }, 500);
+			}
+		};
+		ws.onclose = function() { setTimeout(connect, 5000); };
+	}
+	connect();
+})();
+</script>
+</body>
+</html>
+`))
+
+//scriptTmpl replaces its own script tag with an iframe containing the widget.
+//Options are taken from the script's data attributes, e.g. data-width="400" data-theme="dark"
+var scriptTmpl = texttemplate.Must(texttemplate.New("script").Parse(`(function() {
+	var script = document.currentScript;
+	var src = script.src.replace(/\/widget\.js(\?.*)?$/, "");
+	var params = [];
+	["width", "height", "theme", "limit", "team"].forEach(function(name) {
+		var val = script.getAttribute("data-" + name);
+		if (val !== null) {
+			params.push(name + "=" + encodeURIComponent(val));
+		}
+	});
+	var frame = document.createElement("iframe");
+	frame.src = src + (params.length ? "?" + params.join("&") : "");
+	frame.width = script.getAttribute("data-width") || "400";
+	frame.height = script.getAttribute("data-height") || "600";
+	frame.style.border = "none";
+	frame.setAttribute("scrolling", "no");
+	script.parentNode.replaceChild(frame, script);
+})();
+`))
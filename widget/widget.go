@@ -0,0 +1,141 @@
+package widget
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/competition-scorer/api"
+	"github.com/korylprince/competition-scorer/db"
+)
+
+//themes are the color schemes available to the widget
+var themes = map[string]*theme{
+	"light": {Background: "#ffffff", Foreground: "#212121", Accent: "#1976d2", Border: "#e0e0e0"},
+	"dark":  {Background: "#212121", Foreground: "#fafafa", Accent: "#90caf9", Border: "#424242"},
+}
+
+type theme struct {
+	Background string
+	Foreground string
+	Accent     string
+	Border     string
+}
+
+type options struct {
+	Width  int
+	Height int
+	Theme  *theme
+	Limit  int
+	Team   string
+	//Tags limits the standings to teams with every tag, ranked among themselves
+	Tags []string
+}
+
+type page struct {
+	*options
+	Name        string
+	Standings   []*db.Standing
+	Precision   *db.Precision
+	APIBase     string
+	Maintenance string
+}
+
+//intParam returns the integer query parameter with the given name, clamped to [min, max], or def if it's not set or invalid
+func intParam(r *http.Request, name string, def, min, max int) int {
+	i, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+func parseOptions(r *http.Request) *options {
+	o := &options{
+		Width:  intParam(r, "width", 400, 100, 4000),
+		Height: intParam(r, "height", 600, 100, 4000),
+		Limit:  intParam(r, "limit", 0, 0, 1000),
+		Theme:  themes["light"],
+		Team:   r.URL.Query().Get("team"),
+		Tags:   db.NormalizeTags(r.URL.Query()["tag"]),
+	}
+	if t, ok := themes[r.URL.Query().Get("theme")]; ok {
+		o.Theme = t
+	}
+	return o
+}
+
+//teamStanding returns the standing of the team referenced by ref (an ID, slug, or index), or none if it doesn't exist
+func teamStanding(c *db.Competition, standings []*db.Standing, ref string) []*db.Standing {
+	team := c.FindTeam(ref)
+	for _, s := range standings {
+		if s.Team == team {
+			return []*db.Standing{s}
+		}
+	}
+	return nil
+}
+
+func getWidget(d db.DB, apiBase string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := d.Read()
+		if err != nil {
+			log.Println("Unable to read database:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		m, err := api.ReadMaintenance(d)
+		if err != nil {
+			log.Println("Unable to read maintenance mode:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		p := &page{options: parseOptions(r), APIBase: apiBase}
+		if m.Enabled {
+			p.Maintenance = m.Message
+		} else if c != nil {
+			if len(p.Tags) > 0 {
+				c = c.WithTags(p.Tags...)
+			}
+			p.Name, p.Precision = c.Name, c.Precision
+			p.Standings = c.Standings()
+			if p.Team != "" {
+				p.Standings = teamStanding(c, p.Standings, p.Team)
+			}
+			if p.Limit > 0 && len(p.Standings) > p.Limit {
+				p.Standings = p.Standings[:p.Limit]
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err = pageTmpl.Execute(w, p); err != nil {
+			log.Println("Unable to render widget:", err)
+		}
+	}
+}
+
+func getScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	if err := scriptTmpl.Execute(w, nil); err != nil {
+		log.Println("Unable to render widget script:", err)
+	}
+}
+
+//NewHandler returns an http.Handler serving the embeddable standings widget.
+//The widget is served at prefix and can be embedded with an iframe or with the script at prefix/widget.js.
+//apiBase is the path of the HTTP API the widget listens to for updates
+func NewHandler(d db.DB, prefix, apiBase string) http.Handler {
+	r := mux.NewRouter()
+	r.Path(prefix).Methods("GET").Handler(getWidget(d, apiBase))
+	r.Path(prefix + "/widget.js").Methods("GET").HandlerFunc(getScript)
+	return r
+}